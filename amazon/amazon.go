@@ -0,0 +1,149 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+// amazon sends records to Amazon Kinesis Data Firehose or Amazon SQS.
+package amazon
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"spyderbat-event-forwarder/config"
+	"spyderbat-event-forwarder/logwrapper"
+	"spyderbat-event-forwarder/sink"
+)
+
+var (
+	putTimeout     = 2 * time.Minute
+	retryBaseDelay = 500 * time.Millisecond // doubled for each partial failure retry
+)
+
+// putter delivers a batch of records, and returns the indexes of the records that failed
+// and may be retried. Records that failed and may not be retried are logged and dropped.
+type putter interface {
+	put(ctx context.Context, records [][]byte) (retry []int, err error)
+}
+
+// limits are the service's batch limits.
+type limits struct {
+	maxRecordBytes int
+	maxBatchBytes  int
+	maxRecords     int
+}
+
+// Amazon is a sink that sends batches of records with PutRecordBatch or SendMessageBatch.
+// Requests that fail are retried by the AWS SDK; records that fail in a request that
+// otherwise succeeded are resent on their own.
+type Amazon struct {
+	c       *config.AWS
+	putter  putter
+	limits  limits
+	batcher *sink.Batcher
+}
+
+// New creates a new Amazon sink from the given config. If the config is nil, nil is returned.
+// A nil Amazon will silently drop all records.
+func New(c *config.AWS) *Amazon {
+	if c == nil {
+		return nil
+	}
+
+	a := &Amazon{c: c}
+	switch c.Service {
+	case "firehose":
+		a.putter = newFirehose(c)
+		a.limits = firehoseLimits
+	case "sqs":
+		a.putter = newSQS(c)
+		a.limits = sqsLimits
+	}
+	a.batcher = sink.NewBatcher(sink.BatchOptions{
+		MaxBytes:   a.limits.maxBatchBytes,
+		MaxRecords: a.limits.maxRecords,
+	}, a.sendBatch)
+	return a
+}
+
+// Send queues a record for sending. Records larger than the service allows are dropped.
+// Calling Send after Shutdown will panic.
+func (a *Amazon) Send(record []byte) {
+	a.SendOriginal(record, record)
+}
+
+// SendOriginal queues a record for sending, with cef and leef formats rendering original, the
+// record before it was transformed. Calling SendOriginal after Shutdown will panic.
+func (a *Amazon) SendOriginal(record, original []byte) {
+	if a == nil || len(record) == 0 {
+		return
+	}
+
+	if f := a.c.Format.Formatter(); f != nil {
+		formatted, err := f.Format(original)
+		if err != nil {
+			logwrapper.Logger().Warn().Err(err).Msg("unable to format event for aws; sending it unformatted")
+		} else {
+			record = formatted
+		}
+	}
+	if a.c.Service == "firehose" {
+		// firehose concatenates records, so each is newline-terminated to keep the output NDJSON
+		record = append(record[:len(record):len(record)], '\n')
+	}
+
+	if len(record) > a.limits.maxRecordBytes {
+		logwrapper.Logger().Warn().
+			Str("service", a.c.Service).
+			Int("bytes", len(record)).
+			Int("max_bytes", a.limits.maxRecordBytes).
+			Msg("dropping record that is too large for aws")
+		return
+	}
+	a.batcher.Add(record)
+}
+
+// Shutdown flushes the queue and shuts down the sink. It will block until the queue is empty.
+func (a *Amazon) Shutdown() {
+	log.Printf("shutting down aws")
+	if a == nil {
+		return
+	}
+	a.batcher.Shutdown()
+}
+
+// sendBatch sends a batch, resending records that failed until they succeed or the retries
+// are exhausted.
+func (a *Amazon) sendBatch(b *sink.Batch) {
+	records := b.Records
+	delay := retryBaseDelay
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), putTimeout)
+		retry, err := a.putter.put(ctx, records)
+		cancel()
+		if err != nil {
+			logwrapper.Logger().Error().Err(err).Str("service", a.c.Service).Int("events", len(records)).Msg("Failed to send records to aws")
+			return
+		}
+		logwrapper.Logger().Info().
+			Str("service", a.c.Service).
+			Int("events", len(records)-len(retry)).
+			Int("failed", len(retry)).
+			Msg("sent to aws")
+		if len(retry) == 0 {
+			return
+		}
+		if attempt == *a.c.PartialFailureRetries {
+			logwrapper.Logger().Error().Str("service", a.c.Service).Int("events", len(retry)).Msg("dropping records that aws did not accept")
+			return
+		}
+
+		failed := make([][]byte, 0, len(retry))
+		for _, i := range retry {
+			failed = append(failed, records[i])
+		}
+		records = failed
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
@@ -0,0 +1,210 @@
+package amazon
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"spyderbat-event-forwarder/config"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockAWS is a local stand-in for the Firehose and SQS JSON APIs, in the style of LocalStack.
+// fail lists the record data to fail once, and fault marks SQS failures as sender faults.
+type mockAWS struct {
+	t    *testing.T
+	lock sync.Mutex
+
+	requests  int
+	delivered []string
+	fail      map[string]bool
+	fault     bool
+}
+
+func (m *mockAWS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.requests++
+
+	assert.Contains(m.t, r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDTEST/")
+	body, err := io.ReadAll(r.Body)
+	require.NoError(m.t, err)
+	target := r.Header.Get("X-Amz-Target")
+
+	switch target {
+	case "Firehose_20150804.PutRecordBatch":
+		var in struct {
+			DeliveryStreamName string
+			Records            []struct{ Data string }
+		}
+		require.NoError(m.t, json.Unmarshal(body, &in))
+		assert.Equal(m.t, "spyderbat", in.DeliveryStreamName)
+
+		out := map[string]any{}
+		var responses []map[string]any
+		failed := 0
+		for _, rec := range in.Records {
+			data, err := base64.StdEncoding.DecodeString(rec.Data)
+			require.NoError(m.t, err)
+			if m.fail[string(data)] {
+				delete(m.fail, string(data))
+				failed++
+				responses = append(responses, map[string]any{"ErrorCode": "ServiceUnavailableException", "ErrorMessage": "slow down"})
+				continue
+			}
+			m.delivered = append(m.delivered, string(data))
+			responses = append(responses, map[string]any{"RecordId": "id"})
+		}
+		out["FailedPutCount"] = failed
+		out["RequestResponses"] = responses
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		require.NoError(m.t, json.NewEncoder(w).Encode(out))
+
+	case "AmazonSQS.SendMessageBatch":
+		var in struct {
+			QueueUrl string
+			Entries  []struct{ Id, MessageBody string }
+		}
+		require.NoError(m.t, json.Unmarshal(body, &in))
+		assert.True(m.t, strings.HasSuffix(in.QueueUrl, "/000000000000/spyderbat"))
+		assert.LessOrEqual(m.t, len(in.Entries), 10)
+
+		successful := []map[string]any{}
+		failed := []map[string]any{}
+		for _, e := range in.Entries {
+			if m.fail[e.MessageBody] {
+				delete(m.fail, e.MessageBody)
+				failed = append(failed, map[string]any{"Id": e.Id, "Code": "InternalError", "SenderFault": m.fault, "Message": "try again"})
+				continue
+			}
+			m.delivered = append(m.delivered, e.MessageBody)
+			successful = append(successful, map[string]any{"Id": e.Id, "MessageId": "m-" + e.Id})
+		}
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		require.NoError(m.t, json.NewEncoder(w).Encode(map[string]any{"Successful": successful, "Failed": failed}))
+
+	default:
+		m.t.Errorf("unexpected request: target %q, content type %q", target, r.Header.Get("Content-Type"))
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func newMock(t *testing.T, service string) (*mockAWS, *config.AWS) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDTEST")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_CONFIG_FILE", "/nonexistent")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "/nonexistent")
+
+	oldDelay := retryBaseDelay
+	retryBaseDelay = time.Millisecond
+	t.Cleanup(func() { retryBaseDelay = oldDelay })
+
+	m := &mockAWS{t: t, fail: map[string]bool{}}
+	ts := httptest.NewServer(m)
+	t.Cleanup(ts.Close)
+
+	cfg := &config.AWS{
+		Service:            service,
+		Region:             "us-east-1",
+		DeliveryStreamName: "spyderbat",
+		QueueURL:           ts.URL + "/000000000000/spyderbat",
+		EndpointURL:        ts.URL,
+	}
+	require.NoError(t, config.ValidateAWS(cfg))
+	return m, cfg
+}
+
+func record(i int) []byte {
+	return []byte(`{"schema":"model_process::1.2.0","id":"proc:` + strconv.Itoa(i) + `"}`)
+}
+
+func TestFirehose(t *testing.T) {
+	m, cfg := newMock(t, "firehose")
+	m.fail[string(record(1))+"\n"] = true
+
+	a := New(cfg)
+	for i := 0; i < 3; i++ {
+		a.Send(record(i))
+	}
+	a.Shutdown()
+
+	// the failed record is resent on its own, newline-terminated like the others
+	assert.Equal(t, 2, m.requests)
+	assert.Equal(t, []string{
+		string(record(0)) + "\n",
+		string(record(2)) + "\n",
+		string(record(1)) + "\n",
+	}, m.delivered)
+}
+
+func TestFirehoseRecordTooLarge(t *testing.T) {
+	m, cfg := newMock(t, "firehose")
+	a := New(cfg)
+	a.Send([]byte(`{"big":"` + strings.Repeat("x", firehoseLimits.maxRecordBytes) + `"}`))
+	a.Send(record(0))
+	a.Shutdown()
+
+	assert.Equal(t, []string{string(record(0)) + "\n"}, m.delivered)
+}
+
+func TestSQS(t *testing.T) {
+	m, cfg := newMock(t, "sqs")
+	m.fail[string(record(3))] = true
+
+	a := New(cfg)
+	for i := 0; i < 12; i++ {
+		a.Send(record(i))
+	}
+	a.Shutdown()
+
+	// 12 records are two batches, and the failed record is retried before the second is sent
+	assert.Equal(t, 3, m.requests)
+	require.Len(t, m.delivered, 12)
+	assert.Equal(t, string(record(3)), m.delivered[9])
+	assert.Equal(t, string(record(11)), m.delivered[11])
+}
+
+func TestSQSSenderFault(t *testing.T) {
+	m, cfg := newMock(t, "sqs")
+	m.fail[string(record(0))] = true
+	m.fault = true
+
+	a := New(cfg)
+	a.Send(record(0))
+	a.Send(record(1))
+	a.Shutdown()
+
+	// sender faults are not retried
+	assert.Equal(t, 1, m.requests)
+	assert.Equal(t, []string{string(record(1))}, m.delivered)
+}
+
+func TestPartialFailureRetriesExhausted(t *testing.T) {
+	m, cfg := newMock(t, "firehose")
+	retries := 0
+	cfg.PartialFailureRetries = &retries
+	m.fail[string(record(0))+"\n"] = true
+
+	a := New(cfg)
+	a.Send(record(0))
+	a.Shutdown()
+
+	assert.Equal(t, 1, m.requests)
+	assert.Empty(t, m.delivered)
+}
+
+func TestAmazonNil(t *testing.T) {
+	var a *Amazon
+	a.Send(record(0))
+	a.Shutdown()
+	assert.Nil(t, New(nil))
+}
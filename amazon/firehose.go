@@ -0,0 +1,70 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package amazon
+
+import (
+	"context"
+
+	"spyderbat-event-forwarder/config"
+	"spyderbat-event-forwarder/logwrapper"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/firehose"
+	"github.com/aws/aws-sdk-go-v2/service/firehose/types"
+)
+
+// firehoseLimits are the PutRecordBatch quotas.
+var firehoseLimits = limits{
+	maxRecordBytes: 1000 * 1024,
+	maxBatchBytes:  4 * 1024 * 1024,
+	maxRecords:     500,
+}
+
+type firehosePutter struct {
+	client *firehose.Client
+	stream string
+}
+
+func newFirehose(c *config.AWS) *firehosePutter {
+	client := firehose.NewFromConfig(c.Config(), func(o *firehose.Options) {
+		if c.EndpointURL != "" {
+			o.BaseEndpoint = aws.String(c.EndpointURL)
+		}
+	})
+	return &firehosePutter{client: client, stream: c.DeliveryStreamName}
+}
+
+func (f *firehosePutter) put(ctx context.Context, records [][]byte) ([]int, error) {
+	in := &firehose.PutRecordBatchInput{
+		DeliveryStreamName: aws.String(f.stream),
+		Records:            make([]types.Record, len(records)),
+	}
+	for i, r := range records {
+		in.Records[i] = types.Record{Data: r}
+	}
+
+	out, err := f.client.PutRecordBatch(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+	if aws.ToInt32(out.FailedPutCount) == 0 {
+		return nil, nil
+	}
+
+	// every record failure may be retried; the responses are in the same order as the records
+	var retry []int
+	for i, resp := range out.RequestResponses {
+		if resp.ErrorCode != nil {
+			if len(retry) == 0 {
+				logwrapper.Logger().Warn().
+					Str("error_code", aws.ToString(resp.ErrorCode)).
+					Str("error_message", aws.ToString(resp.ErrorMessage)).
+					Msg("firehose did not accept some records")
+			}
+			retry = append(retry, i)
+		}
+	}
+	return retry, nil
+}
@@ -0,0 +1,76 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package amazon
+
+import (
+	"context"
+	"strconv"
+
+	"spyderbat-event-forwarder/config"
+	"spyderbat-event-forwarder/logwrapper"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// sqsLimits are the SendMessageBatch quotas. SQS can be configured for messages up to 1 MiB,
+// but 256 KiB is the default for queues.
+var sqsLimits = limits{
+	maxRecordBytes: 256 * 1024,
+	maxBatchBytes:  256 * 1024,
+	maxRecords:     10,
+}
+
+type sqsPutter struct {
+	client   *sqs.Client
+	queueURL string
+}
+
+func newSQS(c *config.AWS) *sqsPutter {
+	client := sqs.NewFromConfig(c.Config(), func(o *sqs.Options) {
+		if c.EndpointURL != "" {
+			o.BaseEndpoint = aws.String(c.EndpointURL)
+		}
+	})
+	return &sqsPutter{client: client, queueURL: c.QueueURL}
+}
+
+func (s *sqsPutter) put(ctx context.Context, records [][]byte) ([]int, error) {
+	in := &sqs.SendMessageBatchInput{
+		QueueUrl: aws.String(s.queueURL),
+		Entries:  make([]types.SendMessageBatchRequestEntry, len(records)),
+	}
+	for i, r := range records {
+		// ids only need to be unique within the batch, so they are the record's index
+		in.Entries[i] = types.SendMessageBatchRequestEntry{
+			Id:          aws.String(strconv.Itoa(i)),
+			MessageBody: aws.String(string(r)),
+		}
+	}
+
+	out, err := s.client.SendMessageBatch(ctx, in)
+	if err != nil {
+		return nil, err
+	}
+
+	// failures caused by the message itself (sender fault) will fail again, so are not retried
+	var retry []int
+	for _, f := range out.Failed {
+		i, err := strconv.Atoi(aws.ToString(f.Id))
+		if err != nil || i < 0 || i >= len(records) {
+			continue
+		}
+		if f.SenderFault {
+			logwrapper.Logger().Error().
+				Str("code", aws.ToString(f.Code)).
+				Str("message", aws.ToString(f.Message)).
+				Msg("dropping record that sqs rejected")
+			continue
+		}
+		retry = append(retry, i)
+	}
+	return retry, nil
+}
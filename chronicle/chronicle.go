@@ -0,0 +1,287 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+// chronicle sends records to Google SecOps (Chronicle) as unstructured log entries.
+package chronicle
+
+import (
+	"bytes"
+	stdjson "encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"spyderbat-event-forwarder/config"
+	"spyderbat-event-forwarder/logwrapper"
+	"spyderbat-event-forwarder/sink"
+
+	retryablehttp "github.com/hashicorp/go-retryablehttp"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/valyala/fastjson"
+)
+
+var (
+	json       = jsoniter.ConfigCompatibleWithStandardLibrary
+	parserPool = fastjson.ParserPool{}
+)
+
+// maxGroups is how many sets of labels are batched at once. Each has its own batcher, so when
+// a record has a new set of labels and there are this many, the least recently used is flushed
+// and shut down.
+const maxGroups = 64
+
+type label struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+type entry struct {
+	LogText             string `json:"log_text"`
+	TsEpochMicroseconds int64  `json:"ts_epoch_microseconds"`
+}
+
+type batchCreateRequest struct {
+	CustomerID string               `json:"customer_id"`
+	LogType    string               `json:"log_type"`
+	Namespace  string               `json:"namespace,omitempty"`
+	Labels     []label              `json:"labels,omitempty"`
+	Entries    []stdjson.RawMessage `json:"entries"`
+}
+
+// group is the batch of entries for one set of labels; namespace and labels apply to a whole
+// request, so entries with different labels are batched separately.
+type group struct {
+	labels   []label
+	batcher  *sink.Batcher
+	lastUsed time.Time
+}
+
+// Chronicle is a sink that posts records to the Chronicle ingestion API.
+type Chronicle struct {
+	c      *config.Chronicle
+	client sink.Doer
+	tokens *sink.TokenSource
+
+	lock      sync.Mutex
+	groups    map[string]*group // label key -> group
+	maxGroups int
+	evicted   sync.WaitGroup // groups being flushed after eviction
+}
+
+// New creates a new Chronicle sink from the given config. If the config is nil, nil is returned.
+// A nil Chronicle will silently drop all records.
+func New(c *config.Chronicle) *Chronicle {
+	if c == nil {
+		return nil
+	}
+
+	client := sink.NewHTTPClient(c.Insecure)
+	return &Chronicle{
+		c:      c,
+		client: client,
+		tokens: sink.NewTokenSource(func() (string, time.Duration, error) {
+			return fetchToken(client, c.ServiceAccount(), c.Scope())
+		}),
+		groups:    make(map[string]*group),
+		maxGroups: maxGroups,
+	}
+}
+
+// labelsFor returns the labels for a record, sorted by key, and a key identifying them.
+func (h *Chronicle) labelsFor(v *fastjson.Value) ([]label, string) {
+	labels := make([]label, 0, len(h.c.Labels)+len(h.c.LabelFields))
+	for k, val := range h.c.Labels {
+		labels = append(labels, label{Key: k, Value: val})
+	}
+	for k, path := range h.c.LabelFields {
+		f := v.Get(strings.Split(path, ".")...)
+		if f == nil || f.Type() == fastjson.TypeNull {
+			continue
+		}
+		val := f.String()
+		if f.Type() == fastjson.TypeString {
+			val = string(f.GetStringBytes())
+		}
+		labels = append(labels, label{Key: k, Value: val})
+	}
+	sort.Slice(labels, func(i, j int) bool { return labels[i].Key < labels[j].Key })
+
+	key := &strings.Builder{}
+	for _, l := range labels {
+		fmt.Fprintf(key, "%q=%q,", l.Key, l.Value)
+	}
+	return labels, key.String()
+}
+
+// add queues an entry in the group for a set of labels, creating the group if needed.
+func (h *Chronicle) add(labels []label, key string, e []byte) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	g, found := h.groups[key]
+	if !found {
+		if len(h.groups) >= h.maxGroups {
+			h.evictOldest()
+		}
+
+		// the entries are joined with commas into a request with these labels
+		envelope, _ := json.Marshal(h.request(labels, nil))
+		g = &group{labels: labels}
+		g.batcher = sink.NewBatcher(sink.BatchOptions{
+			MaxBytes:       h.c.MaxPayloadBytes - len(envelope),
+			RecordOverhead: 1,
+		}, func(b *sink.Batch) { h.sendBatch(g, b) })
+		h.groups[key] = g
+	}
+	g.lastUsed = time.Now()
+	g.batcher.Add(e)
+}
+
+// evictOldest removes the least recently used group and flushes it in the background.
+// h.lock must be held.
+func (h *Chronicle) evictOldest() {
+	var oldestKey string
+	var oldest *group
+	for k, g := range h.groups {
+		if oldest == nil || g.lastUsed.Before(oldest.lastUsed) {
+			oldestKey, oldest = k, g
+		}
+	}
+	delete(h.groups, oldestKey)
+	h.evicted.Add(1)
+	go func() {
+		defer h.evicted.Done()
+		oldest.batcher.Shutdown()
+	}()
+}
+
+func (h *Chronicle) request(labels []label, entries []stdjson.RawMessage) *batchCreateRequest {
+	return &batchCreateRequest{
+		CustomerID: h.c.CustomerID,
+		LogType:    h.c.LogType,
+		Namespace:  h.c.Namespace,
+		Labels:     labels,
+		Entries:    entries,
+	}
+}
+
+// Send queues a record for sending. The record time is used as the entry timestamp.
+// Calling Send after Shutdown will panic.
+func (h *Chronicle) Send(record []byte) {
+	h.SendOriginal(record, record)
+}
+
+// SendOriginal queues a record for sending, with the entry timestamp and labels taken from
+// original, the record before it was transformed. cef and leef formats render original.
+// Calling SendOriginal after Shutdown will panic.
+func (h *Chronicle) SendOriginal(record, original []byte) {
+	if h == nil || len(record) == 0 {
+		return
+	}
+
+	p := parserPool.Get()
+	v, err := p.ParseBytes(original)
+	if err != nil {
+		parserPool.Put(p)
+		logwrapper.Logger().Warn().Err(err).Msg("dropping invalid record for chronicle")
+		return
+	}
+	labels, key := h.labelsFor(v)
+	ts := time.Now().UnixMicro()
+	if t := v.GetFloat64("time"); t > 0 {
+		ts = int64(t * 1e6)
+	}
+	parserPool.Put(p)
+
+	if f := h.c.Format.Formatter(); f != nil {
+		formatted, err := f.Format(original)
+		if err != nil {
+			logwrapper.Logger().Warn().Err(err).Msg("unable to format event for chronicle; sending it unformatted")
+		} else {
+			record = formatted
+		}
+	}
+
+	e, err := json.Marshal(entry{LogText: string(record), TsEpochMicroseconds: ts})
+	if err != nil {
+		logwrapper.Logger().Warn().Err(err).Msg("dropping unencodable record for chronicle")
+		return
+	}
+	h.add(labels, key, e)
+}
+
+// Shutdown flushes the queues and shuts down the sink. It will block until the queues are empty.
+func (h *Chronicle) Shutdown() {
+	log.Printf("shutting down chronicle")
+	if h == nil {
+		return
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for _, g := range h.groups {
+		g.batcher.Shutdown()
+	}
+	h.evicted.Wait()
+}
+
+// sendBatch posts a batch of entries that share labels.
+func (h *Chronicle) sendBatch(g *group, b *sink.Batch) {
+	entries := make([]stdjson.RawMessage, len(b.Records))
+	for i, r := range b.Records {
+		entries[i] = r
+	}
+	body, err := json.Marshal(h.request(g.labels, entries))
+	if err == nil {
+		err = h.post(body, len(entries))
+	}
+	if err != nil {
+		logwrapper.Logger().Error().Err(err).Msg("Failed to send records to chronicle")
+	}
+}
+
+func (h *Chronicle) post(body []byte, count int) error {
+	// a rejected token is replaced and the request tried once more
+	for attempt := 0; ; attempt++ {
+		token, err := h.tokens.Token()
+		if err != nil {
+			return err
+		}
+
+		req, err := retryablehttp.NewRequest(http.MethodPost, h.c.BatchCreateURL(), bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := h.client.Do(req)
+		if err != nil {
+			return err
+		}
+		respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			logwrapper.Logger().Info().
+				Int("events", count).
+				Int("bytes", len(body)).
+				Int("status_code", resp.StatusCode).
+				Msg("sent to chronicle")
+			return nil
+		}
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			h.tokens.Invalidate()
+			continue
+		}
+		return fmt.Errorf("chronicle returned status code %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+}
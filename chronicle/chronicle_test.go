@@ -0,0 +1,205 @@
+package chronicle
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"spyderbat-event-forwarder/config"
+	"spyderbat-event-forwarder/transform"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testRecords = [][]byte{
+	[]byte(`{"schema":"event_redflag:bash:1.0.0","id":"flag:1","time":1700000001.5,"runtime_details":{"hostname":"puppies"}}`),
+	[]byte(`{"schema":"event_redflag:bash:1.0.0","id":"flag:2","time":1700000002,"runtime_details":{"hostname":"kittens"}}`),
+	[]byte(`{"schema":"event_redflag:bash:1.0.0","id":"flag:3","time":1700000003,"runtime_details":{"hostname":"puppies"}}`),
+}
+
+// mockChronicle is a local stand-in for Google's token endpoint and the ingestion API.
+type mockChronicle struct {
+	t    *testing.T
+	key  *rsa.PublicKey
+	lock sync.Mutex
+
+	tokenRequests int
+	requests      []batchCreateRequest
+}
+
+func (m *mockChronicle) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	switch r.URL.Path {
+	case "/token":
+		require.NoError(m.t, r.ParseForm())
+		assert.Equal(m.t, "urn:ietf:params:oauth:grant-type:jwt-bearer", r.PostForm.Get("grant_type"))
+		m.verifyJWT(r.PostForm.Get("assertion"))
+		m.tokenRequests++
+		_, _ = w.Write([]byte(`{"access_token":"token-1","expires_in":3599,"token_type":"Bearer"}`))
+
+	case "/v2/unstructuredlogentries:batchCreate":
+		assert.Equal(m.t, "Bearer token-1", r.Header.Get("Authorization"))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(m.t, err)
+		var req batchCreateRequest
+		require.NoError(m.t, json.Unmarshal(body, &req))
+		m.requests = append(m.requests, req)
+		_, _ = w.Write([]byte(`{}`))
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (m *mockChronicle) verifyJWT(assertion string) {
+	parts := strings.Split(assertion, ".")
+	require.Len(m.t, parts, 3)
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	require.NoError(m.t, err)
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	require.NoError(m.t, rsa.VerifyPKCS1v15(m.key, crypto.SHA256, digest[:], sig))
+
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	require.NoError(m.t, err)
+	var claims jwtClaims
+	require.NoError(m.t, json.Unmarshal(claimsJSON, &claims))
+	assert.Equal(m.t, "forwarder@project.iam.gserviceaccount.com", claims.Iss)
+	assert.Equal(m.t, "https://www.googleapis.com/auth/malachite-ingestion", claims.Scope)
+	assert.True(m.t, strings.HasSuffix(claims.Aud, "/token"))
+	assert.Equal(m.t, int64(3600), claims.Exp-claims.Iat)
+}
+
+func newMock(t *testing.T) (*mockChronicle, *config.Chronicle) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	m := &mockChronicle{t: t, key: &key.PublicKey}
+	ts := httptest.NewTLSServer(m)
+	t.Cleanup(ts.Close)
+
+	creds, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"client_email":   "forwarder@project.iam.gserviceaccount.com",
+		"private_key_id": "key-1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":      ts.URL + "/token",
+	})
+	require.NoError(t, err)
+	credsFile := filepath.Join(t.TempDir(), "creds.json")
+	require.NoError(t, os.WriteFile(credsFile, creds, 0600))
+
+	cfg := &config.Chronicle{
+		Endpoint:        ts.URL,
+		CustomerID:      "customer-1",
+		LogType:         "SPYDERBAT_EVENTS",
+		Namespace:       "prod",
+		Labels:          map[string]string{"source": "spyderbat"},
+		LabelFields:     map[string]string{"hostname": "runtime_details.hostname"},
+		CredentialsFile: credsFile,
+		Insecure:        true,
+	}
+	require.NoError(t, config.ValidateChronicle(cfg))
+	return m, cfg
+}
+
+func TestChronicle(t *testing.T) {
+	m, cfg := newMock(t)
+	h := New(cfg)
+	for _, r := range testRecords {
+		h.Send(r)
+	}
+	h.Shutdown()
+
+	assert.Equal(t, 1, m.tokenRequests, "the token is cached")
+	require.Len(t, m.requests, 2, "entries are batched by labels")
+
+	byHost := map[string]batchCreateRequest{}
+	for _, req := range m.requests {
+		assert.Equal(t, "customer-1", req.CustomerID)
+		assert.Equal(t, "SPYDERBAT_EVENTS", req.LogType)
+		assert.Equal(t, "prod", req.Namespace)
+		require.Len(t, req.Labels, 2)
+		assert.Equal(t, label{Key: "source", Value: "spyderbat"}, req.Labels[1])
+		byHost[req.Labels[0].Value] = req
+	}
+
+	puppies := byHost["puppies"]
+	require.Len(t, puppies.Entries, 2)
+	var e entry
+	require.NoError(t, json.Unmarshal(puppies.Entries[0], &e))
+	assert.Equal(t, entry{LogText: string(testRecords[0]), TsEpochMicroseconds: 1700000001500000}, e)
+	assert.Len(t, byHost["kittens"].Entries, 1)
+}
+
+func TestChronicleMaxGroups(t *testing.T) {
+	m, cfg := newMock(t)
+	h := New(cfg)
+	h.maxGroups = 1
+	for _, r := range testRecords {
+		h.Send(r)
+	}
+	assert.Len(t, h.groups, 1, "the least recently used group is evicted")
+	h.Shutdown()
+
+	// each host is flushed when the other arrives, and the last at shutdown
+	require.Len(t, m.requests, 3)
+	entries := 0
+	for _, req := range m.requests {
+		entries += len(req.Entries)
+	}
+	assert.Equal(t, len(testRecords), entries)
+}
+
+func TestChronicleTransformedRecords(t *testing.T) {
+	m, cfg := newMock(t)
+	h := New(cfg)
+	// ocsf has no runtime_details, and its time is in milliseconds
+	ocsf, err := new(transform.OCSF).Transform(testRecords[0])
+	require.NoError(t, err)
+	h.SendOriginal(ocsf, testRecords[0])
+	h.Shutdown()
+
+	require.Len(t, m.requests, 1)
+	assert.Equal(t, label{Key: "hostname", Value: "puppies"}, m.requests[0].Labels[0])
+	var e entry
+	require.NoError(t, json.Unmarshal(m.requests[0].Entries[0], &e))
+	assert.Equal(t, entry{LogText: string(ocsf), TsEpochMicroseconds: 1700000001500000}, e)
+}
+
+func TestChronicleFormat(t *testing.T) {
+	m, cfg := newMock(t)
+	cfg.LabelFields = nil
+	cfg.Format = &config.Format{Type: "cef"}
+	require.NoError(t, config.ValidateChronicle(cfg))
+	h := New(cfg)
+	h.Send(testRecords[0])
+	h.Shutdown()
+
+	require.Len(t, m.requests, 1)
+	var e entry
+	require.NoError(t, json.Unmarshal(m.requests[0].Entries[0], &e))
+	assert.True(t, strings.HasPrefix(e.LogText, "CEF:0|Spyderbat|"), e.LogText)
+}
+
+func TestChronicleNil(t *testing.T) {
+	var h *Chronicle
+	h.Send(testRecords[0])
+	h.Shutdown()
+	assert.Nil(t, New(nil))
+}
@@ -0,0 +1,74 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package chronicle
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"time"
+
+	"spyderbat-event-forwarder/config"
+	"spyderbat-event-forwarder/sink"
+)
+
+const jwtLifetime = time.Hour
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid,omitempty"`
+}
+
+type jwtClaims struct {
+	Iss   string `json:"iss"`
+	Scope string `json:"scope"`
+	Aud   string `json:"aud"`
+	Iat   int64  `json:"iat"`
+	Exp   int64  `json:"exp"`
+}
+
+// signJWT returns an RS256-signed JWT asserting the service account's identity, for the
+// OAuth2 JWT bearer grant.
+func signJWT(sa *config.ServiceAccount, scope string, now time.Time) (string, error) {
+	header, err := json.Marshal(jwtHeader{Alg: "RS256", Typ: "JWT", Kid: sa.PrivateKeyID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(jwtClaims{
+		Iss:   sa.ClientEmail,
+		Scope: scope,
+		Aud:   sa.TokenURI,
+		Iat:   now.Unix(),
+		Exp:   now.Add(jwtLifetime).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, sa.Key(), crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return unsigned + "." + enc.EncodeToString(sig), nil
+}
+
+// fetchToken exchanges a signed JWT for an access token.
+func fetchToken(client sink.Doer, sa *config.ServiceAccount, scope string) (string, time.Duration, error) {
+	assertion, err := signJWT(sa, scope, time.Now())
+	if err != nil {
+		return "", 0, err
+	}
+	return sink.FetchOAuth2Token(client, sa.TokenURI, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+}
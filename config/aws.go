@@ -0,0 +1,119 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+const defaultAWSPartialFailureRetries = 3
+
+// AWS configures delivery to Amazon Kinesis Data Firehose (PutRecordBatch) or Amazon SQS
+// (SendMessageBatch). Credentials come from the standard AWS chain: environment, shared
+// config and credentials files, web identity (IRSA), ECS task role or EC2 instance role.
+type AWS struct {
+	Service               string  `yaml:"service"`                        // firehose or sqs
+	Region                string  `yaml:"region,omitempty"`               // default from the AWS environment
+	DeliveryStreamName    string  `yaml:"delivery_stream_name,omitempty"` // firehose
+	QueueURL              string  `yaml:"queue_url,omitempty"`            // sqs
+	EndpointURL           string  `yaml:"endpoint_url,omitempty"`         // e.g. LocalStack
+	Profile               string  `yaml:"profile,omitempty"`
+	RoleARN               string  `yaml:"role_arn,omitempty"` // assumed with the chain's credentials
+	ExternalID            string  `yaml:"external_id,omitempty"`
+	PartialFailureRetries *int    `yaml:"partial_failure_retries,omitempty"` // times failed records are resent; default 3
+	Format                *Format `yaml:"format,omitempty"`
+	awsConfig             aws.Config
+}
+
+// Config returns the AWS SDK config, with the credential chain and region resolved.
+func (a *AWS) Config() aws.Config {
+	return a.awsConfig
+}
+
+func ValidateAWS(a *AWS) error {
+	if a == nil {
+		return nil
+	}
+
+	a.Service = strings.ToLower(a.Service)
+	switch a.Service {
+	case "firehose":
+		if a.DeliveryStreamName == "" {
+			return fmt.Errorf("aws.delivery_stream_name is required for firehose")
+		}
+	case "sqs":
+		if a.QueueURL == "" {
+			return fmt.Errorf("aws.queue_url is required for sqs")
+		}
+	case "":
+		return fmt.Errorf("aws.service is required")
+	default:
+		return fmt.Errorf("unsupported aws.service '%s'; must be firehose or sqs", a.Service)
+	}
+
+	if a.EndpointURL != "" {
+		u, err := url.Parse(a.EndpointURL)
+		if err != nil {
+			return fmt.Errorf("failed to parse aws.endpoint_url: %w", err)
+		}
+		if u.Scheme != "https" && u.Scheme != "http" {
+			return fmt.Errorf("aws.endpoint_url must use http or https scheme")
+		}
+	}
+	if a.PartialFailureRetries == nil {
+		retries := defaultAWSPartialFailureRetries
+		a.PartialFailureRetries = &retries
+	}
+	if *a.PartialFailureRetries < 0 {
+		return fmt.Errorf("aws.partial_failure_retries cannot be negative")
+	}
+
+	cfg, err := loadAWSConfig("aws", a.Region, a.Profile, a.RoleARN, a.ExternalID)
+	if err != nil {
+		return err
+	}
+	a.Region = cfg.Region
+	a.awsConfig = cfg
+
+	return ValidateFormat(a.Format, "aws.format")
+}
+
+// loadAWSConfig resolves the AWS credential chain and region, assuming roleARN if it is set.
+// key is the config key of the AWS settings, for error messages.
+func loadAWSConfig(key, region, profile, roleARN, externalID string) (aws.Config, error) {
+	opts := []func(*awsconfig.LoadOptions) error{}
+	if region != "" {
+		opts = append(opts, awsconfig.WithRegion(region))
+	}
+	if profile != "" {
+		opts = append(opts, awsconfig.WithSharedConfigProfile(profile))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(context.Background(), opts...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("failed to load %s config: %w", key, err)
+	}
+	if cfg.Region == "" {
+		return aws.Config{}, fmt.Errorf("%s.region is required when it is not set in the AWS environment", key)
+	}
+
+	if roleARN != "" {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), roleARN, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = "spyderbat-event-forwarder"
+			if externalID != "" {
+				o.ExternalID = aws.String(externalID)
+			}
+		})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+	return cfg, nil
+}
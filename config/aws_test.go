@@ -0,0 +1,71 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// awsTestEnv isolates the AWS credential chain from the environment running the tests.
+func awsTestEnv(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDTEST")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_CONFIG_FILE", "/nonexistent")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "/nonexistent")
+}
+
+func TestAWSDefaults(t *testing.T) {
+	awsTestEnv(t)
+	t.Setenv("AWS_REGION", "eu-west-1")
+
+	a := &AWS{Service: "Firehose", DeliveryStreamName: "spyderbat"}
+	require.NoError(t, ValidateAWS(a))
+	assert.Equal(t, "firehose", a.Service)
+	assert.Equal(t, "eu-west-1", a.Region)
+	assert.Equal(t, defaultAWSPartialFailureRetries, *a.PartialFailureRetries)
+
+	creds, err := a.Config().Credentials.Retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "AKIDTEST", creds.AccessKeyID)
+
+	// an explicit region wins over the environment
+	a = &AWS{Service: "sqs", QueueURL: "https://sqs.us-east-2.amazonaws.com/1/q", Region: "us-east-2"}
+	require.NoError(t, ValidateAWS(a))
+	assert.Equal(t, "us-east-2", a.Config().Region)
+}
+
+func TestAWSValidation(t *testing.T) {
+	awsTestEnv(t)
+	negative := -1
+
+	tests := []struct {
+		name string
+		aws  AWS
+		err  string
+	}{
+		{"missing service", AWS{Region: "us-east-1"}, "aws.service is required"},
+		{"bad service", AWS{Service: "kinesis", Region: "us-east-1"}, "unsupported aws.service"},
+		{"missing stream", AWS{Service: "firehose", Region: "us-east-1"}, "aws.delivery_stream_name is required"},
+		{"missing queue", AWS{Service: "sqs", Region: "us-east-1"}, "aws.queue_url is required"},
+		{"bad endpoint", AWS{Service: "sqs", QueueURL: "q", Region: "us-east-1", EndpointURL: "ftp://localstack"}, "http or https"},
+		{"negative retries", AWS{Service: "sqs", QueueURL: "q", Region: "us-east-1", PartialFailureRetries: &negative}, "cannot be negative"},
+		{"missing region", AWS{Service: "sqs", QueueURL: "q"}, "aws.region is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateAWS(&tt.aws)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
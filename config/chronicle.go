@@ -0,0 +1,168 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const (
+	maxChroniclePayloadBytes = 1024 * 1024 * 1 // the ingestion API's limit per request
+	chronicleScope           = "https://www.googleapis.com/auth/malachite-ingestion"
+	chronicleBatchCreatePath = "/v2/unstructuredlogentries:batchCreate"
+	defaultGoogleTokenURI    = "https://oauth2.googleapis.com/token"
+)
+
+// Chronicle configures the Google SecOps (Chronicle) ingestion API. Records are sent as
+// unstructured log entries of a custom log type, authenticated as a service account.
+type Chronicle struct {
+	Region          string            `yaml:"region,omitempty"`       // e.g. us, europe, europe-west2, asia-southeast1
+	Endpoint        string            `yaml:"endpoint_url,omitempty"` // overrides the regional endpoint
+	CustomerID      string            `yaml:"customer_id"`
+	LogType         string            `yaml:"log_type"`
+	Namespace       string            `yaml:"namespace,omitempty"`
+	Labels          map[string]string `yaml:"labels,omitempty"`       // added to every entry
+	LabelFields     map[string]string `yaml:"label_fields,omitempty"` // label -> record field path, e.g. runtime_details.hostname
+	CredentialsFile string            `yaml:"credentials_file"`       // service account JSON key
+	MaxPayloadBytes int               `yaml:"max_payload_bytes"`
+	Insecure        bool              `yaml:"insecure"`
+	Format          *Format           `yaml:"format,omitempty"` // format of each log entry
+	serviceAccount  *ServiceAccount
+}
+
+// ServiceAccount holds the parts of a Google service account key needed to sign JWTs.
+type ServiceAccount struct {
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+	key          *rsa.PrivateKey
+}
+
+// Key returns the service account's parsed private key.
+func (s *ServiceAccount) Key() *rsa.PrivateKey {
+	return s.key
+}
+
+// ServiceAccount returns the service account loaded from credentials_file.
+func (c *Chronicle) ServiceAccount() *ServiceAccount {
+	return c.serviceAccount
+}
+
+// Scope returns the OAuth2 scope requested for the ingestion API.
+func (c *Chronicle) Scope() string {
+	return chronicleScope
+}
+
+// BatchCreateURL returns the URL that batches of entries are posted to.
+func (c *Chronicle) BatchCreateURL() string {
+	return strings.TrimSuffix(c.Endpoint, "/") + chronicleBatchCreatePath
+}
+
+// LoadServiceAccount reads and parses a service account JSON key.
+func LoadServiceAccount(filename string) (*ServiceAccount, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	sa := &ServiceAccount{}
+	if err := json.Unmarshal(data, sa); err != nil {
+		return nil, err
+	}
+	if sa.ClientEmail == "" || sa.PrivateKey == "" {
+		return nil, fmt.Errorf("client_email and private_key are required")
+	}
+	if sa.TokenURI == "" {
+		sa.TokenURI = defaultGoogleTokenURI
+	}
+
+	block, _ := pem.Decode([]byte(sa.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("private_key is not PEM encoded")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		// older keys are PKCS#1
+		if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("failed to parse private_key: %w", err)
+		}
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private_key is not an RSA key")
+	}
+	sa.key = rsaKey
+	return sa, nil
+}
+
+func ValidateChronicle(c *Chronicle) error {
+	if c == nil {
+		return nil
+	}
+
+	if c.CustomerID == "" {
+		return fmt.Errorf("chronicle.customer_id is required")
+	}
+	if c.LogType == "" {
+		return fmt.Errorf("chronicle.log_type is required")
+	}
+	if c.CredentialsFile == "" {
+		return fmt.Errorf("chronicle.credentials_file is required")
+	}
+	sa, err := LoadServiceAccount(c.CredentialsFile)
+	if err != nil {
+		return fmt.Errorf("failed to load chronicle.credentials_file: %w", err)
+	}
+	c.serviceAccount = sa
+
+	c.Region = strings.ToLower(c.Region)
+	if c.Endpoint == "" {
+		switch c.Region {
+		case "", "us":
+			c.Region = "us"
+			c.Endpoint = "https://malachiteingestion-pa.googleapis.com"
+		default:
+			c.Endpoint = "https://" + c.Region + "-malachiteingestion-pa.googleapis.com"
+		}
+	}
+	u, err := url.Parse(c.Endpoint)
+	if err != nil {
+		return fmt.Errorf("failed to parse chronicle.endpoint_url: %w", err)
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("chronicle.endpoint_url must use https scheme")
+	}
+	if u.Host == "" {
+		return fmt.Errorf("chronicle.endpoint_url must include a hostname")
+	}
+
+	for label, path := range c.LabelFields {
+		if path == "" {
+			return fmt.Errorf("chronicle.label_fields.%s must name a record field", label)
+		}
+		if _, found := c.Labels[label]; found {
+			return fmt.Errorf("chronicle label '%s' is in both labels and label_fields", label)
+		}
+	}
+
+	if c.MaxPayloadBytes == 0 {
+		c.MaxPayloadBytes = maxChroniclePayloadBytes
+	}
+	if c.MaxPayloadBytes > maxChroniclePayloadBytes {
+		return fmt.Errorf("chronicle.max_payload_bytes cannot be greater than %d", maxChroniclePayloadBytes)
+	}
+	if c.MaxPayloadBytes < minWebhookPayloadBytes {
+		return fmt.Errorf("chronicle.max_payload_bytes cannot be less than %d", minWebhookPayloadBytes)
+	}
+
+	return ValidateFormat(c.Format, "chronicle.format")
+}
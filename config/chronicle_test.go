@@ -0,0 +1,81 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeServiceAccount writes a service account key file with a new RSA key.
+func writeServiceAccount(t *testing.T, fields map[string]string) string {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	sa := map[string]string{
+		"client_email": "forwarder@project.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+	}
+	for k, v := range fields {
+		sa[k] = v
+	}
+	data, err := json.Marshal(sa)
+	require.NoError(t, err)
+	filename := filepath.Join(t.TempDir(), "creds.json")
+	require.NoError(t, os.WriteFile(filename, data, 0600))
+	return filename
+}
+
+func TestChronicleDefaults(t *testing.T) {
+	c := &Chronicle{CustomerID: "c", LogType: "SPYDERBAT", CredentialsFile: writeServiceAccount(t, nil)}
+	require.NoError(t, ValidateChronicle(c))
+
+	assert.Equal(t, "us", c.Region)
+	assert.Equal(t, "https://malachiteingestion-pa.googleapis.com/v2/unstructuredlogentries:batchCreate", c.BatchCreateURL())
+	assert.Equal(t, maxChroniclePayloadBytes, c.MaxPayloadBytes)
+	require.NotNil(t, c.ServiceAccount())
+	assert.Equal(t, defaultGoogleTokenURI, c.ServiceAccount().TokenURI)
+	assert.NotNil(t, c.ServiceAccount().Key())
+
+	c = &Chronicle{Region: "Europe-West2", CustomerID: "c", LogType: "SPYDERBAT", CredentialsFile: c.CredentialsFile}
+	require.NoError(t, ValidateChronicle(c))
+	assert.Equal(t, "https://europe-west2-malachiteingestion-pa.googleapis.com/v2/unstructuredlogentries:batchCreate", c.BatchCreateURL())
+}
+
+func TestChronicleValidation(t *testing.T) {
+	creds := writeServiceAccount(t, nil)
+	badKey := writeServiceAccount(t, map[string]string{"private_key": "not a key"})
+
+	tests := []struct {
+		name      string
+		chronicle Chronicle
+		err       string
+	}{
+		{"missing customer", Chronicle{LogType: "L", CredentialsFile: creds}, "chronicle.customer_id is required"},
+		{"missing log type", Chronicle{CustomerID: "c", CredentialsFile: creds}, "chronicle.log_type is required"},
+		{"missing credentials", Chronicle{CustomerID: "c", LogType: "L"}, "chronicle.credentials_file is required"},
+		{"missing file", Chronicle{CustomerID: "c", LogType: "L", CredentialsFile: "/nonexistent"}, "failed to load"},
+		{"bad key", Chronicle{CustomerID: "c", LogType: "L", CredentialsFile: badKey}, "not PEM encoded"},
+		{"http endpoint", Chronicle{CustomerID: "c", LogType: "L", CredentialsFile: creds, Endpoint: "http://x"}, "https"},
+		{"duplicate label", Chronicle{CustomerID: "c", LogType: "L", CredentialsFile: creds,
+			Labels: map[string]string{"host": "a"}, LabelFields: map[string]string{"host": "runtime_details.hostname"}}, "both labels and label_fields"},
+		{"too large", Chronicle{CustomerID: "c", LogType: "L", CredentialsFile: creds, MaxPayloadBytes: maxChroniclePayloadBytes + 1}, "cannot be greater"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateChronicle(&tt.chronicle)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"path/filepath"
 	"strings"
 
+	"spyderbat-event-forwarder/transform"
+
 	"gopkg.in/yaml.v2"
 )
 
@@ -20,17 +22,42 @@ const (
 )
 
 type Config struct {
-	APIHost               string   `yaml:"api_host"`
-	LogPath               string   `yaml:"log_path"`
-	OrgUID                string   `yaml:"spyderbat_org_uid"`
-	APIKey                string   `yaml:"spyderbat_secret_api_key"`
-	LocalSyslogForwarding bool     `yaml:"local_syslog_forwarding"`
-	StdOut                bool     `yaml:"stdout"`
-	Webhook               *Webhook `yaml:"webhook"`
+	APIHost               string            `yaml:"api_host"`
+	LogPath               string            `yaml:"log_path"`
+	OrgUID                string            `yaml:"spyderbat_org_uid"`
+	APIKey                string            `yaml:"spyderbat_secret_api_key"`
+	LocalSyslogForwarding bool              `yaml:"local_syslog_forwarding"`
+	StdOut                bool              `yaml:"stdout"`
+	EventLog              *EventLog         `yaml:"event_log"`
+	Transform             string            `yaml:"transform"`
+	FileFormat            *Format           `yaml:"file_format"`
+	StdOutFormat          *Format           `yaml:"stdout_format"`
+	SyslogFormat          *Format           `yaml:"syslog_format"`
+	Webhook               *Webhook          `yaml:"webhook"`
+	Loki                  *Loki             `yaml:"loki"`
+	OTLP                  *OTLP             `yaml:"otlp"`
+	Sentinel              *Sentinel         `yaml:"sentinel"`
+	Chronicle             *Chronicle        `yaml:"chronicle"`
+	AWS                   *AWS              `yaml:"aws"`
+	Forward               *Forward          `yaml:"forward"`
+	NATS                  *NATS             `yaml:"nats"`
+	Redis                 *Redis            `yaml:"redis"`
+	Notify                *Notify           `yaml:"notify"`
+	SQLite                *SQLite           `yaml:"sqlite"`
+	Parquet               *Parquet          `yaml:"parquet"`
+	Redaction             []*Redaction      `yaml:"redaction"`
+	Projection            []*Projection     `yaml:"projection"`
+	FieldTransforms       []*FieldTransform `yaml:"field_transforms"`
+	transformer           transform.Transformer
 }
 
 const iteratorFile = "iterator"
 
+// Transformer returns the transformer applied to every record before it is forwarded, or nil.
+func (c *Config) Transformer() transform.Transformer {
+	return c.transformer
+}
+
 func (c *Config) iteratorFile() string {
 	return filepath.Join(c.LogPath, iteratorFile)
 }
@@ -131,7 +158,75 @@ func (c *Config) PrepareAndValidate() error {
 		}
 	}
 
-	return ValidateWebhook(c.Webhook)
+	c.Transform = strings.ToLower(c.Transform)
+	t, err := transform.New(c.Transform)
+	if err != nil {
+		return fmt.Errorf("failed to validate config key 'transform': %w", err)
+	}
+	c.transformer = t
+
+	for key, f := range map[string]*Format{
+		"file_format":   c.FileFormat,
+		"stdout_format": c.StdOutFormat,
+		"syslog_format": c.SyslogFormat,
+	} {
+		if err := ValidateFormat(f, key); err != nil {
+			return err
+		}
+	}
+
+	if err := ValidateProjection(c.Projection); err != nil {
+		return err
+	}
+	if err := ValidateRedaction(c.Redaction); err != nil {
+		return err
+	}
+	if err := ValidateFieldTransforms(c.FieldTransforms); err != nil {
+		return err
+	}
+
+	// the file output is always configured, so that its defaults are filled in
+	if c.EventLog == nil {
+		c.EventLog = &EventLog{}
+	}
+	if err := ValidateEventLog(c.EventLog, c.LogPath); err != nil {
+		return err
+	}
+
+	if err := ValidateWebhook(c.Webhook); err != nil {
+		return err
+	}
+	if err := ValidateLoki(c.Loki); err != nil {
+		return err
+	}
+	if err := ValidateOTLP(c.OTLP); err != nil {
+		return err
+	}
+	if err := ValidateSentinel(c.Sentinel); err != nil {
+		return err
+	}
+	if err := ValidateChronicle(c.Chronicle); err != nil {
+		return err
+	}
+	if err := ValidateAWS(c.AWS); err != nil {
+		return err
+	}
+	if err := ValidateForward(c.Forward); err != nil {
+		return err
+	}
+	if err := ValidateNATS(c.NATS); err != nil {
+		return err
+	}
+	if err := ValidateRedis(c.Redis); err != nil {
+		return err
+	}
+	if err := ValidateNotify(c.Notify); err != nil {
+		return err
+	}
+	if err := ValidateSQLite(c.SQLite, c.LogPath); err != nil {
+		return err
+	}
+	return ValidateParquet(c.Parquet, c.LogPath)
 }
 
 // LoadConfig loads and parses a yaml config
@@ -0,0 +1,82 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Datadog Logs HTTP intake limits; see https://docs.datadoghq.com/api/latest/logs/
+const (
+	datadogPayloadBytes = 5 * 1024 * 1024 // uncompressed, per request
+	datadogMaxRecords   = 1000            // log entries per request
+	datadogRecordBytes  = 1024 * 1024     // per log entry; larger entries are truncated by the intake
+	datadogAPIKeyHeader = "DD-API-KEY"
+	defaultDatadogSite  = "datadoghq.com"
+	defaultDatadogSrc   = "spyderbat"
+)
+
+// DatadogOptions are the settings for the datadog webhook preset. The service, hostname and
+// tags of each log are derived from the record's schema and runtime_details.
+type DatadogOptions struct {
+	Site    string   `yaml:"site,omitempty"`    // e.g. datadoghq.com, datadoghq.eu, us3.datadoghq.com
+	Source  string   `yaml:"source,omitempty"`  // ddsource; default spyderbat
+	Service string   `yaml:"service,omitempty"` // default is the record's schema, e.g. model_process
+	Tags    []string `yaml:"tags,omitempty"`    // added to every log's ddtags, e.g. env:prod
+}
+
+// applyDatadogPreset fills in the settings for the Datadog Logs intake, leaving anything the
+// user set explicitly alone.
+func applyDatadogPreset(w *Webhook) {
+	if w.Datadog == nil {
+		w.Datadog = &DatadogOptions{}
+	}
+	w.Datadog.Site = strings.ToLower(w.Datadog.Site)
+	if w.Datadog.Site == "" {
+		w.Datadog.Site = defaultDatadogSite
+	}
+	if w.Datadog.Source == "" {
+		w.Datadog.Source = defaultDatadogSrc
+	}
+	if w.Endpoint == "" {
+		w.Endpoint = "https://http-intake.logs." + w.Datadog.Site + "/api/v2/logs"
+	}
+	if w.CompressionAlgo == "" {
+		w.CompressionAlgo = "gzip"
+	}
+	if w.MaxPayloadBytes == 0 {
+		w.MaxPayloadBytes = datadogPayloadBytes
+	}
+	if w.Authentication.Method == "" {
+		w.Authentication.Method = "shared_secret"
+	}
+	if w.Authentication.Parameters.HeaderName == "" {
+		w.Authentication.Parameters.HeaderName = datadogAPIKeyHeader
+	}
+	// the intake takes a JSON array of logs
+	w.jsonArray = true
+	w.maxRecords = datadogMaxRecords
+	w.maxRecordBytes = datadogRecordBytes
+}
+
+// validateDatadogPreset rejects settings that the Datadog Logs intake does not accept.
+func validateDatadogPreset(w *Webhook) error {
+	if w.MaxPayloadBytes > datadogPayloadBytes {
+		return fmt.Errorf("webhook.max_payload_bytes cannot be greater than %d for datadog", datadogPayloadBytes)
+	}
+	if w.CompressionAlgo == "zstd" {
+		return fmt.Errorf("datadog does not support zstd compression; set webhook.compression_algo to gzip or none")
+	}
+	if w.Authentication.Method != "shared_secret" || !strings.EqualFold(w.Authentication.Parameters.HeaderName, datadogAPIKeyHeader) {
+		return fmt.Errorf("datadog requires an api key; set webhook.authentication.parameters.secret")
+	}
+	for _, tag := range w.Datadog.Tags {
+		if tag == "" || strings.Contains(tag, ",") {
+			return fmt.Errorf("invalid webhook.datadog tag '%s'", tag)
+		}
+	}
+	return nil
+}
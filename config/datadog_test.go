@@ -0,0 +1,67 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatadogPresetDefaults(t *testing.T) {
+	w := &Webhook{
+		Preset: "Datadog",
+		Authentication: WebhookAuthentication{
+			Parameters: AuthenticationParameters{Secret: "api-key"},
+		},
+	}
+	require.NoError(t, ValidateWebhook(w))
+
+	assert.Equal(t, "https://http-intake.logs.datadoghq.com/api/v2/logs", w.Endpoint)
+	assert.Equal(t, "gzip", w.CompressionAlgo)
+	assert.Equal(t, datadogPayloadBytes, w.MaxPayloadBytes)
+	assert.Equal(t, datadogMaxRecords, w.MaxRecords())
+	assert.Equal(t, datadogRecordBytes, w.MaxRecordBytes())
+	assert.True(t, w.JSONArray())
+	assert.Equal(t, "shared_secret", w.Authentication.Method)
+	assert.Equal(t, "DD-API-KEY", w.Authentication.Parameters.HeaderName)
+	assert.Equal(t, []byte("api-key"), w.Authentication.Parameters.GetSecretKey())
+	require.NotNil(t, w.Datadog)
+	assert.Equal(t, "spyderbat", w.Datadog.Source)
+
+	w = &Webhook{
+		Preset:  "datadog",
+		Datadog: &DatadogOptions{Site: "datadoghq.eu"},
+		Authentication: WebhookAuthentication{
+			Parameters: AuthenticationParameters{Secret: "api-key"},
+		},
+	}
+	require.NoError(t, ValidateWebhook(w))
+	assert.Equal(t, "https://http-intake.logs.datadoghq.eu/api/v2/logs", w.Endpoint)
+}
+
+func TestDatadogPresetValidation(t *testing.T) {
+	key := WebhookAuthentication{Parameters: AuthenticationParameters{Secret: "api-key"}}
+	tests := []struct {
+		name    string
+		webhook Webhook
+		err     string
+	}{
+		{"missing key", Webhook{Preset: "datadog"}, "secret_key is required"},
+		{"bearer", Webhook{Preset: "datadog", Authentication: WebhookAuthentication{Method: "bearer", Parameters: key.Parameters}}, "requires an api key"},
+		{"too large", Webhook{Preset: "datadog", Authentication: key, MaxPayloadBytes: datadogPayloadBytes + 1}, "cannot be greater"},
+		{"zstd", Webhook{Preset: "datadog", Authentication: key, CompressionAlgo: "zstd"}, "zstd"},
+		{"bad tag", Webhook{Preset: "datadog", Authentication: key, Datadog: &DatadogOptions{Tags: []string{"a:1,b:2"}}}, "invalid webhook.datadog tag"},
+		{"wrong preset", Webhook{Endpoint: "https://example.com", Datadog: &DatadogOptions{}}, "only supported with the datadog preset"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateWebhook(&tt.webhook)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
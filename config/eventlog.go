@@ -0,0 +1,290 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"spyderbat-event-forwarder/encryption"
+	"spyderbat-event-forwarder/hashchain"
+)
+
+const (
+	defaultEventLogFilename   = "spyderbat_events.log"
+	defaultEventLogMaxSizeMB  = 10
+	defaultEventLogMaxBackups = 5
+	defaultCheckpointInterval = time.Minute
+)
+
+// EventLogRotations are the supported time-based rotation intervals.
+var EventLogRotations = []string{"hourly", "daily"}
+
+// EventLog configures the local event log file, which is rotated when it reaches max_size_mb
+// and, optionally, at the start of every hour or day. The file output is enabled by default;
+// it can be disabled for deployments that only use stdout or remote outputs.
+//
+// Routes write records to other files by schema prefix, each with its own rotation settings.
+// A record is written to the first route that matches it, or to this file if none do.
+type EventLog struct {
+	Enabled    *bool               `yaml:"enabled,omitempty"`      // default true
+	Filename   string              `yaml:"filename,omitempty"`     // relative to log_path; default spyderbat_events.log
+	MaxSizeMB  int                 `yaml:"max_size_mb,omitempty"`  // default 10
+	MaxAgeDays int                 `yaml:"max_age_days,omitempty"` // rotated files older than this are deleted; default 0 (kept)
+	MaxBackups *int                `yaml:"max_backups,omitempty"`  // rotated files to keep; default 5, 0 to keep all
+	Compress   bool                `yaml:"compress"`               // gzip rotated files
+	FileMode   string              `yaml:"file_mode,omitempty"`    // octal, e.g. "0640"; default 0600 for new files
+	Rotate     string              `yaml:"rotate,omitempty"`       // hourly or daily; default size only
+	LocalTime  bool                `yaml:"local_time"`             // local time for rotation and backup names; default UTC
+	Routes     []*EventLogRoute    `yaml:"routes,omitempty"`
+	Integrity  *EventLogIntegrity  `yaml:"integrity,omitempty"`  // for every file, including the routes
+	Encryption *EventLogEncryption `yaml:"encryption,omitempty"` // for every file, including the routes
+	path       string
+	mode       os.FileMode
+}
+
+// EventLogIntegrity configures a tamper-evident SHA-256 hash chain over the lines of the event
+// log files. The chain is signed in a checkpoint whenever a file is rotated, and every
+// checkpoint_interval for the current file. The verify subcommand checks the files against
+// their checkpoints.
+type EventLogIntegrity struct {
+	SigningKey         string        `yaml:"signing_key"`                   // PEM encoded PKCS #8 ed25519 private key
+	CheckpointInterval time.Duration `yaml:"checkpoint_interval,omitempty"` // default 1m
+	key                ed25519.PrivateKey
+}
+
+// Key returns the key that checkpoints are signed with.
+func (i *EventLogIntegrity) Key() ed25519.PrivateKey {
+	return i.key
+}
+
+// EventLogEncryptionTypes are the supported ways of protecting the data keys of encrypted files.
+var EventLogEncryptionTypes = []string{encryption.ModeAge, encryption.ModeKeyFile, encryption.ModeKMS}
+
+// EventLogEncryption configures encrypting the event log files at rest. Each file has its own
+// data key, which is encrypted to age recipients, encrypted with a key from a file, or generated
+// by AWS KMS. The decrypt subcommand reads the files back.
+type EventLogEncryption struct {
+	Type       string   `yaml:"type"`                 // age, key_file or kms
+	Recipients []string `yaml:"recipients,omitempty"` // age: age1... public keys
+	KeyFile    string   `yaml:"key_file,omitempty"`   // key_file: 32 bytes in hex or base64
+	KMSKeyID   string   `yaml:"kms_key_id,omitempty"` // kms: key ID, ARN or alias
+	Region     string   `yaml:"region,omitempty"`     // kms: default from the AWS environment
+	Profile    string   `yaml:"profile,omitempty"`
+	RoleARN    string   `yaml:"role_arn,omitempty"`
+	ExternalID string   `yaml:"external_id,omitempty"`
+	wrapper    encryption.KeyWrapper
+	unwrapper  encryption.KeyUnwrapper
+}
+
+// Wrapper returns the source of data keys for new files.
+func (e *EventLogEncryption) Wrapper() encryption.KeyWrapper {
+	return e.wrapper
+}
+
+// Unwrapper returns what recovers the data keys of files, or nil for age, whose identities
+// are not in the config.
+func (e *EventLogEncryption) Unwrapper() encryption.KeyUnwrapper {
+	return e.unwrapper
+}
+
+// EventLogRoute is a file for the records whose schema starts with one of the prefixes, e.g.
+// model_spydertrace or event_redflag. Its rotation settings have the same defaults as the
+// event log's, and a disabled route drops the records it matches.
+type EventLogRoute struct {
+	Schemas  []string `yaml:"schemas"`
+	EventLog `yaml:",inline"`
+}
+
+// Match returns whether the route is for records with the given schema.
+func (r *EventLogRoute) Match(schema string) bool {
+	for _, prefix := range r.Schemas {
+		if strings.HasPrefix(schema, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsEnabled returns whether events are written to the file.
+func (e *EventLog) IsEnabled() bool {
+	return e.Enabled == nil || *e.Enabled
+}
+
+// Path returns the path of the current file.
+func (e *EventLog) Path() string {
+	return e.path
+}
+
+// Mode returns the configured permissions of the file, or 0 if file_mode is not set.
+func (e *EventLog) Mode() os.FileMode {
+	return e.mode
+}
+
+// ValidateEventLog validates the event_log config. logPath is the validated log_path.
+func ValidateEventLog(e *EventLog, logPath string) error {
+	if e == nil {
+		return nil
+	}
+
+	if e.Filename == "" {
+		e.Filename = defaultEventLogFilename
+	}
+	if err := validateEventLogFile(e, logPath, "event_log"); err != nil {
+		return err
+	}
+
+	paths := map[string]bool{e.path: true}
+	for i, r := range e.Routes {
+		key := fmt.Sprintf("event_log.routes[%d]", i)
+		if r == nil || len(r.Schemas) == 0 {
+			return fmt.Errorf("%s.schemas is required", key)
+		}
+		for _, prefix := range r.Schemas {
+			if prefix == "" {
+				return fmt.Errorf("%s.schemas cannot contain an empty prefix", key)
+			}
+		}
+		if len(r.Routes) > 0 {
+			return fmt.Errorf("%s cannot have routes", key)
+		}
+		if r.Integrity != nil || r.Encryption != nil {
+			return fmt.Errorf("%s cannot have integrity or encryption; set them in event_log for every file", key)
+		}
+		if r.Filename == "" {
+			return fmt.Errorf("%s.filename is required", key)
+		}
+		if err := validateEventLogFile(&r.EventLog, logPath, key); err != nil {
+			return err
+		}
+		if paths[r.path] {
+			return fmt.Errorf("%s.filename is already used by another file", key)
+		}
+		paths[r.path] = true
+	}
+	if err := validateEventLogIntegrity(e.Integrity); err != nil {
+		return err
+	}
+	return validateEventLogEncryption(e.Encryption)
+}
+
+func validateEventLogIntegrity(i *EventLogIntegrity) error {
+	if i == nil {
+		return nil
+	}
+
+	if i.SigningKey == "" {
+		return fmt.Errorf("event_log.integrity.signing_key is required")
+	}
+	key, err := hashchain.LoadPrivateKey(i.SigningKey)
+	if err != nil {
+		return fmt.Errorf("failed to load event_log.integrity.signing_key: %w", err)
+	}
+	i.key = key
+
+	if i.CheckpointInterval == 0 {
+		i.CheckpointInterval = defaultCheckpointInterval
+	}
+	if i.CheckpointInterval < time.Second {
+		return fmt.Errorf("event_log.integrity.checkpoint_interval must be at least 1s")
+	}
+	return nil
+}
+
+// validateEventLogFile validates the settings for one file. key is the config key, for errors.
+func validateEventLogFile(e *EventLog, logPath, key string) error {
+	e.path = e.Filename
+	if !filepath.IsAbs(e.path) {
+		e.path = filepath.Join(logPath, e.path)
+	}
+
+	if e.MaxSizeMB == 0 {
+		e.MaxSizeMB = defaultEventLogMaxSizeMB
+	}
+	if e.MaxSizeMB < 0 {
+		return fmt.Errorf("%s.max_size_mb cannot be negative", key)
+	}
+	if e.MaxAgeDays < 0 {
+		return fmt.Errorf("%s.max_age_days cannot be negative", key)
+	}
+	if e.MaxBackups == nil {
+		n := defaultEventLogMaxBackups
+		e.MaxBackups = &n
+	}
+	if *e.MaxBackups < 0 {
+		return fmt.Errorf("%s.max_backups cannot be negative", key)
+	}
+
+	if e.FileMode != "" {
+		mode, err := strconv.ParseUint(e.FileMode, 8, 32)
+		if err != nil || mode == 0 || mode > 0o777 {
+			return fmt.Errorf("%s.file_mode must be octal permissions, e.g. 0640", key)
+		}
+		e.mode = os.FileMode(mode)
+	}
+
+	e.Rotate = strings.ToLower(e.Rotate)
+	if e.Rotate != "" {
+		found := false
+		for _, r := range EventLogRotations {
+			found = found || e.Rotate == r
+		}
+		if !found {
+			return fmt.Errorf("%s.rotate must be one of %s", key, strings.Join(EventLogRotations, ", "))
+		}
+	}
+	return nil
+}
+
+func validateEventLogEncryption(e *EventLogEncryption) error {
+	if e == nil {
+		return nil
+	}
+
+	e.Type = strings.ToLower(e.Type)
+	switch e.Type {
+	case encryption.ModeAge:
+		if len(e.Recipients) == 0 {
+			return fmt.Errorf("event_log.encryption.recipients is required for age")
+		}
+		recipients, err := encryption.ParseRecipients(e.Recipients)
+		if err != nil {
+			return fmt.Errorf("failed to parse event_log.encryption.recipients: %w", err)
+		}
+		e.wrapper = encryption.NewAgeWrapper(recipients)
+	case encryption.ModeKeyFile:
+		if e.KeyFile == "" {
+			return fmt.Errorf("event_log.encryption.key_file is required for key_file")
+		}
+		kek, err := encryption.LoadKeyFile(e.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load event_log.encryption.key_file: %w", err)
+		}
+		keys, err := encryption.NewFileKey(kek)
+		if err != nil {
+			return err
+		}
+		e.wrapper, e.unwrapper = keys, keys
+	case encryption.ModeKMS:
+		if e.KMSKeyID == "" {
+			return fmt.Errorf("event_log.encryption.kms_key_id is required for kms")
+		}
+		cfg, err := loadAWSConfig("event_log.encryption", e.Region, e.Profile, e.RoleARN, e.ExternalID)
+		if err != nil {
+			return err
+		}
+		e.Region = cfg.Region
+		keys := encryption.NewKMS(cfg, e.KMSKeyID)
+		e.wrapper, e.unwrapper = keys, keys
+	default:
+		return fmt.Errorf("event_log.encryption.type must be one of %s", strings.Join(EventLogEncryptionTypes, ", "))
+	}
+	return nil
+}
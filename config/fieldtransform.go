@@ -0,0 +1,105 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// FieldTransformTypes are the types that fields can be coerced to.
+var FieldTransformTypes = []string{"string", "number", "integer", "boolean"}
+
+// FieldTransform reshapes the records sent to some outputs, for destinations that reject
+// nested objects, dotted keys or Unix timestamps. Records are changed in the order of the
+// fields: timestamps, coerce, rename and flatten, after the transform and any redaction.
+// Paths are field names separated by dots, as for redaction rules.
+type FieldTransform struct {
+	Outputs    []string          `yaml:"outputs"`              // names of the outputs, as for redaction
+	Timestamps []string          `yaml:"timestamps,omitempty"` // Unix time fields to convert to RFC 3339 strings
+	Coerce     map[string]string `yaml:"coerce,omitempty"`     // field paths to string, number, integer or boolean
+	Rename     map[string]string `yaml:"rename,omitempty"`     // field paths to the paths to move them to
+	Flatten    string            `yaml:"flatten,omitempty"`    // separator for flattening nested objects: _ or .
+}
+
+// ValidateFieldTransforms validates the field transforms. Each output can have at most one.
+func ValidateFieldTransforms(transforms []*FieldTransform) error {
+	seen := make(map[string]bool)
+	for i, t := range transforms {
+		key := fmt.Sprintf("field_transforms[%d]", i)
+		if t == nil || len(t.Outputs) == 0 {
+			return fmt.Errorf("%s.outputs is required", key)
+		}
+		for j, o := range t.Outputs {
+			o = strings.ToLower(o)
+			t.Outputs[j] = o
+			if !slices.Contains(RedactionOutputs, o) {
+				return fmt.Errorf("%s.outputs: unknown output '%s'; must be one of %s", key, o, strings.Join(RedactionOutputs, ", "))
+			}
+			if seen[o] {
+				return fmt.Errorf("%s.outputs: %s has more than one field transform", key, o)
+			}
+			seen[o] = true
+		}
+		if len(t.Timestamps) == 0 && len(t.Coerce) == 0 && len(t.Rename) == 0 && t.Flatten == "" {
+			return fmt.Errorf("%s must have timestamps, coerce, rename or flatten", key)
+		}
+
+		for j, path := range t.Timestamps {
+			if err := validateFieldPath(path, fmt.Sprintf("%s.timestamps[%d]", key, j)); err != nil {
+				return err
+			}
+		}
+		for path, typ := range t.Coerce {
+			if err := validateFieldPath(path, key+".coerce"); err != nil {
+				return err
+			}
+			typ = strings.ToLower(typ)
+			if !slices.Contains(FieldTransformTypes, typ) {
+				return fmt.Errorf("%s.coerce.%s must be one of %s", key, path, strings.Join(FieldTransformTypes, ", "))
+			}
+			t.Coerce[path] = typ
+		}
+		targets := make(map[string]bool)
+		for from, to := range t.Rename {
+			if err := validateFieldPath(from, key+".rename"); err != nil {
+				return err
+			}
+			if err := validateFieldPath(to, fmt.Sprintf("%s.rename.%s", key, from)); err != nil {
+				return err
+			}
+			if strings.Contains(from, "*") || strings.Contains(to, "*") {
+				return fmt.Errorf("%s.rename.%s cannot have wildcards", key, from)
+			}
+			if targets[to] {
+				return fmt.Errorf("%s.rename: more than one field is renamed to %s", key, to)
+			}
+			targets[to] = true
+		}
+		// a field can't be moved into itself, and renames into a field that is itself renamed
+		// would depend on the order they are applied in
+		for from := range t.Rename {
+			for otherFrom, to := range t.Rename {
+				if to != from && !strings.HasPrefix(to, from+".") {
+					continue
+				}
+				switch {
+				case otherFrom == from:
+					return fmt.Errorf("%s.rename.%s cannot be renamed into itself", key, from)
+				case to == from:
+					return fmt.Errorf("%s.rename.%s: %s is also renamed", key, otherFrom, to)
+				}
+				return fmt.Errorf("%s.rename.%s: %s is in %s, which is also renamed", key, otherFrom, to, from)
+			}
+		}
+		switch t.Flatten {
+		case "", "_", ".":
+		default:
+			return fmt.Errorf("%s.flatten must be _ or .", key)
+		}
+	}
+	return nil
+}
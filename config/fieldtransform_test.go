@@ -0,0 +1,59 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestFieldTransforms(t *testing.T) {
+	var transforms []*FieldTransform
+	require.NoError(t, yaml.Unmarshal([]byte(`
+- outputs: [ Loki ]
+  timestamps: [ time, valid_from, valid_to, model_version ]
+  coerce:
+    pid: Integer
+  rename:
+    runtime_details.hostname: host
+  flatten: _
+`), &transforms))
+	require.NoError(t, ValidateFieldTransforms(transforms))
+	assert.Equal(t, []string{"loki"}, transforms[0].Outputs)
+	assert.Equal(t, "integer", transforms[0].Coerce["pid"])
+
+	tests := []struct {
+		name       string
+		transforms []*FieldTransform
+		err        string
+	}{
+		{"no outputs", []*FieldTransform{{Flatten: "_"}}, "field_transforms[0].outputs is required"},
+		{"unknown output", []*FieldTransform{{Outputs: []string{"kafka"}, Flatten: "_"}}, "unknown output 'kafka'"},
+		{"output twice", []*FieldTransform{
+			{Outputs: []string{"loki"}, Flatten: "_"},
+			{Outputs: []string{"loki"}, Flatten: "."},
+		}, "field_transforms[1].outputs: loki has more than one field transform"},
+		{"nothing to do", []*FieldTransform{{Outputs: []string{"loki"}}}, "must have timestamps, coerce, rename or flatten"},
+		{"empty timestamp", []*FieldTransform{{Outputs: []string{"loki"}, Timestamps: []string{"time", ""}}}, "field_transforms[0].timestamps[1] is required"},
+		{"unknown type", []*FieldTransform{{Outputs: []string{"loki"}, Coerce: map[string]string{"pid": "int64"}}}, "field_transforms[0].coerce.pid must be one of"},
+		{"rename wildcard", []*FieldTransform{{Outputs: []string{"loki"}, Rename: map[string]string{"runtime_details.*": "rd"}}}, "cannot have wildcards"},
+		{"rename to same field", []*FieldTransform{{Outputs: []string{"loki"}, Rename: map[string]string{"a": "c", "b": "c"}}}, "more than one field is renamed to c"},
+		{"rename to itself", []*FieldTransform{{Outputs: []string{"loki"}, Rename: map[string]string{"a": "a"}}}, "rename.a cannot be renamed into itself"},
+		{"rename into itself", []*FieldTransform{{Outputs: []string{"loki"}, Rename: map[string]string{"runtime_details": "runtime_details.original"}}}, "rename.runtime_details cannot be renamed into itself"},
+		{"rename into renamed field", []*FieldTransform{{Outputs: []string{"loki"}, Rename: map[string]string{"a": "x", "b": "a.y"}}}, "rename.b: a.y is in a, which is also renamed"},
+		{"rename chain", []*FieldTransform{{Outputs: []string{"loki"}, Rename: map[string]string{"a": "b", "b": "c"}}}, "rename.a: b is also renamed"},
+		{"bad separator", []*FieldTransform{{Outputs: []string{"loki"}, Flatten: "-"}}, "flatten must be _ or ."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateFieldTransforms(tt.transforms)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"spyderbat-event-forwarder/format"
+)
+
+// Format selects how records are rendered for an output. A nil Format writes records as JSON.
+type Format struct {
+	Type           string            `yaml:"type"`                      // json, cef or leef
+	Fields         map[string]string `yaml:"fields,omitempty"`          // output key -> record field path (e.g. runtime_details.hostname)
+	Labels         map[string]string `yaml:"labels,omitempty"`          // labels for custom cef fields (e.g. cs3Label)
+	SignatureField string            `yaml:"signature_field,omitempty"` // default schema
+	NameField      string            `yaml:"name_field,omitempty"`      // cef only
+	SeverityField  string            `yaml:"severity_field,omitempty"`  // default severity
+	formatter      format.Formatter
+}
+
+// Formatter returns the formatter for the output, or nil if records should be written as-is.
+// It is safe to call on a nil Format.
+func (f *Format) Formatter() format.Formatter {
+	if f == nil {
+		return nil
+	}
+	return f.formatter
+}
+
+// ValidateFormat validates a format and prepares its formatter. key is the config key of the
+// format, for error messages.
+func ValidateFormat(f *Format, key string) error {
+	if f == nil {
+		return nil
+	}
+	f.Type = strings.ToLower(f.Type)
+	formatter, err := format.New(format.Options{
+		Type:           f.Type,
+		Fields:         f.Fields,
+		Labels:         f.Labels,
+		SignatureField: f.SignatureField,
+		NameField:      f.NameField,
+		SeverityField:  f.SeverityField,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to validate config key '%s': %w", key, err)
+	}
+	f.formatter = formatter
+	return nil
+}
+
+// Text reports whether records are rendered as lines of text, such as CEF, rather than JSON.
+// The type is matched case-insensitively and an empty type is JSON. It is safe to call on a
+// nil Format.
+func (f *Format) Text() bool {
+	if f == nil {
+		return false
+	}
+	t := strings.ToLower(f.Type)
+	return t != "" && t != "json"
+}
@@ -0,0 +1,43 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateFormat(t *testing.T) {
+	require.NoError(t, ValidateFormat(nil, "file_format"))
+	assert.Nil(t, (*Format)(nil).Formatter())
+
+	f := &Format{Type: "JSON"}
+	require.NoError(t, ValidateFormat(f, "file_format"))
+	assert.Nil(t, f.Formatter())
+
+	f = &Format{Type: "CEF"}
+	require.NoError(t, ValidateFormat(f, "syslog_format"))
+	assert.Equal(t, "cef", f.Type)
+	assert.NotNil(t, f.Formatter())
+
+	f = &Format{Type: "kittens"}
+	assert.Error(t, ValidateFormat(f, "stdout_format"))
+}
+
+func TestPantherPresetFormat(t *testing.T) {
+	w := &Webhook{
+		Preset:   "panther",
+		Endpoint: "https://example.com",
+		Format:   &Format{Type: "leef"},
+		Authentication: WebhookAuthentication{
+			Parameters: AuthenticationParameters{
+				Secret: "test-secret",
+			},
+		},
+	}
+	assert.Error(t, ValidateWebhook(w))
+}
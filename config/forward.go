@@ -0,0 +1,99 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	defaultForwardPort         = "24224"
+	defaultForwardTag          = "spyderbat.{schema}"
+	defaultForwardPayloadBytes = 1024 * 1024 * 1 // 1MB
+	maxForwardPayloadBytes     = 1024 * 1024 * 8 // fluentd's default chunk_limit_size
+)
+
+var forwardPlaceholder = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// Forward configures delivery to Fluentd or Fluent Bit over the Forward protocol. Records are
+// sent in PackedForward mode, batched by tag.
+type Forward struct {
+	Address         string  `yaml:"address"`              // host or host:port; the default port is 24224
+	Tag             string  `yaml:"tag,omitempty"`        // may include {schema}; default spyderbat.{schema}
+	TLS             bool    `yaml:"tls"`                  // connect with TLS
+	Insecure        bool    `yaml:"insecure"`             // skip certificate validation
+	SharedKey       string  `yaml:"shared_key,omitempty"` // for the security handshake
+	SelfHostname    string  `yaml:"self_hostname,omitempty"`
+	Username        string  `yaml:"username,omitempty"` // user authentication, with shared_key
+	Password        string  `yaml:"password,omitempty"`
+	RequireAck      *bool   `yaml:"require_ack,omitempty"` // wait for the server to acknowledge each chunk; default true
+	MaxPayloadBytes int     `yaml:"max_payload_bytes"`
+	Format          *Format `yaml:"format,omitempty"` // if set, records are sent as {"message": formatted}
+}
+
+// AckRequired reports whether each chunk must be acknowledged by the server.
+func (f *Forward) AckRequired() bool {
+	return f.RequireAck == nil || *f.RequireAck
+}
+
+// TagFor returns the tag for a record of the given schema family.
+func (f *Forward) TagFor(schema string) string {
+	return strings.ReplaceAll(f.Tag, "{schema}", schema)
+}
+
+func ValidateForward(f *Forward) error {
+	if f == nil {
+		return nil
+	}
+
+	if f.Address == "" {
+		return fmt.Errorf("forward.address is required")
+	}
+	if _, _, err := net.SplitHostPort(f.Address); err != nil {
+		f.Address = net.JoinHostPort(f.Address, defaultForwardPort)
+	}
+	if _, _, err := net.SplitHostPort(f.Address); err != nil {
+		return fmt.Errorf("invalid forward.address: %w", err)
+	}
+
+	if f.Tag == "" {
+		f.Tag = defaultForwardTag
+	}
+	for _, m := range forwardPlaceholder.FindAllStringSubmatch(f.Tag, -1) {
+		if m[1] != "schema" {
+			return fmt.Errorf("unsupported placeholder '%s' in forward.tag; only {schema} is supported", m[0])
+		}
+	}
+
+	if f.Username != "" && f.SharedKey == "" {
+		return fmt.Errorf("forward.shared_key is required for user authentication")
+	}
+	if (f.Username == "") != (f.Password == "") {
+		return fmt.Errorf("forward.username and forward.password must be set together")
+	}
+	if f.SelfHostname == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("forward.self_hostname is required: %w", err)
+		}
+		f.SelfHostname = hostname
+	}
+
+	if f.MaxPayloadBytes == 0 {
+		f.MaxPayloadBytes = defaultForwardPayloadBytes
+	}
+	if f.MaxPayloadBytes > maxForwardPayloadBytes {
+		return fmt.Errorf("forward.max_payload_bytes cannot be greater than %d", maxForwardPayloadBytes)
+	}
+	if f.MaxPayloadBytes < minWebhookPayloadBytes {
+		return fmt.Errorf("forward.max_payload_bytes cannot be less than %d", minWebhookPayloadBytes)
+	}
+
+	return ValidateFormat(f.Format, "forward.format")
+}
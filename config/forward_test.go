@@ -0,0 +1,50 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForwardDefaults(t *testing.T) {
+	f := &Forward{Address: "fluentd.logging"}
+	require.NoError(t, ValidateForward(f))
+
+	assert.Equal(t, "fluentd.logging:24224", f.Address)
+	assert.Equal(t, "spyderbat.{schema}", f.Tag)
+	assert.Equal(t, "spyderbat.model_process", f.TagFor("model_process"))
+	assert.True(t, f.AckRequired())
+	assert.NotEmpty(t, f.SelfHostname)
+	assert.Equal(t, defaultForwardPayloadBytes, f.MaxPayloadBytes)
+
+	f = &Forward{Address: "[::1]:24225", Tag: "security"}
+	require.NoError(t, ValidateForward(f))
+	assert.Equal(t, "[::1]:24225", f.Address)
+	assert.Equal(t, "security", f.TagFor("model_process"))
+}
+
+func TestForwardValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		forward Forward
+		err     string
+	}{
+		{"missing address", Forward{}, "forward.address is required"},
+		{"bad placeholder", Forward{Address: "fluentd", Tag: "spyderbat.{hostname}"}, "unsupported placeholder '{hostname}'"},
+		{"user without key", Forward{Address: "fluentd", Username: "u", Password: "p"}, "forward.shared_key is required"},
+		{"user without password", Forward{Address: "fluentd", SharedKey: "k", Username: "u"}, "must be set together"},
+		{"too large", Forward{Address: "fluentd", MaxPayloadBytes: maxForwardPayloadBytes + 1}, "cannot be greater"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateForward(&tt.forward)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
@@ -0,0 +1,115 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	defaultLokiPayloadBytes = 1024 * 1024 * 1 // 1MB
+	maxLokiPayloadBytes     = 1024 * 1024 * 4 // Loki's default grpc_server_max_recv_msg_size
+)
+
+// LokiLabels are the record-derived labels that may be attached to Loki streams.
+var LokiLabels = []string{"schema", "hostname", "severity"}
+
+var lokiLabelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+type Loki struct {
+	Endpoint        string                `yaml:"endpoint_url"`
+	Insecure        bool                  `yaml:"insecure"`
+	TenantID        string                `yaml:"tenant_id,omitempty"`     // sent as X-Scope-OrgID
+	Labels          []string              `yaml:"labels,omitempty"`        // subset of LokiLabels
+	StaticLabels    map[string]string     `yaml:"static_labels,omitempty"` // added to every stream
+	PushFormat      string                `yaml:"push_format,omitempty"`   // protobuf or json
+	OutOfOrder      string                `yaml:"out_of_order,omitempty"`  // sort, drop or accept
+	MaxPayloadBytes int                   `yaml:"max_payload_bytes"`
+	Authentication  WebhookAuthentication `yaml:"authentication,omitempty"`
+	Format          *Format               `yaml:"format,omitempty"` // format of each log line
+}
+
+func ValidateLoki(l *Loki) error {
+	if l == nil {
+		return nil
+	}
+
+	if l.Endpoint == "" {
+		return fmt.Errorf("loki.endpoint_url is required")
+	}
+	u, err := url.Parse(l.Endpoint)
+	if err != nil {
+		return fmt.Errorf("failed to parse loki.endpoint_url: %w", err)
+	}
+	// loki is commonly reached over a cluster-internal network, so plain http is allowed
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return fmt.Errorf("loki.endpoint_url must use http or https scheme")
+	}
+	if u.Host == "" {
+		return fmt.Errorf("loki.endpoint_url must include a hostname")
+	}
+
+	if l.MaxPayloadBytes == 0 {
+		l.MaxPayloadBytes = defaultLokiPayloadBytes
+	}
+	if l.MaxPayloadBytes > maxLokiPayloadBytes {
+		return fmt.Errorf("loki.max_payload_bytes cannot be greater than %d", maxLokiPayloadBytes)
+	}
+	if l.MaxPayloadBytes < minWebhookPayloadBytes {
+		return fmt.Errorf("loki.max_payload_bytes cannot be less than %d", minWebhookPayloadBytes)
+	}
+
+	if l.Labels == nil {
+		l.Labels = []string{"schema", "hostname"}
+	}
+	for i, label := range l.Labels {
+		l.Labels[i] = strings.ToLower(label)
+		found := false
+		for _, known := range LokiLabels {
+			found = found || l.Labels[i] == known
+		}
+		if !found {
+			return fmt.Errorf("unsupported loki label '%s'; must be one of %s", label, strings.Join(LokiLabels, ", "))
+		}
+	}
+	if l.StaticLabels == nil {
+		l.StaticLabels = map[string]string{"job": "spyderbat"}
+	}
+	for name := range l.StaticLabels {
+		if !lokiLabelName.MatchString(name) {
+			return fmt.Errorf("invalid loki static label name '%s'", name)
+		}
+	}
+
+	l.PushFormat = strings.ToLower(l.PushFormat)
+	switch l.PushFormat {
+	case "":
+		l.PushFormat = "protobuf"
+	case "protobuf", "json":
+	default:
+		return fmt.Errorf("unsupported loki.push_format '%s'", l.PushFormat)
+	}
+
+	l.OutOfOrder = strings.ToLower(l.OutOfOrder)
+	switch l.OutOfOrder {
+	case "":
+		l.OutOfOrder = "sort"
+	case "sort", "drop", "accept":
+	default:
+		return fmt.Errorf("unsupported loki.out_of_order '%s'", l.OutOfOrder)
+	}
+
+	if err := ValidateAuthentication(&l.Authentication, "loki.authentication"); err != nil {
+		return err
+	}
+	if l.Authentication.Method == "hmac" {
+		return fmt.Errorf("loki does not support hmac authentication")
+	}
+
+	return ValidateFormat(l.Format, "loki.format")
+}
@@ -0,0 +1,53 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLokiDefaults(t *testing.T) {
+	l := &Loki{Endpoint: "http://loki:3100/loki/api/v1/push"}
+	require.NoError(t, ValidateLoki(l))
+
+	assert.Equal(t, defaultLokiPayloadBytes, l.MaxPayloadBytes)
+	assert.Equal(t, []string{"schema", "hostname"}, l.Labels)
+	assert.Equal(t, map[string]string{"job": "spyderbat"}, l.StaticLabels)
+	assert.Equal(t, "protobuf", l.PushFormat)
+	assert.Equal(t, "sort", l.OutOfOrder)
+}
+
+func TestLokiValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		loki Loki
+		err  string
+	}{
+		{"missing endpoint", Loki{}, "loki.endpoint_url is required"},
+		{"bad scheme", Loki{Endpoint: "ftp://loki"}, "http or https"},
+		{"too large", Loki{Endpoint: "http://loki", MaxPayloadBytes: maxLokiPayloadBytes + 1}, "cannot be greater"},
+		{"unknown label", Loki{Endpoint: "http://loki", Labels: []string{"muid"}}, "unsupported loki label"},
+		{"bad static label", Loki{Endpoint: "http://loki", StaticLabels: map[string]string{"a-b": "c"}}, "invalid loki static label"},
+		{"push format", Loki{Endpoint: "http://loki", PushFormat: "xml"}, "unsupported loki.push_format"},
+		{"out of order", Loki{Endpoint: "http://loki", OutOfOrder: "reject"}, "unsupported loki.out_of_order"},
+		{"hmac", Loki{Endpoint: "http://loki", Authentication: WebhookAuthentication{
+			Method:     "hmac",
+			Parameters: AuthenticationParameters{Secret: "s", HeaderName: "X-Sig", HashAlgorithm: "sha256"},
+		}}, "does not support hmac"},
+		{"format", Loki{Endpoint: "http://loki", Format: &Format{Type: "xml"}}, "unsupported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateLoki(&tt.loki)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+
+	assert.NoError(t, ValidateLoki(nil))
+}
@@ -0,0 +1,130 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	defaultNATSPort    = "4222"
+	defaultNATSSubject = "spyderbat.{schema}.{muid}"
+)
+
+// KeyPlaceholders are the record fields that may be used in NATS subjects and Redis stream
+// keys, as {schema} or {muid}.
+var KeyPlaceholders = []string{"schema", "muid"}
+
+var keyPlaceholder = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// validateKeyTemplate checks that a subject or key template only uses KeyPlaceholders.
+func validateKeyTemplate(tmpl, key string) error {
+	for _, m := range keyPlaceholder.FindAllStringSubmatch(tmpl, -1) {
+		found := false
+		for _, known := range KeyPlaceholders {
+			found = found || m[1] == known
+		}
+		if !found {
+			return fmt.Errorf("unsupported placeholder '%s' in %s; must be one of {%s}", m[0], key, strings.Join(KeyPlaceholders, "}, {"))
+		}
+	}
+	return nil
+}
+
+// NATS configures publishing to NATS JetStream. Each record is published to a subject derived
+// from its schema and muid, and the stream's acknowledgement is awaited.
+type NATS struct {
+	URL      string  `yaml:"url"`               // nats://host:port or tls://host:port
+	Subject  string  `yaml:"subject,omitempty"` // may include {schema} and {muid}; default spyderbat.{schema}.{muid}
+	Token    string  `yaml:"token,omitempty"`
+	Username string  `yaml:"username,omitempty"`
+	Password string  `yaml:"password,omitempty"`
+	Insecure bool    `yaml:"insecure"` // skip certificate validation
+	Format   *Format `yaml:"format,omitempty"`
+	address  string
+	tls      bool
+}
+
+// Address returns the host:port to connect to.
+func (n *NATS) Address() string {
+	return n.address
+}
+
+// TLS reports whether TLS is required by the URL.
+func (n *NATS) TLS() bool {
+	return n.tls
+}
+
+// SubjectFor returns the subject for a record. Characters that separate or match subject
+// tokens are replaced, and missing values become "unknown".
+func (n *NATS) SubjectFor(schema, muid string) string {
+	token := func(s string) string {
+		if s == "" {
+			return "unknown"
+		}
+		return strings.Map(func(r rune) rune {
+			switch r {
+			case '.', '*', '>', ' ', '\t', '\r', '\n':
+				return '_'
+			}
+			return r
+		}, s)
+	}
+	return strings.NewReplacer("{schema}", token(schema), "{muid}", token(muid)).Replace(n.Subject)
+}
+
+func ValidateNATS(n *NATS) error {
+	if n == nil {
+		return nil
+	}
+
+	if n.URL == "" {
+		return fmt.Errorf("nats.url is required")
+	}
+	u, err := url.Parse(n.URL)
+	if err != nil {
+		return fmt.Errorf("failed to parse nats.url: %w", err)
+	}
+	switch u.Scheme {
+	case "nats":
+	case "tls":
+		n.tls = true
+	default:
+		return fmt.Errorf("nats.url must use nats or tls scheme")
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("nats.url must include a hostname")
+	}
+	n.address = u.Host
+	if u.Port() == "" {
+		n.address = net.JoinHostPort(u.Hostname(), defaultNATSPort)
+	}
+	if u.User != nil && n.Username == "" && n.Token == "" {
+		if password, found := u.User.Password(); found {
+			n.Username, n.Password = u.User.Username(), password
+		} else {
+			n.Token = u.User.Username()
+		}
+	}
+	if n.Token != "" && n.Username != "" {
+		return fmt.Errorf("nats.token and nats.username are mutually exclusive")
+	}
+
+	if n.Subject == "" {
+		n.Subject = defaultNATSSubject
+	}
+	if strings.ContainsAny(n.Subject, "*> \t\r\n") || strings.HasPrefix(n.Subject, ".") || strings.HasSuffix(n.Subject, ".") || strings.Contains(n.Subject, "..") {
+		return fmt.Errorf("invalid nats.subject '%s'", n.Subject)
+	}
+	if err := validateKeyTemplate(n.Subject, "nats.subject"); err != nil {
+		return err
+	}
+
+	return ValidateFormat(n.Format, "nats.format")
+}
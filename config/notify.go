@@ -0,0 +1,172 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	defaultNotifySchema    = "model_spydertrace"
+	defaultNotifyRateLimit = time.Hour
+	defaultNotifySeverity  = "critical"
+	defaultNotifyTitle     = `{{.Name}} (score {{.Score}}) on {{.Hostname}}`
+	defaultNotifyMessage   = "Trigger: {{.Trigger}}\nMachine: {{.MUID}}\n{{.Linkback}}"
+
+	pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+)
+
+// NotifyTypes are the supported notification services.
+var NotifyTypes = []string{"slack", "teams", "pagerduty"}
+
+// pagerDutySeverities are the severities accepted by the PagerDuty Events API v2.
+var pagerDutySeverities = []string{"critical", "error", "warning", "info"}
+
+// Alert is the data that notification templates are rendered with.
+type Alert struct {
+	Schema     string         // e.g. model_spydertrace:1.0.0
+	ID         string         // the record id, e.g. the trace id
+	MUID       string         // the machine id
+	Name       string         // the record name
+	Hostname   string         // from runtime_details
+	Linkback   string         // link to the record in the Spyderbat console
+	Trigger    string         // trigger_short_name, or trigger if there is no short name
+	Score      float64        // 0 if the record has no score
+	Suppressed bool           // true if the record is suppressed
+	Time       time.Time      // the record time
+	Record     map[string]any // the whole record
+}
+
+// NotifyFilter selects the records that are notified. By default, only spydertraces that are
+// not suppressed are notified.
+type NotifyFilter struct {
+	Schemas           []string `yaml:"schemas,omitempty"`   // schema families; default model_spydertrace
+	MinScore          *float64 `yaml:"min_score,omitempty"` // records without a score are skipped if set
+	IncludeSuppressed bool     `yaml:"include_suppressed"`
+}
+
+// Notify configures notifications to Slack, Microsoft Teams or PagerDuty for the few records
+// that need a human's attention, such as high-scoring spydertraces.
+type Notify struct {
+	Type       string        `yaml:"type"`                  // slack, teams or pagerduty
+	URL        string        `yaml:"url,omitempty"`         // incoming webhook url; pagerduty defaults to the Events API v2
+	RoutingKey string        `yaml:"routing_key,omitempty"` // pagerduty integration key
+	Severity   string        `yaml:"severity,omitempty"`    // pagerduty only; default critical
+	Filter     NotifyFilter  `yaml:"filter"`
+	Title      string        `yaml:"title,omitempty"`      // text/template rendered with an Alert
+	Message    string        `yaml:"message,omitempty"`    // text/template rendered with an Alert
+	RateLimit  time.Duration `yaml:"rate_limit,omitempty"` // at most one notification per record id in this interval; default 1h
+	Insecure   bool          `yaml:"insecure"`
+	title      *template.Template
+	message    *template.Template
+}
+
+// Render renders the title and message templates for an alert.
+func (n *Notify) Render(a *Alert) (title, message string, err error) {
+	b := &strings.Builder{}
+	if err := n.title.Execute(b, a); err != nil {
+		return "", "", err
+	}
+	title = b.String()
+	b.Reset()
+	if err := n.message.Execute(b, a); err != nil {
+		return "", "", err
+	}
+	return title, b.String(), nil
+}
+
+func ValidateNotify(n *Notify) error {
+	if n == nil {
+		return nil
+	}
+
+	n.Type = strings.ToLower(n.Type)
+	switch n.Type {
+	case "slack", "teams":
+		if n.URL == "" {
+			return fmt.Errorf("notify.url is required for %s", n.Type)
+		}
+		if n.RoutingKey != "" || n.Severity != "" {
+			return fmt.Errorf("notify.routing_key and notify.severity are only supported for pagerduty")
+		}
+	case "pagerduty":
+		if n.URL == "" {
+			n.URL = pagerDutyEventsURL
+		}
+		if n.RoutingKey == "" {
+			return fmt.Errorf("notify.routing_key is required for pagerduty")
+		}
+		n.Severity = strings.ToLower(n.Severity)
+		if n.Severity == "" {
+			n.Severity = defaultNotifySeverity
+		}
+		if !slices.Contains(pagerDutySeverities, n.Severity) {
+			return fmt.Errorf("notify.severity must be one of %s", strings.Join(pagerDutySeverities, ", "))
+		}
+	case "":
+		return fmt.Errorf("notify.type is required")
+	default:
+		return fmt.Errorf("notify.type must be one of %s", strings.Join(NotifyTypes, ", "))
+	}
+
+	u, err := url.Parse(n.URL)
+	if err != nil {
+		return fmt.Errorf("failed to parse notify.url: %w", err)
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("notify.url must use https scheme")
+	}
+	if u.Host == "" {
+		return fmt.Errorf("notify.url must include a hostname")
+	}
+
+	if len(n.Filter.Schemas) == 0 {
+		n.Filter.Schemas = []string{defaultNotifySchema}
+	}
+	for i, s := range n.Filter.Schemas {
+		// a full schema such as model_spydertrace:1.0.0 selects its family
+		n.Filter.Schemas[i], _, _ = strings.Cut(s, ":")
+	}
+
+	if n.RateLimit == 0 {
+		n.RateLimit = defaultNotifyRateLimit
+	}
+	if n.RateLimit < 0 {
+		return fmt.Errorf("notify.rate_limit cannot be negative")
+	}
+
+	if n.Title == "" {
+		n.Title = defaultNotifyTitle
+	}
+	if n.Message == "" {
+		n.Message = defaultNotifyMessage
+	}
+	if n.title, err = parseNotifyTemplate("notify.title", n.Title); err != nil {
+		return err
+	}
+	if n.message, err = parseNotifyTemplate("notify.message", n.Message); err != nil {
+		return err
+	}
+	return nil
+}
+
+// parseNotifyTemplate parses a template and renders it once, so that references to fields
+// that an Alert does not have are reported now rather than for the first alert.
+func parseNotifyTemplate(key, text string) (*template.Template, error) {
+	t, err := template.New(key).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", key, err)
+	}
+	if err := t.Execute(io.Discard, &Alert{Record: map[string]any{}}); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return t, nil
+}
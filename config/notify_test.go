@@ -0,0 +1,63 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifyDefaults(t *testing.T) {
+	n := &Notify{Type: "PagerDuty", RoutingKey: "key"}
+	require.NoError(t, ValidateNotify(n))
+
+	assert.Equal(t, "pagerduty", n.Type)
+	assert.Equal(t, pagerDutyEventsURL, n.URL)
+	assert.Equal(t, "critical", n.Severity)
+	assert.Equal(t, []string{"model_spydertrace"}, n.Filter.Schemas)
+	assert.Nil(t, n.Filter.MinScore)
+	assert.Equal(t, time.Hour, n.RateLimit)
+
+	title, message, err := n.Render(&Alert{Name: "suspicious shell", Score: 95, Hostname: "puppies", Trigger: "reverse_shell", MUID: "mach:1", Linkback: "https://example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, "suspicious shell (score 95) on puppies", title)
+	assert.Equal(t, "Trigger: reverse_shell\nMachine: mach:1\nhttps://example.com", message)
+
+	n = &Notify{Type: "slack", URL: "https://hooks.slack.com/services/T/B/X", Filter: NotifyFilter{Schemas: []string{"model_spydertrace:1.0.0"}}, Message: `{{index .Record "status"}}`}
+	require.NoError(t, ValidateNotify(n))
+	assert.Equal(t, []string{"model_spydertrace"}, n.Filter.Schemas)
+	_, message, err = n.Render(&Alert{Record: map[string]any{"status": "closed"}})
+	require.NoError(t, err)
+	assert.Equal(t, "closed", message)
+}
+
+func TestNotifyValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		notify Notify
+		err    string
+	}{
+		{"missing type", Notify{}, "notify.type is required"},
+		{"bad type", Notify{Type: "email"}, "notify.type must be one of"},
+		{"missing url", Notify{Type: "slack"}, "notify.url is required for slack"},
+		{"http url", Notify{Type: "teams", URL: "http://example.com"}, "must use https scheme"},
+		{"routing key for slack", Notify{Type: "slack", URL: "https://example.com", RoutingKey: "key"}, "only supported for pagerduty"},
+		{"missing routing key", Notify{Type: "pagerduty"}, "notify.routing_key is required"},
+		{"bad severity", Notify{Type: "pagerduty", RoutingKey: "key", Severity: "high"}, "notify.severity must be one of"},
+		{"negative rate limit", Notify{Type: "slack", URL: "https://example.com", RateLimit: -time.Second}, "cannot be negative"},
+		{"bad template", Notify{Type: "slack", URL: "https://example.com", Title: "{{.Name"}, "failed to parse notify.title"},
+		{"unknown field", Notify{Type: "slack", URL: "https://example.com", Message: "{{.Hostnme}}"}, "invalid notify.message"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateNotify(&tt.notify)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
@@ -0,0 +1,97 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	defaultOTLPPayloadBytes = 1024 * 1024 * 1 // 1MB
+	maxOTLPPayloadBytes     = 1024 * 1024 * 4 // the collector's default grpc max_recv_msg_size_mib
+	defaultOTLPServiceName  = "spyderbat-event-forwarder"
+	otlpLogsPath            = "/v1/logs"
+)
+
+type OTLP struct {
+	Endpoint        string                `yaml:"endpoint_url"`
+	Protocol        string                `yaml:"protocol,omitempty"` // http/protobuf, http/json or grpc
+	Insecure        bool                  `yaml:"insecure"`
+	CompressionAlgo string                `yaml:"compression_algo,omitempty"` // gzip or none
+	Headers         map[string]string     `yaml:"headers,omitempty"`
+	ServiceName     string                `yaml:"service_name,omitempty"`
+	MaxPayloadBytes int                   `yaml:"max_payload_bytes"`
+	Authentication  WebhookAuthentication `yaml:"authentication,omitempty"`
+}
+
+func ValidateOTLP(o *OTLP) error {
+	if o == nil {
+		return nil
+	}
+
+	if o.Endpoint == "" {
+		return fmt.Errorf("otlp.endpoint_url is required")
+	}
+	u, err := url.Parse(o.Endpoint)
+	if err != nil {
+		return fmt.Errorf("failed to parse otlp.endpoint_url: %w", err)
+	}
+	// collectors are commonly reached over a cluster-internal network, so plain http is allowed
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return fmt.Errorf("otlp.endpoint_url must use http or https scheme")
+	}
+	if u.Host == "" {
+		return fmt.Errorf("otlp.endpoint_url must include a hostname")
+	}
+
+	o.Protocol = strings.ToLower(o.Protocol)
+	switch o.Protocol {
+	case "":
+		o.Protocol = "http/protobuf"
+	case "http/protobuf", "http/json", "grpc":
+	default:
+		return fmt.Errorf("unsupported otlp.protocol '%s'", o.Protocol)
+	}
+
+	// like the OpenTelemetry SDKs, a bare http endpoint is sent to the logs path
+	if o.Protocol != "grpc" && (u.Path == "" || u.Path == "/") {
+		u.Path = otlpLogsPath
+		o.Endpoint = u.String()
+	}
+
+	o.CompressionAlgo = strings.ToLower(o.CompressionAlgo)
+	switch o.CompressionAlgo {
+	case "":
+		o.CompressionAlgo = "none"
+	case "gzip", "none":
+	default:
+		return fmt.Errorf("unsupported otlp.compression_algo '%s'", o.CompressionAlgo)
+	}
+
+	if o.ServiceName == "" {
+		o.ServiceName = defaultOTLPServiceName
+	}
+
+	if o.MaxPayloadBytes == 0 {
+		o.MaxPayloadBytes = defaultOTLPPayloadBytes
+	}
+	if o.MaxPayloadBytes > maxOTLPPayloadBytes {
+		return fmt.Errorf("otlp.max_payload_bytes cannot be greater than %d", maxOTLPPayloadBytes)
+	}
+	if o.MaxPayloadBytes < minWebhookPayloadBytes {
+		return fmt.Errorf("otlp.max_payload_bytes cannot be less than %d", minWebhookPayloadBytes)
+	}
+
+	if err := ValidateAuthentication(&o.Authentication, "otlp.authentication"); err != nil {
+		return err
+	}
+	if o.Authentication.Method == "hmac" {
+		return fmt.Errorf("otlp does not support hmac authentication")
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOTLPDefaults(t *testing.T) {
+	o := &OTLP{Endpoint: "http://collector:4318"}
+	require.NoError(t, ValidateOTLP(o))
+
+	assert.Equal(t, "http://collector:4318/v1/logs", o.Endpoint)
+	assert.Equal(t, "http/protobuf", o.Protocol)
+	assert.Equal(t, "none", o.CompressionAlgo)
+	assert.Equal(t, defaultOTLPServiceName, o.ServiceName)
+	assert.Equal(t, defaultOTLPPayloadBytes, o.MaxPayloadBytes)
+
+	// grpc and explicit paths are left alone
+	o = &OTLP{Endpoint: "https://collector:4317", Protocol: "GRPC"}
+	require.NoError(t, ValidateOTLP(o))
+	assert.Equal(t, "https://collector:4317", o.Endpoint)
+	assert.Equal(t, "grpc", o.Protocol)
+
+	o = &OTLP{Endpoint: "https://collector/otlp/v1/logs"}
+	require.NoError(t, ValidateOTLP(o))
+	assert.Equal(t, "https://collector/otlp/v1/logs", o.Endpoint)
+}
+
+func TestOTLPValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		otlp OTLP
+		err  string
+	}{
+		{"missing endpoint", OTLP{}, "otlp.endpoint_url is required"},
+		{"bad scheme", OTLP{Endpoint: "grpc://collector"}, "http or https"},
+		{"protocol", OTLP{Endpoint: "http://collector", Protocol: "thrift"}, "unsupported otlp.protocol"},
+		{"compression", OTLP{Endpoint: "http://collector", CompressionAlgo: "zstd"}, "unsupported otlp.compression_algo"},
+		{"too large", OTLP{Endpoint: "http://collector", MaxPayloadBytes: maxOTLPPayloadBytes + 1}, "cannot be greater"},
+		{"hmac", OTLP{Endpoint: "http://collector", Authentication: WebhookAuthentication{
+			Method:     "hmac",
+			Parameters: AuthenticationParameters{Secret: "s", HeaderName: "X-Sig", HashAlgorithm: "sha256"},
+		}}, "does not support hmac"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateOTLP(&tt.otlp)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
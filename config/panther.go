@@ -0,0 +1,71 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"spyderbat-event-forwarder/panther"
+)
+
+const (
+	pantherPayloadBytes  = 500000
+	pantherBuiltinSchema = "builtin"
+)
+
+// applyPantherPreset fills in the settings recommended for Panther HTTP log sources,
+// leaving anything the user set explicitly alone.
+func applyPantherPreset(w *Webhook) {
+	if w.CompressionAlgo == "" {
+		w.CompressionAlgo = "zstd"
+		// Panther does not support HMAC with compression, so don't turn it on behind the user's back
+		if strings.EqualFold(w.Authentication.Method, "hmac") {
+			w.CompressionAlgo = "none"
+		}
+	}
+	if w.MaxPayloadBytes == 0 {
+		w.MaxPayloadBytes = pantherPayloadBytes
+	}
+	if w.Authentication.Method == "" {
+		w.Authentication.Method = "bearer"
+	}
+	// Panther parses newline-delimited JSON
+	w.delimiter, w.contentType = []byte("\n"), ndjsonContentType
+}
+
+// validatePantherPreset rejects settings that Panther is known not to accept, and loads the
+// schema used to validate forwarded events, if one was requested.
+func validatePantherPreset(w *Webhook) error {
+	if w.Authentication.Method == "hmac" && w.CompressionAlgo != "none" {
+		return fmt.Errorf("panther does not support hmac authentication with compression; set webhook.compression_algo to none")
+	}
+
+	if w.Format.Formatter() != nil {
+		return fmt.Errorf("the panther preset requires the json format")
+	}
+
+	switch w.SchemaFile {
+	case "":
+	case pantherBuiltinSchema:
+		s, err := panther.ParseSchema(panther.DefaultSchema)
+		if err != nil {
+			return err
+		}
+		w.schema = s
+	default:
+		data, err := os.ReadFile(w.SchemaFile)
+		if err != nil {
+			return fmt.Errorf("failed to read webhook.schema_file: %w", err)
+		}
+		s, err := panther.ParseSchema(data)
+		if err != nil {
+			return err
+		}
+		w.schema = s
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPantherPresetDefaults(t *testing.T) {
+	w := &Webhook{
+		Preset:   "Panther",
+		Endpoint: "https://example.com",
+		Authentication: WebhookAuthentication{
+			Parameters: AuthenticationParameters{
+				Secret: "test-secret",
+			},
+		},
+	}
+	require.NoError(t, ValidateWebhook(w))
+
+	assert.Equal(t, "panther", w.Preset)
+	assert.Equal(t, "zstd", w.CompressionAlgo)
+	assert.Equal(t, pantherPayloadBytes, w.MaxPayloadBytes)
+	assert.Equal(t, "bearer", w.Authentication.Method)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("test-secret")), w.Authentication.Parameters.SecretKey)
+	assert.Equal(t, []byte("test-secret"), w.Authentication.Parameters.GetSecretKey())
+	assert.Equal(t, []byte("\n"), w.Delimiter())
+	assert.Equal(t, "application/x-ndjson", w.ContentType())
+	assert.NotNil(t, w.Compressor())
+	assert.Nil(t, w.Schema())
+}
+
+func TestPantherPresetHMAC(t *testing.T) {
+	w := &Webhook{
+		Preset:   "panther",
+		Endpoint: "https://example.com",
+		Authentication: WebhookAuthentication{
+			Method: "HMAC",
+			Parameters: AuthenticationParameters{
+				HeaderName:    "X-HMAC",
+				Secret:        "test-secret",
+				HashAlgorithm: "sha256",
+			},
+		},
+	}
+	require.NoError(t, ValidateWebhook(w))
+	assert.Equal(t, "none", w.CompressionAlgo, "compression must not be enabled implicitly with hmac")
+
+	w = &Webhook{
+		Preset:          "panther",
+		Endpoint:        "https://example.com",
+		CompressionAlgo: "gzip",
+		Authentication: WebhookAuthentication{
+			Method: "hmac",
+			Parameters: AuthenticationParameters{
+				HeaderName:    "X-HMAC",
+				Secret:        "test-secret",
+				HashAlgorithm: "sha256",
+			},
+		},
+	}
+	assert.Error(t, ValidateWebhook(w))
+}
+
+func TestPantherPresetSchema(t *testing.T) {
+	w := &Webhook{
+		Preset:     "panther",
+		Endpoint:   "https://example.com",
+		SchemaFile: "builtin",
+		Authentication: WebhookAuthentication{
+			Parameters: AuthenticationParameters{
+				SecretKey: "dGVzdC1zZWNyZXQ=",
+			},
+		},
+	}
+	require.NoError(t, ValidateWebhook(w))
+	assert.NotNil(t, w.Schema())
+
+	w.SchemaFile = "/nonexistent/schema.yaml"
+	assert.Error(t, ValidateWebhook(w))
+}
+
+func TestWebhookPresetErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		w    *Webhook
+	}{
+		{
+			name: "unsupported preset",
+			w: &Webhook{
+				Preset:   "kittens",
+				Endpoint: "https://example.com",
+			},
+		},
+		{
+			name: "schema file without preset",
+			w: &Webhook{
+				Endpoint:   "https://example.com",
+				SchemaFile: "builtin",
+			},
+		},
+		{
+			name: "secret and secret key",
+			w: &Webhook{
+				Endpoint: "https://example.com",
+				Authentication: WebhookAuthentication{
+					Method: "bearer",
+					Parameters: AuthenticationParameters{
+						Secret:    "test-secret",
+						SecretKey: "dGVzdC1zZWNyZXQ=",
+					},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Error(t, ValidateWebhook(tt.w))
+		})
+	}
+}
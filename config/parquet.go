@@ -0,0 +1,139 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+const (
+	defaultParquetDirectory   = "parquet"
+	defaultParquetFileBytes   = 64 * 1024 * 1024
+	maxParquetFileBytes       = 1024 * 1024 * 1024 // records are held in memory until the file is written
+	defaultParquetFileAge     = 15 * time.Minute
+	defaultParquetCompression = "snappy"
+)
+
+// ParquetCompressions are the supported Parquet compression codecs.
+var ParquetCompressions = []string{"snappy", "zstd", "gzip", "none"}
+
+// Parquet configures writing records to Parquet files, one set of files per schema family, for
+// querying with Athena, Spark and the like. A file is written when the records for it reach
+// max_file_bytes or the oldest is max_file_age old.
+type Parquet struct {
+	Directory    string        `yaml:"directory,omitempty"`      // relative to log_path; default parquet
+	MaxFileBytes int           `yaml:"max_file_bytes,omitempty"` // size of the records in a file, as JSON; default 64 MiB
+	MaxFileAge   time.Duration `yaml:"max_file_age,omitempty"`   // default 15m
+	Compression  string        `yaml:"compression,omitempty"`    // snappy, zstd, gzip or none; default snappy
+	S3           *ParquetS3    `yaml:"s3,omitempty"`             // upload files to an object store
+	path         string
+}
+
+// ParquetS3 configures uploading Parquet files to Amazon S3 or an S3-compatible object store.
+// Credentials come from the standard AWS chain, as for the aws output.
+type ParquetS3 struct {
+	Bucket      string `yaml:"bucket"`
+	Prefix      string `yaml:"prefix,omitempty"`       // prepended to the file path to make the key
+	Region      string `yaml:"region,omitempty"`       // default from the AWS environment
+	EndpointURL string `yaml:"endpoint_url,omitempty"` // e.g. MinIO; path-style addressing is used
+	Profile     string `yaml:"profile,omitempty"`
+	RoleARN     string `yaml:"role_arn,omitempty"` // assumed with the chain's credentials
+	ExternalID  string `yaml:"external_id,omitempty"`
+	KeepLocal   bool   `yaml:"keep_local"` // keep files after they are uploaded
+	awsConfig   aws.Config
+}
+
+// Path returns the directory that files are written to.
+func (p *Parquet) Path() string {
+	return p.path
+}
+
+// Config returns the AWS SDK config, with the credential chain and region resolved.
+func (s *ParquetS3) Config() aws.Config {
+	return s.awsConfig
+}
+
+// ValidateParquet validates the parquet config and creates its directory. logPath is the
+// validated log_path.
+func ValidateParquet(p *Parquet, logPath string) error {
+	if p == nil {
+		return nil
+	}
+
+	if p.Directory == "" {
+		p.Directory = defaultParquetDirectory
+	}
+	p.path = p.Directory
+	if !filepath.IsAbs(p.path) {
+		p.path = filepath.Join(logPath, p.path)
+	}
+	if err := os.MkdirAll(p.path, 0o755); err != nil {
+		return fmt.Errorf("unable to create parquet.directory: %w", err)
+	}
+
+	if p.MaxFileBytes == 0 {
+		p.MaxFileBytes = defaultParquetFileBytes
+	}
+	if p.MaxFileBytes < 0 || p.MaxFileBytes > maxParquetFileBytes {
+		return fmt.Errorf("parquet.max_file_bytes must be between 1 and %d", maxParquetFileBytes)
+	}
+	if p.MaxFileAge == 0 {
+		p.MaxFileAge = defaultParquetFileAge
+	}
+	if p.MaxFileAge < time.Second {
+		return fmt.Errorf("parquet.max_file_age must be at least 1s")
+	}
+
+	p.Compression = strings.ToLower(p.Compression)
+	if p.Compression == "" {
+		p.Compression = defaultParquetCompression
+	}
+	found := false
+	for _, c := range ParquetCompressions {
+		found = found || p.Compression == c
+	}
+	if !found {
+		return fmt.Errorf("parquet.compression must be one of %s", strings.Join(ParquetCompressions, ", "))
+	}
+
+	return validateParquetS3(p.S3)
+}
+
+func validateParquetS3(s *ParquetS3) error {
+	if s == nil {
+		return nil
+	}
+
+	if s.Bucket == "" {
+		return fmt.Errorf("parquet.s3.bucket is required")
+	}
+	if s.Prefix != "" && !strings.HasSuffix(s.Prefix, "/") {
+		s.Prefix += "/"
+	}
+	if s.EndpointURL != "" {
+		u, err := url.Parse(s.EndpointURL)
+		if err != nil {
+			return fmt.Errorf("failed to parse parquet.s3.endpoint_url: %w", err)
+		}
+		if u.Scheme != "https" && u.Scheme != "http" {
+			return fmt.Errorf("parquet.s3.endpoint_url must use http or https scheme")
+		}
+	}
+
+	cfg, err := loadAWSConfig("parquet.s3", s.Region, s.Profile, s.RoleARN, s.ExternalID)
+	if err != nil {
+		return err
+	}
+	s.Region = cfg.Region
+	s.awsConfig = cfg
+	return nil
+}
@@ -0,0 +1,67 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParquetDefaults(t *testing.T) {
+	logPath := t.TempDir()
+	p := &Parquet{}
+	require.NoError(t, ValidateParquet(p, logPath))
+
+	assert.Equal(t, filepath.Join(logPath, "parquet"), p.Path())
+	assert.DirExists(t, p.Path())
+	assert.Equal(t, defaultParquetFileBytes, p.MaxFileBytes)
+	assert.Equal(t, 15*time.Minute, p.MaxFileAge)
+	assert.Equal(t, "snappy", p.Compression)
+
+	abs := filepath.Join(t.TempDir(), "lake")
+	p = &Parquet{Directory: abs, Compression: "ZSTD"}
+	require.NoError(t, ValidateParquet(p, logPath))
+	assert.Equal(t, abs, p.Path())
+	assert.Equal(t, "zstd", p.Compression)
+}
+
+func TestParquetS3(t *testing.T) {
+	awsTestEnv(t)
+	p := &Parquet{S3: &ParquetS3{Bucket: "lake", Prefix: "spyderbat", Region: "us-west-2"}}
+	require.NoError(t, ValidateParquet(p, t.TempDir()))
+	assert.Equal(t, "spyderbat/", p.S3.Prefix)
+	assert.Equal(t, "us-west-2", p.S3.Config().Region)
+}
+
+func TestParquetValidation(t *testing.T) {
+	awsTestEnv(t)
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, nil, 0o600))
+
+	tests := []struct {
+		name    string
+		parquet Parquet
+		err     string
+	}{
+		{"directory is a file", Parquet{Directory: file}, "unable to create parquet.directory"},
+		{"too large", Parquet{MaxFileBytes: maxParquetFileBytes + 1}, "parquet.max_file_bytes must be between"},
+		{"too young", Parquet{MaxFileAge: time.Millisecond}, "at least 1s"},
+		{"bad compression", Parquet{Compression: "lz4"}, "parquet.compression must be one of"},
+		{"missing bucket", Parquet{S3: &ParquetS3{}}, "parquet.s3.bucket is required"},
+		{"bad endpoint", Parquet{S3: &ParquetS3{Bucket: "lake", EndpointURL: "ftp://minio"}}, "must use http or https"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateParquet(&tt.parquet, t.TempDir())
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
@@ -0,0 +1,82 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ProjectionKeptFields are the fields that projections never remove: outputs route, index and
+// partition records by them, and runtime_details is added to every record by the forwarder.
+var ProjectionKeptFields = []string{"schema", "id", "time", "muid", "runtime_details"}
+
+// Projection keeps or removes fields of the records of some schemas, so that outputs are not
+// sent fields that are never used. It is applied after runtime_details is added to records
+// and before they are transformed.
+type Projection struct {
+	Schemas       []string `yaml:"schemas,omitempty"`        // schema prefixes the projection applies to; default all
+	IncludeFields []string `yaml:"include_fields,omitempty"` // fields to keep; ProjectionKeptFields are always kept
+	ExcludeFields []string `yaml:"exclude_fields,omitempty"` // fields to remove, after include_fields is applied
+}
+
+// Match returns whether the projection applies to records with the given schema.
+func (p *Projection) Match(schema string) bool {
+	if len(p.Schemas) == 0 {
+		return true
+	}
+	for _, prefix := range p.Schemas {
+		if strings.HasPrefix(schema, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateProjection validates the projections. The first projection that matches the schema
+// of a record is applied to it.
+func ValidateProjection(projections []*Projection) error {
+	for i, p := range projections {
+		key := fmt.Sprintf("projection[%d]", i)
+		if p == nil || (len(p.IncludeFields) == 0 && len(p.ExcludeFields) == 0) {
+			return fmt.Errorf("%s must have include_fields or exclude_fields", key)
+		}
+		for j, s := range p.Schemas {
+			if s == "" {
+				return fmt.Errorf("%s.schemas[%d] is an empty prefix", key, j)
+			}
+		}
+		for j, f := range p.IncludeFields {
+			if err := validateFieldPath(f, fmt.Sprintf("%s.include_fields[%d]", key, j)); err != nil {
+				return err
+			}
+		}
+		for j, f := range p.ExcludeFields {
+			fkey := fmt.Sprintf("%s.exclude_fields[%d]", key, j)
+			if err := validateFieldPath(f, fkey); err != nil {
+				return err
+			}
+			if f == "*" || slices.Contains(ProjectionKeptFields, f) {
+				return fmt.Errorf("%s cannot remove %s, which are always kept", fkey, strings.Join(ProjectionKeptFields, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// validateFieldPath validates a path of field names separated by dots, such as
+// runtime_details.hostname.
+func validateFieldPath(path, key string) error {
+	if path == "" {
+		return fmt.Errorf("%s is required", key)
+	}
+	for _, segment := range strings.Split(path, ".") {
+		if segment == "" {
+			return fmt.Errorf("%s '%s' has an empty field name", key, path)
+		}
+	}
+	return nil
+}
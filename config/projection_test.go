@@ -0,0 +1,46 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestProjection(t *testing.T) {
+	var projections []*Projection
+	require.NoError(t, yaml.Unmarshal([]byte(`
+- schemas: [ event_k8saudit ]
+  include_fields: [ id, time, verb, request.principal.* ]
+- exclude_fields: [ runtime_details.ip_addresses ]
+`), &projections))
+	require.NoError(t, ValidateProjection(projections))
+	assert.True(t, projections[0].Match("event_k8saudit:1.0.0"))
+	assert.False(t, projections[0].Match("model_process::1.2.0"))
+	assert.True(t, projections[1].Match("model_process::1.2.0"))
+
+	tests := []struct {
+		name       string
+		projection *Projection
+		err        string
+	}{
+		{"no fields", &Projection{Schemas: []string{"model_"}}, "projection[0] must have include_fields or exclude_fields"},
+		{"empty prefix", &Projection{Schemas: []string{""}, IncludeFields: []string{"id"}}, "projection[0].schemas[0] is an empty prefix"},
+		{"empty include", &Projection{IncludeFields: []string{""}}, "projection[0].include_fields[0] is required"},
+		{"exclude kept field", &Projection{ExcludeFields: []string{"runtime_details.ip_addresses", "muid"}}, "projection[0].exclude_fields[1] cannot remove schema, id, time, muid, runtime_details"},
+		{"exclude everything", &Projection{ExcludeFields: []string{"*"}}, "projection[0].exclude_fields[0] cannot remove"},
+		{"empty segment", &Projection{ExcludeFields: []string{"stage", "request..user"}}, "projection[0].exclude_fields[1] 'request..user' has an empty field name"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateProjection([]*Projection{tt.projection})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
@@ -0,0 +1,149 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const defaultRedactionMask = "REDACTED"
+
+// RedactionOutputs are the names of the outputs that redaction can be configured for.
+var RedactionOutputs = []string{
+	"file", "stdout", "syslog",
+	"webhook", "loki", "otlp", "sentinel", "chronicle", "aws", "forward", "nats", "redis",
+	"notify", "sqlite", "parquet",
+}
+
+// RedactionActions are the supported redaction rule actions.
+var RedactionActions = []string{"drop", "mask", "regex", "hmac"}
+
+// Redaction is a set of rules that removes or pseudonymizes fields of the records sent to some
+// outputs, e.g. so that a third-party SIEM gets redacted records while the local file stays
+// complete. The rules are applied in order, before the transform, so that the transform cannot
+// copy a redacted value to another field.
+type Redaction struct {
+	Outputs     []string         `yaml:"outputs"`                 // names of the outputs the rules apply to
+	HMACKeyFile string           `yaml:"hmac_key_file,omitempty"` // key for hmac rules
+	Rules       []*RedactionRule `yaml:"rules"`
+	hmacKey     []byte
+}
+
+// RedactionRule redacts the value at a path, such as args, euser or
+// runtime_details.ip_addresses. Paths are field names separated by dots; * matches every
+// field, and arrays along the path are searched element by element.
+type RedactionRule struct {
+	Path    string   `yaml:"path"`
+	Schemas []string `yaml:"schemas,omitempty"` // schema prefixes the rule applies to; default all
+	Action  string   `yaml:"action"`            // drop, mask, regex or hmac
+	Mask    string   `yaml:"mask,omitempty"`    // mask: replacement value; default REDACTED
+	Pattern string   `yaml:"pattern,omitempty"` // regex: regular expression
+	Replace string   `yaml:"replace,omitempty"` // regex: replacement, which may refer to groups as $1
+	regex   *regexp.Regexp
+}
+
+// HMACKey returns the key for hmac rules.
+func (r *Redaction) HMACKey() []byte {
+	return r.hmacKey
+}
+
+// Regex returns the compiled pattern of a regex rule.
+func (r *RedactionRule) Regex() *regexp.Regexp {
+	return r.regex
+}
+
+// Match returns whether the rule applies to records with the given schema.
+func (r *RedactionRule) Match(schema string) bool {
+	if len(r.Schemas) == 0 {
+		return true
+	}
+	for _, prefix := range r.Schemas {
+		if strings.HasPrefix(schema, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateRedaction validates the redaction rule sets. Each output can have at most one.
+func ValidateRedaction(redactions []*Redaction) error {
+	seen := make(map[string]bool)
+	for i, r := range redactions {
+		key := fmt.Sprintf("redaction[%d]", i)
+		if r == nil || len(r.Outputs) == 0 {
+			return fmt.Errorf("%s.outputs is required", key)
+		}
+		for j, o := range r.Outputs {
+			o = strings.ToLower(o)
+			r.Outputs[j] = o
+			if !slices.Contains(RedactionOutputs, o) {
+				return fmt.Errorf("%s.outputs: unknown output '%s'; must be one of %s", key, o, strings.Join(RedactionOutputs, ", "))
+			}
+			if seen[o] {
+				return fmt.Errorf("%s.outputs: %s has more than one set of redaction rules", key, o)
+			}
+			seen[o] = true
+		}
+		if len(r.Rules) == 0 {
+			return fmt.Errorf("%s.rules is required", key)
+		}
+
+		needKey := false
+		for j, rule := range r.Rules {
+			if err := validateRedactionRule(rule, fmt.Sprintf("%s.rules[%d]", key, j)); err != nil {
+				return err
+			}
+			needKey = needKey || rule.Action == "hmac"
+		}
+		if needKey {
+			if r.HMACKeyFile == "" {
+				return fmt.Errorf("%s.hmac_key_file is required for hmac rules", key)
+			}
+			data, err := os.ReadFile(r.HMACKeyFile)
+			if err != nil {
+				return fmt.Errorf("failed to read %s.hmac_key_file: %w", key, err)
+			}
+			r.hmacKey = []byte(strings.TrimSpace(string(data)))
+			if len(r.hmacKey) < 16 {
+				return fmt.Errorf("%s.hmac_key_file must contain a key of at least 16 bytes", key)
+			}
+		}
+	}
+	return nil
+}
+
+func validateRedactionRule(r *RedactionRule, key string) error {
+	if r == nil {
+		return fmt.Errorf("%s.path is required", key)
+	}
+	if err := validateFieldPath(r.Path, key+".path"); err != nil {
+		return err
+	}
+
+	r.Action = strings.ToLower(r.Action)
+	switch r.Action {
+	case "drop", "hmac":
+	case "mask":
+		if r.Mask == "" {
+			r.Mask = defaultRedactionMask
+		}
+	case "regex":
+		if r.Pattern == "" {
+			return fmt.Errorf("%s.pattern is required for regex", key)
+		}
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return fmt.Errorf("failed to compile %s.pattern: %w", key, err)
+		}
+		r.regex = re
+	default:
+		return fmt.Errorf("%s.action must be one of %s", key, strings.Join(RedactionActions, ", "))
+	}
+	return nil
+}
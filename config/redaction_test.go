@@ -0,0 +1,79 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestRedactionDefaults(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "hmac.key")
+	require.NoError(t, os.WriteFile(keyFile, []byte("0123456789abcdef\n"), 0o600))
+
+	var redactions []*Redaction
+	require.NoError(t, yaml.Unmarshal([]byte(`
+- outputs: [ Webhook, loki ]
+  hmac_key_file: `+keyFile+`
+  rules:
+    - path: args
+      action: Mask
+    - path: euser
+      action: hmac
+      schemas: [ model_process ]
+    - path: runtime_details.ip_addresses
+      action: regex
+      pattern: '^(\d+)\.\d+\.\d+\.\d+$'
+      replace: '$1.x.x.x'
+`), &redactions))
+	require.NoError(t, ValidateRedaction(redactions))
+
+	r := redactions[0]
+	assert.Equal(t, []string{"webhook", "loki"}, r.Outputs)
+	assert.Equal(t, []byte("0123456789abcdef"), r.HMACKey())
+	assert.Equal(t, "mask", r.Rules[0].Action)
+	assert.Equal(t, "REDACTED", r.Rules[0].Mask)
+	assert.True(t, r.Rules[0].Match("model_connection::1.0.0"))
+	assert.True(t, r.Rules[1].Match("model_process::1.2.0"))
+	assert.False(t, r.Rules[1].Match("model_connection::1.0.0"))
+	assert.Equal(t, "10.x.x.x", r.Rules[2].Regex().ReplaceAllString("10.1.2.3", r.Rules[2].Replace))
+}
+
+func TestRedactionValidation(t *testing.T) {
+	shortKey := filepath.Join(t.TempDir(), "short.key")
+	require.NoError(t, os.WriteFile(shortKey, []byte("short"), 0o600))
+	drop := []*RedactionRule{{Path: "args", Action: "drop"}}
+
+	tests := []struct {
+		name       string
+		redactions []*Redaction
+		err        string
+	}{
+		{"no outputs", []*Redaction{{Rules: drop}}, "redaction[0].outputs is required"},
+		{"unknown output", []*Redaction{{Outputs: []string{"email"}, Rules: drop}}, "unknown output 'email'"},
+		{"output twice", []*Redaction{{Outputs: []string{"webhook"}, Rules: drop}, {Outputs: []string{"webhook"}, Rules: drop}},
+			"redaction[1].outputs: webhook has more than one set"},
+		{"no rules", []*Redaction{{Outputs: []string{"webhook"}}}, "redaction[0].rules is required"},
+		{"no path", []*Redaction{{Outputs: []string{"webhook"}, Rules: []*RedactionRule{{Action: "drop"}}}}, "rules[0].path is required"},
+		{"empty field", []*Redaction{{Outputs: []string{"webhook"}, Rules: []*RedactionRule{{Path: "a..b", Action: "drop"}}}}, "empty field name"},
+		{"unknown action", []*Redaction{{Outputs: []string{"webhook"}, Rules: []*RedactionRule{{Path: "args", Action: "encrypt"}}}}, "action must be one of"},
+		{"no pattern", []*Redaction{{Outputs: []string{"webhook"}, Rules: []*RedactionRule{{Path: "args", Action: "regex"}}}}, "pattern is required"},
+		{"bad pattern", []*Redaction{{Outputs: []string{"webhook"}, Rules: []*RedactionRule{{Path: "args", Action: "regex", Pattern: "("}}}}, "failed to compile"},
+		{"no hmac key", []*Redaction{{Outputs: []string{"webhook"}, Rules: []*RedactionRule{{Path: "euser", Action: "hmac"}}}}, "hmac_key_file is required"},
+		{"short hmac key", []*Redaction{{Outputs: []string{"webhook"}, HMACKeyFile: shortKey, Rules: []*RedactionRule{{Path: "euser", Action: "hmac"}}}}, "at least 16 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRedaction(tt.redactions)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
@@ -0,0 +1,74 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	defaultRedisPort   = "6379"
+	defaultRedisKey    = "spyderbat:{schema}"
+	defaultRedisMaxLen = 100000
+)
+
+// Redis configures publishing to Redis Streams with XADD. Each record is added to a stream whose
+// key is derived from its schema and muid, and streams are trimmed to about max_len entries.
+type Redis struct {
+	Address  string  `yaml:"address"`           // host or host:port; the default port is 6379
+	Key      string  `yaml:"key,omitempty"`     // may include {schema} and {muid}; default spyderbat:{schema}
+	MaxLen   *int    `yaml:"max_len,omitempty"` // approximate; default 100000; 0 to not trim
+	DB       int     `yaml:"db,omitempty"`
+	Username string  `yaml:"username,omitempty"`
+	Password string  `yaml:"password,omitempty"`
+	TLS      bool    `yaml:"tls"`
+	Insecure bool    `yaml:"insecure"` // skip certificate validation
+	Format   *Format `yaml:"format,omitempty"`
+}
+
+// KeyFor returns the stream key for a record.
+func (r *Redis) KeyFor(schema, muid string) string {
+	return strings.NewReplacer("{schema}", schema, "{muid}", muid).Replace(r.Key)
+}
+
+func ValidateRedis(r *Redis) error {
+	if r == nil {
+		return nil
+	}
+
+	if r.Address == "" {
+		return fmt.Errorf("redis.address is required")
+	}
+	if _, _, err := net.SplitHostPort(r.Address); err != nil {
+		r.Address = net.JoinHostPort(r.Address, defaultRedisPort)
+	}
+	if _, _, err := net.SplitHostPort(r.Address); err != nil {
+		return fmt.Errorf("invalid redis.address: %w", err)
+	}
+
+	if r.Key == "" {
+		r.Key = defaultRedisKey
+	}
+	if err := validateKeyTemplate(r.Key, "redis.key"); err != nil {
+		return err
+	}
+	if r.MaxLen == nil {
+		maxLen := defaultRedisMaxLen
+		r.MaxLen = &maxLen
+	}
+	if *r.MaxLen < 0 {
+		return fmt.Errorf("redis.max_len cannot be negative")
+	}
+	if r.DB < 0 {
+		return fmt.Errorf("redis.db cannot be negative")
+	}
+	if r.Username != "" && r.Password == "" {
+		return fmt.Errorf("redis.password is required with redis.username")
+	}
+
+	return ValidateFormat(r.Format, "redis.format")
+}
@@ -0,0 +1,52 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisDefaults(t *testing.T) {
+	r := &Redis{Address: "redis.cache"}
+	require.NoError(t, ValidateRedis(r))
+
+	assert.Equal(t, "redis.cache:6379", r.Address)
+	assert.Equal(t, "spyderbat:{schema}", r.Key)
+	assert.Equal(t, "spyderbat:model_process", r.KeyFor("model_process", "mach:abc"))
+	require.NotNil(t, r.MaxLen)
+	assert.Equal(t, defaultRedisMaxLen, *r.MaxLen)
+
+	maxLen := 0
+	r = &Redis{Address: "redis.cache:6380", Key: "events:{muid}:{schema}", MaxLen: &maxLen}
+	require.NoError(t, ValidateRedis(r))
+	assert.Equal(t, "redis.cache:6380", r.Address)
+	assert.Equal(t, "events:mach:abc:model_process", r.KeyFor("model_process", "mach:abc"))
+	assert.Equal(t, 0, *r.MaxLen)
+}
+
+func TestRedisValidation(t *testing.T) {
+	negative := -1
+	tests := []struct {
+		name  string
+		redis Redis
+		err   string
+	}{
+		{"missing address", Redis{}, "redis.address is required"},
+		{"bad placeholder", Redis{Address: "redis", Key: "spyderbat:{id}"}, "unsupported placeholder '{id}'"},
+		{"negative max_len", Redis{Address: "redis", MaxLen: &negative}, "redis.max_len cannot be negative"},
+		{"negative db", Redis{Address: "redis", DB: -1}, "redis.db cannot be negative"},
+		{"user without password", Redis{Address: "redis", Username: "u"}, "redis.password is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRedis(&tt.redis)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
@@ -0,0 +1,124 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	maxSentinelPayloadBytes  = 1024 * 1024 * 1 // the Logs Ingestion API's limit per call
+	defaultSentinelAuthority = "https://login.microsoftonline.com"
+	sentinelScope            = "https://monitor.azure.com//.default"
+)
+
+// Sentinel configures the Azure Monitor Logs Ingestion API, which Microsoft Sentinel reads
+// from. Records are posted to a data collection rule (DCR) through a data collection
+// endpoint (DCE), using a Microsoft Entra application's client credentials.
+type Sentinel struct {
+	Endpoint        string            `yaml:"endpoint_url"`     // the DCE logs ingestion endpoint
+	DCRImmutableID  string            `yaml:"dcr_immutable_id"` // the DCR's immutableId, dcr-...
+	TenantID        string            `yaml:"tenant_id"`
+	ClientID        string            `yaml:"client_id"`
+	ClientSecret    string            `yaml:"client_secret"`
+	AuthorityHost   string            `yaml:"authority_host,omitempty"` // for sovereign clouds or testing
+	Streams         map[string]string `yaml:"streams,omitempty"`        // schema family -> DCR stream
+	DefaultStream   string            `yaml:"default_stream,omitempty"` // for schemas not in streams
+	CompressionAlgo string            `yaml:"compression_algo,omitempty"`
+	MaxPayloadBytes int               `yaml:"max_payload_bytes"`
+	Insecure        bool              `yaml:"insecure"`
+}
+
+// TokenURL returns the OAuth2 token endpoint for the configured tenant.
+func (s *Sentinel) TokenURL() string {
+	return strings.TrimSuffix(s.AuthorityHost, "/") + "/" + url.PathEscape(s.TenantID) + "/oauth2/v2.0/token"
+}
+
+// Scope returns the OAuth2 scope requested for the Logs Ingestion API.
+func (s *Sentinel) Scope() string {
+	return sentinelScope
+}
+
+// StreamURL returns the URL that records for the given DCR stream are posted to.
+func (s *Sentinel) StreamURL(stream string) string {
+	return fmt.Sprintf("%s/dataCollectionRules/%s/streams/%s?api-version=2023-01-01",
+		strings.TrimSuffix(s.Endpoint, "/"), url.PathEscape(s.DCRImmutableID), url.PathEscape(stream))
+}
+
+// Stream returns the DCR stream for a schema family, or "" if records of that family are
+// not sent.
+func (s *Sentinel) Stream(family string) string {
+	if stream, found := s.Streams[family]; found {
+		return stream
+	}
+	return s.DefaultStream
+}
+
+func ValidateSentinel(s *Sentinel) error {
+	if s == nil {
+		return nil
+	}
+
+	for _, required := range [][2]string{
+		{"endpoint_url", s.Endpoint},
+		{"dcr_immutable_id", s.DCRImmutableID},
+		{"tenant_id", s.TenantID},
+		{"client_id", s.ClientID},
+		{"client_secret", s.ClientSecret},
+	} {
+		if required[1] == "" {
+			return fmt.Errorf("sentinel.%s is required", required[0])
+		}
+	}
+
+	if s.AuthorityHost == "" {
+		s.AuthorityHost = defaultSentinelAuthority
+	}
+	for _, endpoint := range [][2]string{{"endpoint_url", s.Endpoint}, {"authority_host", s.AuthorityHost}} {
+		key := endpoint[0]
+		u, err := url.Parse(endpoint[1])
+		if err != nil {
+			return fmt.Errorf("failed to parse sentinel.%s: %w", key, err)
+		}
+		if u.Scheme != "https" {
+			return fmt.Errorf("sentinel.%s must use https scheme", key)
+		}
+		if u.Host == "" {
+			return fmt.Errorf("sentinel.%s must include a hostname", key)
+		}
+	}
+
+	if len(s.Streams) == 0 && s.DefaultStream == "" {
+		return fmt.Errorf("sentinel.streams or sentinel.default_stream is required")
+	}
+	for family, stream := range s.Streams {
+		if stream == "" {
+			return fmt.Errorf("sentinel.streams.%s must name a stream", family)
+		}
+	}
+
+	s.CompressionAlgo = strings.ToLower(s.CompressionAlgo)
+	switch s.CompressionAlgo {
+	case "":
+		s.CompressionAlgo = "gzip"
+	case "gzip", "none":
+	default:
+		return fmt.Errorf("unsupported sentinel.compression_algo '%s'", s.CompressionAlgo)
+	}
+
+	if s.MaxPayloadBytes == 0 {
+		s.MaxPayloadBytes = maxSentinelPayloadBytes
+	}
+	if s.MaxPayloadBytes > maxSentinelPayloadBytes {
+		return fmt.Errorf("sentinel.max_payload_bytes cannot be greater than %d", maxSentinelPayloadBytes)
+	}
+	if s.MaxPayloadBytes < minWebhookPayloadBytes {
+		return fmt.Errorf("sentinel.max_payload_bytes cannot be less than %d", minWebhookPayloadBytes)
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func validSentinel() *Sentinel {
+	return &Sentinel{
+		Endpoint:       "https://dce-1.eastus-1.ingest.monitor.azure.com",
+		DCRImmutableID: "dcr-0123",
+		TenantID:       "tenant-1",
+		ClientID:       "client-1",
+		ClientSecret:   "secret",
+		Streams:        map[string]string{"model_spydertrace": "Custom-SpyderbatTraces"},
+	}
+}
+
+func TestSentinelDefaults(t *testing.T) {
+	s := validSentinel()
+	require.NoError(t, ValidateSentinel(s))
+
+	assert.Equal(t, defaultSentinelAuthority, s.AuthorityHost)
+	assert.Equal(t, "gzip", s.CompressionAlgo)
+	assert.Equal(t, maxSentinelPayloadBytes, s.MaxPayloadBytes)
+	assert.Equal(t, "https://login.microsoftonline.com/tenant-1/oauth2/v2.0/token", s.TokenURL())
+	assert.Equal(t, "https://dce-1.eastus-1.ingest.monitor.azure.com/dataCollectionRules/dcr-0123/streams/Custom-SpyderbatTraces?api-version=2023-01-01",
+		s.StreamURL("Custom-SpyderbatTraces"))
+	assert.Equal(t, "Custom-SpyderbatTraces", s.Stream("model_spydertrace"))
+	assert.Equal(t, "", s.Stream("model_process"))
+
+	s.DefaultStream = "Custom-SpyderbatEvents"
+	assert.Equal(t, "Custom-SpyderbatEvents", s.Stream("model_process"))
+}
+
+func TestSentinelValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(s *Sentinel)
+		err    string
+	}{
+		{"missing endpoint", func(s *Sentinel) { s.Endpoint = "" }, "sentinel.endpoint_url is required"},
+		{"missing dcr", func(s *Sentinel) { s.DCRImmutableID = "" }, "sentinel.dcr_immutable_id is required"},
+		{"missing secret", func(s *Sentinel) { s.ClientSecret = "" }, "sentinel.client_secret is required"},
+		{"http endpoint", func(s *Sentinel) { s.Endpoint = "http://dce" }, "sentinel.endpoint_url must use https"},
+		{"http authority", func(s *Sentinel) { s.AuthorityHost = "http://login" }, "sentinel.authority_host must use https"},
+		{"no streams", func(s *Sentinel) { s.Streams = nil }, "sentinel.streams or sentinel.default_stream is required"},
+		{"empty stream", func(s *Sentinel) { s.Streams["model_process"] = "" }, "sentinel.streams.model_process"},
+		{"compression", func(s *Sentinel) { s.CompressionAlgo = "zstd" }, "unsupported sentinel.compression_algo"},
+		{"too large", func(s *Sentinel) { s.MaxPayloadBytes = maxSentinelPayloadBytes + 1 }, "cannot be greater"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := validSentinel()
+			tt.modify(s)
+			err := ValidateSentinel(s)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	defaultSQLiteFilename      = "spyderbat_events.db"
+	defaultSQLiteRetentionDays = 7
+)
+
+// SQLite configures a local SQLite database of records under log_path, which can be searched
+// with the query subcommand.
+type SQLite struct {
+	Filename      string `yaml:"filename,omitempty"`       // relative to log_path; default spyderbat_events.db
+	RetentionDays int    `yaml:"retention_days,omitempty"` // records older than this are deleted; default 7
+	path          string
+}
+
+// Path returns the path of the database.
+func (s *SQLite) Path() string {
+	return s.path
+}
+
+// ValidateSQLite validates the sqlite config. logPath is the validated log_path.
+func ValidateSQLite(s *SQLite, logPath string) error {
+	if s == nil {
+		return nil
+	}
+
+	if s.Filename == "" {
+		s.Filename = defaultSQLiteFilename
+	}
+	if filepath.IsAbs(s.Filename) || strings.ContainsRune(s.Filename, filepath.Separator) {
+		return fmt.Errorf("sqlite.filename must be a file name in log_path")
+	}
+	s.path = filepath.Join(logPath, s.Filename)
+
+	if s.RetentionDays == 0 {
+		s.RetentionDays = defaultSQLiteRetentionDays
+	}
+	if s.RetentionDays < 0 {
+		return fmt.Errorf("sqlite.retention_days cannot be negative")
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteDefaults(t *testing.T) {
+	s := &SQLite{}
+	require.NoError(t, ValidateSQLite(s, "/var/log/sef"))
+	assert.Equal(t, filepath.Join("/var/log/sef", "spyderbat_events.db"), s.Path())
+	assert.Equal(t, 7, s.RetentionDays)
+
+	s = &SQLite{Filename: "events.sqlite", RetentionDays: 30}
+	require.NoError(t, ValidateSQLite(s, "/var/log/sef"))
+	assert.Equal(t, filepath.Join("/var/log/sef", "events.sqlite"), s.Path())
+	assert.Equal(t, 30, s.RetentionDays)
+}
+
+func TestSQLiteValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		sqlite SQLite
+		err    string
+	}{
+		{"absolute path", SQLite{Filename: "/tmp/events.db"}, "must be a file name"},
+		{"subdirectory", SQLite{Filename: "db/events.db"}, "must be a file name"},
+		{"negative retention", SQLite{RetentionDays: -1}, "cannot be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSQLite(&tt.sqlite, "/var/log/sef")
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
@@ -0,0 +1,67 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSumoLogicPresetDefaults(t *testing.T) {
+	w := &Webhook{
+		Preset:   "SumoLogic",
+		Endpoint: "https://endpoint1.collection.sumologic.com/receiver/v1/http/token",
+	}
+	require.NoError(t, ValidateWebhook(w))
+
+	assert.Equal(t, "gzip", w.CompressionAlgo)
+	assert.Equal(t, sumoLogicPayloadBytes, w.MaxPayloadBytes)
+	assert.Equal(t, []byte("\n"), w.Delimiter())
+	assert.Equal(t, map[string]string{
+		"X-Sumo-Category": "spyderbat",
+		"X-Sumo-Name":     "spyderbat-event-forwarder",
+	}, w.Headers())
+
+	w = &Webhook{
+		Preset:   "sumologic",
+		Endpoint: "https://endpoint1.collection.sumologic.com/receiver/v1/http/token",
+		SumoLogic: &SumoLogicOptions{
+			Category: "security/spyderbat",
+			Host:     "forwarder-1",
+			Fields:   map[string]string{"team": "secops", "env": "prod"},
+		},
+	}
+	require.NoError(t, ValidateWebhook(w))
+	assert.Equal(t, map[string]string{
+		"X-Sumo-Category": "security/spyderbat",
+		"X-Sumo-Name":     "spyderbat-event-forwarder",
+		"X-Sumo-Host":     "forwarder-1",
+		"X-Sumo-Fields":   "env=prod,team=secops",
+	}, w.Headers())
+}
+
+func TestSumoLogicPresetValidation(t *testing.T) {
+	endpoint := "https://endpoint1.collection.sumologic.com/receiver/v1/http/token"
+	tests := []struct {
+		name    string
+		webhook Webhook
+		err     string
+	}{
+		{"missing endpoint", Webhook{Preset: "sumologic"}, "webhook.endpoint_url is required"},
+		{"too large", Webhook{Preset: "sumologic", Endpoint: endpoint, MaxPayloadBytes: sumoLogicPayloadBytes + 1}, "cannot be greater"},
+		{"zstd", Webhook{Preset: "sumologic", Endpoint: endpoint, CompressionAlgo: "zstd"}, "zstd"},
+		{"bad field", Webhook{Preset: "sumologic", Endpoint: endpoint, SumoLogic: &SumoLogicOptions{Fields: map[string]string{"a": "1,b=2"}}}, "invalid webhook.sumologic field"},
+		{"wrong preset", Webhook{Endpoint: endpoint, SumoLogic: &SumoLogicOptions{}}, "only supported with the sumologic preset"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateWebhook(&tt.webhook)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
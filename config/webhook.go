@@ -11,9 +11,12 @@ import (
 	"fmt"
 	"hash"
 	"io"
+	"net/http"
 	"net/url"
 	"strings"
 
+	"spyderbat-event-forwarder/panther"
+
 	"github.com/klauspost/compress/zstd"
 )
 
@@ -24,12 +27,25 @@ const (
 )
 
 type Webhook struct {
+	Preset          string                `yaml:"preset,omitempty"`
 	Endpoint        string                `yaml:"endpoint_url"`
 	Insecure        bool                  `yaml:"insecure"`
 	CompressionAlgo string                `yaml:"compression_algo"`
 	MaxPayloadBytes int                   `yaml:"max_payload_bytes"`
 	Authentication  WebhookAuthentication `yaml:"authentication,omitempty"`
+	SchemaFile      string                `yaml:"schema_file,omitempty"` // panther preset only
+	Datadog         *DatadogOptions       `yaml:"datadog,omitempty"`     // datadog preset only
+	SumoLogic       *SumoLogicOptions     `yaml:"sumologic,omitempty"`   // sumologic preset only
+	Format          *Format               `yaml:"format,omitempty"`
+	Payload         *WebhookPayload       `yaml:"payload,omitempty"`
 	compressor      func(io.Writer) Compressor
+	delimiter       []byte
+	jsonArray       bool
+	contentType     string
+	headers         map[string]string
+	maxRecords      int
+	maxRecordBytes  int
+	schema          *panther.Schema
 }
 
 type WebhookAuthentication struct {
@@ -40,6 +56,7 @@ type WebhookAuthentication struct {
 type AuthenticationParameters struct {
 	HeaderName    string `yaml:"header_name,omitempty"`
 	SecretKey     string `yaml:"secret_key,omitempty"` // Base64 encoded
+	Secret        string `yaml:"secret,omitempty"`     // Plain text alternative to SecretKey
 	HashAlgorithm string `yaml:"hash_algo,omitempty"`
 	Username      string `yaml:"username,omitempty"`
 	Password      string `yaml:"password,omitempty"` // Base64 encoded
@@ -72,10 +89,54 @@ func (w *Webhook) Compressor() func(io.Writer) Compressor {
 	return w.compressor
 }
 
+// Delimiter returns the bytes written after each event in a payload, if any.
+func (w *Webhook) Delimiter() []byte {
+	return w.delimiter
+}
+
+// JSONArray reports whether the events in a payload are sent as a JSON array.
+func (w *Webhook) JSONArray() bool {
+	return w.jsonArray
+}
+
+// Headers returns extra headers to set on every request.
+func (w *Webhook) Headers() map[string]string {
+	return w.headers
+}
+
+// MaxRecords returns the most events that may be sent in a payload, or 0 for no limit.
+func (w *Webhook) MaxRecords() int {
+	return w.maxRecords
+}
+
+// MaxRecordBytes returns the size of the largest event that may be sent, or 0 for no limit.
+func (w *Webhook) MaxRecordBytes() int {
+	return w.maxRecordBytes
+}
+
+// Schema returns the schema that forwarded events should be validated against, if any.
+func (w *Webhook) Schema() *panther.Schema {
+	return w.schema
+}
+
 func ValidateWebhook(w *Webhook) error {
 	if w == nil {
 		return nil
 	}
+
+	w.Preset = strings.ToLower(w.Preset)
+	switch w.Preset {
+	case "":
+	case "panther":
+		applyPantherPreset(w)
+	case "datadog":
+		applyDatadogPreset(w)
+	case "sumologic":
+		applySumoLogicPreset(w)
+	default:
+		return fmt.Errorf("unsupported webhook preset '%s'", w.Preset)
+	}
+
 	if w.MaxPayloadBytes == 0 {
 		w.MaxPayloadBytes = defaultWebhookPayloadBytes
 	}
@@ -126,50 +187,106 @@ func ValidateWebhook(w *Webhook) error {
 		return fmt.Errorf("unsupported compression algorithm '%s'", w.CompressionAlgo)
 	}
 
-	w.Authentication.Method = strings.ToLower(w.Authentication.Method)
-	switch w.Authentication.Method {
+	if err := ValidateAuthentication(&w.Authentication, "webhook.authentication"); err != nil {
+		return err
+	}
+
+	if err := ValidateFormat(w.Format, "webhook.format"); err != nil {
+		return err
+	}
+
+	if err := ValidateWebhookPayload(w); err != nil {
+		return err
+	}
+
+	if w.SchemaFile != "" && w.Preset != "panther" {
+		return fmt.Errorf("webhook.schema_file is only supported with the panther preset")
+	}
+	if w.Datadog != nil && w.Preset != "datadog" {
+		return fmt.Errorf("webhook.datadog is only supported with the datadog preset")
+	}
+	if w.SumoLogic != nil && w.Preset != "sumologic" {
+		return fmt.Errorf("webhook.sumologic is only supported with the sumologic preset")
+	}
+
+	switch w.Preset {
+	case "panther":
+		return validatePantherPreset(w)
+	case "datadog":
+		return validateDatadogPreset(w)
+	case "sumologic":
+		return validateSumoLogicPreset(w)
+	}
+	return nil
+}
+
+// ValidateAuthentication validates authentication settings. key is the config key of the
+// settings, for error messages.
+func ValidateAuthentication(a *WebhookAuthentication, key string) error {
+	if a.Parameters.Secret != "" {
+		if a.Parameters.SecretKey != "" {
+			return fmt.Errorf("%s.secret and %s.secret_key are mutually exclusive", key, key)
+		}
+		a.Parameters.SecretKey = base64.StdEncoding.EncodeToString([]byte(a.Parameters.Secret))
+	}
+
+	a.Method = strings.ToLower(a.Method)
+	switch a.Method {
 	case "none":
 	case "":
 	case "basic":
-		if w.Authentication.Parameters.Username == "" {
-			return fmt.Errorf("webhook.authentication.username is required for basic auth")
+		if a.Parameters.Username == "" {
+			return fmt.Errorf("%s.username is required for basic auth", key)
 		}
-		if w.Authentication.Parameters.Password == "" {
-			return fmt.Errorf("webhook.authentication.password is required for basic auth")
+		if a.Parameters.Password == "" {
+			return fmt.Errorf("%s.password is required for basic auth", key)
 		}
-		if w.Authentication.Parameters.GetPassword() == nil {
-			return fmt.Errorf("webhook.authentication.password must be base64 encoded")
+		if a.Parameters.GetPassword() == nil {
+			return fmt.Errorf("%s.password must be base64 encoded", key)
 		}
 	case "hmac":
-		if w.Authentication.Parameters.HeaderName == "" {
-			return fmt.Errorf("webhook.authentication.header_name is required for hmac auth")
+		if a.Parameters.HeaderName == "" {
+			return fmt.Errorf("%s.header_name is required for hmac auth", key)
 		}
-		if w.Authentication.Parameters.SecretKey == "" {
-			return fmt.Errorf("webhook.authentication.secret_key is required for hmac auth")
+		if a.Parameters.SecretKey == "" {
+			return fmt.Errorf("%s.secret_key is required for hmac auth", key)
 		}
-		if w.Authentication.Parameters.GetSecretKey() == nil {
-			return fmt.Errorf("webhook.authentication.secret_key must be base64 encoded")
+		if a.Parameters.GetSecretKey() == nil {
+			return fmt.Errorf("%s.secret_key must be base64 encoded", key)
 		}
-		w.Authentication.Parameters.HashAlgorithm = strings.ToLower(w.Authentication.Parameters.HashAlgorithm)
-		switch w.Authentication.Parameters.HashAlgorithm {
+		a.Parameters.HashAlgorithm = strings.ToLower(a.Parameters.HashAlgorithm)
+		switch a.Parameters.HashAlgorithm {
 		case "sha256":
-			w.Authentication.Parameters.hasher = sha256.New
+			a.Parameters.hasher = sha256.New
 		default:
-			return fmt.Errorf("unsupported hash algorithm '%s'", w.Authentication.Parameters.HashAlgorithm)
+			return fmt.Errorf("unsupported hash algorithm '%s'", a.Parameters.HashAlgorithm)
 		}
 	case "bearer":
-		if w.Authentication.Parameters.SecretKey == "" {
-			return fmt.Errorf("webhook.authentication.secret_key is required for bearer auth")
+		if a.Parameters.SecretKey == "" {
+			return fmt.Errorf("%s.secret_key is required for bearer auth", key)
 		}
 	case "shared_secret":
-		if w.Authentication.Parameters.SecretKey == "" {
-			return fmt.Errorf("webhook.authentication.secret_key is required for shared secret auth")
+		if a.Parameters.SecretKey == "" {
+			return fmt.Errorf("%s.secret_key is required for shared secret auth", key)
 		}
-		if w.Authentication.Parameters.HeaderName == "" {
-			return fmt.Errorf("webhook.authentication.header_name is required for shared secret auth")
+		if a.Parameters.HeaderName == "" {
+			return fmt.Errorf("%s.header_name is required for shared secret auth", key)
 		}
 	default:
-		return fmt.Errorf("unsupported authentication method '%s'", w.Authentication.Method)
+		return fmt.Errorf("unsupported authentication method '%s'", a.Method)
 	}
 	return nil
 }
+
+// SetHeaders adds the headers for basic, bearer and shared secret authentication to a request.
+// HMAC authentication depends on the request body, so it is left to the caller.
+func (a *WebhookAuthentication) SetHeaders(req *http.Request) {
+	switch a.Method {
+	case "basic":
+		req.SetBasicAuth(a.Parameters.Username, string(a.Parameters.GetPassword()))
+	case "shared_secret":
+		req.Header.Set(a.Parameters.HeaderName, string(a.Parameters.GetSecretKey()))
+	case "bearer":
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.Parameters.GetSecretKey()))
+	}
+}
@@ -0,0 +1,173 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+	"text/template"
+
+	"github.com/itchyny/gojq"
+)
+
+const (
+	defaultWebhookWrapperKey = "events"
+	ndjsonContentType        = "application/x-ndjson"
+	textContentType          = "text/plain"
+)
+
+// WebhookFramings are the ways the events in a webhook payload can be framed.
+var WebhookFramings = []string{"ndjson", "json_array", "wrapper", "concatenated"}
+
+// WebhookPayload customizes the payloads sent to a webhook, for endpoints such as ServiceNow
+// that expect events in their own shape. Each event can be rendered with a Go template or a
+// jq expression, and the events of a payload are framed as newline-delimited JSON, a JSON
+// array, an array in a wrapper object such as {"events":[...]}, or concatenated without
+// separators, as some older receivers expect. Formatted events such as CEF are always sent
+// one per line.
+type WebhookPayload struct {
+	Framing     string `yaml:"framing,omitempty"`      // ndjson, json_array, wrapper or concatenated; default ndjson
+	WrapperKey  string `yaml:"wrapper_key,omitempty"`  // wrapper: key of the events array; default events
+	Template    string `yaml:"template,omitempty"`     // text/template rendered with each event
+	JQ          string `yaml:"jq,omitempty"`           // jq expression applied to each event; each result is an event
+	ContentType string `yaml:"content_type,omitempty"` // default application/x-ndjson for ndjson, text/plain for cef and leef, else application/json
+	template    *template.Template
+	jq          *gojq.Code
+}
+
+// WebhookTemplateFuncs are the functions that webhook payload templates can call.
+var WebhookTemplateFuncs = template.FuncMap{
+	// json renders a value as JSON, e.g. {{ json .args }} or {{ .cmdline | json }}
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// EventTemplate returns the template that each event is rendered with, or nil.
+func (p *WebhookPayload) EventTemplate() *template.Template {
+	if p == nil {
+		return nil
+	}
+	return p.template
+}
+
+// EventJQ returns the jq expression that each event is run through, or nil.
+func (p *WebhookPayload) EventJQ() *gojq.Code {
+	if p == nil {
+		return nil
+	}
+	return p.jq
+}
+
+// ValidateWebhookPayload validates the payload settings of a webhook and sets its framing.
+// Presets set the framing their vendor expects; otherwise events are sent as NDJSON, or as
+// lines of text for formats such as CEF, unless the payload settings say otherwise.
+func ValidateWebhookPayload(w *Webhook) error {
+	textFormat := w.Format.Text()
+	p := w.Payload
+	if p == nil {
+		switch {
+		case w.Preset != "":
+		case textFormat:
+			w.delimiter, w.contentType = []byte("\n"), textContentType
+		default:
+			w.delimiter, w.contentType = []byte("\n"), ndjsonContentType
+		}
+		return nil
+	}
+	if w.Preset != "" {
+		return fmt.Errorf("webhook.payload is not supported with the %s preset", w.Preset)
+	}
+
+	p.Framing = strings.ToLower(p.Framing)
+	if p.Framing == "" {
+		p.Framing = "ndjson"
+	}
+	switch p.Framing {
+	case "ndjson":
+		w.delimiter, w.contentType = []byte("\n"), ndjsonContentType
+		if textFormat {
+			w.contentType = textContentType
+		}
+	case "concatenated":
+		// lines of text can't be told apart without a separator
+		if textFormat {
+			w.delimiter, w.contentType = []byte("\n"), textContentType
+		}
+	case "json_array":
+		w.jsonArray = true
+	case "wrapper":
+		if p.WrapperKey == "" {
+			p.WrapperKey = defaultWebhookWrapperKey
+		}
+		w.jsonArray = true
+	default:
+		return fmt.Errorf("webhook.payload.framing must be one of %s", strings.Join(WebhookFramings, ", "))
+	}
+	if p.WrapperKey != "" && p.Framing != "wrapper" {
+		return fmt.Errorf("webhook.payload.wrapper_key is only supported with wrapper framing")
+	}
+
+	if p.Template != "" && p.JQ != "" {
+		return fmt.Errorf("webhook.payload.template and webhook.payload.jq are mutually exclusive")
+	}
+	if (p.Template != "" || p.JQ != "") && textFormat {
+		return fmt.Errorf("webhook.payload.template and webhook.payload.jq require json format")
+	}
+	// formatted events such as CEF are lines of text, which can't be put in a JSON array
+	if p.Framing != "ndjson" && p.Framing != "concatenated" && textFormat {
+		return fmt.Errorf("webhook.payload.framing %s requires json format; use ndjson or concatenated with %s", p.Framing, strings.ToLower(w.Format.Type))
+	}
+	if p.Template != "" {
+		t, err := template.New("webhook.payload.template").Funcs(WebhookTemplateFuncs).Parse(p.Template)
+		if err != nil {
+			return fmt.Errorf("failed to parse webhook.payload.template: %w", err)
+		}
+		if err := t.Execute(io.Discard, map[string]any{}); err != nil {
+			return fmt.Errorf("invalid webhook.payload.template: %w", err)
+		}
+		p.template = t
+	}
+	if p.JQ != "" {
+		q, err := gojq.Parse(p.JQ)
+		if err != nil {
+			return fmt.Errorf("failed to parse webhook.payload.jq: %w", err)
+		}
+		if p.jq, err = gojq.Compile(q); err != nil {
+			return fmt.Errorf("failed to compile webhook.payload.jq: %w", err)
+		}
+	}
+
+	if p.ContentType != "" {
+		if _, _, err := mime.ParseMediaType(p.ContentType); err != nil {
+			return fmt.Errorf("webhook.payload.content_type is not a valid media type: %w", err)
+		}
+	}
+	return nil
+}
+
+// ContentType returns the content type of the payloads sent to the webhook.
+func (w *Webhook) ContentType() string {
+	if w.Payload != nil && w.Payload.ContentType != "" {
+		return w.Payload.ContentType
+	}
+	if w.contentType != "" {
+		return w.contentType
+	}
+	return "application/json"
+}
+
+// WrapperKey returns the key of the events array in the wrapper object that payloads are
+// sent in, or "" if they are not wrapped.
+func (w *Webhook) WrapperKey() string {
+	if w.Payload == nil {
+		return ""
+	}
+	return w.Payload.WrapperKey
+}
@@ -0,0 +1,108 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookPayload(t *testing.T) {
+	// without a preset or payload settings, events are sent as NDJSON
+	w := &Webhook{Endpoint: "https://example.com"}
+	require.NoError(t, ValidateWebhook(w))
+	assert.Equal(t, []byte("\n"), w.Delimiter())
+	assert.False(t, w.JSONArray())
+	assert.Equal(t, "application/x-ndjson", w.ContentType())
+
+	w = &Webhook{Endpoint: "https://example.com", Payload: &WebhookPayload{Framing: "Concatenated"}}
+	require.NoError(t, ValidateWebhook(w))
+	assert.Empty(t, w.Delimiter())
+	assert.False(t, w.JSONArray())
+	assert.Equal(t, "application/json", w.ContentType())
+
+	// formatted events such as CEF are always sent as lines of text, whatever the framing
+	for _, p := range []*WebhookPayload{nil, {}, {ContentType: "text/x-leef"}, {Framing: "ndjson"}, {Framing: "concatenated"}} {
+		w = &Webhook{Endpoint: "https://example.com", Format: &Format{Type: "leef"}, Payload: p}
+		require.NoError(t, ValidateWebhook(w))
+		assert.Equal(t, []byte("\n"), w.Delimiter())
+		assert.False(t, w.JSONArray())
+		if p == nil || p.ContentType == "" {
+			assert.Equal(t, "text/plain", w.ContentType())
+		}
+	}
+
+	// the format type is matched case-insensitively, however it was normalized
+	w = &Webhook{Endpoint: "https://example.com", Format: &Format{Type: "CEF"}, Payload: &WebhookPayload{Framing: "ndjson"}}
+	require.NoError(t, ValidateWebhookPayload(w))
+	assert.Equal(t, []byte("\n"), w.Delimiter())
+	assert.Equal(t, "text/plain", w.ContentType())
+	w = &Webhook{Endpoint: "https://example.com", Format: &Format{Type: "LEEF"}, Payload: &WebhookPayload{Framing: "json_array"}}
+	assert.ErrorContains(t, ValidateWebhookPayload(w), "framing json_array requires json format")
+
+	// an empty format type is json
+	w = &Webhook{Endpoint: "https://example.com", Format: &Format{}, Payload: &WebhookPayload{Framing: "json_array"}}
+	require.NoError(t, ValidateWebhookPayload(w))
+	assert.True(t, w.JSONArray())
+	assert.Equal(t, "application/json", w.ContentType())
+
+	w = &Webhook{Endpoint: "https://example.com", Payload: &WebhookPayload{ContentType: "text/plain"}}
+	require.NoError(t, ValidateWebhook(w))
+	assert.Equal(t, "ndjson", w.Payload.Framing)
+	assert.Equal(t, "text/plain", w.ContentType())
+
+	// presets keep the framing and content type their vendor expects
+	w = &Webhook{Preset: "sumologic", Endpoint: "https://endpoint1.collection.sumologic.com/receiver/v1/http/token"}
+	require.NoError(t, ValidateWebhook(w))
+	assert.Equal(t, "application/json", w.ContentType())
+
+	w = &Webhook{Endpoint: "https://example.com", Payload: &WebhookPayload{Framing: "Wrapper"}}
+	require.NoError(t, ValidateWebhook(w))
+	assert.True(t, w.JSONArray())
+	assert.Equal(t, "events", w.WrapperKey())
+	assert.Equal(t, "application/json", w.ContentType())
+
+	w = &Webhook{Endpoint: "https://example.com", Payload: &WebhookPayload{
+		Framing: "ndjson",
+		JQ:      `select(.schema | startswith("event_redflag")) | {short_description: .description}`,
+	}}
+	require.NoError(t, ValidateWebhook(w))
+	assert.Equal(t, []byte("\n"), w.Delimiter())
+	assert.NotNil(t, w.Payload.EventJQ())
+	assert.Equal(t, "application/x-ndjson", w.ContentType())
+
+	w = &Webhook{Endpoint: "https://example.com", Payload: &WebhookPayload{Template: `{"id":{{ json .id }}}`}}
+	require.NoError(t, ValidateWebhook(w))
+	assert.NotNil(t, w.Payload.EventTemplate())
+	assert.Equal(t, "", w.WrapperKey())
+
+	tests := []struct {
+		name    string
+		webhook *Webhook
+		err     string
+	}{
+		{"preset", &Webhook{Preset: "sumologic", Endpoint: "https://example.com", Payload: &WebhookPayload{Framing: "json_array"}}, "webhook.payload is not supported with the sumologic preset"},
+		{"unknown framing", &Webhook{Endpoint: "https://example.com", Payload: &WebhookPayload{Framing: "xml"}}, "framing must be one of ndjson, json_array, wrapper, concatenated"},
+		{"wrapper key without wrapper", &Webhook{Endpoint: "https://example.com", Payload: &WebhookPayload{WrapperKey: "records"}}, "wrapper_key is only supported with wrapper framing"},
+		{"template and jq", &Webhook{Endpoint: "https://example.com", Payload: &WebhookPayload{Template: "{}", JQ: "."}}, "mutually exclusive"},
+		{"template with cef", &Webhook{Endpoint: "https://example.com", Format: &Format{Type: "cef"}, Payload: &WebhookPayload{Template: "{}"}}, "require json format"},
+		{"json_array with cef", &Webhook{Endpoint: "https://example.com", Format: &Format{Type: "cef"}, Payload: &WebhookPayload{Framing: "json_array"}}, "framing json_array requires json format; use ndjson or concatenated with cef"},
+		{"wrapper with leef", &Webhook{Endpoint: "https://example.com", Format: &Format{Type: "LEEF"}, Payload: &WebhookPayload{Framing: "wrapper"}}, "framing wrapper requires json format; use ndjson or concatenated with leef"},
+		{"bad template", &Webhook{Endpoint: "https://example.com", Payload: &WebhookPayload{Template: "{{ .id "}}, "failed to parse webhook.payload.template"},
+		{"unknown function", &Webhook{Endpoint: "https://example.com", Payload: &WebhookPayload{Template: "{{ yaml .id }}"}}, "failed to parse webhook.payload.template"},
+		{"bad jq", &Webhook{Endpoint: "https://example.com", Payload: &WebhookPayload{JQ: "{id: .id"}}, "failed to parse webhook.payload.jq"},
+		{"undefined jq function", &Webhook{Endpoint: "https://example.com", Payload: &WebhookPayload{JQ: "nosuch(.id)"}}, "failed to compile webhook.payload.jq"},
+		{"bad content type", &Webhook{Endpoint: "https://example.com", Payload: &WebhookPayload{ContentType: "json;;"}}, "content_type is not a valid media type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateWebhook(tt.webhook)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
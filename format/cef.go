@@ -0,0 +1,95 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package format
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// cefFields are the default CEF extension keys and the record fields they are read from.
+var cefFields = map[string]string{
+	"dhost":      "runtime_details.hostname",
+	"src":        "runtime_details.ip_addresses.0",
+	"smac":       "runtime_details.mac_addresses.0",
+	"externalId": "id",
+	"msg":        "description",
+	"suser":      "auser",
+	"duser":      "euser",
+	"request":    "linkback",
+	"cs1":        "muid",
+	"cs2":        "schema",
+}
+
+// cefLabels are the default labels for the custom extension fields.
+var cefLabels = map[string]string{
+	"cs1Label": "muid",
+	"cs2Label": "schema",
+}
+
+// CEF renders records in ArcSight Common Event Format.
+type CEF struct {
+	fields  []field
+	labels  map[string]string
+	options Options
+}
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`)
+)
+
+// Format implements Formatter.
+func (c *CEF) Format(record []byte) ([]byte, error) {
+	p := parserPool.Get()
+	defer parserPool.Put(p)
+
+	v, err := p.ParseBytes(record)
+	if err != nil {
+		return nil, err
+	}
+
+	signature := lookup(v, strings.Split(c.options.SignatureField, "."))
+	name := signature
+	if c.options.NameField != "" {
+		name = lookup(v, strings.Split(c.options.NameField, "."))
+	} else {
+		for _, f := range []string{"name", "short_name", "trigger_short_name", "description"} {
+			if n := lookup(v, []string{f}); n != "" {
+				name = n
+				break
+			}
+		}
+	}
+
+	b := &bytes.Buffer{}
+	b.WriteString("CEF:0|")
+	for _, h := range []string{deviceVendor, deviceProduct, deviceVersion, signature, name} {
+		b.WriteString(cefHeaderEscaper.Replace(h))
+		b.WriteByte('|')
+	}
+	b.WriteString(strconv.Itoa(severity(v, c.options.SeverityField)))
+	b.WriteByte('|')
+
+	b.WriteString("rt=")
+	b.WriteString(strconv.FormatInt(int64(v.GetFloat64("time")*1000), 10))
+	for _, f := range c.fields {
+		value := lookup(v, f.path)
+		if value == "" {
+			continue
+		}
+		if label, found := c.labels[f.key+"Label"]; found {
+			b.WriteByte(' ')
+			b.WriteString(f.key + "Label=")
+			b.WriteString(cefExtensionEscaper.Replace(label))
+		}
+		b.WriteByte(' ')
+		b.WriteString(f.key)
+		b.WriteByte('=')
+		b.WriteString(cefExtensionEscaper.Replace(value))
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,150 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+// format renders records in the formats expected by the various outputs.
+package format
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/valyala/fastjson"
+)
+
+const (
+	deviceVendor  = "Spyderbat"
+	deviceProduct = "Event Forwarder"
+	deviceVersion = "2"
+)
+
+var parserPool = fastjson.ParserPool{}
+
+// Formatter renders a JSON record for output.
+type Formatter interface {
+	Format(record []byte) ([]byte, error)
+}
+
+// Options configures a Formatter.
+type Options struct {
+	Type           string            // json, cef or leef
+	Fields         map[string]string // extension/attribute key -> record field path; an empty path removes a default
+	Labels         map[string]string // labels for custom extension fields, e.g. cs3Label (cef only)
+	SignatureField string            // record field used for the event id
+	NameField      string            // record field used for the event name (cef only)
+	SeverityField  string            // record field used for the severity
+}
+
+// New returns a Formatter for the given options. The json format returns nil, since
+// records are already JSON.
+func New(o Options) (Formatter, error) {
+	if o.SignatureField == "" {
+		o.SignatureField = "schema"
+	}
+	if o.SeverityField == "" {
+		o.SeverityField = "severity"
+	}
+
+	switch o.Type {
+	case "", "json":
+		return nil, nil
+	case "cef":
+		labels := make(map[string]string, len(cefLabels)+len(o.Labels))
+		for k, v := range cefLabels {
+			labels[k] = v
+		}
+		for k, v := range o.Labels {
+			labels[k] = v
+		}
+		return &CEF{fields: mergeFields(cefFields, o.Fields), labels: labels, options: o}, nil
+	case "leef":
+		return &LEEF{fields: mergeFields(leefFields, o.Fields), options: o}, nil
+	}
+	return nil, fmt.Errorf("unsupported format '%s'", o.Type)
+}
+
+// field is an output key and the record field it is read from.
+type field struct {
+	key  string
+	path []string
+}
+
+// mergeFields overlays the configured fields on the defaults, and returns them sorted by key
+// so that output is deterministic.
+func mergeFields(defaults, overrides map[string]string) []field {
+	merged := make(map[string]string, len(defaults)+len(overrides))
+	for k, v := range defaults {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		merged[k] = v
+	}
+
+	fields := make([]field, 0, len(merged))
+	for k, v := range merged {
+		if v == "" {
+			continue
+		}
+		fields = append(fields, field{key: k, path: strings.Split(v, ".")})
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].key < fields[j].key })
+	return fields
+}
+
+// lookup returns the string form of the value at path: strings as-is, arrays joined with
+// commas, and anything else as JSON. Missing and null values return "".
+func lookup(v *fastjson.Value, path []string) string {
+	e := v.Get(path...)
+	if e == nil {
+		return ""
+	}
+	switch e.Type() {
+	case fastjson.TypeNull:
+		return ""
+	case fastjson.TypeString:
+		return string(e.GetStringBytes())
+	case fastjson.TypeArray:
+		a := e.GetArray()
+		s := make([]string, 0, len(a))
+		for _, ae := range a {
+			if ae.Type() == fastjson.TypeString {
+				s = append(s, string(ae.GetStringBytes()))
+			} else {
+				s = append(s, ae.String())
+			}
+		}
+		return strings.Join(s, ",")
+	}
+	return e.String()
+}
+
+// severities maps spyderbat severities to the 0-10 scale used by CEF and LEEF.
+var severities = map[string]int{
+	"info":     1,
+	"low":      3,
+	"medium":   5,
+	"high":     8,
+	"critical": 10,
+}
+
+// severity returns a 0-10 severity from the severity field, falling back to the trace
+// score (0-100) if there is no severity.
+func severity(v *fastjson.Value, path string) int {
+	s := lookup(v, strings.Split(path, "."))
+	if sev, found := severities[strings.ToLower(s)]; found {
+		return sev
+	}
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 && n <= 10 {
+		return n
+	}
+	if v.Get("score") != nil {
+		score := v.GetInt("score") / 10
+		if score > 10 {
+			score = 10
+		}
+		return score
+	}
+	return 0
+}
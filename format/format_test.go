@@ -0,0 +1,79 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package format
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// formatGolden formats every record in testdata/records.ndjson and compares the output to
+// testdata/<name>.golden.
+func formatGolden(t *testing.T, name string, o Options) {
+	f, err := New(o)
+	require.NoError(t, err)
+
+	data, err := os.ReadFile("testdata/records.ndjson")
+	require.NoError(t, err)
+
+	out := &bytes.Buffer{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		formatted, err := f.Format(scanner.Bytes())
+		require.NoError(t, err)
+		out.Write(formatted)
+		out.WriteByte('\n')
+	}
+	require.NoError(t, scanner.Err())
+
+	golden := filepath.Join("testdata", name+".golden")
+	if *update {
+		require.NoError(t, os.WriteFile(golden, out.Bytes(), 0644))
+	}
+	expected, err := os.ReadFile(golden)
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), out.String())
+}
+
+func TestCEF(t *testing.T) {
+	formatGolden(t, "cef", Options{Type: "cef"})
+}
+
+func TestCEFMapping(t *testing.T) {
+	formatGolden(t, "cef_mapping", Options{
+		Type:           "cef",
+		Fields:         map[string]string{"cs3": "runtime_details.cloud_instance_id", "cs2": "", "dhost": "muid"},
+		Labels:         map[string]string{"cs3Label": "instance"},
+		SignatureField: "id",
+		NameField:      "schema",
+	})
+}
+
+func TestLEEF(t *testing.T) {
+	formatGolden(t, "leef", Options{Type: "leef"})
+}
+
+func TestNew(t *testing.T) {
+	f, err := New(Options{Type: "json"})
+	require.NoError(t, err)
+	assert.Nil(t, f)
+
+	_, err = New(Options{Type: "kittens"})
+	assert.Error(t, err)
+
+	f, err = New(Options{Type: "cef"})
+	require.NoError(t, err)
+	_, err = f.Format([]byte(`{`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,77 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package format
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// leefFields are the default LEEF attributes and the record fields they are read from.
+var leefFields = map[string]string{
+	"identHostName": "runtime_details.hostname",
+	"src":           "runtime_details.ip_addresses.0",
+	"srcMAC":        "runtime_details.mac_addresses.0",
+	"externalId":    "id",
+	"msg":           "description",
+	"usrName":       "euser",
+	"accountName":   "auser",
+	"url":           "linkback",
+	"muid":          "muid",
+	"schema":        "schema",
+}
+
+const leefTimeFormat = "MMM dd yyyy HH:mm:ss.SSS z"
+
+// LEEF renders records in IBM QRadar Log Event Extended Format (version 1.0, tab delimited).
+type LEEF struct {
+	fields  []field
+	options Options
+}
+
+var (
+	leefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ")
+	leefAttributeEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+)
+
+// Format implements Formatter.
+func (l *LEEF) Format(record []byte) ([]byte, error) {
+	p := parserPool.Get()
+	defer parserPool.Put(p)
+
+	v, err := p.ParseBytes(record)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &bytes.Buffer{}
+	b.WriteString("LEEF:1.0|")
+	for _, h := range []string{deviceVendor, deviceProduct, deviceVersion, lookup(v, strings.Split(l.options.SignatureField, "."))} {
+		b.WriteString(leefHeaderEscaper.Replace(h))
+		b.WriteByte('|')
+	}
+
+	t := time.UnixMilli(int64(v.GetFloat64("time") * 1000)).UTC()
+	b.WriteString("devTime=")
+	b.WriteString(t.Format("Jan 02 2006 15:04:05.000 MST"))
+	b.WriteString("\tdevTimeFormat=")
+	b.WriteString(leefTimeFormat)
+	b.WriteString("\tsev=")
+	b.WriteString(strconv.Itoa(severity(v, l.options.SeverityField)))
+
+	for _, f := range l.fields {
+		value := lookup(v, f.path)
+		if value == "" {
+			continue
+		}
+		b.WriteByte('\t')
+		b.WriteString(f.key)
+		b.WriteByte('=')
+		b.WriteString(leefAttributeEscaper.Replace(value))
+	}
+	return b.Bytes(), nil
+}
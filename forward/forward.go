@@ -0,0 +1,336 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+// forward sends records to Fluentd or Fluent Bit over the Forward protocol.
+package forward
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"spyderbat-event-forwarder/config"
+	"spyderbat-event-forwarder/logwrapper"
+	"spyderbat-event-forwarder/sink"
+
+	"github.com/valyala/fastjson"
+)
+
+var (
+	dialTimeout    = 30 * time.Second
+	ackTimeout     = 60 * time.Second // how long to wait for a chunk to be acknowledged
+	retryBaseDelay = 1 * time.Second  // doubled after each failed attempt
+	maxRetries     = 5
+)
+
+var parserPool = fastjson.ParserPool{}
+
+// Forward is a sink that sends records in PackedForward mode, batching each tag separately.
+// When acks are required, a chunk that is not acknowledged is sent again on a new connection,
+// so records are delivered at least once.
+type Forward struct {
+	c *config.Forward
+
+	lock   sync.Mutex
+	groups map[string]*sink.Batcher // tag -> batcher
+
+	// batches for all tags share one connection
+	connLock sync.Mutex
+	conn     net.Conn
+	r        *bufio.Reader
+}
+
+// New creates a new Forward sink from the given config. If the config is nil, nil is returned.
+// A nil Forward will silently drop all records.
+func New(c *config.Forward) *Forward {
+	if c == nil {
+		return nil
+	}
+	return &Forward{
+		c:      c,
+		groups: make(map[string]*sink.Batcher),
+	}
+}
+
+// Send queues a record for sending with the tag for its schema. The record time is used as the
+// event time. Calling Send after Shutdown will panic.
+func (f *Forward) Send(record []byte) {
+	f.SendOriginal(record, record)
+}
+
+// SendOriginal queues a record for sending, taking the tag and event time from the schema and
+// time of original, the record before it was transformed. cef and leef formats render original.
+// Calling SendOriginal after Shutdown will panic.
+func (f *Forward) SendOriginal(record, original []byte) {
+	if f == nil || len(record) == 0 {
+		return
+	}
+
+	p := parserPool.Get()
+	defer parserPool.Put(p)
+	v, err := p.ParseBytes(record)
+	if err != nil || v.Type() != fastjson.TypeObject {
+		logwrapper.Logger().Warn().Err(err).Msg("dropping invalid record for forward")
+		return
+	}
+	ov := v
+	if !bytes.Equal(original, record) {
+		op := parserPool.Get()
+		defer parserPool.Put(op)
+		if ov, err = op.ParseBytes(original); err != nil {
+			logwrapper.Logger().Warn().Err(err).Msg("dropping invalid record for forward")
+			return
+		}
+	}
+	family := string(ov.GetStringBytes("schema"))
+	if i := strings.IndexByte(family, ':'); i >= 0 {
+		family = family[:i]
+	}
+
+	// each entry is [time, record]
+	ts := time.Now()
+	if t := ov.GetFloat64("time"); t > 0 {
+		ts = time.Unix(0, int64(t*1e9))
+	}
+	entry := appendArrayHeader(nil, 2)
+	entry = appendEventTime(entry, uint32(ts.Unix()), uint32(ts.Nanosecond()))
+
+	if formatter := f.c.Format.Formatter(); formatter != nil {
+		formatted, err := formatter.Format(original)
+		if err != nil {
+			logwrapper.Logger().Warn().Err(err).Msg("unable to format event for forward; sending it unformatted")
+			entry = appendJSON(entry, v)
+		} else {
+			entry = appendMapHeader(entry, 1)
+			entry = appendString(entry, "message")
+			entry = appendString(entry, string(formatted))
+		}
+	} else {
+		entry = appendJSON(entry, v)
+	}
+
+	f.batcherFor(f.c.TagFor(family)).Add(entry)
+}
+
+// batcherFor returns the batcher for a tag, creating it if needed.
+func (f *Forward) batcherFor(tag string) *sink.Batcher {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	b, found := f.groups[tag]
+	if !found {
+		b = sink.NewBatcher(sink.BatchOptions{MaxBytes: f.c.MaxPayloadBytes}, func(b *sink.Batch) { f.sendBatch(tag, b) })
+		f.groups[tag] = b
+	}
+	return b
+}
+
+// Shutdown flushes the queues and shuts down the sink. It will block until the queues are empty.
+func (f *Forward) Shutdown() {
+	log.Printf("shutting down forward")
+	if f == nil {
+		return
+	}
+	f.lock.Lock()
+	for _, b := range f.groups {
+		b.Shutdown()
+	}
+	f.lock.Unlock()
+
+	f.connLock.Lock()
+	defer f.connLock.Unlock()
+	f.disconnect()
+}
+
+// sendBatch sends a batch of entries as one PackedForward message, retrying on a new
+// connection if it fails or is not acknowledged.
+func (f *Forward) sendBatch(tag string, b *sink.Batch) {
+	chunk := ""
+	if f.c.AckRequired() {
+		id := make([]byte, 16)
+		_, _ = rand.Read(id)
+		chunk = base64.StdEncoding.EncodeToString(id)
+	}
+
+	// [tag, entries, {size, chunk}]
+	msg := make([]byte, 0, b.Bytes+len(tag)+64)
+	msg = appendArrayHeader(msg, 3)
+	msg = appendString(msg, tag)
+	msg = appendBinHeader(msg, b.Bytes)
+	for _, entry := range b.Records {
+		msg = append(msg, entry...)
+	}
+	if chunk == "" {
+		msg = appendMapHeader(msg, 1)
+	} else {
+		msg = appendMapHeader(msg, 2)
+		msg = appendString(msg, "chunk")
+		msg = appendString(msg, chunk)
+	}
+	msg = appendString(msg, "size")
+	msg = appendInt(msg, int64(len(b.Records)))
+
+	for attempt := 0; ; attempt++ {
+		err := f.deliver(msg, chunk)
+		if err == nil {
+			logwrapper.Logger().Info().
+				Str("tag", tag).
+				Int("events", len(b.Records)).
+				Int("bytes", len(msg)).
+				Msg("sent to forward")
+			return
+		}
+		if attempt >= maxRetries {
+			logwrapper.Logger().Error().Err(err).Str("tag", tag).Int("events", len(b.Records)).Msg("Failed to send records to forward")
+			return
+		}
+		logwrapper.Logger().Warn().Err(err).Str("tag", tag).Msg("retrying records for forward")
+		time.Sleep(retryBaseDelay << attempt)
+	}
+}
+
+// deliver writes a message and waits for the ack of its chunk, if it has one. On any error the
+// connection is closed, so that the next attempt starts afresh.
+func (f *Forward) deliver(msg []byte, chunk string) error {
+	f.connLock.Lock()
+	defer f.connLock.Unlock()
+
+	if f.conn == nil {
+		if err := f.connect(); err != nil {
+			f.disconnect()
+			return err
+		}
+	}
+	err := f.writeAndAck(msg, chunk)
+	if err != nil {
+		f.disconnect()
+	}
+	return err
+}
+
+func (f *Forward) writeAndAck(msg []byte, chunk string) error {
+	_ = f.conn.SetDeadline(time.Now().Add(ackTimeout))
+	if _, err := f.conn.Write(msg); err != nil {
+		return err
+	}
+	if chunk == "" {
+		return nil
+	}
+
+	resp, err := decode(f.r)
+	if err != nil {
+		return fmt.Errorf("failed to read ack: %w", err)
+	}
+	m, _ := resp.(map[string]any)
+	if ack, _ := asString(m["ack"]); ack != chunk {
+		return fmt.Errorf("unexpected ack %v", resp)
+	}
+	return nil
+}
+
+func (f *Forward) connect() error {
+	dialer := &net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second}
+	var conn net.Conn
+	var err error
+	if f.c.TLS {
+		host, _, _ := net.SplitHostPort(f.c.Address)
+		conn, err = tls.DialWithDialer(dialer, "tcp", f.c.Address, &tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: f.c.Insecure,
+		})
+	} else {
+		conn, err = dialer.Dial("tcp", f.c.Address)
+	}
+	if err != nil {
+		return err
+	}
+	f.conn = conn
+	f.r = bufio.NewReader(conn)
+
+	if f.c.SharedKey == "" {
+		return nil
+	}
+	_ = conn.SetDeadline(time.Now().Add(dialTimeout))
+	return f.handshake()
+}
+
+func (f *Forward) disconnect() {
+	if f.conn != nil {
+		_ = f.conn.Close()
+	}
+	f.conn = nil
+	f.r = nil
+}
+
+func digest(parts ...string) string {
+	h := sha512.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// handshake authenticates with the server: it sends HELO with a nonce (and a salt, for user
+// authentication), we answer with PING, and it proves it knows the shared key with PONG.
+func (f *Forward) handshake() error {
+	resp, err := decode(f.r)
+	if err != nil {
+		return fmt.Errorf("failed to read HELO: %w", err)
+	}
+	helo, _ := resp.([]any)
+	if len(helo) < 2 || helo[0] != "HELO" {
+		return fmt.Errorf("expected HELO, got %v", resp)
+	}
+	opts, _ := helo[1].(map[string]any)
+	nonce, _ := asString(opts["nonce"])
+	authSalt, _ := asString(opts["auth"])
+
+	saltBytes := make([]byte, 16)
+	_, _ = rand.Read(saltBytes)
+	salt := hex.EncodeToString(saltBytes)
+
+	passwordDigest := ""
+	if f.c.Username != "" {
+		passwordDigest = digest(authSalt, f.c.Username, f.c.Password)
+	}
+	ping := appendArrayHeader(nil, 6)
+	ping = appendString(ping, "PING")
+	ping = appendString(ping, f.c.SelfHostname)
+	ping = appendString(ping, salt)
+	ping = appendString(ping, digest(salt, f.c.SelfHostname, nonce, f.c.SharedKey))
+	ping = appendString(ping, f.c.Username)
+	ping = appendString(ping, passwordDigest)
+	if _, err := f.conn.Write(ping); err != nil {
+		return err
+	}
+
+	resp, err = decode(f.r)
+	if err != nil {
+		return fmt.Errorf("failed to read PONG: %w", err)
+	}
+	pong, _ := resp.([]any)
+	if len(pong) < 5 || pong[0] != "PONG" {
+		return fmt.Errorf("expected PONG, got %v", resp)
+	}
+	if ok, _ := pong[1].(bool); !ok {
+		reason, _ := asString(pong[2])
+		return fmt.Errorf("forward authentication failed: %s", reason)
+	}
+	serverHostname, _ := asString(pong[3])
+	serverDigest, _ := asString(pong[4])
+	if serverDigest != digest(salt, serverHostname, nonce, f.c.SharedKey) {
+		return fmt.Errorf("forward server %s does not know the shared key", serverHostname)
+	}
+	return nil
+}
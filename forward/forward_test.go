@@ -0,0 +1,333 @@
+package forward
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"math/big"
+	"net"
+	"spyderbat-event-forwarder/config"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fastjson"
+)
+
+var testRecords = [][]byte{
+	[]byte(`{"schema":"model_process::1.2.0","id":"proc:1","time":1700000001.5,"pid":42,"args":["bash","-c"],"ok":true,"parent":null}`),
+	[]byte(`{"schema":"event_redflag:bash:1.0.0","id":"flag:1","time":1700000002,"score":-1.25}`),
+	[]byte(`{"schema":"model_process::1.2.0","id":"proc:2","time":1700000003}`),
+}
+
+// event is an entry received by mockForward.
+type event struct {
+	tag    string
+	time   time.Time
+	record map[string]any
+}
+
+// mockForward is a local stand-in for a Fluentd in_forward listener.
+type mockForward struct {
+	t         *testing.T
+	ln        net.Listener
+	sharedKey string
+	dropAcks  int // number of chunks to read without acknowledging
+
+	lock   sync.Mutex
+	events []event
+	chunks []string
+	conns  int
+}
+
+// start starts listening, with TLS if tlsConfig is set.
+func (m *mockForward) start(t *testing.T, tlsConfig *tls.Config) {
+	var err error
+	if tlsConfig != nil {
+		m.ln, err = tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	} else {
+		m.ln, err = net.Listen("tcp", "127.0.0.1:0")
+	}
+	require.NoError(t, err)
+	t.Cleanup(func() { m.ln.Close() })
+	go m.serve()
+}
+
+// received returns the events and chunks received so far, and the number of connections.
+func (m *mockForward) received() ([]event, []string, int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.events, m.chunks, m.conns
+}
+
+func (m *mockForward) serve() {
+	for {
+		conn, err := m.ln.Accept()
+		if err != nil {
+			return
+		}
+		m.lock.Lock()
+		m.conns++
+		m.lock.Unlock()
+		go m.handle(conn)
+	}
+}
+
+func (m *mockForward) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	if m.sharedKey != "" {
+		helo := appendArrayHeader(nil, 2)
+		helo = appendString(helo, "HELO")
+		helo = appendMapHeader(helo, 2)
+		helo = appendString(helo, "nonce")
+		helo = appendString(helo, "nonce-1")
+		helo = appendString(helo, "auth")
+		helo = appendString(helo, "")
+		_, err := conn.Write(helo)
+		require.NoError(m.t, err)
+
+		v, err := decode(r)
+		require.NoError(m.t, err)
+		ping := v.([]any)
+		require.Len(m.t, ping, 6)
+		assert.Equal(m.t, "PING", ping[0])
+		hostname, salt, sharedKeyDigest := ping[1].(string), ping[2].(string), ping[3].(string)
+		ok := sharedKeyDigest == digest(salt, hostname, "nonce-1", m.sharedKey)
+
+		pong := appendArrayHeader(nil, 5)
+		pong = appendString(pong, "PONG")
+		pong = appendBool(pong, ok)
+		pong = appendString(pong, "")
+		pong = appendString(pong, "fluentd-1")
+		pong = appendString(pong, digest(salt, "fluentd-1", "nonce-1", m.sharedKey))
+		_, err = conn.Write(pong)
+		require.NoError(m.t, err)
+		if !ok {
+			return
+		}
+	}
+
+	for {
+		v, err := decode(r)
+		if err != nil {
+			return
+		}
+		msg := v.([]any)
+		require.Len(m.t, msg, 3)
+		tag := msg[0].(string)
+		options := msg[2].(map[string]any)
+
+		entries := bufio.NewReader(bytes.NewReader(msg[1].([]byte)))
+		var events []event
+		for {
+			e, err := decode(entries)
+			if err != nil {
+				break
+			}
+			entry := e.([]any)
+			et := entry[0].(ext)
+			require.Equal(m.t, int8(0), et.Type)
+			sec, nsec := binary.BigEndian.Uint32(et.Data), binary.BigEndian.Uint32(et.Data[4:])
+			events = append(events, event{tag: tag, time: time.Unix(int64(sec), int64(nsec)), record: entry[1].(map[string]any)})
+		}
+		assert.Equal(m.t, int64(len(events)), options["size"])
+
+		m.lock.Lock()
+		chunk, _ := options["chunk"].(string)
+		if chunk != "" && m.dropAcks > 0 {
+			m.dropAcks--
+			m.lock.Unlock()
+			return
+		}
+		m.events = append(m.events, events...)
+		m.chunks = append(m.chunks, chunk)
+		m.lock.Unlock()
+
+		if chunk != "" {
+			ack := appendMapHeader(nil, 1)
+			ack = appendString(ack, "ack")
+			ack = appendString(ack, chunk)
+			_, err = conn.Write(ack)
+			require.NoError(m.t, err)
+		}
+	}
+}
+
+func newConfig(t *testing.T, m *mockForward) *config.Forward {
+	oldDelay := retryBaseDelay
+	retryBaseDelay = time.Millisecond
+	t.Cleanup(func() { retryBaseDelay = oldDelay })
+
+	cfg := &config.Forward{Address: m.ln.Addr().String(), SelfHostname: "forwarder-1"}
+	require.NoError(t, config.ValidateForward(cfg))
+	return cfg
+}
+
+func TestForward(t *testing.T) {
+	m := &mockForward{t: t, sharedKey: "secret"}
+	m.start(t, nil)
+	cfg := newConfig(t, m)
+	cfg.SharedKey = "secret"
+
+	f := New(cfg)
+	for _, r := range testRecords {
+		f.Send(r)
+	}
+	f.Shutdown()
+
+	events, chunks, conns := m.received()
+	require.Len(t, events, 3)
+	assert.Len(t, chunks, 2, "entries are batched by tag")
+	assert.Equal(t, 1, conns, "the connection is shared by tags")
+
+	byID := map[string]event{}
+	for _, e := range events {
+		byID[e.record["id"].(string)] = e
+	}
+	proc := byID["proc:1"]
+	assert.Equal(t, "spyderbat.model_process", proc.tag)
+	assert.Equal(t, time.Unix(1700000001, 500000000), proc.time)
+	assert.Equal(t, int64(42), proc.record["pid"])
+	assert.Equal(t, []any{"bash", "-c"}, proc.record["args"])
+	assert.Equal(t, true, proc.record["ok"])
+	assert.Nil(t, proc.record["parent"])
+	assert.Equal(t, "spyderbat.event_redflag", byID["flag:1"].tag)
+	assert.Equal(t, -1.25, byID["flag:1"].record["score"])
+}
+
+func TestForwardTransformedRecords(t *testing.T) {
+	m := &mockForward{t: t}
+	m.start(t, nil)
+	f := New(newConfig(t, m))
+	// an OCSF record has no Spyderbat schema and its time is in milliseconds
+	f.SendOriginal([]byte(`{"class_uid":1007,"time":1700000001500}`), testRecords[0])
+	f.Shutdown()
+
+	events, _, _ := m.received()
+	require.Len(t, events, 1)
+	assert.Equal(t, "spyderbat.model_process", events[0].tag)
+	assert.Equal(t, time.Unix(1700000001, 500000000), events[0].time)
+	assert.Equal(t, uint64(1007), events[0].record["class_uid"])
+}
+
+func TestForwardSharedKeyMismatch(t *testing.T) {
+	m := &mockForward{t: t, sharedKey: "secret"}
+	m.start(t, nil)
+	cfg := newConfig(t, m)
+	cfg.SharedKey = "wrong"
+
+	oldRetries := maxRetries
+	maxRetries = 1
+	t.Cleanup(func() { maxRetries = oldRetries })
+
+	f := New(cfg)
+	f.Send(testRecords[0])
+	f.Shutdown()
+
+	events, _, conns := m.received()
+	assert.Empty(t, events)
+	assert.Equal(t, 2, conns)
+}
+
+func TestForwardRetry(t *testing.T) {
+	m := &mockForward{t: t, dropAcks: 1}
+	m.start(t, nil)
+	cfg := newConfig(t, m)
+
+	f := New(cfg)
+	f.Send(testRecords[0])
+	f.Shutdown()
+
+	// the unacknowledged chunk is resent on a new connection
+	events, _, conns := m.received()
+	require.Len(t, events, 1)
+	assert.Equal(t, 2, conns)
+}
+
+func TestForwardNoAck(t *testing.T) {
+	m := &mockForward{t: t}
+	m.start(t, nil)
+	cfg := newConfig(t, m)
+	requireAck := false
+	cfg.RequireAck = &requireAck
+	cfg.Tag = "spyderbat"
+	cfg.Format = &config.Format{Type: "cef"}
+	require.NoError(t, config.ValidateForward(cfg))
+
+	f := New(cfg)
+	f.Send(testRecords[0])
+	f.Send(testRecords[1])
+	f.Shutdown()
+
+	// without acks, the sink does not wait for the server to read the chunk
+	require.Eventually(t, func() bool {
+		events, _, _ := m.received()
+		return len(events) == 2
+	}, time.Second, 10*time.Millisecond)
+	events, chunks, _ := m.received()
+	assert.Equal(t, []string{""}, chunks)
+	assert.Equal(t, "spyderbat", events[0].tag)
+	assert.Contains(t, events[0].record["message"], "CEF:0|Spyderbat|")
+}
+
+func TestForwardTLS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	m := &mockForward{t: t}
+	m.start(t, &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}})
+	cfg := newConfig(t, m)
+	cfg.TLS = true
+	cfg.Insecure = true
+
+	f := New(cfg)
+	f.Send(testRecords[0])
+	f.Shutdown()
+
+	events, _, _ := m.received()
+	assert.Len(t, events, 1)
+}
+
+func TestAppendJSON(t *testing.T) {
+	v := fastjson.MustParse(`{"small":1,"negative":-200,"big":18446744073709551615,"float":1.5,"exp":1e3,"s":"` +
+		strings.Repeat("x", 40) + `","nested":{"a":[1,"b"]}}`)
+	r := bufio.NewReader(bytes.NewReader(appendJSON(nil, v)))
+	decoded, err := decode(r)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{
+		"small":    int64(1),
+		"negative": int64(-200),
+		"big":      uint64(18446744073709551615),
+		"float":    1.5,
+		"exp":      1000.0,
+		"s":        strings.Repeat("x", 40),
+		"nested":   map[string]any{"a": []any{int64(1), "b"}},
+	}, decoded)
+}
+
+func TestForwardNil(t *testing.T) {
+	var f *Forward
+	f.Send(testRecords[0])
+	f.Shutdown()
+	assert.Nil(t, New(nil))
+}
@@ -0,0 +1,329 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package forward
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/valyala/fastjson"
+)
+
+// The subset of MessagePack (https://github.com/msgpack/msgpack/blob/master/spec.md) that the
+// Forward protocol needs: JSON values, binary data and the EventTime extension.
+
+func appendNil(b []byte) []byte {
+	return append(b, 0xc0)
+}
+
+func appendBool(b []byte, v bool) []byte {
+	if v {
+		return append(b, 0xc3)
+	}
+	return append(b, 0xc2)
+}
+
+func appendInt(b []byte, v int64) []byte {
+	switch {
+	case v >= 0:
+		return appendUint(b, uint64(v))
+	case v >= -32:
+		return append(b, byte(v))
+	case v >= math.MinInt8:
+		return append(b, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(v))
+	case v >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(v))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(v))
+	}
+}
+
+func appendUint(b []byte, v uint64) []byte {
+	switch {
+	case v < 128:
+		return append(b, byte(v))
+	case v <= math.MaxUint8:
+		return append(b, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(v))
+	case v <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(v))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, 0xcf), v)
+	}
+}
+
+func appendFloat(b []byte, v float64) []byte {
+	return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(v))
+}
+
+func appendString(b []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+func appendBinHeader(b []byte, n int) []byte {
+	switch {
+	case n <= math.MaxUint8:
+		return append(b, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xc5), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xc6), uint32(n))
+	}
+}
+
+func appendArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xdc), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdd), uint32(n))
+	}
+}
+
+func appendMapHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xde), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(b, 0xdf), uint32(n))
+	}
+}
+
+// appendEventTime appends a Forward protocol EventTime: extension type 0 holding seconds and
+// nanoseconds.
+func appendEventTime(b []byte, sec, nsec uint32) []byte {
+	b = append(b, 0xd7, 0x00)
+	b = binary.BigEndian.AppendUint32(b, sec)
+	return binary.BigEndian.AppendUint32(b, nsec)
+}
+
+// appendJSON appends a JSON value. Numbers without a fraction or exponent are encoded as
+// integers, if they fit.
+func appendJSON(b []byte, v *fastjson.Value) []byte {
+	switch v.Type() {
+	case fastjson.TypeObject:
+		o := v.GetObject()
+		b = appendMapHeader(b, o.Len())
+		o.Visit(func(key []byte, val *fastjson.Value) {
+			b = appendString(b, string(key))
+			b = appendJSON(b, val)
+		})
+		return b
+	case fastjson.TypeArray:
+		a := v.GetArray()
+		b = appendArrayHeader(b, len(a))
+		for _, val := range a {
+			b = appendJSON(b, val)
+		}
+		return b
+	case fastjson.TypeString:
+		return appendString(b, string(v.GetStringBytes()))
+	case fastjson.TypeNumber:
+		if raw := v.String(); !strings.ContainsAny(raw, ".eE") {
+			if i, err := v.Int64(); err == nil {
+				return appendInt(b, i)
+			}
+			if u, err := v.Uint64(); err == nil {
+				return appendUint(b, u)
+			}
+		}
+		return appendFloat(b, v.GetFloat64())
+	case fastjson.TypeTrue:
+		return appendBool(b, true)
+	case fastjson.TypeFalse:
+		return appendBool(b, false)
+	default:
+		return appendNil(b)
+	}
+}
+
+// ext is an extension value that decode does not interpret.
+type ext struct {
+	Type int8
+	Data []byte
+}
+
+// decode reads one value. Maps are decoded as map[string]any, strings as string, binary data as
+// []byte and integers as int64 or uint64.
+func decode(r *bufio.Reader) (any, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return decodeMap(r, int(c&0x0f))
+	case c&0xf0 == 0x90:
+		return decodeArray(r, int(c&0x0f))
+	case c&0xe0 == 0xa0:
+		return readString(r, int(c&0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := readLength(r, c-0xc4)
+		if err != nil {
+			return nil, err
+		}
+		return readBytes(r, n)
+	case 0xc7, 0xc8, 0xc9:
+		n, err := readLength(r, c-0xc7)
+		if err != nil {
+			return nil, err
+		}
+		return readExt(r, n)
+	case 0xca:
+		u, err := readUint(r, 4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case 0xcb:
+		u, err := readUint(r, 8)
+		return math.Float64frombits(u), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return readUint(r, 1<<(c-0xcc))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		u, err := readUint(r, size)
+		shift := 64 - 8*size
+		return int64(u<<shift) >> shift, err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return readExt(r, 1<<(c-0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := readLength(r, c-0xd9)
+		if err != nil {
+			return nil, err
+		}
+		return readString(r, n)
+	case 0xdc, 0xdd:
+		n, err := readLength(r, c-0xdc+1)
+		if err != nil {
+			return nil, err
+		}
+		return decodeArray(r, n)
+	case 0xde, 0xdf:
+		n, err := readLength(r, c-0xde+1)
+		if err != nil {
+			return nil, err
+		}
+		return decodeMap(r, n)
+	}
+	return nil, fmt.Errorf("unsupported msgpack type 0x%02x", c)
+}
+
+func decodeArray(r *bufio.Reader, n int) ([]any, error) {
+	a := make([]any, 0, min(n, 1024))
+	for i := 0; i < n; i++ {
+		v, err := decode(r)
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, v)
+	}
+	return a, nil
+}
+
+func decodeMap(r *bufio.Reader, n int) (map[string]any, error) {
+	m := make(map[string]any, min(n, 1024))
+	for i := 0; i < n; i++ {
+		k, err := decode(r)
+		if err != nil {
+			return nil, err
+		}
+		v, err := decode(r)
+		if err != nil {
+			return nil, err
+		}
+		switch k := k.(type) {
+		case string:
+			m[k] = v
+		case []byte:
+			m[string(k)] = v
+		default:
+			m[fmt.Sprint(k)] = v
+		}
+	}
+	return m, nil
+}
+
+// readLength reads a length of 1, 2 or 4 bytes, for size class 0, 1 or 2.
+func readLength(r *bufio.Reader, class byte) (int, error) {
+	u, err := readUint(r, 1<<class)
+	return int(u), err
+}
+
+func readUint(r *bufio.Reader, size int) (uint64, error) {
+	buf, err := readBytes(r, size)
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, c := range buf {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+func readBytes(r *bufio.Reader, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	_, err := io.ReadFull(r, buf)
+	return buf, err
+}
+
+func readString(r *bufio.Reader, n int) (string, error) {
+	buf, err := readBytes(r, n)
+	return string(buf), err
+}
+
+func readExt(r *bufio.Reader, n int) (ext, error) {
+	t, err := r.ReadByte()
+	if err != nil {
+		return ext{}, err
+	}
+	data, err := readBytes(r, n)
+	return ext{Type: int8(t), Data: data}, err
+}
+
+// asString returns a decoded str or bin value as a string.
+func asString(v any) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case []byte:
+		return string(v), true
+	}
+	return "", false
+}
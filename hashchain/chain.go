@@ -0,0 +1,192 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+// hashchain makes files of records tamper-evident. Each line is hashed together with the hash
+// of the line before it, so changing, reordering or removing a line changes the hash of every
+// line after it. The hashes are signed with an ed25519 key in checkpoints, which are appended
+// to a file next to the records.
+package hashchain
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	// CheckpointsSuffix is appended to the name of a file to name the file that the
+	// checkpoints of its rotated files are appended to.
+	CheckpointsSuffix = ".checkpoints"
+	// CurrentSuffix is appended to the name of a file to name the file with the latest
+	// checkpoint of the current file, which is replaced as the file grows.
+	CurrentSuffix = ".checkpoint"
+)
+
+// markInterval is the number of lines between the hashes kept in a checkpoint, which locate
+// changes in a file that fails verification.
+const markInterval = 1000
+
+// Hash is a link of the chain, encoded in hex.
+type Hash [sha256.Size]byte
+
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(h[:])), nil
+}
+
+func (h *Hash) UnmarshalText(text []byte) error {
+	if hex.DecodedLen(len(text)) != len(h) {
+		return fmt.Errorf("invalid hash length")
+	}
+	_, err := hex.Decode(h[:], text)
+	return err
+}
+
+// Checkpoint is a signed record of the chain of a file. The chain continues from one file to
+// the next as the files are rotated, so each checkpoint's prev is the head of the rotated file
+// before it, and its seq is one more.
+type Checkpoint struct {
+	Seq     int       `json:"seq"`
+	Time    time.Time `json:"time"`
+	File    string    `json:"file"`    // base name; for a rotated file, the name it was rotated to
+	Rotated bool      `json:"rotated"` // false for the current file, which may have more lines
+	Prev    Hash      `json:"prev"`    // the chain before the file's first line
+	Head    Hash      `json:"head"`    // the chain after the file's last line
+	Lines   int       `json:"lines"`
+	Marks   []Hash    `json:"marks,omitempty"` // the chain after every 1000th line
+	Sig     []byte    `json:"sig,omitempty"`   // of the checkpoint without sig
+}
+
+// message returns the bytes that are signed.
+func (c Checkpoint) message() []byte {
+	c.Sig = nil
+	b, _ := json.Marshal(c)
+	return b
+}
+
+func (c *Checkpoint) sign(key ed25519.PrivateKey) {
+	c.Sig = ed25519.Sign(key, c.message())
+}
+
+func (c *Checkpoint) verify(key ed25519.PublicKey) bool {
+	return ed25519.Verify(key, c.message(), c.Sig)
+}
+
+// chain is the state of the chain over the lines of a file.
+type chain struct {
+	prev  Hash
+	head  Hash
+	lines int
+	marks []Hash
+}
+
+func newChain(prev Hash) chain {
+	return chain{prev: prev, head: prev}
+}
+
+// add adds a line, without its newline, to the chain.
+func (c *chain) add(line []byte) {
+	h := sha256.New()
+	h.Write(c.head[:])
+	h.Write(line)
+	h.Sum(c.head[:0])
+	c.lines++
+	if c.lines%markInterval == 0 {
+		c.marks = append(c.marks, c.head)
+	}
+}
+
+// addLines adds the lines of p, which end with newlines, to the chain.
+func (c *chain) addLines(p []byte) {
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			c.add(p)
+			return
+		}
+		c.add(p[:i])
+		p = p[i+1:]
+	}
+}
+
+// readChain hashes the lines of r, starting from prev. fn, if not nil, is called with the
+// chain after each line.
+func readChain(r io.Reader, prev Hash, fn func(c *chain)) (chain, error) {
+	c := newChain(prev)
+	br := bufio.NewReaderSize(r, 64*1024)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			c.add(bytes.TrimSuffix(line, []byte{'\n'}))
+			if fn != nil {
+				fn(&c)
+			}
+		}
+		if err == io.EOF {
+			return c, nil
+		}
+		if err != nil {
+			return c, err
+		}
+	}
+}
+
+// LoadPrivateKey reads a PEM encoded PKCS #8 ed25519 private key, such as one generated with
+// "openssl genpkey -algorithm ed25519".
+func LoadPrivateKey(filename string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not PEM encoded", filename)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filename, err)
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ed25519 key", filename)
+	}
+	return edKey, nil
+}
+
+// LoadPublicKey reads a PEM encoded ed25519 public key, such as one extracted with
+// "openssl pkey -pubout". The public key of a private key file is also accepted.
+func LoadPublicKey(filename string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not PEM encoded", filename)
+	}
+	if block.Type == "PRIVATE KEY" {
+		key, err := LoadPrivateKey(filename)
+		if err != nil {
+			return nil, err
+		}
+		return key.Public().(ed25519.PublicKey), nil
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filename, err)
+	}
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ed25519 key", filename)
+	}
+	return edKey, nil
+}
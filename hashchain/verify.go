@@ -0,0 +1,180 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package hashchain
+
+import (
+	"compress/gzip"
+	"crypto/ed25519"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Result is the outcome of verifying a file.
+type Result struct {
+	File  string // base name
+	Lines int    // records covered by a checkpoint
+	Err   error  // why the file failed verification; nil if it did not
+	Note  string // anything else worth knowing, e.g. records that are not checkpointed yet
+}
+
+// Verify verifies the file at path, and the files rotated from it, against their checkpoints.
+// It returns a result for each file and for each problem with the checkpoints, oldest first.
+//
+// Rotated files that are missing are reported as failures, unless they are older than every
+// rotated file that remains, which is how files are removed by max_backups and max_age_days.
+func Verify(path string, key ed25519.PublicKey) ([]Result, error) {
+	dir := filepath.Dir(path)
+	checkpointsName := filepath.Base(path) + CheckpointsSuffix
+	checkpoints, err := readCheckpoints(path + CheckpointsSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	var valid []Checkpoint
+	var prev Hash
+	seq := 0
+	for i, c := range checkpoints {
+		fail := func(format string, args ...any) {
+			results = append(results, Result{File: checkpointsName, Err: fmt.Errorf(format, args...)})
+		}
+		switch {
+		case !c.verify(key):
+			fail("checkpoint %d has an invalid signature", c.Seq)
+		case i == 0 && c.Seq != 1:
+			fail("checkpoints before %d are missing", c.Seq)
+		case i > 0 && c.Seq != seq+1:
+			fail("checkpoints %d to %d are missing", seq+1, c.Seq-1)
+		case i > 0 && c.Prev != prev:
+			fail("checkpoint %d does not follow checkpoint %d", c.Seq, seq)
+		}
+		if c.verify(key) {
+			valid = append(valid, c)
+		}
+		// continue from this checkpoint, so that one problem is reported once
+		seq, prev = c.Seq, c.Head
+	}
+
+	backups, err := backupFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	onDisk := make(map[string]bool, len(backups))
+	for _, name := range backups {
+		onDisk[name] = true
+	}
+	oldest := len(valid)
+	for i, c := range valid {
+		if onDisk[c.File] {
+			oldest = i
+			break
+		}
+	}
+	for i, c := range valid {
+		switch {
+		case onDisk[c.File]:
+			results = append(results, verifyFile(filepath.Join(dir, c.File), c, true))
+			delete(onDisk, c.File)
+		case i < oldest:
+			results = append(results, Result{File: c.File, Note: "removed by rotation"})
+		default:
+			results = append(results, Result{File: c.File, Err: fmt.Errorf("file is missing")})
+		}
+	}
+	for _, name := range backups {
+		if onDisk[name] {
+			results = append(results, Result{File: name, Note: "not covered by a checkpoint"})
+		}
+	}
+
+	// the current file
+	base := filepath.Base(path)
+	current, err := readCurrent(path + CurrentSuffix)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(path); err != nil {
+		if os.IsNotExist(err) && current == nil {
+			return results, nil
+		}
+		return append(results, Result{File: base, Err: err}), nil
+	}
+	switch {
+	case current == nil:
+		r := verifyFile(path, Checkpoint{Prev: prev, Head: prev}, false)
+		if r.Err == nil && r.Note == "" {
+			r.Note = "no records are checkpointed yet"
+		}
+		results = append(results, r)
+	case !current.verify(key):
+		results = append(results, Result{File: base + CurrentSuffix, Err: fmt.Errorf("checkpoint has an invalid signature")})
+	case current.Seq != seq+1 || current.Prev != prev:
+		results = append(results, Result{File: base + CurrentSuffix, Err: fmt.Errorf("checkpoint does not follow checkpoint %d", seq)})
+	default:
+		results = append(results, verifyFile(path, *current, false))
+	}
+	return results, nil
+}
+
+// verifyFile verifies a file against its checkpoint. If the file is not complete, it may have
+// more lines than the checkpoint.
+func verifyFile(path string, c Checkpoint, complete bool) Result {
+	result := Result{File: filepath.Base(path)}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		f, err = os.Open(path + ".gz")
+	}
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer f.Close()
+	r := io.Reader(f)
+	if filepath.Ext(f.Name()) == ".gz" {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			result.Err = err
+			return result
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	at := c.Prev // the chain after the checkpoint's last line
+	ch, err := readChain(r, c.Prev, func(ch *chain) {
+		if ch.lines == c.Lines {
+			at = ch.head
+		}
+	})
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if ch.lines >= c.Lines && at == c.Head && (!complete || ch.lines == c.Lines) {
+		result.Lines = c.Lines
+		if extra := ch.lines - c.Lines; extra > 0 {
+			result.Note = fmt.Sprintf("%d records written since the last checkpoint", extra)
+		}
+		return result
+	}
+
+	// the marks locate the first change to within markInterval lines
+	i := 0
+	for i < len(c.Marks) && i < len(ch.marks) && ch.marks[i] == c.Marks[i] {
+		i++
+	}
+	if i < len(c.Marks) {
+		result.Err = fmt.Errorf("records were modified, reordered or deleted between lines %d and %d",
+			i*markInterval+1, (i+1)*markInterval)
+	} else {
+		result.Err = fmt.Errorf("records were modified, reordered or deleted after line %d", i*markInterval)
+	}
+	if ch.lines != c.Lines && complete {
+		result.Err = fmt.Errorf("%w; the file has %d records and its checkpoint %d", result.Err, ch.lines, c.Lines)
+	}
+	return result
+}
@@ -0,0 +1,299 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package hashchain
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"spyderbat-event-forwarder/logwrapper"
+)
+
+// File is a file of records that the Writer rotates, such as a lumberjack.Logger.
+type File interface {
+	io.WriteCloser
+	Rotate() error
+}
+
+// Options configure a Writer.
+type Options struct {
+	MaxBytes           int64 // the file is rotated before a write would make it larger
+	Key                ed25519.PrivateKey
+	CheckpointInterval time.Duration // how often the current file is checkpointed; 0 for only on close
+	Mode               os.FileMode   // of the checkpoint files; default 0600
+}
+
+// Writer writes lines to a file, adding them to the chain, and writes a checkpoint whenever the
+// file is rotated. It rotates the file itself when it reaches the size limit, so that rotated
+// files are always checkpointed.
+type Writer struct {
+	f    File
+	path string
+	o    Options
+	done chan struct{}
+	wg   sync.WaitGroup
+
+	lock         sync.Mutex
+	size         int64
+	chain        chain
+	seq          int // of the last rotated file's checkpoint
+	checkpointed int // lines in the current file's last checkpoint
+}
+
+// NewWriter creates a Writer for f, which writes to path. The chain continues from the last
+// checkpoint of the file, and over the lines already in it.
+func NewWriter(f File, path string, o Options) (*Writer, error) {
+	if o.Mode == 0 {
+		o.Mode = 0o600
+	}
+	w := &Writer{f: f, path: path, o: o, done: make(chan struct{})}
+
+	checkpoints, err := readCheckpoints(path + CheckpointsSuffix)
+	if err != nil {
+		return nil, err
+	}
+	var prev Hash
+	if n := len(checkpoints); n > 0 {
+		w.seq = checkpoints[n-1].Seq
+		prev = checkpoints[n-1].Head
+	}
+
+	w.chain = newChain(prev)
+	current, err := readCurrent(path + CurrentSuffix)
+	if err != nil {
+		return nil, err
+	}
+	matched := current == nil || current.Prev != prev // nothing to compare with
+	if file, err := os.Open(path); err == nil {
+		w.chain, err = readChain(file, prev, func(c *chain) {
+			if current != nil && c.lines == current.Lines {
+				matched = matched || c.head == current.Head
+			}
+		})
+		if err == nil {
+			var st os.FileInfo
+			if st, err = file.Stat(); err == nil {
+				w.size = st.Size()
+			}
+		}
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if !matched {
+		logwrapper.Logger().Warn().Str("file", path).Msg("file does not match its last checkpoint; it may have been modified")
+	}
+
+	if o.CheckpointInterval > 0 {
+		w.wg.Add(1)
+		go w.checkpointLoop()
+	}
+	return w, nil
+}
+
+// Write writes p, which is one or more lines, to the file.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	// lumberjack rotates at the same size when the file is opened, and just after it when
+	// written to, so the file is always rotated here first
+	if w.size > 0 && w.size+int64(len(p)) >= w.o.MaxBytes {
+		if err := w.rotate(); err != nil {
+			logwrapper.Logger().Error().Err(err).Str("file", w.path).Msg("Failed to rotate file")
+		}
+	}
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	w.chain.addLines(p[:n])
+	return n, err
+}
+
+// Rotate rotates the file and checkpoints the rotated file.
+func (w *Writer) Rotate() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.rotate()
+}
+
+// Close checkpoints and closes the file.
+func (w *Writer) Close() error {
+	close(w.done)
+	w.wg.Wait()
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.chain.lines != w.checkpointed {
+		if err := w.checkpointCurrent(); err != nil {
+			logwrapper.Logger().Error().Err(err).Str("file", w.path).Msg("Failed to checkpoint file")
+		}
+	}
+	return w.f.Close()
+}
+
+func (w *Writer) checkpointLoop() {
+	defer w.wg.Done()
+	t := time.NewTicker(w.o.CheckpointInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-t.C:
+		}
+		w.lock.Lock()
+		if w.chain.lines != w.checkpointed {
+			if err := w.checkpointCurrent(); err != nil {
+				logwrapper.Logger().Error().Err(err).Str("file", w.path).Msg("Failed to checkpoint file")
+			}
+		}
+		w.lock.Unlock()
+	}
+}
+
+func (w *Writer) checkpoint(file string, rotated bool) Checkpoint {
+	c := Checkpoint{
+		Seq:     w.seq + 1,
+		Time:    time.Now().UTC(),
+		File:    file,
+		Rotated: rotated,
+		Prev:    w.chain.prev,
+		Head:    w.chain.head,
+		Lines:   w.chain.lines,
+		Marks:   w.chain.marks,
+	}
+	c.sign(w.o.Key)
+	return c
+}
+
+// checkpointCurrent replaces the checkpoint of the current file.
+func (w *Writer) checkpointCurrent() error {
+	b, err := json.Marshal(w.checkpoint(filepath.Base(w.path), false))
+	if err != nil {
+		return err
+	}
+	tmp := w.path + CurrentSuffix + ".tmp"
+	if err := os.WriteFile(tmp, append(b, '\n'), w.o.Mode); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, w.path+CurrentSuffix); err != nil {
+		return err
+	}
+	w.checkpointed = w.chain.lines
+	return nil
+}
+
+// rotate rotates the file, appends the checkpoint of the rotated file, and starts the chain of
+// the new file from it.
+func (w *Writer) rotate() error {
+	if err := w.f.Rotate(); err != nil {
+		return err
+	}
+	c := w.checkpoint(w.latestBackup(), true)
+	w.seq = c.Seq
+	w.chain = newChain(c.Head)
+	w.size = 0
+	w.checkpointed = 0
+	_ = os.Remove(w.path + CurrentSuffix)
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(w.path+CheckpointsSuffix, os.O_CREATE|os.O_WRONLY|os.O_APPEND, w.o.Mode)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// latestBackup returns the name of the most recently rotated file. Rotated files are named
+// with the time they were rotated, e.g. spyderbat_events-2025-06-02T08-00-00.000.log, and may
+// since have been compressed.
+func (w *Writer) latestBackup() string {
+	backups, _ := backupFiles(w.path)
+	if len(backups) == 0 {
+		return ""
+	}
+	return backups[len(backups)-1]
+}
+
+// backupFiles returns the names of the rotated files for path, oldest first, without any .gz
+// extension.
+func backupFiles(path string) ([]string, error) {
+	dir, base := filepath.Split(path)
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext) + "-"
+	entries, err := os.ReadDir(filepath.Clean(dir))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".gz")
+		if e.Type().IsRegular() && strings.HasPrefix(name, prefix) && strings.HasSuffix(name, ext) {
+			names = append(names, name)
+		}
+	}
+	// the times in the names sort in order, and entries are sorted by name
+	return names, nil
+}
+
+// readCheckpoints reads the checkpoints of the rotated files, if there are any.
+func readCheckpoints(path string) ([]Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var checkpoints []Checkpoint
+	for i, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line == "" {
+			continue
+		}
+		var c Checkpoint
+		if err := json.Unmarshal([]byte(line), &c); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, i+1, err)
+		}
+		checkpoints = append(checkpoints, c)
+	}
+	return checkpoints, nil
+}
+
+// readCurrent reads the checkpoint of the current file, if there is one.
+func readCurrent(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := &Checkpoint{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
@@ -0,0 +1,258 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+// loki forwards records to Grafana Loki using the push API.
+package loki
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"spyderbat-event-forwarder/config"
+	"spyderbat-event-forwarder/logwrapper"
+	"spyderbat-event-forwarder/sink"
+
+	retryablehttp "github.com/hashicorp/go-retryablehttp"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/klauspost/compress/snappy"
+	"github.com/valyala/fastjson"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+type httpclient interface {
+	Do(req *retryablehttp.Request) (*http.Response, error)
+}
+
+// Loki is a sink that pushes records to Loki, grouped into streams by label.
+type Loki struct {
+	c       *config.Loki
+	client  httpclient
+	batcher *sink.Batcher
+
+	// only accessed by the batcher's sender goroutine
+	last map[string]int64 // newest timestamp pushed to each stream, for out_of_order: drop
+}
+
+// New creates a new Loki sink from the given config. If the config is nil, nil is returned.
+// A nil Loki will silently drop all records.
+func New(c *config.Loki) *Loki {
+	if c == nil {
+		return nil
+	}
+
+	l := &Loki{
+		c:      c,
+		client: sink.NewHTTPClient(c.Insecure),
+		last:   make(map[string]int64),
+	}
+	l.batcher = sink.NewBatcher(sink.BatchOptions{MaxBytes: c.MaxPayloadBytes}, l.sendBatch)
+	return l
+}
+
+// header is the timestamp and stream labels of a queued entry. It is queued as JSON on a line
+// in front of the entry's line.
+type header struct {
+	TS     int64             `json:"ts"` // unix nanoseconds
+	Labels map[string]string `json:"labels"`
+}
+
+// Send queues a record for pushing to Loki. Calling Send after Shutdown will panic.
+func (l *Loki) Send(record []byte) {
+	l.SendOriginal(record, record)
+}
+
+// SendOriginal queues a record for pushing to Loki, with the timestamp and stream labels taken
+// from original, the record before it was transformed. cef and leef formats render original.
+// Calling SendOriginal after Shutdown will panic.
+func (l *Loki) SendOriginal(record, original []byte) {
+	if l == nil || len(record) == 0 {
+		return
+	}
+	row, err := l.row(record, original)
+	if err != nil {
+		logwrapper.Logger().Warn().Err(err).Msg("dropping invalid record for loki")
+		return
+	}
+	l.batcher.Add(row)
+}
+
+// row returns the header and line queued for a record.
+func (l *Loki) row(record, original []byte) ([]byte, error) {
+	var p fastjson.Parser
+	v, err := p.ParseBytes(original)
+	if err != nil {
+		return nil, err
+	}
+	h := header{TS: time.Now().UnixNano(), Labels: l.labels(v)}
+	if t := v.GetFloat64("time"); t > 0 {
+		h.TS = int64(t * 1e9)
+	}
+
+	line := record
+	if formatter := l.c.Format.Formatter(); formatter != nil {
+		if formatted, err := formatter.Format(original); err == nil {
+			line = formatted
+		}
+	}
+
+	row, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	row = append(row, '\n')
+	return append(row, line...), nil
+}
+
+// Shutdown flushes the queue and shuts down the sink. It will block until the queue is empty.
+func (l *Loki) Shutdown() {
+	log.Printf("shutting down loki")
+	if l == nil {
+		return
+	}
+	l.batcher.Shutdown()
+}
+
+// labels returns the stream labels for a record.
+func (l *Loki) labels(v *fastjson.Value) map[string]string {
+	labels := make(map[string]string, len(l.c.StaticLabels)+len(l.c.Labels))
+	for k, val := range l.c.StaticLabels {
+		labels[k] = val
+	}
+	for _, name := range l.c.Labels {
+		var val string
+		switch name {
+		case "schema":
+			val = string(v.GetStringBytes("schema"))
+			if i := strings.IndexByte(val, ':'); i >= 0 {
+				val = val[:i]
+			}
+		case "hostname":
+			val = string(v.GetStringBytes("runtime_details", "hostname"))
+		case "severity":
+			val = string(v.GetStringBytes("severity"))
+		}
+		// loki ignores empty labels
+		if val != "" {
+			labels[name] = val
+		}
+	}
+	return labels
+}
+
+// streams groups a batch of rows queued by SendOriginal into streams.
+func (l *Loki) streams(b *sink.Batch) []*stream {
+	byKey := make(map[string]*stream)
+	var streams []*stream
+
+	for _, row := range b.Records {
+		hb, line, _ := bytes.Cut(row, []byte{'\n'})
+		var h header
+		if err := json.Unmarshal(hb, &h); err != nil {
+			continue // written by SendOriginal
+		}
+
+		st := &stream{labels: h.Labels}
+		key := st.key()
+		if existing, found := byKey[key]; found {
+			st = existing
+		} else {
+			byKey[key] = st
+			streams = append(streams, st)
+		}
+		st.entries = append(st.entries, entry{ts: h.TS, line: line})
+	}
+
+	dropped := 0
+	kept := streams[:0]
+	for _, st := range streams {
+		switch l.c.OutOfOrder {
+		case "sort":
+			sort.SliceStable(st.entries, func(i, j int) bool { return st.entries[i].ts < st.entries[j].ts })
+		case "drop":
+			key := st.key()
+			entries := st.entries[:0]
+			for _, e := range st.entries {
+				if e.ts < l.last[key] {
+					dropped++
+					continue
+				}
+				l.last[key] = e.ts
+				entries = append(entries, e)
+			}
+			st.entries = entries
+		}
+		if len(st.entries) > 0 {
+			kept = append(kept, st)
+		}
+	}
+	if dropped > 0 {
+		logwrapper.Logger().Warn().Int("dropped", dropped).Msg("dropped out of order records for loki")
+	}
+	return kept
+}
+
+// sendBatch pushes a batch of records to Loki.
+func (l *Loki) sendBatch(b *sink.Batch) {
+	streams := l.streams(b)
+	if len(streams) == 0 {
+		return
+	}
+	if err := l.push(streams, len(b.Records)); err != nil {
+		logwrapper.Logger().Error().Err(err).Msg("Failed to push records to loki")
+	}
+}
+
+func (l *Loki) push(streams []*stream, count int) error {
+	var body []byte
+	var contentType string
+	if l.c.PushFormat == "json" {
+		data, err := encodeJSON(streams)
+		if err != nil {
+			return err
+		}
+		body = data
+		contentType = "application/json"
+	} else {
+		body = snappy.Encode(nil, encodeProtobuf(streams))
+		contentType = "application/x-protobuf"
+	}
+
+	req, err := retryablehttp.NewRequest(http.MethodPost, l.c.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if l.c.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", l.c.TenantID)
+	}
+	l.c.Authentication.SetHeaders(req.Request)
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return err
+	}
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		logwrapper.Logger().Info().
+			Int("events", count).
+			Int("streams", len(streams)).
+			Int("bytes", len(body)).
+			Int("status_code", resp.StatusCode).
+			Msg("pushed to loki")
+		return nil
+	}
+	return fmt.Errorf("loki returned status code %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+}
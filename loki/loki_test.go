@@ -0,0 +1,194 @@
+package loki
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"spyderbat-event-forwarder/config"
+	"spyderbat-event-forwarder/sink"
+	"spyderbat-event-forwarder/transform"
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var testRecords = [][]byte{
+	[]byte(`{"schema":"model_process::1.2.0","time":1700000002.5,"runtime_details":{"hostname":"puppies"},"name":"bash"}`),
+	[]byte(`{"schema":"model_process::1.2.0","time":1700000001,"runtime_details":{"hostname":"puppies"},"name":"sh"}`),
+	[]byte(`{"schema":"event_redflag:bash:1.0.0","time":1700000003,"severity":"high","runtime_details":{"hostname":"kittens"}}`),
+}
+
+// pushed is a decoded push request: stream labels -> entries
+type pushed map[string][]entry
+
+func newTestServer(t *testing.T, check func(r *http.Request, body []byte)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		check(r, body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+func newTestLoki(t *testing.T, cfg *config.Loki) *Loki {
+	require.NoError(t, config.ValidateLoki(cfg))
+	return New(cfg)
+}
+
+// decodeFields splits a protobuf message into its length-delimited and varint fields.
+func decodeFields(t *testing.T, b []byte) (bytesFields map[int][][]byte, varints map[int]uint64) {
+	bytesFields = make(map[int][][]byte)
+	varints = make(map[int]uint64)
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		require.GreaterOrEqual(t, n, 0)
+		b = b[n:]
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			require.GreaterOrEqual(t, n, 0)
+			varints[int(num)] = v
+			b = b[n:]
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			require.GreaterOrEqual(t, n, 0)
+			bytesFields[int(num)] = append(bytesFields[int(num)], v)
+			b = b[n:]
+		default:
+			t.Fatalf("unexpected wire type %d", typ)
+		}
+	}
+	return bytesFields, varints
+}
+
+func decodeProtobuf(t *testing.T, b []byte) pushed {
+	p := make(pushed)
+	req, _ := decodeFields(t, b)
+	for _, s := range req[1] {
+		stream, _ := decodeFields(t, s)
+		require.Len(t, stream[1], 1)
+		labels := string(stream[1][0])
+		for _, e := range stream[2] {
+			en, _ := decodeFields(t, e)
+			_, ts := decodeFields(t, en[1][0])
+			p[labels] = append(p[labels], entry{ts: int64(ts[1])*1e9 + int64(ts[2]), line: en[2][0]})
+		}
+	}
+	return p
+}
+
+func TestLokiProtobuf(t *testing.T) {
+	var got pushed
+	ts := newTestServer(t, func(r *http.Request, body []byte) {
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Equal(t, "tenant-1", r.Header.Get("X-Scope-OrgID"))
+		decoded, err := snappy.Decode(nil, body)
+		require.NoError(t, err)
+		got = decodeProtobuf(t, decoded)
+	})
+	defer ts.Close()
+
+	l := newTestLoki(t, &config.Loki{Endpoint: ts.URL, TenantID: "tenant-1"})
+	for _, r := range testRecords {
+		l.Send(r)
+	}
+	l.Shutdown()
+
+	// records in a stream are sorted by time
+	assert.Equal(t, pushed{
+		`{hostname="puppies", job="spyderbat", schema="model_process"}`: {
+			{ts: 1700000001000000000, line: testRecords[1]},
+			{ts: 1700000002500000000, line: testRecords[0]},
+		},
+		`{hostname="kittens", job="spyderbat", schema="event_redflag"}`: {
+			{ts: 1700000003000000000, line: testRecords[2]},
+		},
+	}, got)
+}
+
+func TestLokiJSON(t *testing.T) {
+	var got jsonPush
+	ts := newTestServer(t, func(r *http.Request, body []byte) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Empty(t, r.Header.Get("X-Scope-OrgID"))
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		require.NoError(t, json.Unmarshal(body, &got))
+	})
+	defer ts.Close()
+
+	l := newTestLoki(t, &config.Loki{
+		Endpoint:     ts.URL,
+		PushFormat:   "json",
+		Labels:       []string{"severity"},
+		StaticLabels: map[string]string{"env": "test"},
+		OutOfOrder:   "accept",
+		Authentication: config.WebhookAuthentication{
+			Method:     "bearer",
+			Parameters: config.AuthenticationParameters{Secret: "token"},
+		},
+	})
+	for _, r := range testRecords {
+		l.Send(r)
+	}
+	l.Shutdown()
+
+	// records without a severity are in a stream without the label, in the order received
+	require.Len(t, got.Streams, 2)
+	assert.Equal(t, map[string]string{"env": "test"}, got.Streams[0].Stream)
+	assert.Equal(t, [][2]string{
+		{"1700000002500000000", string(testRecords[0])},
+		{"1700000001000000000", string(testRecords[1])},
+	}, got.Streams[0].Values)
+	assert.Equal(t, map[string]string{"env": "test", "severity": "high"}, got.Streams[1].Stream)
+}
+
+func TestLokiTransformedRecords(t *testing.T) {
+	var got pushed
+	ts := newTestServer(t, func(r *http.Request, body []byte) {
+		decoded, err := snappy.Decode(nil, body)
+		require.NoError(t, err)
+		got = decodeProtobuf(t, decoded)
+	})
+	defer ts.Close()
+
+	l := newTestLoki(t, &config.Loki{Endpoint: ts.URL})
+	// ocsf has no schema or runtime_details, and its time is in milliseconds
+	ocsf, err := new(transform.OCSF).Transform(testRecords[2])
+	require.NoError(t, err)
+	l.SendOriginal(ocsf, testRecords[2])
+	l.Shutdown()
+
+	assert.Equal(t, pushed{
+		`{hostname="kittens", job="spyderbat", schema="event_redflag"}`: {
+			{ts: 1700000003000000000, line: ocsf},
+		},
+	}, got)
+}
+
+func TestLokiDropOutOfOrder(t *testing.T) {
+	l := newTestLoki(t, &config.Loki{Endpoint: "http://loki", OutOfOrder: "drop"})
+	defer l.Shutdown()
+
+	row := func(record []byte) []byte {
+		r, err := l.row(record, record)
+		require.NoError(t, err)
+		return r
+	}
+	streams := l.streams(&sink.Batch{Records: [][]byte{row(testRecords[0])}})
+	require.Len(t, streams, 1)
+	assert.Len(t, streams[0].entries, 1)
+
+	// the second record is older than the first, which was already pushed
+	streams = l.streams(&sink.Batch{Records: [][]byte{row(testRecords[1])}})
+	assert.Empty(t, streams)
+}
+
+func TestLokiNil(t *testing.T) {
+	var l *Loki
+	l.Send(testRecords[0])
+	l.Shutdown()
+	assert.Nil(t, New(nil))
+}
@@ -0,0 +1,100 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package loki
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// stream is a set of entries that share the same labels.
+type stream struct {
+	labels  map[string]string
+	entries []entry
+}
+
+type entry struct {
+	ts   int64 // unix nanoseconds
+	line []byte
+}
+
+// key returns the labels in Loki's text form, e.g. {hostname="puppies", schema="model_process"}.
+// The labels are sorted, so the key identifies the stream.
+func (s *stream) key() string {
+	names := make([]string, 0, len(s.labels))
+	for name := range s.labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b := &strings.Builder{}
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(s.labels[name]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// The protobuf encoding below follows Loki's logproto.PushRequest:
+//
+//	message PushRequest { repeated StreamAdapter streams = 1; }
+//	message StreamAdapter { string labels = 1; repeated EntryAdapter entries = 2; }
+//	message EntryAdapter { google.protobuf.Timestamp timestamp = 1; string line = 2; }
+//	message Timestamp { int64 seconds = 1; int32 nanos = 2; }
+
+// encodeProtobuf encodes streams as an (uncompressed) logproto.PushRequest.
+func encodeProtobuf(streams []*stream) []byte {
+	var req, s, e, ts []byte
+	for _, st := range streams {
+		s = protowire.AppendTag(s[:0], 1, protowire.BytesType)
+		s = protowire.AppendString(s, st.key())
+		for _, en := range st.entries {
+			ts = protowire.AppendTag(ts[:0], 1, protowire.VarintType)
+			ts = protowire.AppendVarint(ts, uint64(en.ts/1e9))
+			ts = protowire.AppendTag(ts, 2, protowire.VarintType)
+			ts = protowire.AppendVarint(ts, uint64(en.ts%1e9))
+			e = protowire.AppendTag(e[:0], 1, protowire.BytesType)
+			e = protowire.AppendBytes(e, ts)
+			e = protowire.AppendTag(e, 2, protowire.BytesType)
+			e = protowire.AppendBytes(e, en.line)
+			s = protowire.AppendTag(s, 2, protowire.BytesType)
+			s = protowire.AppendBytes(s, e)
+		}
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, s)
+	}
+	return req
+}
+
+type jsonPush struct {
+	Streams []jsonStream `json:"streams"`
+}
+
+type jsonStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// encodeJSON encodes streams in the JSON push format.
+func encodeJSON(streams []*stream) ([]byte, error) {
+	push := jsonPush{Streams: make([]jsonStream, 0, len(streams))}
+	for _, st := range streams {
+		js := jsonStream{Stream: st.labels, Values: make([][2]string, 0, len(st.entries))}
+		for _, en := range st.entries {
+			js.Values = append(js.Values, [2]string{strconv.FormatInt(en.ts, 10), string(en.line)})
+		}
+		push.Streams = append(push.Streams, js)
+	}
+	return json.Marshal(push)
+}
@@ -0,0 +1,388 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+// nats publishes records to NATS JetStream.
+package nats
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"spyderbat-event-forwarder/config"
+	"spyderbat-event-forwarder/logwrapper"
+	"spyderbat-event-forwarder/sink"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/valyala/fastjson"
+)
+
+const (
+	batchBytes   = 1024 * 1024 // messages published before waiting for their acks
+	batchRecords = 256
+)
+
+var (
+	dialTimeout    = 30 * time.Second
+	ackTimeout     = 60 * time.Second
+	retryBaseDelay = 1 * time.Second // doubled after each failed attempt
+	maxRetries     = 5
+)
+
+var (
+	json       = jsoniter.ConfigCompatibleWithStandardLibrary
+	parserPool = fastjson.ParserPool{}
+)
+
+// NATS is a sink that publishes each record to a JetStream subject and waits for the stream
+// to acknowledge it. Messages that are not acknowledged are published again, so records are
+// stored at least once.
+type NATS struct {
+	c       *config.NATS
+	batcher *sink.Batcher
+
+	// only accessed by the batcher's sender goroutine
+	conn       net.Conn
+	r          *bufio.Reader
+	inbox      string // acks are sent to inbox.<seq>
+	seq        uint64
+	maxPayload int
+}
+
+// New creates a new NATS sink from the given config. If the config is nil, nil is returned.
+// A nil NATS will silently drop all records.
+func New(c *config.NATS) *NATS {
+	if c == nil {
+		return nil
+	}
+	n := &NATS{c: c}
+	n.batcher = sink.NewBatcher(sink.BatchOptions{
+		MaxBytes:   batchBytes,
+		MaxRecords: batchRecords,
+	}, n.sendBatch)
+	return n
+}
+
+// Send queues a record for publishing to the subject for its schema and muid. Calling Send
+// after Shutdown will panic.
+func (n *NATS) Send(record []byte) {
+	n.SendOriginal(record, record)
+}
+
+// SendOriginal queues a record for publishing to the subject for the schema and muid of
+// original, the record before it was transformed. cef and leef formats render original.
+// Calling SendOriginal after Shutdown will panic.
+func (n *NATS) SendOriginal(record, original []byte) {
+	if n == nil || len(record) == 0 {
+		return
+	}
+
+	p := parserPool.Get()
+	v, err := p.ParseBytes(original)
+	if err != nil || v.Type() != fastjson.TypeObject {
+		parserPool.Put(p)
+		logwrapper.Logger().Warn().Err(err).Msg("dropping invalid record for nats")
+		return
+	}
+	family := string(v.GetStringBytes("schema"))
+	if i := strings.IndexByte(family, ':'); i >= 0 {
+		family = family[:i]
+	}
+	muid := string(v.GetStringBytes("muid"))
+	parserPool.Put(p)
+
+	if f := n.c.Format.Formatter(); f != nil {
+		formatted, err := f.Format(original)
+		if err != nil {
+			logwrapper.Logger().Warn().Err(err).Msg("unable to format event for nats; sending it unformatted")
+		} else {
+			record = formatted
+		}
+	}
+
+	// the subject has no whitespace, so it is queued in front of the record
+	subject := n.c.SubjectFor(family, muid)
+	msg := make([]byte, 0, len(subject)+1+len(record))
+	msg = append(msg, subject...)
+	msg = append(msg, ' ')
+	n.batcher.Add(append(msg, record...))
+}
+
+// Shutdown flushes the queue and shuts down the sink. It will block until the queue is empty.
+func (n *NATS) Shutdown() {
+	log.Printf("shutting down nats")
+	if n == nil {
+		return
+	}
+	n.batcher.Shutdown()
+	n.disconnect()
+}
+
+// sendBatch publishes a batch of messages, publishing again any that are not acknowledged.
+func (n *NATS) sendBatch(b *sink.Batch) {
+	pending := b.Records
+	for attempt := 0; ; attempt++ {
+		failed, err := n.publish(pending)
+		if err != nil {
+			n.disconnect()
+		}
+		if sent := len(pending) - len(failed); sent > 0 {
+			logwrapper.Logger().Info().Int("events", sent).Int("failed", len(failed)).Msg("sent to nats")
+		}
+		if len(failed) == 0 {
+			return
+		}
+		if attempt >= maxRetries {
+			logwrapper.Logger().Error().Err(err).Int("events", len(failed)).Msg("Failed to send records to nats")
+			return
+		}
+		logwrapper.Logger().Warn().Err(err).Int("events", len(failed)).Msg("retrying records for nats")
+		pending = failed
+		time.Sleep(retryBaseDelay << attempt)
+	}
+}
+
+// jsAck is the reply JetStream sends to a published message.
+type jsAck struct {
+	Stream string `json:"stream"`
+	Seq    uint64 `json:"seq"`
+	Error  *struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+// publish publishes messages and waits for their acks. It returns the messages that were not
+// acknowledged, and an error if the connection failed.
+func (n *NATS) publish(msgs [][]byte) ([][]byte, error) {
+	if n.conn == nil {
+		if err := n.connect(); err != nil {
+			return msgs, err
+		}
+	}
+
+	// each message's ack is sent to its own reply subject
+	first := n.seq + 1
+	buf := &bytes.Buffer{}
+	acked := make([]bool, len(msgs))
+	replied := make([]bool, len(msgs))
+	remaining := 0
+	for i, msg := range msgs {
+		subject, payload, _ := bytes.Cut(msg, []byte{' '})
+		if len(payload) > n.maxPayload {
+			logwrapper.Logger().Warn().Int("bytes", len(payload)).Int("max_bytes", n.maxPayload).Msg("dropping record that is too large for nats")
+			acked[i], replied[i] = true, true
+			continue
+		}
+		fmt.Fprintf(buf, "PUB %s %s.%d %d\r\n", subject, n.inbox, first+uint64(i), len(payload))
+		buf.Write(payload)
+		buf.WriteString("\r\n")
+		remaining++
+	}
+	n.seq += uint64(len(msgs))
+
+	_ = n.conn.SetDeadline(time.Now().Add(ackTimeout))
+	_, err := n.conn.Write(buf.Bytes())
+
+	for err == nil && remaining > 0 {
+		var subject string
+		var payload []byte
+		subject, payload, err = n.next()
+		if err != nil {
+			break
+		}
+		seq, perr := strconv.ParseUint(strings.TrimPrefix(subject, n.inbox+"."), 10, 64)
+		if perr != nil || seq < first || seq >= first+uint64(len(msgs)) || replied[seq-first] {
+			continue // not an ack for this batch
+		}
+		i := seq - first
+		replied[i] = true
+		remaining--
+
+		if payload == nil {
+			// a status message: 503 when no stream is bound to the subject
+			continue
+		}
+		ack := jsAck{}
+		if jerr := json.Unmarshal(payload, &ack); jerr != nil || ack.Error != nil || ack.Stream == "" {
+			if ack.Error != nil {
+				logwrapper.Logger().Warn().Int("code", ack.Error.Code).Str("description", ack.Error.Description).Msg("nats did not store a record")
+			}
+			continue
+		}
+		acked[i] = true
+	}
+
+	var failed [][]byte
+	for i, msg := range msgs {
+		if !acked[i] {
+			failed = append(failed, msg)
+		}
+	}
+	return failed, err
+}
+
+// next reads protocol messages until a message for the inbox arrives, answering pings. A
+// message with headers (a status message) is returned with a nil payload.
+func (n *NATS) next() (string, []byte, error) {
+	for {
+		line, err := n.readLine()
+		if err != nil {
+			return "", nil, err
+		}
+		op, args, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(op) {
+		case "PING":
+			if _, err := n.conn.Write([]byte("PONG\r\n")); err != nil {
+				return "", nil, err
+			}
+		case "PONG", "+OK", "INFO":
+		case "-ERR":
+			return "", nil, fmt.Errorf("nats error: %s", args)
+		case "MSG", "HMSG":
+			// MSG <subject> <sid> [reply] <size>; HMSG <subject> <sid> [reply] <header size> <total size>
+			fields := strings.Fields(args)
+			if len(fields) < 3 {
+				return "", nil, fmt.Errorf("malformed nats message %q", line)
+			}
+			size, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil {
+				return "", nil, fmt.Errorf("malformed nats message %q", line)
+			}
+			buf := make([]byte, size+2)
+			if _, err := io.ReadFull(n.r, buf); err != nil {
+				return "", nil, err
+			}
+			if strings.ToUpper(op) == "HMSG" {
+				return fields[0], nil, nil
+			}
+			return fields[0], buf[:size], nil
+		default:
+			return "", nil, fmt.Errorf("unexpected nats message %q", line)
+		}
+	}
+}
+
+func (n *NATS) readLine() (string, error) {
+	line, err := n.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// serverInfo is the part of the server's INFO message that the sink uses.
+type serverInfo struct {
+	TLSRequired bool `json:"tls_required"`
+	MaxPayload  int  `json:"max_payload"`
+	Headers     bool `json:"headers"`
+}
+
+// connectOptions is the client's CONNECT message.
+type connectOptions struct {
+	Verbose      bool   `json:"verbose"`
+	Pedantic     bool   `json:"pedantic"`
+	TLSRequired  bool   `json:"tls_required"`
+	Name         string `json:"name"`
+	Lang         string `json:"lang"`
+	Version      string `json:"version"`
+	Protocol     int    `json:"protocol"`
+	Headers      bool   `json:"headers"`
+	NoResponders bool   `json:"no_responders"`
+	AuthToken    string `json:"auth_token,omitempty"`
+	User         string `json:"user,omitempty"`
+	Pass         string `json:"pass,omitempty"`
+}
+
+func (n *NATS) connect() error {
+	dialer := &net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second}
+	conn, err := dialer.Dial("tcp", n.c.Address())
+	if err != nil {
+		return err
+	}
+	n.conn = conn
+	n.r = bufio.NewReader(conn)
+	_ = conn.SetDeadline(time.Now().Add(dialTimeout))
+
+	line, err := n.readLine()
+	if err != nil {
+		return err
+	}
+	op, args, _ := strings.Cut(line, " ")
+	if op != "INFO" {
+		return fmt.Errorf("expected INFO from nats, got %q", line)
+	}
+	info := serverInfo{}
+	if err := json.Unmarshal([]byte(args), &info); err != nil {
+		return fmt.Errorf("failed to parse nats INFO: %w", err)
+	}
+	n.maxPayload = info.MaxPayload
+	if n.maxPayload == 0 {
+		n.maxPayload = 1024 * 1024
+	}
+
+	useTLS := n.c.TLS() || info.TLSRequired
+	if useTLS {
+		host, _, _ := net.SplitHostPort(n.c.Address())
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host, InsecureSkipVerify: n.c.Insecure})
+		if err := tlsConn.Handshake(); err != nil {
+			return err
+		}
+		n.conn = tlsConn
+		n.r = bufio.NewReader(tlsConn)
+	}
+
+	id := make([]byte, 12)
+	_, _ = rand.Read(id)
+	n.inbox = "_INBOX." + hex.EncodeToString(id)
+
+	options, _ := json.Marshal(connectOptions{
+		TLSRequired:  useTLS,
+		Name:         "spyderbat-event-forwarder",
+		Lang:         "go",
+		Version:      "1.0.0",
+		Protocol:     1,
+		Headers:      info.Headers,
+		NoResponders: info.Headers,
+		AuthToken:    n.c.Token,
+		User:         n.c.Username,
+		Pass:         n.c.Password,
+	})
+	hello := fmt.Sprintf("CONNECT %s\r\nSUB %s.* 1\r\nPING\r\n", options, n.inbox)
+	if _, err := n.conn.Write([]byte(hello)); err != nil {
+		return err
+	}
+
+	// the server answers the ping once it has processed CONNECT, or reports an error
+	for {
+		line, err := n.readLine()
+		if err != nil {
+			return err
+		}
+		op, args, _ := strings.Cut(line, " ")
+		switch op {
+		case "PONG":
+			return nil
+		case "-ERR":
+			return fmt.Errorf("nats connection failed: %s", args)
+		}
+	}
+}
+
+func (n *NATS) disconnect() {
+	if n.conn != nil {
+		_ = n.conn.Close()
+	}
+	n.conn = nil
+	n.r = nil
+}
@@ -0,0 +1,238 @@
+package nats
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"spyderbat-event-forwarder/config"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testRecords = [][]byte{
+	[]byte(`{"schema":"model_process::1.2.0","id":"proc:1","muid":"mach:abc","time":1700000001.5}`),
+	[]byte(`{"schema":"event_redflag:bash:1.0.0","id":"flag:1","muid":"mach:abc","time":1700000002}`),
+	[]byte(`{"schema":"model_process::1.2.0","id":"proc:2","muid":"mach:def","time":1700000003}`),
+}
+
+// message is a message published to mockNATS.
+type message struct {
+	subject string
+	payload string
+}
+
+// mockNATS is a local stand-in for a NATS server with a JetStream stream bound to every subject
+// except those starting with "nostream".
+type mockNATS struct {
+	ln         net.Listener
+	token      string
+	maxPayload int
+	dropConn   int // number of messages to read before closing the connection unanswered
+	nak        int // number of messages to answer with a JetStream error
+
+	lock     sync.Mutex
+	messages []message
+	conns    int
+}
+
+func (m *mockNATS) start(t *testing.T) {
+	var err error
+	m.ln, err = net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = m.ln.Close() })
+	go func() {
+		for {
+			conn, err := m.ln.Accept()
+			if err != nil {
+				return
+			}
+			m.lock.Lock()
+			m.conns++
+			m.lock.Unlock()
+			go m.serve(conn)
+		}
+	}()
+}
+
+func (m *mockNATS) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"mock\",\"headers\":true,\"max_payload\":%d}\r\n", m.maxPayload)
+
+	sid := ""
+	pinged := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		op, args, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		switch op {
+		case "CONNECT":
+			if m.token != "" && !strings.Contains(args, `"auth_token":"`+m.token+`"`) {
+				_, _ = conn.Write([]byte("-ERR 'Authorization Violation'\r\n"))
+				return
+			}
+		case "PING":
+			_, _ = conn.Write([]byte("PONG\r\n"))
+		case "SUB":
+			sid = strings.Fields(args)[1]
+		case "PUB":
+			fields := strings.Fields(args)
+			size, _ := strconv.Atoi(fields[2])
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			// the sink must answer pings while waiting for acks
+			if !pinged {
+				pinged = true
+				_, _ = conn.Write([]byte("PING\r\n"))
+			}
+
+			m.lock.Lock()
+			var reply string
+			switch {
+			case m.dropConn > 0:
+				m.dropConn--
+				m.lock.Unlock()
+				return
+			case strings.HasPrefix(fields[0], "nostream"):
+				reply = fmt.Sprintf("HMSG %s %s 16 16\r\nNATS/1.0 503\r\n\r\n\r\n", fields[1], sid)
+			case m.nak > 0:
+				m.nak--
+				ack := `{"error":{"code":503,"err_code":10077,"description":"maximum messages exceeded"}}`
+				reply = fmt.Sprintf("MSG %s %s %d\r\n%s\r\n", fields[1], sid, len(ack), ack)
+			default:
+				m.messages = append(m.messages, message{fields[0], string(payload[:size])})
+				ack := fmt.Sprintf(`{"stream":"SPYDERBAT","seq":%d}`, len(m.messages))
+				reply = fmt.Sprintf("MSG %s %s %d\r\n%s\r\n", fields[1], sid, len(ack), ack)
+			}
+			m.lock.Unlock()
+			if _, err := conn.Write([]byte(reply)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func (m *mockNATS) received() ([]message, int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]message(nil), m.messages...), m.conns
+}
+
+func newNATS(t *testing.T, m *mockNATS, c *config.NATS) *NATS {
+	retryBaseDelay = time.Millisecond
+	if m.maxPayload == 0 {
+		m.maxPayload = 1024 * 1024
+	}
+	m.start(t)
+	if c.URL == "" {
+		c.URL = "nats://" + m.ln.Addr().String()
+	}
+	require.NoError(t, config.ValidateNATS(c))
+	return New(c)
+}
+
+func TestNATS(t *testing.T) {
+	m := &mockNATS{token: "s3cr3t"}
+	n := newNATS(t, m, &config.NATS{Token: "s3cr3t"})
+	for _, record := range testRecords {
+		n.Send(record)
+	}
+	n.Send([]byte(`not json`))
+	n.Shutdown()
+
+	messages, conns := m.received()
+	assert.Equal(t, 1, conns)
+	assert.Equal(t, []message{
+		{"spyderbat.model_process.mach:abc", string(testRecords[0])},
+		{"spyderbat.event_redflag.mach:abc", string(testRecords[1])},
+		{"spyderbat.model_process.mach:def", string(testRecords[2])},
+	}, messages)
+}
+
+func TestNATSTransformedRecords(t *testing.T) {
+	m := &mockNATS{}
+	n := newNATS(t, m, &config.NATS{})
+	// an OCSF record has no Spyderbat schema or muid
+	ocsf := `{"class_uid":1007,"time":1700000001500}`
+	n.SendOriginal([]byte(ocsf), testRecords[0])
+	n.Shutdown()
+
+	messages, _ := m.received()
+	assert.Equal(t, []message{{"spyderbat.model_process.mach:abc", ocsf}}, messages)
+}
+
+func TestNATSRetry(t *testing.T) {
+	m := &mockNATS{dropConn: 1, nak: 1}
+	n := newNATS(t, m, &config.NATS{Subject: "spyderbat.{schema}"})
+	for _, record := range testRecords {
+		n.Send(record)
+	}
+	n.Shutdown()
+
+	// the first connection is closed before any acks and the first message on the second is
+	// rejected, so every record is eventually stored once
+	messages, conns := m.received()
+	assert.Equal(t, 2, conns)
+	require.Len(t, messages, 3)
+	assert.ElementsMatch(t, []message{
+		{"spyderbat.model_process", string(testRecords[0])},
+		{"spyderbat.event_redflag", string(testRecords[1])},
+		{"spyderbat.model_process", string(testRecords[2])},
+	}, messages)
+}
+
+func TestNATSNoStream(t *testing.T) {
+	maxRetries = 1
+	defer func() { maxRetries = 5 }()
+	m := &mockNATS{}
+	n := newNATS(t, m, &config.NATS{Subject: "nostream.{schema}"})
+	n.Send(testRecords[0])
+	n.Shutdown()
+
+	messages, conns := m.received()
+	assert.Empty(t, messages)
+	assert.Equal(t, 1, conns)
+}
+
+func TestNATSTooLarge(t *testing.T) {
+	m := &mockNATS{maxPayload: 100}
+	n := newNATS(t, m, &config.NATS{})
+	n.Send([]byte(`{"schema":"model_process::1.2.0","id":"proc:1","args":"` + strings.Repeat("x", 100) + `"}`))
+	n.Send(testRecords[1])
+	n.Shutdown()
+
+	messages, _ := m.received()
+	require.Len(t, messages, 1)
+	assert.Equal(t, string(testRecords[1]), messages[0].payload)
+}
+
+func TestNATSAuthFailed(t *testing.T) {
+	maxRetries = 1
+	defer func() { maxRetries = 5 }()
+	m := &mockNATS{token: "s3cr3t"}
+	n := newNATS(t, m, &config.NATS{Token: "wrong"})
+	n.Send(testRecords[0])
+	n.Shutdown()
+
+	messages, conns := m.received()
+	assert.Empty(t, messages)
+	assert.Equal(t, 2, conns)
+}
+
+func TestNATSNil(t *testing.T) {
+	var n *NATS
+	assert.Nil(t, New(nil))
+	n.Send(testRecords[0])
+	n.Shutdown()
+}
@@ -0,0 +1,306 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+// notify sends notifications to Slack, Microsoft Teams or PagerDuty for selected records.
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"spyderbat-event-forwarder/config"
+	"spyderbat-event-forwarder/logwrapper"
+	"spyderbat-event-forwarder/sink"
+
+	retryablehttp "github.com/hashicorp/go-retryablehttp"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/valyala/fastjson"
+)
+
+const (
+	maxPayloadBytes  = 1024 * 1024
+	maxSummaryLength = 1024 // PagerDuty truncates longer summaries
+)
+
+var (
+	json       = jsoniter.ConfigCompatibleWithStandardLibrary
+	parserPool = fastjson.ParserPool{}
+)
+
+type httpclient interface {
+	Do(req *retryablehttp.Request) (*http.Response, error)
+}
+
+// Notify is a sink that sends a notification for each record that matches its filter, at most
+// once per record id in the rate limit interval.
+type Notify struct {
+	c       *config.Notify
+	client  httpclient
+	batcher *sink.Batcher
+
+	lock     sync.Mutex
+	notified map[string]time.Time // record id -> time of its last notification
+	swept    time.Time            // when expired entries were last removed from notified
+}
+
+// New creates a new Notify sink from the given config. If the config is nil, nil is returned.
+// A nil Notify will silently drop all records.
+func New(c *config.Notify) *Notify {
+	if c == nil {
+		return nil
+	}
+	n := &Notify{
+		c:        c,
+		client:   sink.NewHTTPClient(c.Insecure),
+		notified: make(map[string]time.Time),
+		swept:    time.Now(),
+	}
+	// each notification is sent on its own
+	n.batcher = sink.NewBatcher(sink.BatchOptions{
+		MaxBytes:   maxPayloadBytes,
+		MaxRecords: 1,
+	}, n.sendBatch)
+	return n
+}
+
+// Send queues a notification for the record if it matches the filter and its id has not been
+// notified within the rate limit interval. Calling Send after Shutdown will panic.
+func (n *Notify) Send(record []byte) {
+	n.SendOriginal(record, record)
+}
+
+// SendOriginal is Send for a transformed record. Notifications are about Spyderbat records, so
+// the filter and templates are applied to original, the record before it was transformed.
+// Calling SendOriginal after Shutdown will panic.
+func (n *Notify) SendOriginal(record, original []byte) {
+	if n == nil || len(original) == 0 {
+		return
+	}
+
+	a, ok := n.match(original)
+	if !ok {
+		return
+	}
+	if !n.allow(a.ID, time.Now()) {
+		logwrapper.Logger().Debug().Str("id", a.ID).Msg("notification rate limited")
+		return
+	}
+
+	payload, err := n.payload(a)
+	if err != nil {
+		logwrapper.Logger().Warn().Err(err).Str("id", a.ID).Msg("unable to render notification")
+		return
+	}
+	n.batcher.Add(payload)
+}
+
+// Shutdown flushes the queue and shuts down the sink. It will block until the queue is empty.
+func (n *Notify) Shutdown() {
+	log.Printf("shutting down notify")
+	if n == nil {
+		return
+	}
+	n.batcher.Shutdown()
+}
+
+// match applies the filter to a record, and returns the alert for it if it matches.
+func (n *Notify) match(record []byte) (*config.Alert, bool) {
+	p := parserPool.Get()
+	defer parserPool.Put(p)
+	v, err := p.ParseBytes(record)
+	if err != nil || v.Type() != fastjson.TypeObject {
+		return nil, false
+	}
+
+	f := n.c.Filter
+	schema := string(v.GetStringBytes("schema"))
+	family, _, _ := strings.Cut(schema, ":")
+	if !slices.Contains(f.Schemas, family) {
+		return nil, false
+	}
+	suppressed := v.GetBool("suppressed")
+	if suppressed && !f.IncludeSuppressed {
+		return nil, false
+	}
+	score := v.Get("score")
+	if f.MinScore != nil && (score == nil || score.Type() != fastjson.TypeNumber || score.GetFloat64() < *f.MinScore) {
+		return nil, false
+	}
+
+	a := &config.Alert{
+		Schema:     schema,
+		ID:         string(v.GetStringBytes("id")),
+		MUID:       string(v.GetStringBytes("muid")),
+		Name:       string(v.GetStringBytes("name")),
+		Hostname:   string(v.GetStringBytes("runtime_details", "hostname")),
+		Linkback:   string(v.GetStringBytes("linkback")),
+		Trigger:    string(v.GetStringBytes("trigger_short_name")),
+		Score:      v.GetFloat64("score"),
+		Suppressed: suppressed,
+	}
+	if a.Trigger == "" {
+		a.Trigger = string(v.GetStringBytes("trigger"))
+	}
+	if t := v.GetFloat64("time"); t > 0 {
+		sec, frac := math.Modf(t)
+		a.Time = time.Unix(int64(sec), int64(frac*1e9)).UTC()
+	}
+	if err := json.Unmarshal(record, &a.Record); err != nil {
+		return nil, false
+	}
+	return a, true
+}
+
+// allow reports whether a notification may be sent for a record id, and if so records it.
+func (n *Notify) allow(id string, now time.Time) bool {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	interval := n.c.RateLimit
+	if now.Sub(n.swept) > interval {
+		for k, t := range n.notified {
+			if now.Sub(t) >= interval {
+				delete(n.notified, k)
+			}
+		}
+		n.swept = now
+	}
+	if t, ok := n.notified[id]; ok && now.Sub(t) < interval {
+		return false
+	}
+	n.notified[id] = now
+	return true
+}
+
+// payload renders the notification for an alert in the format of the configured service.
+func (n *Notify) payload(a *config.Alert) ([]byte, error) {
+	title, message, err := n.c.Render(a)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.c.Type {
+	case "slack":
+		return json.Marshal(slackMessage(title, message))
+	case "teams":
+		return json.Marshal(teamsMessage(title, message, a))
+	default:
+		return json.Marshal(pagerDutyEvent(n.c, title, message, a))
+	}
+}
+
+// slackMessage is an incoming webhook message; the title is shown in bold.
+func slackMessage(title, message string) map[string]any {
+	return map[string]any{"text": "*" + title + "*\n" + message}
+}
+
+// teamsMessage is an Adaptive Card for a Teams incoming webhook or Workflows webhook.
+func teamsMessage(title, message string, a *config.Alert) map[string]any {
+	card := map[string]any{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body": []map[string]any{
+			{"type": "TextBlock", "text": title, "weight": "Bolder", "size": "Medium", "wrap": true},
+			{"type": "TextBlock", "text": message, "wrap": true},
+		},
+	}
+	if a.Linkback != "" {
+		card["actions"] = []map[string]any{
+			{"type": "Action.OpenUrl", "title": "View in Spyderbat", "url": a.Linkback},
+		}
+	}
+	return map[string]any{
+		"type": "message",
+		"attachments": []map[string]any{
+			{"contentType": "application/vnd.microsoft.card.adaptive", "content": card},
+		},
+	}
+}
+
+// pagerDutyEvent is an Events API v2 trigger event. The record id is the dedup key, so
+// updates to a trace that has an open incident are grouped into it.
+func pagerDutyEvent(c *config.Notify, title, message string, a *config.Alert) map[string]any {
+	if len(title) > maxSummaryLength {
+		title = title[:maxSummaryLength]
+	}
+	source := a.Hostname
+	if source == "" {
+		source = "spyderbat"
+	}
+	family, _, _ := strings.Cut(a.Schema, ":")
+	payload := map[string]any{
+		"summary":  title,
+		"source":   source,
+		"severity": c.Severity,
+		"class":    family,
+		"custom_details": map[string]any{
+			"message": message,
+			"score":   a.Score,
+			"trigger": a.Trigger,
+			"muid":    a.MUID,
+			"id":      a.ID,
+		},
+	}
+	if !a.Time.IsZero() {
+		payload["timestamp"] = a.Time.Format(time.RFC3339Nano)
+	}
+	event := map[string]any{
+		"routing_key":  c.RoutingKey,
+		"event_action": "trigger",
+		"client":       "Spyderbat",
+		"payload":      payload,
+	}
+	if a.ID != "" {
+		event["dedup_key"] = a.ID
+	}
+	if a.Linkback != "" {
+		event["client_url"] = a.Linkback
+		event["links"] = []map[string]any{{"href": a.Linkback, "text": "View in Spyderbat"}}
+	}
+	return event
+}
+
+func (n *Notify) sendBatch(b *sink.Batch) {
+	for _, payload := range b.Records {
+		if err := n.post(payload); err != nil {
+			logwrapper.Logger().Error().Err(err).Msg("Failed to send notification to " + n.c.Type)
+		}
+	}
+}
+
+func (n *Notify) post(payload []byte) error {
+	req, err := retryablehttp.NewRequest(http.MethodPost, n.c.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		logwrapper.Logger().Info().
+			Int("bytes", len(payload)).
+			Int("status_code", resp.StatusCode).
+			Msg("sent notification to " + n.c.Type)
+		return nil
+	}
+	return fmt.Errorf("%s returned status code %d: %s", n.c.Type, resp.StatusCode, strings.TrimSpace(string(respBody)))
+}
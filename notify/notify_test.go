@@ -0,0 +1,185 @@
+package notify
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"spyderbat-event-forwarder/config"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testRecords = [][]byte{
+	[]byte(`{"id":"trace:1","schema":"model_spydertrace:1.0.0","muid":"mach:1","time":1700000000.25,"name":"suspicious shell","score":95,"suppressed":false,"trigger_short_name":"reverse_shell","linkback":"https://example.com/trace?id=1","runtime_details":{"hostname":"puppies"}}`),
+	[]byte(`{"id":"trace:2","schema":"model_spydertrace:1.0.0","muid":"mach:1","time":1700000001,"name":"cron job","score":10,"suppressed":false}`),
+	[]byte(`{"id":"trace:3","schema":"model_spydertrace:1.0.0","muid":"mach:2","time":1700000002,"name":"known scanner","score":99,"suppressed":true}`),
+	[]byte(`{"id":"flag:1","schema":"event_redflag:bash:1.0.0","muid":"mach:1","time":1700000003,"score":99}`),
+	[]byte(`{"id":"trace:1","schema":"model_spydertrace:1.0.0","muid":"mach:1","time":1700000004,"name":"suspicious shell","score":100,"suppressed":false}`),
+	[]byte(`{"id":"trace:4","schema":"model_spydertrace:1.0.0","muid":"mach:2","time":1700000005,"name":"no score","suppressed":false}`),
+}
+
+// notifyServer collects the notifications it receives.
+type notifyServer struct {
+	*httptest.Server
+	lock   sync.Mutex
+	bodies []map[string]any
+}
+
+func newNotifyServer(t *testing.T, status int) *notifyServer {
+	s := &notifyServer{}
+	s.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		m := map[string]any{}
+		require.NoError(t, json.Unmarshal(body, &m))
+		s.lock.Lock()
+		s.bodies = append(s.bodies, m)
+		s.lock.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *notifyServer) received() []map[string]any {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]map[string]any(nil), s.bodies...)
+}
+
+func newTestNotify(t *testing.T, c *config.Notify) *Notify {
+	c.Insecure = true
+	require.NoError(t, config.ValidateNotify(c))
+	return New(c)
+}
+
+func sendAll(n *Notify) {
+	for _, record := range testRecords {
+		n.Send(record)
+	}
+	n.Shutdown()
+}
+
+func TestNotifySlack(t *testing.T) {
+	s := newNotifyServer(t, http.StatusOK)
+	minScore := 50.0
+	n := newTestNotify(t, &config.Notify{Type: "slack", URL: s.URL, Filter: config.NotifyFilter{MinScore: &minScore}})
+	sendAll(n)
+
+	// the low score, suppressed, other schema, repeated and unscored records are skipped
+	bodies := s.received()
+	require.Len(t, bodies, 1)
+	assert.Equal(t, "*suspicious shell (score 95) on puppies*\nTrigger: reverse_shell\nMachine: mach:1\nhttps://example.com/trace?id=1", bodies[0]["text"])
+}
+
+func TestNotifyFilter(t *testing.T) {
+	s := newNotifyServer(t, http.StatusOK)
+	n := newTestNotify(t, &config.Notify{
+		Type:    "slack",
+		URL:     s.URL,
+		Filter:  config.NotifyFilter{Schemas: []string{"model_spydertrace", "event_redflag"}, IncludeSuppressed: true},
+		Title:   "{{.ID}}",
+		Message: `{{index .Record "muid"}}`,
+	})
+	sendAll(n)
+
+	var texts []string
+	for _, b := range s.received() {
+		texts = append(texts, b["text"].(string))
+	}
+	assert.Equal(t, []string{"*trace:1*\nmach:1", "*trace:2*\nmach:1", "*trace:3*\nmach:2", "*flag:1*\nmach:1", "*trace:4*\nmach:2"}, texts)
+}
+
+func TestNotifyTransformedRecords(t *testing.T) {
+	s := newNotifyServer(t, http.StatusOK)
+	n := newTestNotify(t, &config.Notify{Type: "slack", URL: s.URL, Message: `{{index .Record "muid"}}`})
+	// an OCSF record has none of the fields that are filtered on
+	n.SendOriginal([]byte(`{"class_uid":2004,"time":1700000000250}`), testRecords[0])
+	n.Shutdown()
+
+	bodies := s.received()
+	require.Len(t, bodies, 1)
+	assert.Equal(t, "*suspicious shell (score 95) on puppies*\nmach:1", bodies[0]["text"])
+}
+
+func TestNotifyTeams(t *testing.T) {
+	s := newNotifyServer(t, http.StatusAccepted)
+	n := newTestNotify(t, &config.Notify{Type: "teams", URL: s.URL})
+	n.Send(testRecords[0])
+	n.Shutdown()
+
+	bodies := s.received()
+	require.Len(t, bodies, 1)
+	assert.Equal(t, "message", bodies[0]["type"])
+	attachment := bodies[0]["attachments"].([]any)[0].(map[string]any)
+	assert.Equal(t, "application/vnd.microsoft.card.adaptive", attachment["contentType"])
+	card := attachment["content"].(map[string]any)
+	assert.Equal(t, "AdaptiveCard", card["type"])
+	body := card["body"].([]any)
+	assert.Equal(t, "suspicious shell (score 95) on puppies", body[0].(map[string]any)["text"])
+	action := card["actions"].([]any)[0].(map[string]any)
+	assert.Equal(t, "https://example.com/trace?id=1", action["url"])
+}
+
+func TestNotifyPagerDuty(t *testing.T) {
+	s := newNotifyServer(t, http.StatusAccepted)
+	n := newTestNotify(t, &config.Notify{Type: "pagerduty", URL: s.URL, RoutingKey: "R0UT1NGKEY", Severity: "Error"})
+	n.Send(testRecords[0])
+	n.Send(testRecords[1])
+	n.Shutdown()
+
+	bodies := s.received()
+	require.Len(t, bodies, 2)
+	event := bodies[0]
+	assert.Equal(t, "R0UT1NGKEY", event["routing_key"])
+	assert.Equal(t, "trigger", event["event_action"])
+	assert.Equal(t, "trace:1", event["dedup_key"])
+	assert.Equal(t, "https://example.com/trace?id=1", event["client_url"])
+	payload := event["payload"].(map[string]any)
+	assert.Equal(t, "suspicious shell (score 95) on puppies", payload["summary"])
+	assert.Equal(t, "puppies", payload["source"])
+	assert.Equal(t, "error", payload["severity"])
+	assert.Equal(t, "model_spydertrace", payload["class"])
+	assert.Equal(t, "2023-11-14T22:13:20.25Z", payload["timestamp"])
+	details := payload["custom_details"].(map[string]any)
+	assert.Equal(t, 95.0, details["score"])
+	assert.Equal(t, "reverse_shell", details["trigger"])
+
+	// a record without a hostname or linkback
+	payload = bodies[1]["payload"].(map[string]any)
+	assert.Equal(t, "spyderbat", payload["source"])
+	assert.NotContains(t, bodies[1], "links")
+}
+
+func TestNotifyRateLimit(t *testing.T) {
+	n := &Notify{c: &config.Notify{RateLimit: time.Hour}, notified: make(map[string]time.Time), swept: time.Unix(0, 0)}
+	start := time.Unix(1700000000, 0)
+	assert.True(t, n.allow("trace:1", start))
+	assert.True(t, n.allow("trace:2", start))
+	assert.False(t, n.allow("trace:1", start.Add(59*time.Minute)))
+	assert.True(t, n.allow("trace:1", start.Add(time.Hour)))
+
+	// expired entries are removed
+	assert.True(t, n.allow("trace:3", start.Add(3*time.Hour)))
+	assert.Len(t, n.notified, 1)
+}
+
+func TestNotifyRejected(t *testing.T) {
+	s := newNotifyServer(t, http.StatusBadRequest)
+	n := newTestNotify(t, &config.Notify{Type: "slack", URL: s.URL})
+	n.Send(testRecords[0])
+	n.Shutdown()
+	assert.Len(t, s.received(), 1)
+}
+
+func TestNotifyNil(t *testing.T) {
+	var n *Notify
+	assert.Nil(t, New(nil))
+	n.Send(testRecords[0])
+	n.Shutdown()
+}
@@ -0,0 +1,191 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	retryablehttp "github.com/hashicorp/go-retryablehttp"
+	"github.com/valyala/fastjson"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// OTLP/gRPC is a single unary call, so it is made directly over HTTP/2 rather than with a
+// gRPC client: the request is a length-prefixed protobuf message, and the status is reported
+// in the grpc-status trailer.
+
+const grpcExportPath = "/opentelemetry.proto.collector.logs.v1.LogsService/Export"
+
+// grpcRetryable are the gRPC status codes that the OTLP specification says may be retried.
+var grpcRetryable = map[string]bool{
+	"1":  true, // CANCELLED
+	"4":  true, // DEADLINE_EXCEEDED
+	"8":  true, // RESOURCE_EXHAUSTED
+	"10": true, // ABORTED
+	"11": true, // OUT_OF_RANGE
+	"14": true, // UNAVAILABLE
+	"15": true, // DATA_LOSS
+}
+
+// enableGRPC switches a client to HTTP/2, including unencrypted HTTP/2 for http:// endpoints,
+// and retries on the retryable gRPC status codes.
+func enableGRPC(client *retryablehttp.Client) {
+	t := client.HTTPClient.Transport.(*http.Transport)
+	t.ForceAttemptHTTP2 = true
+	t.Protocols = new(http.Protocols)
+	t.Protocols.SetHTTP2(true)
+	t.Protocols.SetUnencryptedHTTP2(true)
+
+	client.CheckRetry = func(ctx context.Context, resp *http.Response, err error) (bool, error) {
+		if err != nil || resp.StatusCode != http.StatusOK {
+			return retryablehttp.DefaultRetryPolicy(ctx, resp, err)
+		}
+		// the status trailer is only available once the body has been read
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			return true, err
+		}
+		return grpcRetryable[grpcStatus(resp)], nil
+	}
+}
+
+// newGRPCRequest returns a request for the logs Export call with msg as its message.
+func newGRPCRequest(endpoint string, msg []byte, gzipped bool) (*retryablehttp.Request, error) {
+	frame := make([]byte, 5, 5+len(msg))
+	if gzipped {
+		frame[0] = 1
+	}
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	frame = append(frame, msg...)
+
+	req, err := retryablehttp.NewRequest(http.MethodPost, strings.TrimSuffix(endpoint, "/")+grpcExportPath, frame)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	if gzipped {
+		req.Header.Set("grpc-encoding", "gzip")
+	}
+	return req, nil
+}
+
+// grpcStatus returns the grpc-status of a response whose body has been read. A response with
+// no message carries it in the headers rather than the trailers.
+func grpcStatus(resp *http.Response) string {
+	if s := resp.Trailer.Get("grpc-status"); s != "" {
+		return s
+	}
+	return resp.Header.Get("grpc-status")
+}
+
+// grpcResponse checks the status of a gRPC response, and returns its message.
+func grpcResponse(resp *http.Response, body []byte) ([]byte, error) {
+	status := grpcStatus(resp)
+	if status != "0" {
+		msg := resp.Trailer.Get("grpc-message")
+		if msg == "" {
+			msg = resp.Header.Get("grpc-message")
+		}
+		if unescaped, err := url.PathUnescape(msg); err == nil {
+			msg = unescaped
+		}
+		if status == "" {
+			return nil, fmt.Errorf("otlp endpoint did not return a grpc status")
+		}
+		return nil, fmt.Errorf("otlp endpoint returned grpc status %s: %s", status, msg)
+	}
+
+	if len(body) < 5 {
+		return nil, nil
+	}
+	n := binary.BigEndian.Uint32(body[1:5])
+	if int(n) > len(body)-5 {
+		return nil, fmt.Errorf("truncated grpc response")
+	}
+	msg := body[5 : 5+n]
+	if body[0] == 1 {
+		z, err := gzip.NewReader(bytes.NewReader(msg))
+		if err != nil {
+			return nil, err
+		}
+		defer z.Close()
+		return io.ReadAll(z)
+	}
+	return msg, nil
+}
+
+// partialSuccess returns the number of rejected records and the error message from an
+// ExportLogsServiceResponse, if the collector reported a partial success.
+func partialSuccess(protocol string, body []byte) (int64, string) {
+	if len(body) == 0 {
+		return 0, ""
+	}
+
+	if protocol == "http/json" {
+		v, err := fastjson.ParseBytes(body)
+		if err != nil {
+			return 0, ""
+		}
+		// int64 fields are strings in OTLP/JSON, but some encoders write numbers
+		rejected := v.Get("partialSuccess", "rejectedLogRecords")
+		if rejected == nil {
+			return 0, ""
+		}
+		n, err := rejected.Int64()
+		if err != nil {
+			n, _ = strconv.ParseInt(string(rejected.GetStringBytes()), 10, 64)
+		}
+		return n, string(v.GetStringBytes("partialSuccess", "errorMessage"))
+	}
+
+	var rejected int64
+	var msg string
+	rangeFields(body, func(num protowire.Number, typ protowire.Type, ps []byte) {
+		if num != 1 || typ != protowire.BytesType {
+			return
+		}
+		ps, _ = protowire.ConsumeBytes(ps)
+		rangeFields(ps, func(num protowire.Number, typ protowire.Type, v []byte) {
+			switch {
+			case num == 1 && typ == protowire.VarintType:
+				n, _ := protowire.ConsumeVarint(v)
+				rejected = int64(n)
+			case num == 2 && typ == protowire.BytesType:
+				b, _ := protowire.ConsumeBytes(v)
+				msg = string(b)
+			}
+		})
+	})
+	return rejected, msg
+}
+
+// rangeFields calls fn with the number, type and encoded value of each field in a message.
+func rangeFields(b []byte, fn func(num protowire.Number, typ protowire.Type, value []byte)) {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return
+		}
+		b = b[n:]
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return
+		}
+		fn(num, typ, b[:n])
+		b = b[n:]
+	}
+}
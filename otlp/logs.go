@@ -0,0 +1,282 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package otlp
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/valyala/fastjson"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The types below mirror the parts of opentelemetry-proto's logs data model that the forwarder
+// uses. Each can be encoded as protobuf (appendProto) or as OTLP/JSON (json tags).
+
+type exportRequest struct {
+	ResourceLogs []*resourceLogs `json:"resourceLogs"`
+}
+
+type resourceLogs struct {
+	Resource  resource    `json:"resource"`
+	ScopeLogs []scopeLogs `json:"scopeLogs"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeLogs struct {
+	Scope      scope       `json:"scope"`
+	LogRecords []logRecord `json:"logRecords"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type logRecord struct {
+	TimeUnixNano         uint64     `json:"timeUnixNano,string"`
+	ObservedTimeUnixNano uint64     `json:"observedTimeUnixNano,string"`
+	SeverityNumber       int32      `json:"severityNumber,omitempty"`
+	SeverityText         string     `json:"severityText,omitempty"`
+	Body                 anyValue   `json:"body"`
+	Attributes           []keyValue `json:"attributes,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type valueKind int
+
+const (
+	kindEmpty valueKind = iota
+	kindString
+	kindBool
+	kindInt
+	kindDouble
+	kindArray
+	kindKVList
+)
+
+// anyValue is an OTLP AnyValue; only the field selected by kind is set.
+type anyValue struct {
+	kind    valueKind
+	str     string
+	boolean bool
+	integer int64
+	double  float64
+	array   []anyValue
+	kvlist  []keyValue
+}
+
+func stringValue(s string) anyValue {
+	return anyValue{kind: kindString, str: s}
+}
+
+// MarshalJSON encodes the value in OTLP/JSON form, where 64 bit integers are strings.
+func (a anyValue) MarshalJSON() ([]byte, error) {
+	type values[T any] struct {
+		Values []T `json:"values"`
+	}
+	var v map[string]any
+	switch a.kind {
+	case kindString:
+		v = map[string]any{"stringValue": a.str}
+	case kindBool:
+		v = map[string]any{"boolValue": a.boolean}
+	case kindInt:
+		v = map[string]any{"intValue": strconv.FormatInt(a.integer, 10)}
+	case kindDouble:
+		v = map[string]any{"doubleValue": a.double}
+	case kindArray:
+		v = map[string]any{"arrayValue": values[anyValue]{Values: a.array}}
+	case kindKVList:
+		v = map[string]any{"kvlistValue": values[keyValue]{Values: a.kvlist}}
+	default:
+		return []byte("{}"), nil
+	}
+	return json.Marshal(v)
+}
+
+// valueFromJSON converts a JSON value to an AnyValue, keeping its structure. Numbers without
+// a fraction or exponent are ints; null is an empty value.
+func valueFromJSON(v *fastjson.Value) anyValue {
+	switch v.Type() {
+	case fastjson.TypeString:
+		return stringValue(string(v.GetStringBytes()))
+	case fastjson.TypeTrue:
+		return anyValue{kind: kindBool, boolean: true}
+	case fastjson.TypeFalse:
+		return anyValue{kind: kindBool}
+	case fastjson.TypeNumber:
+		s := v.String()
+		if !strings.ContainsAny(s, ".eE") {
+			if i, err := v.Int64(); err == nil {
+				return anyValue{kind: kindInt, integer: i}
+			}
+		}
+		return anyValue{kind: kindDouble, double: v.GetFloat64()}
+	case fastjson.TypeArray:
+		a := v.GetArray()
+		values := make([]anyValue, 0, len(a))
+		for _, e := range a {
+			values = append(values, valueFromJSON(e))
+		}
+		return anyValue{kind: kindArray, array: values}
+	case fastjson.TypeObject:
+		return anyValue{kind: kindKVList, kvlist: attributesFromJSON(v.GetObject())}
+	}
+	return anyValue{}
+}
+
+// attributesFromJSON converts the fields of a JSON object to attributes, in order.
+func attributesFromJSON(o *fastjson.Object, skip ...string) []keyValue {
+	kvs := make([]keyValue, 0, o.Len())
+	o.Visit(func(key []byte, v *fastjson.Value) {
+		for _, s := range skip {
+			if string(key) == s {
+				return
+			}
+		}
+		kvs = append(kvs, keyValue{Key: string(key), Value: valueFromJSON(v)})
+	})
+	return kvs
+}
+
+// Protobuf field numbers, from opentelemetry-proto.
+const (
+	fieldExportResourceLogs = 1
+
+	fieldResourceLogsResource  = 1
+	fieldResourceLogsScopeLogs = 2
+	fieldResourceAttributes    = 1
+	fieldScopeLogsScope        = 1
+	fieldScopeLogsLogRecords   = 2
+	fieldScopeName             = 1
+
+	fieldLogTime           = 1
+	fieldLogSeverityNumber = 2
+	fieldLogSeverityText   = 3
+	fieldLogBody           = 5
+	fieldLogAttributes     = 6
+	fieldLogObservedTime   = 11
+
+	fieldKeyValueKey   = 1
+	fieldKeyValueValue = 2
+
+	fieldAnyString = 1
+	fieldAnyBool   = 2
+	fieldAnyInt    = 3
+	fieldAnyDouble = 4
+	fieldAnyArray  = 5
+	fieldAnyKVList = 6
+	fieldValues    = 1 // ArrayValue.values and KeyValueList.values
+)
+
+// appendMessage appends an embedded message field, encoded by appendFn.
+func appendMessage(b []byte, num protowire.Number, appendFn func([]byte) []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, appendFn(nil))
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendFixed64(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, v)
+}
+
+func (r *exportRequest) appendProto(b []byte) []byte {
+	for _, rl := range r.ResourceLogs {
+		b = appendMessage(b, fieldExportResourceLogs, rl.appendProto)
+	}
+	return b
+}
+
+func (rl *resourceLogs) appendProto(b []byte) []byte {
+	b = appendMessage(b, fieldResourceLogsResource, func(b []byte) []byte {
+		return appendKeyValues(b, fieldResourceAttributes, rl.Resource.Attributes)
+	})
+	for i := range rl.ScopeLogs {
+		b = appendMessage(b, fieldResourceLogsScopeLogs, rl.ScopeLogs[i].appendProto)
+	}
+	return b
+}
+
+func (sl *scopeLogs) appendProto(b []byte) []byte {
+	b = appendMessage(b, fieldScopeLogsScope, func(b []byte) []byte {
+		return appendString(b, fieldScopeName, sl.Scope.Name)
+	})
+	for i := range sl.LogRecords {
+		b = appendMessage(b, fieldScopeLogsLogRecords, sl.LogRecords[i].appendProto)
+	}
+	return b
+}
+
+func (l *logRecord) appendProto(b []byte) []byte {
+	b = appendFixed64(b, fieldLogTime, l.TimeUnixNano)
+	if l.SeverityNumber != 0 {
+		b = protowire.AppendTag(b, fieldLogSeverityNumber, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(l.SeverityNumber))
+	}
+	b = appendString(b, fieldLogSeverityText, l.SeverityText)
+	b = appendMessage(b, fieldLogBody, l.Body.appendProto)
+	b = appendKeyValues(b, fieldLogAttributes, l.Attributes)
+	return appendFixed64(b, fieldLogObservedTime, l.ObservedTimeUnixNano)
+}
+
+func appendKeyValues(b []byte, num protowire.Number, kvs []keyValue) []byte {
+	for i := range kvs {
+		kv := &kvs[i]
+		b = appendMessage(b, num, func(b []byte) []byte {
+			b = appendString(b, fieldKeyValueKey, kv.Key)
+			return appendMessage(b, fieldKeyValueValue, kv.Value.appendProto)
+		})
+	}
+	return b
+}
+
+func (a *anyValue) appendProto(b []byte) []byte {
+	switch a.kind {
+	case kindString:
+		// an empty string is still set, so it is encoded explicitly
+		b = protowire.AppendTag(b, fieldAnyString, protowire.BytesType)
+		b = protowire.AppendString(b, a.str)
+	case kindBool:
+		b = protowire.AppendTag(b, fieldAnyBool, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeBool(a.boolean))
+	case kindInt:
+		b = protowire.AppendTag(b, fieldAnyInt, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(a.integer))
+	case kindDouble:
+		b = protowire.AppendTag(b, fieldAnyDouble, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(a.double))
+	case kindArray:
+		b = appendMessage(b, fieldAnyArray, func(b []byte) []byte {
+			for i := range a.array {
+				b = appendMessage(b, fieldValues, a.array[i].appendProto)
+			}
+			return b
+		})
+	case kindKVList:
+		b = appendMessage(b, fieldAnyKVList, func(b []byte) []byte {
+			return appendKeyValues(b, fieldValues, a.kvlist)
+		})
+	}
+	return b
+}
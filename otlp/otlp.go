@@ -0,0 +1,321 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+// otlp exports records as OpenTelemetry log records, over OTLP/HTTP or OTLP/gRPC.
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"spyderbat-event-forwarder/config"
+	"spyderbat-event-forwarder/logwrapper"
+	"spyderbat-event-forwarder/sink"
+
+	retryablehttp "github.com/hashicorp/go-retryablehttp"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/valyala/fastjson"
+)
+
+var json = jsoniter.ConfigCompatibleWithStandardLibrary
+
+const scopeName = "spyderbat-event-forwarder"
+
+type httpclient interface {
+	Do(req *retryablehttp.Request) (*http.Response, error)
+}
+
+// OTLP is a sink that exports records to an OpenTelemetry collector.
+type OTLP struct {
+	c       *config.OTLP
+	client  httpclient
+	batcher *sink.Batcher
+}
+
+// New creates a new OTLP sink from the given config. If the config is nil, nil is returned.
+// A nil OTLP will silently drop all records.
+func New(c *config.OTLP) *OTLP {
+	if c == nil {
+		return nil
+	}
+
+	client := sink.NewHTTPClient(c.Insecure)
+	if c.Protocol == "grpc" {
+		enableGRPC(client)
+	}
+	o := &OTLP{
+		c:      c,
+		client: client,
+	}
+	o.batcher = sink.NewBatcher(sink.BatchOptions{MaxBytes: c.MaxPayloadBytes}, o.sendBatch)
+	return o
+}
+
+// originalFields are the fields of the record before it was transformed that the timestamp,
+// severity and resource of its log record come from.
+var originalFields = []string{"time", "severity", "muid", "runtime_details"}
+
+// Send queues a record for export. Calling Send after Shutdown will panic.
+func (o *OTLP) Send(record []byte) {
+	o.SendOriginal(record, record)
+}
+
+// SendOriginal queues a record for export, with the timestamp, severity and resource taken
+// from original, the record before it was transformed. Calling SendOriginal after Shutdown will
+// panic.
+func (o *OTLP) SendOriginal(record, original []byte) {
+	if o == nil || len(record) == 0 {
+		return
+	}
+	row, err := row(record, original)
+	if err != nil {
+		logwrapper.Logger().Warn().Err(err).Msg("dropping invalid record for otlp")
+		return
+	}
+	o.batcher.Add(row)
+}
+
+// row returns the row queued for a record. The fields of a transformed record's original are
+// queued as a JSON object on a line in front of it; the line is empty if the record is not
+// transformed.
+func row(record, original []byte) ([]byte, error) {
+	var row []byte
+	if !bytes.Equal(record, original) {
+		var p fastjson.Parser
+		v, err := p.ParseBytes(original)
+		if err == nil && v.Type() != fastjson.TypeObject {
+			err = fmt.Errorf("record is a %s, not an object", v.Type())
+		}
+		if err != nil {
+			return nil, err
+		}
+		var a fastjson.Arena
+		header := a.NewObject()
+		for _, name := range originalFields {
+			if fv := v.Get(name); fv != nil {
+				header.Set(name, fv)
+			}
+		}
+		row = header.MarshalTo(nil)
+	}
+	row = append(row, '\n')
+	return append(row, record...), nil
+}
+
+// Shutdown flushes the queue and shuts down the sink. It will block until the queue is empty.
+func (o *OTLP) Shutdown() {
+	log.Printf("shutting down otlp")
+	if o == nil {
+		return
+	}
+	o.batcher.Shutdown()
+}
+
+// severityNumbers maps spyderbat severities to OpenTelemetry severity numbers.
+var severityNumbers = map[string]int32{
+	"info":     9,  // INFO
+	"low":      13, // WARN
+	"medium":   14, // WARN2
+	"high":     17, // ERROR
+	"critical": 21, // FATAL
+}
+
+// resourceAttributes maps runtime_details fields to OpenTelemetry resource semantic conventions.
+// Other runtime_details fields are added as spyderbat.<field>.
+var resourceAttributes = map[string]string{
+	"hostname":          "host.name",
+	"cloud_instance_id": "host.id",
+	"ip_addresses":      "host.ip",
+	"mac_addresses":     "host.mac",
+}
+
+// resourceFor returns the resource attributes for a record: the service name, the muid and
+// the record's runtime_details.
+func (o *OTLP) resourceFor(v *fastjson.Value) []keyValue {
+	attrs := []keyValue{{Key: "service.name", Value: stringValue(o.c.ServiceName)}}
+	if muid := v.GetStringBytes("muid"); len(muid) > 0 {
+		attrs = append(attrs, keyValue{Key: "spyderbat.muid", Value: stringValue(string(muid))})
+	}
+	if rd := v.GetObject("runtime_details"); rd != nil {
+		for _, kv := range attributesFromJSON(rd) {
+			if key, found := resourceAttributes[kv.Key]; found {
+				kv.Key = key
+			} else {
+				kv.Key = "spyderbat." + kv.Key
+			}
+			attrs = append(attrs, kv)
+		}
+	}
+	return attrs
+}
+
+// logRecordFor maps a record to a log record. The record's fields, other than runtime_details,
+// become attributes, and the body is its description or name. The time and severity are taken
+// from original, the record before it was transformed.
+func logRecordFor(v, original *fastjson.Value, observed uint64) logRecord {
+	l := logRecord{
+		TimeUnixNano:         observed,
+		ObservedTimeUnixNano: observed,
+		SeverityText:         string(original.GetStringBytes("severity")),
+		Attributes:           attributesFromJSON(v.GetObject(), "runtime_details"),
+	}
+	if t := original.GetFloat64("time"); t > 0 {
+		l.TimeUnixNano = uint64(t * 1e9)
+	}
+	l.SeverityNumber = severityNumbers[strings.ToLower(l.SeverityText)]
+	for _, key := range []string{"description", "name", "short_name", "schema"} {
+		if s := v.GetStringBytes(key); len(s) > 0 {
+			l.Body = stringValue(string(s))
+			break
+		}
+	}
+	return l
+}
+
+// buildRequest maps a batch of rows queued by SendOriginal to an export request, with one
+// resource per machine. It returns the request and the number of records in it.
+func (o *OTLP) buildRequest(b *sink.Batch) (*exportRequest, int) {
+	var p, op fastjson.Parser
+	req := &exportRequest{}
+	byResource := make(map[string]*resourceLogs)
+	observed := uint64(time.Now().UnixNano())
+	count := 0
+
+	for _, row := range b.Records {
+		header, record, _ := bytes.Cut(row, []byte{'\n'})
+		v, err := p.ParseBytes(record)
+		if err == nil && v.Type() != fastjson.TypeObject {
+			err = fmt.Errorf("record is a %s, not an object", v.Type())
+		}
+		if err != nil {
+			logwrapper.Logger().Warn().Err(err).Msg("dropping invalid record for otlp")
+			continue
+		}
+		original := v
+		if len(header) > 0 {
+			if original, err = op.ParseBytes(header); err != nil {
+				continue // written by SendOriginal
+			}
+		}
+
+		key := string(original.GetStringBytes("muid"))
+		if rd := original.Get("runtime_details"); rd != nil {
+			key += rd.String()
+		}
+		rl, found := byResource[key]
+		if !found {
+			rl = &resourceLogs{
+				Resource:  resource{Attributes: o.resourceFor(original)},
+				ScopeLogs: []scopeLogs{{Scope: scope{Name: scopeName}}},
+			}
+			byResource[key] = rl
+			req.ResourceLogs = append(req.ResourceLogs, rl)
+		}
+		rl.ScopeLogs[0].LogRecords = append(rl.ScopeLogs[0].LogRecords, logRecordFor(v, original, observed))
+		count++
+	}
+	return req, count
+}
+
+// sendBatch exports a batch of records.
+func (o *OTLP) sendBatch(b *sink.Batch) {
+	req, count := o.buildRequest(b)
+	if count == 0 {
+		return
+	}
+	if err := o.export(req, count); err != nil {
+		logwrapper.Logger().Error().Err(err).Msg("Failed to export records to otlp")
+	}
+}
+
+// newRequest encodes an export request for the configured protocol.
+func (o *OTLP) newRequest(r *exportRequest) (req *retryablehttp.Request, size int, err error) {
+	var data []byte
+	if o.c.Protocol == "http/json" {
+		if data, err = json.Marshal(r); err != nil {
+			return nil, 0, err
+		}
+	} else {
+		data = r.appendProto(nil)
+	}
+
+	body := data
+	gzipped := o.c.CompressionAlgo == "gzip"
+	if gzipped {
+		buf := &bytes.Buffer{}
+		z, err := gzip.NewWriterLevel(buf, gzip.BestSpeed)
+		if err != nil {
+			panic(err) // only panics if level is invalid
+		}
+		// a write to a bytes.Buffer never returns an error
+		_, _ = z.Write(data)
+		_ = z.Close()
+		body = buf.Bytes()
+	}
+
+	if o.c.Protocol == "grpc" {
+		req, err = newGRPCRequest(o.c.Endpoint, body, gzipped)
+		return req, len(data), err
+	}
+
+	req, err = retryablehttp.NewRequest(http.MethodPost, o.c.Endpoint, body)
+	if err != nil {
+		return nil, 0, err
+	}
+	if o.c.Protocol == "http/json" {
+		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req.Header.Set("Content-Type", "application/x-protobuf")
+	}
+	if gzipped {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	return req, len(data), nil
+}
+
+func (o *OTLP) export(r *exportRequest, count int) error {
+	req, size, err := o.newRequest(r)
+	if err != nil {
+		return err
+	}
+	for k, v := range o.c.Headers {
+		req.Header.Set(k, v)
+	}
+	o.c.Authentication.SetHeaders(req.Request)
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("otlp endpoint returned status code %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	if o.c.Protocol == "grpc" {
+		if respBody, err = grpcResponse(resp, respBody); err != nil {
+			return err
+		}
+	}
+
+	if rejected, msg := partialSuccess(o.c.Protocol, respBody); rejected > 0 {
+		logwrapper.Logger().Warn().Int64("rejected", rejected).Str("message", msg).Msg("otlp endpoint rejected records")
+	}
+	logwrapper.Logger().Info().
+		Int("events", count).
+		Int("bytes", size).
+		Int("status_code", resp.StatusCode).
+		Msg("exported to otlp")
+	return nil
+}
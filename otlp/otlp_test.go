@@ -0,0 +1,310 @@
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"spyderbat-event-forwarder/config"
+	"spyderbat-event-forwarder/sink"
+	"spyderbat-event-forwarder/transform"
+	"testing"
+	"time"
+
+	retryablehttp "github.com/hashicorp/go-retryablehttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var testRecord = []byte(`{"schema":"event_redflag:bash:1.0.0","id":"flag:1","muid":"mach:1","time":1700000001.5,` +
+	`"severity":"high","description":"bash ran","pid":42,"score":7.5,"args":["bash","-i"],"ancestors":null,` +
+	`"runtime_details":{"hostname":"puppies","ip_addresses":["10.0.0.1"],"cloud_instance_id":"i-123","forwarder":"v2"}}`)
+
+// fields decodes a protobuf message into its fields' encoded values, by field number.
+func fields(b []byte) map[protowire.Number][][]byte {
+	m := make(map[protowire.Number][][]byte)
+	rangeFields(b, func(num protowire.Number, typ protowire.Type, v []byte) {
+		if typ == protowire.BytesType {
+			v, _ = protowire.ConsumeBytes(v)
+		}
+		m[num] = append(m[num], v)
+	})
+	return m
+}
+
+// attributes decodes repeated KeyValues with string values; other values are left encoded.
+func attributes(kvs [][]byte) map[string]string {
+	attrs := make(map[string]string)
+	for _, kv := range kvs {
+		f := fields(kv)
+		value := fields(f[fieldKeyValueValue][0])
+		if s, found := value[fieldAnyString]; found {
+			attrs[string(f[fieldKeyValueKey][0])] = string(s[0])
+		} else {
+			attrs[string(f[fieldKeyValueKey][0])] = string(f[fieldKeyValueValue][0])
+		}
+	}
+	return attrs
+}
+
+func newTestOTLP(t *testing.T, cfg *config.OTLP) *OTLP {
+	require.NoError(t, config.ValidateOTLP(cfg))
+	return New(cfg)
+}
+
+func TestOTLPHTTPProtobuf(t *testing.T) {
+	var got []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/logs", r.URL.Path)
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "value", r.Header.Get("X-Custom"))
+		z, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		got, err = io.ReadAll(z)
+		require.NoError(t, err)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	o := newTestOTLP(t, &config.OTLP{
+		Endpoint:        ts.URL,
+		CompressionAlgo: "gzip",
+		Headers:         map[string]string{"X-Custom": "value"},
+	})
+	o.Send(testRecord)
+	o.Send(testRecord)
+	o.Shutdown()
+
+	req := fields(got)
+	require.Len(t, req[fieldExportResourceLogs], 1, "records from the same machine share a resource")
+	rl := fields(req[fieldExportResourceLogs][0])
+
+	resource := attributes(fields(rl[fieldResourceLogsResource][0])[fieldResourceAttributes])
+	assert.Equal(t, "spyderbat-event-forwarder", resource["service.name"])
+	assert.Equal(t, "mach:1", resource["spyderbat.muid"])
+	assert.Equal(t, "puppies", resource["host.name"])
+	assert.Equal(t, "i-123", resource["host.id"])
+	assert.Equal(t, "v2", resource["spyderbat.forwarder"])
+	assert.Contains(t, resource, "host.ip")
+
+	sl := fields(rl[fieldResourceLogsScopeLogs][0])
+	assert.Equal(t, scopeName, string(fields(sl[fieldScopeLogsScope][0])[fieldScopeName][0]))
+	require.Len(t, sl[fieldScopeLogsLogRecords], 2)
+
+	lr := fields(sl[fieldScopeLogsLogRecords][0])
+	ts64, _ := protowire.ConsumeFixed64(lr[fieldLogTime][0])
+	assert.Equal(t, uint64(1700000001500000000), ts64)
+	sev, _ := protowire.ConsumeVarint(lr[fieldLogSeverityNumber][0])
+	assert.Equal(t, uint64(17), sev)
+	assert.Equal(t, "high", string(lr[fieldLogSeverityText][0]))
+	assert.Equal(t, "bash ran", string(fields(lr[fieldLogBody][0])[fieldAnyString][0]))
+	assert.NotEmpty(t, lr[fieldLogObservedTime])
+
+	attrs := attributes(lr[fieldLogAttributes])
+	assert.Equal(t, "event_redflag:bash:1.0.0", attrs["schema"])
+	assert.NotContains(t, attrs, "runtime_details")
+	pid, _ := protowire.ConsumeVarint(fields([]byte(attrs["pid"]))[fieldAnyInt][0])
+	assert.Equal(t, uint64(42), pid)
+}
+
+func TestOTLPHTTPJSON(t *testing.T) {
+	var got map[string]any
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/custom/logs", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(body, &got))
+		_, _ = w.Write([]byte(`{"partialSuccess":{"rejectedLogRecords":"1","errorMessage":"nope"}}`))
+	}))
+	defer ts.Close()
+
+	o := newTestOTLP(t, &config.OTLP{
+		Endpoint: ts.URL + "/custom/logs",
+		Protocol: "http/json",
+		Authentication: config.WebhookAuthentication{
+			Method:     "bearer",
+			Parameters: config.AuthenticationParameters{Secret: "token"},
+		},
+	})
+	o.Send(testRecord)
+	o.Shutdown()
+
+	rl := got["resourceLogs"].([]any)[0].(map[string]any)
+	lr := rl["scopeLogs"].([]any)[0].(map[string]any)["logRecords"].([]any)[0].(map[string]any)
+	assert.Equal(t, "1700000001500000000", lr["timeUnixNano"])
+	assert.Equal(t, float64(17), lr["severityNumber"])
+	assert.Equal(t, map[string]any{"stringValue": "bash ran"}, lr["body"])
+
+	attrs := map[string]any{}
+	for _, kv := range lr["attributes"].([]any) {
+		attrs[kv.(map[string]any)["key"].(string)] = kv.(map[string]any)["value"]
+	}
+	assert.Equal(t, map[string]any{"intValue": "42"}, attrs["pid"])
+	assert.Equal(t, map[string]any{"doubleValue": 7.5}, attrs["score"])
+	assert.Equal(t, map[string]any{}, attrs["ancestors"])
+	assert.Equal(t, map[string]any{"arrayValue": map[string]any{"values": []any{
+		map[string]any{"stringValue": "bash"},
+		map[string]any{"stringValue": "-i"},
+	}}}, attrs["args"])
+}
+
+// grpcServer returns a server speaking HTTP/2, over TLS unless plaintext is set, that answers
+// Export calls with the given statuses in turn, and records the messages it receives.
+func grpcServer(t *testing.T, plaintext bool, statuses []string, got *[][]byte) *httptest.Server {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, 2, r.ProtoMajor)
+		assert.Equal(t, grpcExportPath, r.URL.Path)
+		assert.Equal(t, "application/grpc", r.Header.Get("Content-Type"))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, len(body), 5)
+		assert.Equal(t, byte(0), body[0])
+		assert.Equal(t, uint32(len(body)-5), binary.BigEndian.Uint32(body[1:5]))
+		*got = append(*got, body[5:])
+
+		status := statuses[0]
+		statuses = statuses[1:]
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "grpc-status, grpc-message")
+		w.WriteHeader(http.StatusOK)
+		if status == "0" {
+			// an empty ExportLogsServiceResponse
+			_, _ = w.Write([]byte{0, 0, 0, 0, 0})
+		}
+		w.Header().Set("grpc-status", status)
+		w.Header().Set("grpc-message", "try again")
+	}))
+	if plaintext {
+		ts.Config.Protocols = new(http.Protocols)
+		ts.Config.Protocols.SetUnencryptedHTTP2(true)
+		ts.Start()
+		return ts
+	}
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	return ts
+}
+
+func TestOTLPGRPC(t *testing.T) {
+	var got [][]byte
+	ts := grpcServer(t, false, []string{"14", "0"}, &got)
+	defer ts.Close()
+
+	o := newTestOTLP(t, &config.OTLP{Endpoint: ts.URL, Protocol: "grpc", Insecure: true})
+	o.client.(*retryablehttp.Client).RetryWaitMin = 10 * time.Millisecond
+	o.Send(testRecord)
+	o.Shutdown()
+
+	// UNAVAILABLE is retried
+	require.Len(t, got, 2)
+	assert.Equal(t, got[0], got[1])
+	assert.Len(t, fields(got[1])[fieldExportResourceLogs], 1)
+}
+
+func TestOTLPGRPCPlaintext(t *testing.T) {
+	var got [][]byte
+	ts := grpcServer(t, true, []string{"0"}, &got)
+	defer ts.Close()
+
+	o := newTestOTLP(t, &config.OTLP{Endpoint: ts.URL, Protocol: "grpc"})
+	o.Send(testRecord)
+	o.Shutdown()
+
+	assert.Len(t, got, 1)
+}
+
+func TestOTLPGRPCError(t *testing.T) {
+	var got [][]byte
+	ts := grpcServer(t, false, []string{"3"}, &got)
+	defer ts.Close()
+
+	o := newTestOTLP(t, &config.OTLP{Endpoint: ts.URL, Protocol: "grpc", Insecure: true})
+	r, err := row(testRecord, testRecord)
+	require.NoError(t, err)
+	req, count := o.buildRequest(&sink.Batch{Records: [][]byte{r}})
+	err = o.export(req, count)
+	o.Shutdown()
+
+	// INVALID_ARGUMENT is not retried
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "grpc status 3: try again")
+	assert.Len(t, got, 1)
+}
+
+func TestOTLPTransformedRecords(t *testing.T) {
+	o := newTestOTLP(t, &config.OTLP{Endpoint: "http://collector:4318"})
+	defer o.Shutdown()
+
+	// ocsf has no muid, severity or runtime_details, and its time is in milliseconds
+	ocsf, err := new(transform.OCSF).Transform(testRecord)
+	require.NoError(t, err)
+	r, err := row(ocsf, testRecord)
+	require.NoError(t, err)
+	req, count := o.buildRequest(&sink.Batch{Records: [][]byte{r}})
+	require.Equal(t, 1, count)
+
+	rl := req.ResourceLogs[0]
+	resource := map[string]string{}
+	for _, kv := range rl.Resource.Attributes {
+		resource[kv.Key] = kv.Value.str
+	}
+	assert.Equal(t, "mach:1", resource["spyderbat.muid"])
+	assert.Equal(t, "puppies", resource["host.name"])
+
+	lr := rl.ScopeLogs[0].LogRecords[0]
+	assert.Equal(t, uint64(1700000001500000000), lr.TimeUnixNano)
+	assert.Equal(t, "high", lr.SeverityText)
+	attrs := map[string]bool{}
+	for _, kv := range lr.Attributes {
+		attrs[kv.Key] = true
+	}
+	assert.True(t, attrs["class_uid"], "the attributes are the transformed record's fields")
+}
+
+func TestOTLPNil(t *testing.T) {
+	var o *OTLP
+	o.Send(testRecord)
+	o.Shutdown()
+	assert.Nil(t, New(nil))
+}
+
+func TestPartialSuccess(t *testing.T) {
+	var ps []byte
+	ps = protowire.AppendTag(ps, 1, protowire.VarintType)
+	ps = protowire.AppendVarint(ps, 3)
+	ps = protowire.AppendTag(ps, 2, protowire.BytesType)
+	ps = protowire.AppendString(ps, "bad records")
+	var resp []byte
+	resp = protowire.AppendTag(resp, 1, protowire.BytesType)
+	resp = protowire.AppendBytes(resp, ps)
+
+	n, msg := partialSuccess("grpc", resp)
+	assert.Equal(t, int64(3), n)
+	assert.Equal(t, "bad records", msg)
+
+	n, _ = partialSuccess("http/protobuf", nil)
+	assert.Zero(t, n)
+
+	n, msg = partialSuccess("http/json", []byte(`{"partialSuccess":{"rejectedLogRecords":2,"errorMessage":"x"}}`))
+	assert.Equal(t, int64(2), n)
+	assert.Equal(t, "x", msg)
+}
+
+func TestGRPCResponseGzip(t *testing.T) {
+	buf := &bytes.Buffer{}
+	z := gzip.NewWriter(buf)
+	_, _ = z.Write([]byte("message"))
+	require.NoError(t, z.Close())
+	body := append([]byte{1, 0, 0, 0, byte(buf.Len())}, buf.Bytes()...)
+
+	resp := &http.Response{Header: http.Header{}, Trailer: http.Header{"Grpc-Status": {"0"}}}
+	msg, err := grpcResponse(resp, body)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("message"), msg)
+}
@@ -0,0 +1,58 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package panther
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Diff compares two schemas and returns one line per difference, sorted by field path:
+// "+ path (type)" for fields only in to, "- path (type)" for fields only in from, and
+// "~ path: from -> to" for fields whose type changed.
+func Diff(from, to *Schema) []string {
+	var lines []string
+	diffFields(&lines, "", from.Fields, to.Fields)
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i][2:] < lines[j][2:] })
+	return lines
+}
+
+func diffFields(lines *[]string, prefix string, from, to []Field) {
+	for i := range to {
+		name := prefix + to[i].Name
+		old := findField(from, to[i].Name)
+		if old == nil {
+			*lines = append(*lines, fmt.Sprintf("+ %s (%s)", name, typeName(&to[i])))
+			continue
+		}
+		diffField(lines, name, old, &to[i])
+	}
+	for i := range from {
+		if findField(to, from[i].Name) == nil {
+			*lines = append(*lines, fmt.Sprintf("- %s (%s)", prefix+from[i].Name, typeName(&from[i])))
+		}
+	}
+}
+
+func diffField(lines *[]string, name string, from, to *Field) {
+	if typeName(from) != typeName(to) {
+		*lines = append(*lines, fmt.Sprintf("~ %s: %s -> %s", name, typeName(from), typeName(to)))
+		return
+	}
+	switch {
+	case from.Type == "object":
+		diffFields(lines, name+".", from.Fields, to.Fields)
+	case from.Type == "array" && from.Element != nil && to.Element != nil:
+		diffField(lines, name+"[]", from.Element, to.Element)
+	}
+}
+
+// typeName describes a field's type, including array element types.
+func typeName(f *Field) string {
+	if f.Type == "array" && f.Element != nil {
+		return "array<" + typeName(f.Element) + ">"
+	}
+	return f.Type
+}
@@ -0,0 +1,109 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package panther
+
+// ElasticsearchMapping converts the schema to an Elasticsearch index mapping.
+func (s *Schema) ElasticsearchMapping() map[string]any {
+	return map[string]any{
+		"mappings": map[string]any{
+			"properties": esProperties(s.Fields),
+		},
+	}
+}
+
+func esProperties(fields []Field) map[string]any {
+	props := make(map[string]any, len(fields))
+	for i := range fields {
+		props[fields[i].Name] = esField(&fields[i])
+	}
+	return props
+}
+
+func esField(f *Field) map[string]any {
+	switch f.Type {
+	case "object":
+		return map[string]any{"properties": esProperties(f.Fields)}
+	case "array":
+		// elasticsearch arrays are implicit; map the element type
+		if f.Element == nil {
+			return map[string]any{"type": "flattened"}
+		}
+		return esField(f.Element)
+	case "string":
+		return map[string]any{"type": "keyword"}
+	case "boolean":
+		return map[string]any{"type": "boolean"}
+	case "bigint", "int", "smallint":
+		return map[string]any{"type": "long"}
+	case "float":
+		return map[string]any{"type": "double"}
+	case "timestamp":
+		for _, tf := range f.TimeFormats {
+			if tf == "unix" {
+				return map[string]any{"type": "date", "format": "epoch_second"}
+			}
+		}
+		return map[string]any{"type": "date"}
+	}
+	return map[string]any{"type": "flattened"}
+}
+
+// JSONSchema converts the schema to a JSON Schema (draft 2020-12) document.
+func (s *Schema) JSONSchema() map[string]any {
+	doc := jsObject(s.Fields)
+	doc["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	doc["title"] = "Spyderbat event"
+	return doc
+}
+
+func jsObject(fields []Field) map[string]any {
+	props := make(map[string]any, len(fields))
+	var required []string
+	for i := range fields {
+		props[fields[i].Name] = jsField(&fields[i])
+		if fields[i].Required {
+			required = append(required, fields[i].Name)
+		}
+	}
+	o := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		o["required"] = required
+	}
+	return o
+}
+
+func jsField(f *Field) map[string]any {
+	var js map[string]any
+	switch f.Type {
+	case "object":
+		js = jsObject(f.Fields)
+	case "array":
+		js = map[string]any{"type": "array"}
+		if f.Element != nil {
+			js["items"] = jsField(f.Element)
+		}
+	case "string":
+		js = map[string]any{"type": "string"}
+	case "boolean":
+		js = map[string]any{"type": "boolean"}
+	case "bigint", "int", "smallint":
+		js = map[string]any{"type": "integer"}
+	case "float":
+		js = map[string]any{"type": "number"}
+	case "timestamp":
+		js = map[string]any{"type": "string", "format": "date-time"}
+		for _, tf := range f.TimeFormats {
+			if tf == "unix" {
+				js = map[string]any{"type": "number"}
+			}
+		}
+	default:
+		js = map[string]any{}
+	}
+	if f.Description != "" {
+		js["description"] = f.Description
+	}
+	return js
+}
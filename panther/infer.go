@@ -0,0 +1,229 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package panther
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/valyala/fastjson"
+)
+
+// unixTimeFields are numeric top-level fields that hold unix timestamps.
+var unixTimeFields = map[string]bool{
+	"time":          true,
+	"valid_from":    true,
+	"valid_to":      true,
+	"expire_at":     true,
+	"model_version": true,
+}
+
+// requiredFields are top-level fields that are marked required if every sampled record has them.
+var requiredFields = map[string]bool{
+	"id":     true,
+	"schema": true,
+	"time":   true,
+}
+
+// Inferrer builds a schema from observed records.
+type Inferrer struct {
+	root    *node
+	records int
+}
+
+// node accumulates what has been observed about a single field.
+type node struct {
+	kinds   map[string]bool  // panther types of the observed values
+	rfc3339 bool             // all observed strings were RFC 3339 timestamps
+	seen    int              // number of records (or parent objects) the field appeared in
+	schemas map[string]bool  // schema families the field appeared in
+	fields  map[string]*node // for objects
+	element *node            // for arrays
+}
+
+func newNode() *node {
+	return &node{kinds: make(map[string]bool), rfc3339: true, schemas: make(map[string]bool)}
+}
+
+// NewInferrer returns an empty Inferrer.
+func NewInferrer() *Inferrer {
+	return &Inferrer{root: newNode()}
+}
+
+// Records returns the number of records observed so far.
+func (in *Inferrer) Records() int {
+	return in.records
+}
+
+// Observe adds a JSON record to the inferred schema.
+func (in *Inferrer) Observe(record []byte) error {
+	p := parserPool.Get()
+	defer parserPool.Put(p)
+
+	v, err := p.ParseBytes(record)
+	if err != nil {
+		return err
+	}
+	in.records++
+	in.root.observe(v, SchemaFamily(string(v.GetStringBytes("schema"))))
+	return nil
+}
+
+// SchemaFamily returns the portion of a spyderbat schema name before the version,
+// e.g. "model_spydertrace" for "model_spydertrace:1.0.0".
+func SchemaFamily(schema string) string {
+	if i := strings.IndexByte(schema, ':'); i >= 0 {
+		return schema[:i]
+	}
+	return schema
+}
+
+func (n *node) observe(v *fastjson.Value, family string) {
+	if v.Type() == fastjson.TypeNull {
+		return
+	}
+	n.seen++
+	if family != "" {
+		n.schemas[family] = true
+	}
+
+	kind := InferType(v)
+	n.kinds[kind] = true
+
+	switch kind {
+	case "object":
+		if n.fields == nil {
+			n.fields = make(map[string]*node)
+		}
+		o, _ := v.Object()
+		o.Visit(func(key []byte, v *fastjson.Value) {
+			child, found := n.fields[string(key)]
+			if !found {
+				child = newNode()
+				n.fields[string(key)] = child
+			}
+			child.observe(v, family)
+		})
+	case "array":
+		if n.element == nil {
+			n.element = newNode()
+		}
+		for _, e := range v.GetArray() {
+			n.element.observe(e, family)
+		}
+	case "string":
+		if n.rfc3339 {
+			_, err := time.Parse(time.RFC3339Nano, string(v.GetStringBytes()))
+			n.rfc3339 = err == nil
+		}
+	}
+}
+
+// kind resolves the observed value types to a single panther type.
+func (n *node) kind() string {
+	switch {
+	case len(n.kinds) == 0:
+		return "json"
+	case len(n.kinds) == 1:
+		for k := range n.kinds {
+			return k
+		}
+	case len(n.kinds) == 2 && n.kinds["bigint"] && n.kinds["float"]:
+		return "float"
+	}
+	return "json"
+}
+
+// Schema returns the schema inferred from the records observed so far. Annotations that
+// cannot be inferred (indicators and time formats) are carried over from base, which may be nil.
+func (in *Inferrer) Schema(base *Schema) *Schema {
+	var baseFields []Field
+	if base != nil {
+		baseFields = base.Fields
+	}
+	return &Schema{Fields: in.root.toFields(baseFields, in.records, true)}
+}
+
+func (n *node) toFields(base []Field, parentSeen int, top bool) []Field {
+	names := make([]string, 0, len(n.fields))
+	for name := range n.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := make([]Field, 0, len(names))
+	for _, name := range names {
+		child := n.fields[name]
+		f := child.toField(findField(base, name), top && unixTimeFields[name])
+		f.Name = name
+		f.Required = top && requiredFields[name] && child.seen == parentSeen
+		if top && name == "time" && f.Type == "timestamp" {
+			f.IsEventTime = true
+		}
+		if top && len(child.schemas) > 0 {
+			families := make([]string, 0, len(child.schemas))
+			for s := range child.schemas {
+				families = append(families, s)
+			}
+			sort.Strings(families)
+			f.Description = "Seen in " + strings.Join(families, ", ")
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func (n *node) toField(base *Field, unixTime bool) Field {
+	// nothing observed (e.g. only empty arrays), so trust the base schema if there is one
+	if n.seen == 0 && base != nil {
+		return *base
+	}
+
+	f := Field{Type: n.kind()}
+
+	switch f.Type {
+	case "object":
+		var baseFields []Field
+		if base != nil {
+			baseFields = base.Fields
+		}
+		f.Fields = n.toFields(baseFields, n.seen, false)
+	case "array":
+		var baseElement *Field
+		if base != nil {
+			baseElement = base.Element
+		}
+		e := n.element.toField(baseElement, false)
+		f.Element = &e
+	case "string":
+		if n.rfc3339 {
+			f.Type = "timestamp"
+			f.TimeFormats = []string{"rfc3339"}
+		}
+	case "bigint", "float":
+		if unixTime {
+			f.Type = "timestamp"
+			f.TimeFormats = []string{"unix"}
+		}
+	}
+
+	if base != nil && base.Type == f.Type {
+		f.Indicators = base.Indicators
+		if len(base.TimeFormats) > 0 {
+			f.TimeFormats = base.TimeFormats
+		}
+	}
+	return f
+}
+
+func findField(fields []Field, name string) *Field {
+	for i := range fields {
+		if fields[i].Name == name {
+			return &fields[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package panther
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func inferTestSchema(t *testing.T, base *Schema) *Schema {
+	in := NewInferrer()
+	records := []string{
+		`{"id":"t1","schema":"model_spydertrace:1.0.0","time":1700000000.5,"score":50,"tags":[],` +
+			`"runtime_details":{"hostname":"puppies","ip_addresses":["10.0.0.1"]}}`,
+		`{"id":"r1","schema":"event_redflag:bash:1.0.0","time":1700000001,"score":12.5,"tags":["a"],` +
+			`"last_active":"2024-01-01T00:00:00Z","mixed":"x","runtime_details":{"hostname":"kittens","ip_addresses":[]}}`,
+		`{"schema":"event_redflag:bash:1.0.0","time":1700000002,"mixed":1,"runtime_details":null}`,
+	}
+	for _, r := range records {
+		require.NoError(t, in.Observe([]byte(r)))
+	}
+	assert.Error(t, in.Observe([]byte(`{`)))
+	assert.Equal(t, 3, in.Records())
+	return in.Schema(base)
+}
+
+func TestInfer(t *testing.T) {
+	s := inferTestSchema(t, nil)
+
+	id := findField(s.Fields, "id")
+	require.NotNil(t, id)
+	assert.Equal(t, "string", id.Type)
+	assert.False(t, id.Required, "id is missing from one record")
+	assert.Equal(t, "Seen in event_redflag, model_spydertrace", id.Description)
+
+	tm := findField(s.Fields, "time")
+	require.NotNil(t, tm)
+	assert.Equal(t, "timestamp", tm.Type)
+	assert.Equal(t, []string{"unix"}, tm.TimeFormats)
+	assert.True(t, tm.Required)
+	assert.True(t, tm.IsEventTime)
+
+	assert.Equal(t, "float", findField(s.Fields, "score").Type)
+	assert.Equal(t, "json", findField(s.Fields, "mixed").Type)
+	assert.Equal(t, "timestamp", findField(s.Fields, "last_active").Type)
+	assert.Equal(t, "array<string>", typeName(findField(s.Fields, "tags")))
+
+	rd := findField(s.Fields, "runtime_details")
+	require.NotNil(t, rd)
+	assert.Equal(t, "object", rd.Type)
+	assert.Equal(t, "array<string>", typeName(findField(rd.Fields, "ip_addresses")))
+	assert.Empty(t, findField(rd.Fields, "ip_addresses").Element.Indicators)
+}
+
+func TestInferWithBase(t *testing.T) {
+	base, err := ParseSchema(DefaultSchema)
+	require.NoError(t, err)
+	s := inferTestSchema(t, base)
+
+	rd := findField(s.Fields, "runtime_details")
+	require.NotNil(t, rd)
+	assert.Equal(t, []string{"ip"}, findField(rd.Fields, "ip_addresses").Element.Indicators)
+
+	// the inferred schema must validate the records it was inferred from
+	problems, err := s.Validate([]byte(`{"schema":"event_redflag:bash:1.0.0","time":1700000002,"mixed":1}`))
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+}
+
+func TestDiff(t *testing.T) {
+	from := &Schema{Fields: []Field{
+		{Name: "a", Type: "string"},
+		{Name: "b", Type: "bigint"},
+		{Name: "c", Type: "object", Fields: []Field{{Name: "d", Type: "string"}}},
+		{Name: "e", Type: "array", Element: &Field{Type: "string"}},
+	}}
+	to := &Schema{Fields: []Field{
+		{Name: "a", Type: "string"},
+		{Name: "b", Type: "float"},
+		{Name: "c", Type: "object", Fields: []Field{{Name: "f", Type: "boolean"}}},
+		{Name: "e", Type: "array", Element: &Field{Type: "bigint"}},
+		{Name: "g", Type: "string"},
+	}}
+
+	assert.Equal(t, []string{
+		"~ b: bigint -> float",
+		"- c.d (string)",
+		"+ c.f (boolean)",
+		"~ e: array<string> -> array<bigint>",
+		"+ g (string)",
+	}, Diff(from, to))
+	assert.Empty(t, Diff(from, from))
+}
+
+func TestExport(t *testing.T) {
+	s := &Schema{Fields: []Field{
+		{Name: "id", Type: "string", Required: true},
+		{Name: "time", Type: "timestamp", TimeFormats: []string{"unix"}},
+		{Name: "tags", Type: "array", Element: &Field{Type: "string"}},
+		{Name: "rd", Type: "object", Fields: []Field{{Name: "n", Type: "bigint"}}},
+	}}
+
+	es := s.ElasticsearchMapping()
+	props := es["mappings"].(map[string]any)["properties"].(map[string]any)
+	assert.Equal(t, map[string]any{"type": "keyword"}, props["id"])
+	assert.Equal(t, map[string]any{"type": "date", "format": "epoch_second"}, props["time"])
+	assert.Equal(t, map[string]any{"type": "keyword"}, props["tags"])
+	assert.Equal(t, map[string]any{"properties": map[string]any{"n": map[string]any{"type": "long"}}}, props["rd"])
+
+	js := s.JSONSchema()
+	assert.Equal(t, []string{"id"}, js["required"])
+	jsProps := js["properties"].(map[string]any)
+	assert.Equal(t, map[string]any{"type": "number"}, jsProps["time"])
+	assert.Equal(t, map[string]any{"type": "array", "items": map[string]any{"type": "string"}}, jsProps["tags"])
+}
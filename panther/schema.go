@@ -0,0 +1,181 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+// panther contains helpers for working with Panther custom log schemas.
+package panther
+
+import (
+	_ "embed"
+	"fmt"
+	"sort"
+
+	"github.com/valyala/fastjson"
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultSchema is the bundled Custom.SpyderbatR0 schema.
+//
+//go:embed Custom.SpyderbatR0.schema.yaml
+var DefaultSchema []byte
+
+// Schema is a Panther custom log schema.
+type Schema struct {
+	Fields []Field `yaml:"fields"`
+}
+
+// Field is a single field (or array element) in a Panther schema.
+type Field struct {
+	Name        string   `yaml:"name,omitempty"`
+	Description string   `yaml:"description,omitempty"`
+	Required    bool     `yaml:"required,omitempty"`
+	Type        string   `yaml:"type"`
+	Element     *Field   `yaml:"element,omitempty"`
+	Fields      []Field  `yaml:"fields,omitempty"`
+	Indicators  []string `yaml:"indicators,omitempty"`
+	TimeFormats []string `yaml:"timeFormats,omitempty"`
+	IsEventTime bool     `yaml:"isEventTime,omitempty"`
+}
+
+// ParseSchema parses a Panther schema from YAML.
+func ParseSchema(data []byte) (*Schema, error) {
+	s := &Schema{}
+	if err := yaml.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse panther schema: %w", err)
+	}
+	if len(s.Fields) == 0 {
+		return nil, fmt.Errorf("panther schema has no fields")
+	}
+	return s, nil
+}
+
+var parserPool = fastjson.ParserPool{}
+
+// Validate checks a JSON record against the schema, and returns a sorted list of problems:
+// fields missing from the schema, values that don't match the declared type, and missing
+// required fields. A nil result means the record conforms to the schema.
+func (s *Schema) Validate(record []byte) ([]string, error) {
+	p := parserPool.Get()
+	defer parserPool.Put(p)
+
+	v, err := p.ParseBytes(record)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	validateObject(&problems, "", s.Fields, v)
+	sort.Strings(problems)
+	return problems, nil
+}
+
+func validateObject(problems *[]string, prefix string, fields []Field, v *fastjson.Value) {
+	o, err := v.Object()
+	if err != nil {
+		*problems = append(*problems, fmt.Sprintf("%s: expected object, got %s", prefix, v.Type()))
+		return
+	}
+
+	declared := make(map[string]*Field, len(fields))
+	for i := range fields {
+		declared[fields[i].Name] = &fields[i]
+	}
+
+	o.Visit(func(key []byte, v *fastjson.Value) {
+		name := prefix + string(key)
+		f, found := declared[string(key)]
+		if !found {
+			*problems = append(*problems, fmt.Sprintf("%s: not declared in schema (observed %s)", name, InferType(v)))
+			return
+		}
+		validateValue(problems, name, f, v)
+	})
+
+	for _, f := range fields {
+		if f.Required && o.Get(f.Name) == nil {
+			*problems = append(*problems, fmt.Sprintf("%s%s: required field is missing", prefix, f.Name))
+		}
+	}
+}
+
+func validateValue(problems *[]string, name string, f *Field, v *fastjson.Value) {
+	if v.Type() == fastjson.TypeNull {
+		return
+	}
+
+	switch f.Type {
+	case "object":
+		validateObject(problems, name+".", f.Fields, v)
+	case "array":
+		a, err := v.Array()
+		if err != nil {
+			*problems = append(*problems, fmt.Sprintf("%s: expected array, got %s", name, v.Type()))
+			return
+		}
+		if f.Element == nil {
+			return
+		}
+		for _, e := range a {
+			validateValue(problems, name+"[]", f.Element, e)
+		}
+	case "json":
+		// anything goes
+	default:
+		if !compatible(f, v) {
+			*problems = append(*problems, fmt.Sprintf("%s: expected %s, got %s", name, f.Type, v.Type()))
+		}
+	}
+}
+
+// compatible reports whether a scalar value can be ingested as the given field type.
+func compatible(f *Field, v *fastjson.Value) bool {
+	switch f.Type {
+	case "string":
+		return v.Type() == fastjson.TypeString
+	case "boolean":
+		return v.Type() == fastjson.TypeTrue || v.Type() == fastjson.TypeFalse
+	case "bigint", "int", "smallint":
+		if v.Type() != fastjson.TypeNumber {
+			return false
+		}
+		_, err := v.Int64()
+		return err == nil
+	case "float":
+		return v.Type() == fastjson.TypeNumber
+	case "timestamp":
+		for _, tf := range f.TimeFormats {
+			switch tf {
+			case "unix", "unix_ms", "unix_us", "unix_ns":
+				if v.Type() == fastjson.TypeNumber {
+					return true
+				}
+			default:
+				if v.Type() == fastjson.TypeString {
+					return true
+				}
+			}
+		}
+		return len(f.TimeFormats) == 0
+	}
+	return true
+}
+
+// InferType returns the Panther type that best describes a JSON value.
+func InferType(v *fastjson.Value) string {
+	switch v.Type() {
+	case fastjson.TypeObject:
+		return "object"
+	case fastjson.TypeArray:
+		return "array"
+	case fastjson.TypeString:
+		return "string"
+	case fastjson.TypeTrue, fastjson.TypeFalse:
+		return "boolean"
+	case fastjson.TypeNumber:
+		if _, err := v.Int64(); err == nil {
+			return "bigint"
+		}
+		return "float"
+	}
+	return "json"
+}
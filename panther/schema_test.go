@@ -0,0 +1,44 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package panther
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultSchema(t *testing.T) {
+	s, err := ParseSchema(DefaultSchema)
+	require.NoError(t, err)
+	assert.NotEmpty(t, s.Fields)
+}
+
+func TestValidate(t *testing.T) {
+	s, err := ParseSchema(DefaultSchema)
+	require.NoError(t, err)
+
+	record := []byte(`{"id":"trace:1","schema":"model_spydertrace:1.0.0","time":1642790400.5,"score":50,` +
+		`"suppressed":false,"runtime_details":{"hostname":"puppies","ip_addresses":["10.0.0.1"],"mac_addresses":[]}}`)
+	problems, err := s.Validate(record)
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+
+	record = []byte(`{"schema":"model_spydertrace:1.0.0","time":1642790400,"score":50.5,"kittens":[1],` +
+		`"runtime_details":{"hostname":"puppies","ip_addresses":[1],"puppies":true}}`)
+	problems, err = s.Validate(record)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"id: required field is missing",
+		"kittens: not declared in schema (observed array)",
+		"runtime_details.ip_addresses[]: expected string, got number",
+		"runtime_details.puppies: not declared in schema (observed boolean)",
+		"score: expected bigint, got number",
+	}, problems)
+
+	_, err = s.Validate([]byte(`{`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,211 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package parquet
+
+import (
+	"sort"
+	"strings"
+
+	pq "github.com/parquet-go/parquet-go"
+	"github.com/valyala/fastjson"
+)
+
+// kind is the type of a column. Columns whose values have different JSON types in the same
+// file are written as text.
+type kind int
+
+const (
+	kindNull kind = iota // no values seen yet
+	kindBool
+	kindNumber
+	kindString
+	kindText // mixed types; strings as-is and other values as JSON
+	kindTimestamp
+)
+
+// promoted are the columns that every file has, whether or not its records have the fields,
+// so that the common fields have the same names and types across schemas and files.
+var promoted = map[string]kind{
+	"schema":   kindString,
+	"id":       kindString,
+	"muid":     kindString,
+	"time":     kindTimestamp, // record time in milliseconds since the epoch, UTC
+	"severity": kindString,
+}
+
+// partitionColumns are the names of the partition columns in file paths. Query engines
+// reject tables where a data column has the same name, so fields with these names get a
+// trailing _, e.g. date_.
+var partitionColumns = map[string]bool{"family": true, "date": true}
+
+// runtimeDetailsPrefix is prepended to the fields of runtime_details, which are promoted to
+// top-level columns, e.g. runtime_details_hostname.
+const runtimeDetailsPrefix = "runtime_details_"
+
+// field is a top-level column value of a record.
+type field struct {
+	column string
+	value  *fastjson.Value
+}
+
+// table is the inferred schema and rows for a file.
+type table struct {
+	kinds map[string]kind
+	rows  [][]field
+}
+
+func newTable() *table {
+	t := &table{kinds: make(map[string]kind, len(promoted))}
+	for name, k := range promoted {
+		t.kinds[name] = k
+	}
+	return t
+}
+
+// add adds a record to the table, adding or widening columns for its fields. If original is not
+// nil, it has the promoted fields of the record before it was transformed, and the promoted
+// columns are taken from it rather than from v.
+func (t *table) add(v, original *fastjson.Value) {
+	var row []field
+	if original != nil {
+		original.GetObject().Visit(func(key []byte, ov *fastjson.Value) {
+			row = t.addField(row, string(key), ov)
+		})
+	}
+	v.GetObject().Visit(func(key []byte, fv *fastjson.Value) {
+		if string(key) == "runtime_details" && fv.Type() == fastjson.TypeObject {
+			fv.GetObject().Visit(func(key []byte, rv *fastjson.Value) {
+				row = t.addField(row, runtimeDetailsPrefix+columnName(key), rv)
+			})
+			return
+		}
+		column := columnName(key)
+		if partitionColumns[column] {
+			column += "_"
+		}
+		if _, found := promoted[column]; found && original != nil {
+			return
+		}
+		row = t.addField(row, column, fv)
+	})
+	t.rows = append(t.rows, row)
+}
+
+func (t *table) addField(row []field, column string, v *fastjson.Value) []field {
+	if v.Type() == fastjson.TypeNull {
+		return row
+	}
+	k := valueKind(v)
+	switch current, found := t.kinds[column]; {
+	case !found || current == kindNull:
+		t.kinds[column] = k
+	case current == kindTimestamp:
+		if k != kindNumber {
+			return row // not a time; left null
+		}
+	case current != k:
+		t.kinds[column] = kindText
+	}
+	return append(row, field{column: column, value: v})
+}
+
+func valueKind(v *fastjson.Value) kind {
+	switch v.Type() {
+	case fastjson.TypeTrue, fastjson.TypeFalse:
+		return kindBool
+	case fastjson.TypeNumber:
+		return kindNumber
+	case fastjson.TypeString:
+		return kindString
+	}
+	return kindText // objects and arrays are written as JSON
+}
+
+// columnName makes a field name safe for Athena, Hive and Spark, which expect lowercase
+// letters, digits and underscores.
+func columnName(key []byte) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '_'
+	}, string(key))
+}
+
+// schema returns the Parquet schema for the table and its column names, in column order.
+// Every column is optional.
+func (t *table) schema(name string) (*pq.Schema, []string) {
+	group := make(pq.Group, len(t.kinds))
+	columns := make([]string, 0, len(t.kinds))
+	for column, k := range t.kinds {
+		var node pq.Node
+		switch k {
+		case kindBool:
+			node = pq.Leaf(pq.BooleanType)
+		case kindNumber:
+			node = pq.Leaf(pq.DoubleType)
+		case kindTimestamp:
+			node = pq.Timestamp(pq.Millisecond)
+		default:
+			node = pq.String()
+		}
+		group[column] = pq.Optional(node)
+		columns = append(columns, column)
+	}
+	// groups order their fields by name
+	sort.Strings(columns)
+	return pq.NewSchema(name, group), columns
+}
+
+// parquetRows converts the table's rows for writing with the given column order.
+func (t *table) parquetRows(columns []string) []pq.Row {
+	index := make(map[string]int, len(columns))
+	for i, c := range columns {
+		index[c] = i
+	}
+
+	rows := make([]pq.Row, 0, len(t.rows))
+	for _, fields := range t.rows {
+		row := make(pq.Row, len(columns))
+		for i := range row {
+			row[i] = pq.Value{}.Level(0, 0, i) // null
+		}
+		for _, f := range fields {
+			i, found := index[f.column]
+			if !found {
+				continue
+			}
+			if v, ok := columnValue(t.kinds[f.column], f.value); ok {
+				row[i] = v.Level(0, 1, i)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// columnValue converts a JSON value for a column of kind k.
+func columnValue(k kind, v *fastjson.Value) (pq.Value, bool) {
+	switch k {
+	case kindBool:
+		return pq.BooleanValue(v.Type() == fastjson.TypeTrue), true
+	case kindNumber:
+		return pq.DoubleValue(v.GetFloat64()), true
+	case kindTimestamp:
+		if v.Type() != fastjson.TypeNumber {
+			return pq.Value{}, false
+		}
+		return pq.Int64Value(int64(v.GetFloat64() * 1000)), true
+	case kindString:
+		return pq.ByteArrayValue(v.GetStringBytes()), true
+	}
+	if v.Type() == fastjson.TypeString {
+		return pq.ByteArrayValue(v.GetStringBytes()), true
+	}
+	return pq.ByteArrayValue(v.MarshalTo(nil)), true
+}
@@ -0,0 +1,289 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+// parquet writes records to Parquet files, one set of files per schema family, and optionally
+// uploads them to an object store.
+package parquet
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"spyderbat-event-forwarder/config"
+	"spyderbat-event-forwarder/logwrapper"
+	"spyderbat-event-forwarder/sink"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	pq "github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+	"github.com/valyala/fastjson"
+)
+
+var uploadTimeout = 10 * time.Minute
+
+var (
+	parserPool = fastjson.ParserPool{}
+	arenaPool  = fastjson.ArenaPool{}
+)
+
+var codecs = map[string]compress.Codec{
+	"snappy": &pq.Snappy,
+	"zstd":   &pq.Zstd,
+	"gzip":   &pq.Gzip,
+	"none":   &pq.Uncompressed,
+}
+
+// uploader puts a file in the object store.
+type uploader interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// Parquet is a sink that collects the records for each schema family and writes them to a new
+// file when they reach the size limit or the oldest reaches the age limit. Each file's columns
+// are inferred from its records, so new fields appear as new columns in later files.
+//
+// Files are partitioned by schema family and the date of their first record, as
+// family=<family>/date=<yyyy-mm-dd>/part-<time>-<random>.parquet, which Athena, Glue and Spark
+// recognize as partition columns.
+type Parquet struct {
+	c        *config.Parquet
+	uploader uploader // nil to only write files locally
+
+	lock   sync.Mutex
+	groups map[string]*sink.Batcher // schema family -> batcher
+}
+
+// New creates a new Parquet sink from the given config. If the config is nil, nil is returned.
+// A nil Parquet will silently drop all records.
+func New(c *config.Parquet) *Parquet {
+	if c == nil {
+		return nil
+	}
+	p := &Parquet{
+		c:      c,
+		groups: make(map[string]*sink.Batcher),
+	}
+	if c.S3 != nil {
+		p.uploader = s3.NewFromConfig(c.S3.Config(), func(o *s3.Options) {
+			if c.S3.EndpointURL != "" {
+				o.BaseEndpoint = aws.String(c.S3.EndpointURL)
+				o.UsePathStyle = true
+			}
+		})
+	}
+	return p
+}
+
+// Send queues a record for the next file for its schema family. Calling Send after Shutdown
+// will panic.
+func (p *Parquet) Send(record []byte) {
+	p.SendOriginal(record, record)
+}
+
+// SendOriginal queues a record for the next file for the schema family of original, the record
+// before it was transformed, which the promoted columns are also taken from. Calling
+// SendOriginal after Shutdown will panic.
+func (p *Parquet) SendOriginal(record, original []byte) {
+	if p == nil || len(record) == 0 {
+		return
+	}
+
+	pp := parserPool.Get()
+	defer parserPool.Put(pp)
+	v, err := pp.ParseBytes(original)
+	if err != nil || v.Type() != fastjson.TypeObject {
+		logwrapper.Logger().Warn().Err(err).Msg("dropping invalid record for parquet")
+		return
+	}
+	family := string(v.GetStringBytes("schema"))
+	if i := strings.IndexByte(family, ':'); i >= 0 {
+		family = family[:i]
+	}
+	if family == "" {
+		family = "unknown"
+	}
+
+	// the promoted fields of a transformed record are queued as a JSON object on a line in
+	// front of it; the line is empty if the record is not transformed
+	var row []byte
+	if !bytes.Equal(record, original) {
+		a := arenaPool.Get()
+		defer arenaPool.Put(a)
+		header := a.NewObject()
+		for name := range promoted {
+			if fv := v.Get(name); fv != nil {
+				header.Set(name, fv)
+			}
+		}
+		row = header.MarshalTo(nil)
+	}
+	row = append(row, '\n')
+	p.batcherFor(columnName([]byte(family))).Add(append(row, record...))
+}
+
+// batcherFor returns the batcher for a schema family, creating it if needed.
+func (p *Parquet) batcherFor(family string) *sink.Batcher {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	b, found := p.groups[family]
+	if !found {
+		b = sink.NewBatcher(sink.BatchOptions{
+			MaxBytes:  p.c.MaxFileBytes,
+			MaxAge:    p.c.MaxFileAge,
+			QueueSize: 1, // each batch is a file's worth of records
+		}, func(b *sink.Batch) { p.writeBatch(family, b) })
+		p.groups[family] = b
+	}
+	return b
+}
+
+// Shutdown writes the pending files and shuts down the sink. It will block until they are
+// written and uploaded.
+func (p *Parquet) Shutdown() {
+	log.Printf("shutting down parquet")
+	if p == nil {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, b := range p.groups {
+		b.Shutdown()
+	}
+}
+
+// writeBatch writes a batch of records to a new file, and uploads it if configured to.
+func (p *Parquet) writeBatch(family string, b *sink.Batch) {
+	t := newTable()
+	first := time.Time{}
+	for _, row := range b.Records {
+		header, record, _ := bytes.Cut(row, []byte{'\n'})
+		// the values are kept until the file is written, so they are not parsed with the pool
+		v, err := fastjson.ParseBytes(record)
+		if err != nil || v.Type() != fastjson.TypeObject {
+			logwrapper.Logger().Warn().Err(err).Msg("dropping invalid record for parquet")
+			continue
+		}
+		var original *fastjson.Value
+		if len(header) > 0 {
+			if original, err = fastjson.ParseBytes(header); err != nil {
+				continue // written by SendOriginal
+			}
+		}
+		if first.IsZero() {
+			ts := v.GetFloat64("time")
+			if original != nil {
+				ts = original.GetFloat64("time")
+			}
+			if ts > 0 {
+				first = time.Unix(0, int64(ts*1e9)).UTC()
+			}
+		}
+		t.add(v, original)
+	}
+	if len(t.rows) == 0 {
+		return
+	}
+	if first.IsZero() {
+		first = time.Now().UTC()
+	}
+
+	rel, err := p.writeFile(family, first, t)
+	if err != nil {
+		logwrapper.Logger().Error().Err(err).Int("events", len(t.rows)).Msg("Failed to write records to parquet")
+		return
+	}
+	logwrapper.Logger().Info().Int("events", len(t.rows)).Int("bytes", b.Bytes).Str("file", rel).Msg("sent to parquet")
+
+	if p.uploader != nil {
+		p.upload(rel)
+	}
+}
+
+// writeFile writes the table to a new file and returns its path relative to the directory.
+// The file is written under a temporary name and renamed when complete, so readers of the
+// directory never see a partial file.
+func (p *Parquet) writeFile(family string, first time.Time, t *table) (string, error) {
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	rel := filepath.Join(
+		"family="+family,
+		"date="+first.Format(time.DateOnly),
+		fmt.Sprintf("part-%s-%s.parquet", time.Now().UTC().Format("20060102T150405"), hex.EncodeToString(suffix)))
+	path := filepath.Join(p.c.Path(), rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp) // fails harmlessly once renamed
+
+	schema, columns := t.schema(family)
+	w := pq.NewWriter(f, schema, pq.Compression(codecs[p.c.Compression]), pq.CreatedBy("spyderbat-event-forwarder", "", ""))
+	if _, err := w.WriteRows(t.parquetRows(columns)); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return rel, os.Rename(tmp, path)
+}
+
+// upload puts a file in the object store, and removes the local copy unless configured to
+// keep it. A file that fails to upload is kept.
+func (p *Parquet) upload(rel string) {
+	path := filepath.Join(p.c.Path(), rel)
+	f, err := os.Open(path)
+	if err != nil {
+		logwrapper.Logger().Error().Err(err).Str("file", rel).Msg("Failed to upload parquet file")
+		return
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		logwrapper.Logger().Error().Err(err).Str("file", rel).Msg("Failed to upload parquet file")
+		return
+	}
+
+	key := p.c.S3.Prefix + filepath.ToSlash(rel)
+	ctx, cancel := context.WithTimeout(context.Background(), uploadTimeout)
+	defer cancel()
+	_, err = p.uploader.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(p.c.S3.Bucket),
+		Key:           aws.String(key),
+		Body:          f,
+		ContentLength: aws.Int64(st.Size()),
+		ContentType:   aws.String("application/vnd.apache.parquet"),
+	})
+	if err != nil {
+		logwrapper.Logger().Error().Err(err).Str("file", rel).Msg("Failed to upload parquet file; it is kept in the parquet directory")
+		return
+	}
+	logwrapper.Logger().Info().Str("bucket", p.c.S3.Bucket).Str("key", key).Int64("bytes", st.Size()).Msg("uploaded parquet file")
+
+	if !p.c.S3.KeepLocal {
+		if err := os.Remove(path); err != nil {
+			logwrapper.Logger().Warn().Err(err).Str("file", rel).Msg("unable to remove uploaded parquet file")
+		}
+	}
+}
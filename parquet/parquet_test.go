@@ -0,0 +1,273 @@
+package parquet
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"spyderbat-event-forwarder/config"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	pq "github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fastjson"
+)
+
+var testRecords = [][]byte{
+	[]byte(`{"schema":"model_process::1.2.0","id":"proc:1","muid":"mach:1","time":1700000001.5,"pid":42,"args":["bash","-c"],"runtime_details":{"hostname":"puppies","ip_addresses":["10.0.0.1"]}}`),
+	[]byte(`{"schema":"event_redflag:bash:1.0.0","id":"flag:1","muid":"mach:1","time":1700000002,"severity":"high","ok":true}`),
+	[]byte(`{"schema":"model_process::1.2.0","id":"proc:2","muid":"mach:2","time":1700000003,"pid":"unknown","Exe.Path":"/bin/sh"}`),
+}
+
+func newTestParquet(t *testing.T, c *config.Parquet) *Parquet {
+	require.NoError(t, config.ValidateParquet(c, t.TempDir()))
+	return New(c)
+}
+
+// readFiles reads the rows of every parquet file under dir, keyed by path relative to dir.
+func readFiles(t *testing.T, dir string) map[string][]map[string]any {
+	files := map[string][]map[string]any{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		require.NoError(t, err)
+		if info.IsDir() {
+			return nil
+		}
+		require.True(t, strings.HasSuffix(path, ".parquet"), path)
+		rel, _ := filepath.Rel(dir, path)
+		files[rel] = readFile(t, path)
+		return nil
+	})
+	require.NoError(t, err)
+	return files
+}
+
+func readFile(t *testing.T, path string) []map[string]any {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	f, err := pq.OpenFile(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+
+	columns := f.Schema().Columns()
+	reader := pq.NewReader(f)
+	defer reader.Close()
+	var rows []map[string]any
+	buf := make([]pq.Row, 1)
+	for {
+		n, err := reader.ReadRows(buf)
+		if n == 0 {
+			require.ErrorIs(t, err, io.EOF)
+			return rows
+		}
+		row := map[string]any{}
+		for _, v := range buf[0] {
+			if v.IsNull() {
+				continue
+			}
+			name := columns[v.Column()][0]
+			switch v.Kind() {
+			case pq.Boolean:
+				row[name] = v.Boolean()
+			case pq.Double:
+				row[name] = v.Double()
+			case pq.Int64:
+				row[name] = v.Int64()
+			default:
+				row[name] = v.String()
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+func TestParquet(t *testing.T) {
+	p := newTestParquet(t, &config.Parquet{})
+	for _, record := range testRecords {
+		p.Send(record)
+	}
+	p.Send([]byte(`not json`))
+	p.Shutdown()
+
+	files := readFiles(t, p.c.Path())
+	require.Len(t, files, 2)
+	var names []string
+	for name := range files {
+		names = append(names, filepath.Dir(name))
+	}
+	sort.Strings(names)
+	assert.Equal(t, []string{
+		filepath.Join("family=event_redflag", "date=2023-11-14"),
+		filepath.Join("family=model_process", "date=2023-11-14"),
+	}, names)
+
+	for name, rows := range files {
+		if !strings.HasPrefix(name, "family=model_process") {
+			assert.Equal(t, []map[string]any{{
+				"schema": "event_redflag:bash:1.0.0", "id": "flag:1", "muid": "mach:1", "time": int64(1700000002000), "severity": "high", "ok": true,
+			}}, rows)
+			continue
+		}
+		// pid has numbers and strings, so it is text; runtime_details is promoted
+		assert.Equal(t, []map[string]any{{
+			"schema": "model_process::1.2.0", "id": "proc:1", "muid": "mach:1", "time": int64(1700000001500),
+			"pid": "42", "args": `["bash","-c"]`,
+			"runtime_details_hostname": "puppies", "runtime_details_ip_addresses": `["10.0.0.1"]`,
+		}, {
+			"schema": "model_process::1.2.0", "id": "proc:2", "muid": "mach:2", "time": int64(1700000003000),
+			"pid": "unknown", "exe_path": "/bin/sh",
+		}}, rows)
+	}
+}
+
+func TestParquetPathLayout(t *testing.T) {
+	p := newTestParquet(t, &config.Parquet{})
+	p.Send([]byte(`{"schema":"model_process::1.2.0","id":"proc:1","time":1700000001.5,"family":"bash","date":"today"}`))
+	p.Shutdown()
+
+	files := readFiles(t, p.c.Path())
+	require.Len(t, files, 1)
+	for name, rows := range files {
+		assert.Regexp(t, `^family=model_process/date=2023-11-14/part-\d{8}T\d{6}-[0-9a-f]{8}\.parquet$`, filepath.ToSlash(name))
+		// the partition columns are not also data columns
+		require.Len(t, rows, 1)
+		assert.Equal(t, "model_process::1.2.0", rows[0]["schema"])
+		assert.Equal(t, "bash", rows[0]["family_"])
+		assert.Equal(t, "today", rows[0]["date_"])
+		assert.NotContains(t, rows[0], "family")
+		assert.NotContains(t, rows[0], "date")
+	}
+}
+
+func TestParquetTransformedRecords(t *testing.T) {
+	p := newTestParquet(t, &config.Parquet{})
+	// an OCSF record has no Spyderbat schema, id or muid, and its time is in milliseconds
+	p.SendOriginal([]byte(`{"class_uid":1007,"time":1700000001500,"severity":"High"}`), testRecords[1])
+	p.Shutdown()
+
+	files := readFiles(t, p.c.Path())
+	require.Len(t, files, 1)
+	for name, rows := range files {
+		assert.True(t, strings.HasPrefix(filepath.ToSlash(name), "family=event_redflag/date=2023-11-14/"), name)
+		assert.Equal(t, []map[string]any{{
+			"schema": "event_redflag:bash:1.0.0", "id": "flag:1", "muid": "mach:1", "time": int64(1700000002000), "severity": "high",
+			"class_uid": float64(1007),
+		}}, rows)
+	}
+}
+
+func TestParquetSchema(t *testing.T) {
+	tbl := newTable()
+	for _, record := range testRecords {
+		tbl.add(fastjson.MustParseBytes(record), nil)
+	}
+	schema, columns := tbl.schema("spyderbat")
+	assert.Equal(t, []string{
+		"args", "exe_path", "id", "muid", "ok", "pid",
+		"runtime_details_hostname", "runtime_details_ip_addresses", "schema", "severity", "time",
+	}, columns)
+	for i, c := range schema.Columns() {
+		assert.Equal(t, columns[i], c[0])
+	}
+
+	types := map[string]string{}
+	for _, f := range schema.Fields() {
+		assert.True(t, f.Optional(), f.Name())
+		types[f.Name()] = f.Type().String()
+	}
+	assert.Equal(t, "BOOLEAN", types["ok"])
+	assert.Equal(t, "STRING", types["pid"])
+	assert.Equal(t, "TIMESTAMP(isAdjustedToUTC=true,unit=MILLIS)", types["time"])
+}
+
+func TestParquetRolling(t *testing.T) {
+	// each record is larger than half the limit, so each is written to its own file, and the
+	// later file has the column for the new field
+	p := newTestParquet(t, &config.Parquet{MaxFileBytes: 200, Compression: "zstd"})
+	p.Send(testRecords[0])
+	p.Send(testRecords[2])
+	p.Shutdown()
+
+	files := readFiles(t, p.c.Path())
+	require.Len(t, files, 2)
+	var exePaths int
+	for _, rows := range files {
+		require.Len(t, rows, 1)
+		if _, ok := rows[0]["exe_path"]; ok {
+			exePaths++
+		}
+	}
+	assert.Equal(t, 1, exePaths)
+}
+
+func TestParquetMaxAge(t *testing.T) {
+	p := newTestParquet(t, &config.Parquet{MaxFileAge: time.Second})
+	p.Send(testRecords[1])
+	// files are written as .tmp and then renamed, so only count the finished ones
+	require.Eventually(t, func() bool {
+		files, _ := filepath.Glob(filepath.Join(p.c.Path(), "*", "*", "*.parquet"))
+		return len(files) == 1
+	}, 5*time.Second, 100*time.Millisecond)
+	p.Shutdown()
+	assert.Len(t, readFiles(t, p.c.Path()), 1)
+}
+
+// mockS3 accepts PutObject requests.
+type mockS3 struct {
+	lock    sync.Mutex
+	objects map[string][]byte
+}
+
+func (m *mockS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	m.lock.Lock()
+	m.objects[r.URL.Path] = body
+	m.lock.Unlock()
+	w.Header().Set("ETag", `"etag"`)
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestParquetS3(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDTEST")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_CONFIG_FILE", "/nonexistent")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", "/nonexistent")
+
+	m := &mockS3{objects: map[string][]byte{}}
+	ts := httptest.NewServer(m)
+	defer ts.Close()
+
+	p := newTestParquet(t, &config.Parquet{S3: &config.ParquetS3{
+		Bucket:      "lake",
+		Prefix:      "spyderbat",
+		Region:      "us-east-1",
+		EndpointURL: ts.URL,
+	}})
+	p.Send(testRecords[1])
+	p.Shutdown()
+
+	// the uploaded file is removed
+	assert.Empty(t, readFiles(t, p.c.Path()))
+	require.Len(t, m.objects, 1)
+	for key, body := range m.objects {
+		assert.True(t, strings.HasPrefix(key, "/lake/spyderbat/family=event_redflag/date=2023-11-14/part-"), key)
+		assert.Equal(t, "PAR1", string(body[:4]))
+	}
+}
+
+func TestParquetNil(t *testing.T) {
+	var p *Parquet
+	assert.Nil(t, New(nil))
+	p.Send(testRecords[0])
+	p.Shutdown()
+}
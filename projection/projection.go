@@ -0,0 +1,210 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+// projection keeps or removes fields of records by schema, to reduce what is sent to outputs.
+package projection
+
+import (
+	"strings"
+
+	"spyderbat-event-forwarder/config"
+
+	"github.com/valyala/fastjson"
+)
+
+var parserPool = fastjson.ParserPool{}
+
+// node is a tree of field paths. A leaf matches the whole value at its path.
+type node struct {
+	leaf     bool
+	children map[string]*node
+}
+
+func (n *node) add(path []string) {
+	if n.leaf {
+		return
+	}
+	if len(path) == 0 {
+		n.leaf, n.children = true, nil
+		return
+	}
+	if n.children == nil {
+		n.children = make(map[string]*node)
+	}
+	c := n.children[path[0]]
+	if c == nil {
+		c = &node{}
+		n.children[path[0]] = c
+	}
+	c.add(path[1:])
+}
+
+// matching returns the nodes under ns that match a field name, exactly or with *.
+func matching(ns []*node, key string) []*node {
+	var m []*node
+	for _, n := range ns {
+		if c := n.children[key]; c != nil {
+			m = append(m, c)
+		}
+		if c := n.children["*"]; c != nil {
+			m = append(m, c)
+		}
+	}
+	return m
+}
+
+func newTree(paths []string) *node {
+	if len(paths) == 0 {
+		return nil
+	}
+	n := &node{}
+	for _, p := range paths {
+		n.add(strings.Split(p, "."))
+	}
+	return n
+}
+
+type projection struct {
+	*config.Projection
+	include *node
+	exclude *node
+}
+
+// Projector applies projections to records.
+type Projector struct {
+	projections []projection
+}
+
+// New creates a Projector from the given config. If there are no projections, nil is returned.
+func New(c []*config.Projection) *Projector {
+	if len(c) == 0 {
+		return nil
+	}
+	p := &Projector{}
+	for _, pc := range c {
+		include := newTree(pc.IncludeFields)
+		if include != nil {
+			for _, f := range config.ProjectionKeptFields {
+				include.add([]string{f})
+			}
+		}
+		p.projections = append(p.projections, projection{
+			Projection: pc,
+			include:    include,
+			exclude:    newTree(pc.ExcludeFields),
+		})
+	}
+	return p
+}
+
+// Project returns the record with the first projection for its schema applied. schema is the
+// schema of the record. The record is returned as-is if no projection matches it or the
+// projection doesn't change it.
+func (p *Projector) Project(record []byte, schema string) ([]byte, error) {
+	var pr *projection
+	for i := range p.projections {
+		if p.projections[i].Match(schema) {
+			pr = &p.projections[i]
+			break
+		}
+	}
+	if pr == nil {
+		return record, nil
+	}
+
+	parser := parserPool.Get()
+	defer parserPool.Put(parser)
+	v, err := parser.ParseBytes(record)
+	if err != nil {
+		return nil, err
+	}
+	changed := false
+	if pr.include != nil {
+		changed = include(v, []*node{pr.include})
+	}
+	if pr.exclude != nil {
+		changed = exclude(v, []*node{pr.exclude}) || changed
+	}
+	if !changed {
+		return record, nil
+	}
+	return v.MarshalTo(nil), nil
+}
+
+// include removes the fields of v that are not matched by ns, searching arrays element by
+// element. Objects that are left empty are removed too. It returns whether anything was
+// removed.
+func include(v *fastjson.Value, ns []*node) bool {
+	changed := false
+	switch v.Type() {
+	case fastjson.TypeArray:
+		for _, e := range v.GetArray() {
+			changed = include(e, ns) || changed
+		}
+		return changed
+	case fastjson.TypeObject:
+	default:
+		return false
+	}
+
+	o := v.GetObject()
+	var remove []string
+	o.Visit(func(key []byte, child *fastjson.Value) {
+		m := matching(ns, string(key))
+		for _, n := range m {
+			if n.leaf {
+				return
+			}
+		}
+		if len(m) == 0 || child.Type() != fastjson.TypeObject && child.Type() != fastjson.TypeArray {
+			remove = append(remove, string(key))
+			return
+		}
+		if include(child, m) {
+			changed = true
+			if child.Type() == fastjson.TypeObject && child.GetObject().Len() == 0 {
+				remove = append(remove, string(key))
+			}
+		}
+	})
+	for _, key := range remove {
+		o.Del(key)
+	}
+	return changed || len(remove) > 0
+}
+
+// exclude removes the fields of v that are matched by ns, searching arrays element by element.
+// It returns whether anything was removed.
+func exclude(v *fastjson.Value, ns []*node) bool {
+	changed := false
+	switch v.Type() {
+	case fastjson.TypeArray:
+		for _, e := range v.GetArray() {
+			changed = exclude(e, ns) || changed
+		}
+		return changed
+	case fastjson.TypeObject:
+	default:
+		return false
+	}
+
+	o := v.GetObject()
+	var remove []string
+	o.Visit(func(key []byte, child *fastjson.Value) {
+		m := matching(ns, string(key))
+		for _, n := range m {
+			if n.leaf {
+				remove = append(remove, string(key))
+				return
+			}
+		}
+		if len(m) > 0 {
+			changed = exclude(child, m) || changed
+		}
+	})
+	for _, key := range remove {
+		o.Del(key)
+	}
+	return changed || len(remove) > 0
+}
@@ -0,0 +1,77 @@
+package projection
+
+import (
+	"testing"
+
+	"spyderbat-event-forwarder/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const audit = `{"schema":"event_k8saudit:1.0.0","id":"audit:1","muid":"mach:1","time":1700000000.5,"verb":"get","stage":"ResponseComplete",` +
+	`"request":{"uri":"/api/v1/pods","principal":{"user":"alice","groups":["admins"]},"headers":{"accept":"json"}},` +
+	`"objects":[{"kind":"Pod","name":"web","labels":{"app":"web"}},{"kind":"Pod","name":"db"}],` +
+	`"runtime_details":{"hostname":"web-1","ip_addresses":["10.1.2.3"]}}`
+
+func TestProject(t *testing.T) {
+	tests := []struct {
+		name       string
+		projection config.Projection
+		want       string
+	}{
+		{"include", config.Projection{IncludeFields: []string{"id", "verb"}},
+			`{"schema":"event_k8saudit:1.0.0","id":"audit:1","muid":"mach:1","time":1700000000.5,"verb":"get","runtime_details":{"hostname":"web-1","ip_addresses":["10.1.2.3"]}}`},
+		{"include nested", config.Projection{IncludeFields: []string{"id", "request.principal.*"}},
+			`{"schema":"event_k8saudit:1.0.0","id":"audit:1","muid":"mach:1","time":1700000000.5,"request":{"principal":{"user":"alice","groups":["admins"]}},"runtime_details":{"hostname":"web-1","ip_addresses":["10.1.2.3"]}}`},
+		{"include in arrays", config.Projection{IncludeFields: []string{"objects.name"}},
+			`{"schema":"event_k8saudit:1.0.0","id":"audit:1","muid":"mach:1","time":1700000000.5,"objects":[{"name":"web"},{"name":"db"}],"runtime_details":{"hostname":"web-1","ip_addresses":["10.1.2.3"]}}`},
+		{"include missing nested", config.Projection{IncludeFields: []string{"id", "request.body.text"}},
+			`{"schema":"event_k8saudit:1.0.0","id":"audit:1","muid":"mach:1","time":1700000000.5,"runtime_details":{"hostname":"web-1","ip_addresses":["10.1.2.3"]}}`},
+		{"exclude", config.Projection{ExcludeFields: []string{"stage", "request.headers", "objects.labels", "runtime_details.ip_addresses"}},
+			`{"schema":"event_k8saudit:1.0.0","id":"audit:1","muid":"mach:1","time":1700000000.5,"verb":"get",` +
+				`"request":{"uri":"/api/v1/pods","principal":{"user":"alice","groups":["admins"]}},` +
+				`"objects":[{"kind":"Pod","name":"web"},{"kind":"Pod","name":"db"}],"runtime_details":{"hostname":"web-1"}}`},
+		{"exclude wildcard", config.Projection{ExcludeFields: []string{"request.*.user"}},
+			`{"schema":"event_k8saudit:1.0.0","id":"audit:1","muid":"mach:1","time":1700000000.5,"verb":"get","stage":"ResponseComplete",` +
+				`"request":{"uri":"/api/v1/pods","principal":{"groups":["admins"]},"headers":{"accept":"json"}},` +
+				`"objects":[{"kind":"Pod","name":"web","labels":{"app":"web"}},{"kind":"Pod","name":"db"}],` +
+				`"runtime_details":{"hostname":"web-1","ip_addresses":["10.1.2.3"]}}`},
+		{"include and exclude", config.Projection{IncludeFields: []string{"request"}, ExcludeFields: []string{"request.headers"}},
+			`{"schema":"event_k8saudit:1.0.0","id":"audit:1","muid":"mach:1","time":1700000000.5,"request":{"uri":"/api/v1/pods","principal":{"user":"alice","groups":["admins"]}},"runtime_details":{"hostname":"web-1","ip_addresses":["10.1.2.3"]}}`},
+		{"other schema", config.Projection{Schemas: []string{"model_process"}, IncludeFields: []string{"id"}},
+			audit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.NoError(t, config.ValidateProjection([]*config.Projection{&tt.projection}))
+			got, err := New([]*config.Projection{&tt.projection}).Project([]byte(audit), "event_k8saudit:1.0.0")
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestProjectFirstMatch(t *testing.T) {
+	p := New([]*config.Projection{
+		{Schemas: []string{"event_k8saudit"}, IncludeFields: []string{"verb"}},
+		{ExcludeFields: []string{"verb"}},
+	})
+	got, err := p.Project([]byte(audit), "event_k8saudit:1.0.0")
+	require.NoError(t, err)
+	assert.Contains(t, string(got), `"verb":"get"`)
+	assert.NotContains(t, string(got), `"stage"`)
+
+	process := []byte(`{"schema":"model_process::1.2.0","id":"proc:1","verb":"x"}`)
+	got, err = p.Project(process, "model_process::1.2.0")
+	require.NoError(t, err)
+	assert.Equal(t, `{"schema":"model_process::1.2.0","id":"proc:1"}`, string(got))
+
+	unchanged := []byte(`{"schema":"model_process::1.2.0", "id":"proc:1"}`)
+	got, err = p.Project(unchanged, "model_process::1.2.0")
+	require.NoError(t, err)
+	assert.Equal(t, string(unchanged), string(got))
+
+	_, err = p.Project([]byte(`{"schema":`), "model_process::1.2.0")
+	require.Error(t, err)
+}
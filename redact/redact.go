@@ -0,0 +1,153 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+// redact removes or pseudonymizes fields of records before they are sent to an output.
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"spyderbat-event-forwarder/config"
+
+	"github.com/valyala/fastjson"
+)
+
+// pseudonymBytes is the length of an HMAC pseudonym, before hex encoding.
+const pseudonymBytes = 16
+
+var (
+	parserPool = fastjson.ParserPool{}
+	arenaPool  = fastjson.ArenaPool{}
+)
+
+type rule struct {
+	*config.RedactionRule
+	path []string
+}
+
+// Redactor applies a set of redaction rules to records.
+type Redactor struct {
+	rules []rule
+	key   []byte
+}
+
+// New creates a Redactor from the given config. If the config is nil, nil is returned.
+func New(c *config.Redaction) *Redactor {
+	if c == nil {
+		return nil
+	}
+	r := &Redactor{key: c.HMACKey()}
+	for _, rc := range c.Rules {
+		r.rules = append(r.rules, rule{RedactionRule: rc, path: strings.Split(rc.Path, ".")})
+	}
+	return r
+}
+
+// Redact returns the record with the rules for its schema applied. schema is the schema of the
+// record. The record is returned as-is if no rule changes it.
+func (r *Redactor) Redact(record []byte, schema string) ([]byte, error) {
+	p := parserPool.Get()
+	defer parserPool.Put(p)
+	v, err := p.ParseBytes(record)
+	if err != nil {
+		return nil, err
+	}
+	a := arenaPool.Get()
+	defer arenaPool.Put(a)
+
+	changed := false
+	for _, rl := range r.rules {
+		if rl.Match(schema) {
+			changed = r.walk(a, v, rl.path, &rl) || changed
+		}
+	}
+	if !changed {
+		return record, nil
+	}
+	return v.MarshalTo(nil), nil
+}
+
+// walk finds the fields at path under v, searching arrays element by element, and redacts
+// them. It returns whether anything was changed.
+func (r *Redactor) walk(a *fastjson.Arena, v *fastjson.Value, path []string, rl *rule) bool {
+	changed := false
+	switch v.Type() {
+	case fastjson.TypeArray:
+		for _, e := range v.GetArray() {
+			changed = r.walk(a, e, path, rl) || changed
+		}
+		return changed
+	case fastjson.TypeObject:
+	default:
+		return false
+	}
+
+	o := v.GetObject()
+	var keys []string
+	if path[0] == "*" {
+		o.Visit(func(key []byte, _ *fastjson.Value) {
+			keys = append(keys, string(key))
+		})
+	} else if o.Get(path[0]) != nil {
+		keys = []string{path[0]}
+	}
+
+	for _, key := range keys {
+		child := o.Get(key)
+		switch {
+		case len(path) > 1:
+			changed = r.walk(a, child, path[1:], rl) || changed
+		case rl.Action == "drop":
+			o.Del(key)
+			changed = true
+		default:
+			o.Set(key, r.replace(a, child, rl))
+			changed = true
+		}
+	}
+	return changed
+}
+
+// replace returns the redacted value. The elements of arrays are redacted one by one, so that
+// the field is still an array, and nulls are left as they are.
+func (r *Redactor) replace(a *fastjson.Arena, v *fastjson.Value, rl *rule) *fastjson.Value {
+	switch v.Type() {
+	case fastjson.TypeNull:
+		return v
+	case fastjson.TypeArray:
+		for i, e := range v.GetArray() {
+			v.SetArrayItem(i, r.replace(a, e, rl))
+		}
+		return v
+	}
+
+	switch rl.Action {
+	case "mask":
+		return a.NewString(rl.Mask)
+	case "regex":
+		if v.Type() != fastjson.TypeString {
+			return v
+		}
+		return a.NewString(rl.Regex().ReplaceAllString(string(v.GetStringBytes()), rl.Replace))
+	case "hmac":
+		// strings are hashed as they are, and other values as JSON
+		text := v.GetStringBytes()
+		if v.Type() != fastjson.TypeString {
+			text = v.MarshalTo(nil)
+		}
+		return a.NewString(r.pseudonym(text))
+	}
+	return v
+}
+
+// pseudonym returns a keyed hash of b, so that the same value always has the same pseudonym
+// but the value cannot be recovered without the key.
+func (r *Redactor) pseudonym(b []byte) string {
+	h := hmac.New(sha256.New, r.key)
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil)[:pseudonymBytes])
+}
@@ -0,0 +1,81 @@
+package redact
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"spyderbat-event-forwarder/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/valyala/fastjson"
+)
+
+const process = `{"schema":"model_process::1.2.0","id":"proc:1","args":["/bin/bash","-c","id"],"euser":"alice","auser":"alice",` +
+	`"runtime_details":{"hostname":"web-1","ip_addresses":["10.1.2.3","192.168.7.8"]},"pid":42,"env":null}`
+
+func newRedactor(t *testing.T, rules ...*config.RedactionRule) *Redactor {
+	t.Helper()
+	keyFile := filepath.Join(t.TempDir(), "hmac.key")
+	require.NoError(t, os.WriteFile(keyFile, []byte("0123456789abcdef0123456789abcdef"), 0o600))
+	c := &config.Redaction{Outputs: []string{"webhook"}, Rules: rules, HMACKeyFile: keyFile}
+	require.NoError(t, config.ValidateRedaction([]*config.Redaction{c}))
+	return New(c)
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []*config.RedactionRule
+		want  string
+	}{
+		{"drop", []*config.RedactionRule{{Path: "args", Action: "drop"}},
+			`{"schema":"model_process::1.2.0","id":"proc:1","euser":"alice","auser":"alice","runtime_details":{"hostname":"web-1","ip_addresses":["10.1.2.3","192.168.7.8"]},"pid":42,"env":null}`},
+		{"mask array", []*config.RedactionRule{{Path: "args", Action: "mask"}},
+			`{"schema":"model_process::1.2.0","id":"proc:1","args":["REDACTED","REDACTED","REDACTED"],"euser":"alice","auser":"alice","runtime_details":{"hostname":"web-1","ip_addresses":["10.1.2.3","192.168.7.8"]},"pid":42,"env":null}`},
+		{"mask number and null", []*config.RedactionRule{{Path: "pid", Action: "mask", Mask: "x"}, {Path: "env", Action: "mask"}},
+			`{"schema":"model_process::1.2.0","id":"proc:1","args":["/bin/bash","-c","id"],"euser":"alice","auser":"alice","runtime_details":{"hostname":"web-1","ip_addresses":["10.1.2.3","192.168.7.8"]},"pid":"x","env":null}`},
+		{"regex nested", []*config.RedactionRule{{Path: "runtime_details.ip_addresses", Action: "regex", Pattern: `^(\d+\.\d+)\.\d+\.\d+$`, Replace: "$1.0.0"}},
+			`{"schema":"model_process::1.2.0","id":"proc:1","args":["/bin/bash","-c","id"],"euser":"alice","auser":"alice","runtime_details":{"hostname":"web-1","ip_addresses":["10.1.0.0","192.168.0.0"]},"pid":42,"env":null}`},
+		{"wildcard", []*config.RedactionRule{{Path: "runtime_details.*", Action: "drop"}},
+			`{"schema":"model_process::1.2.0","id":"proc:1","args":["/bin/bash","-c","id"],"euser":"alice","auser":"alice","runtime_details":{},"pid":42,"env":null}`},
+		{"other schema", []*config.RedactionRule{{Path: "args", Action: "drop", Schemas: []string{"model_connection"}}},
+			process},
+		{"missing path", []*config.RedactionRule{{Path: "cmdline.text", Action: "drop"}},
+			process},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRedactor(t, tt.rules...)
+			got, err := r.Redact([]byte(process), "model_process::1.2.0")
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestRedactHMAC(t *testing.T) {
+	r := newRedactor(t, &config.RedactionRule{Path: "euser", Action: "hmac"}, &config.RedactionRule{Path: "auser", Action: "hmac"})
+	got, err := r.Redact([]byte(process), "model_process::1.2.0")
+	require.NoError(t, err)
+
+	v, err := fastjson.ParseBytes(got)
+	require.NoError(t, err)
+	euser, auser := string(v.GetStringBytes("euser")), string(v.GetStringBytes("auser"))
+	assert.Len(t, euser, 32)
+	assert.NotContains(t, string(got), "alice")
+	// the same value has the same pseudonym
+	assert.Equal(t, euser, auser)
+	assert.Equal(t, r.pseudonym([]byte("alice")), euser)
+
+	// a different key gives a different pseudonym
+	other := &Redactor{key: []byte("another key of 16 bytes")}
+	assert.NotEqual(t, other.pseudonym([]byte("alice")), euser)
+}
+
+func TestRedactInvalid(t *testing.T) {
+	r := newRedactor(t, &config.RedactionRule{Path: "args", Action: "drop"})
+	_, err := r.Redact([]byte(`{"args":`), "")
+	require.Error(t, err)
+}
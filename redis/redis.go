@@ -0,0 +1,234 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+// redis adds records to Redis Streams with XADD.
+package redis
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"spyderbat-event-forwarder/config"
+	"spyderbat-event-forwarder/logwrapper"
+	"spyderbat-event-forwarder/sink"
+
+	"github.com/valyala/fastjson"
+)
+
+const (
+	pipelineBytes   = 1024 * 1024 // commands written before waiting for their replies
+	pipelineRecords = 1000
+)
+
+var (
+	dialTimeout    = 30 * time.Second
+	replyTimeout   = 60 * time.Second
+	retryBaseDelay = 1 * time.Second // doubled after each failed attempt
+	maxRetries     = 5
+)
+
+var parserPool = fastjson.ParserPool{}
+
+// Redis is a sink that adds each record to a stream, pipelining the XADD commands for a batch
+// of records. If the connection fails, the batch is sent again on a new connection, so records
+// are added at least once.
+type Redis struct {
+	c       *config.Redis
+	batcher *sink.Batcher
+
+	// only accessed by the batcher's sender goroutine
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// New creates a new Redis sink from the given config. If the config is nil, nil is returned.
+// A nil Redis will silently drop all records.
+func New(c *config.Redis) *Redis {
+	if c == nil {
+		return nil
+	}
+	r := &Redis{c: c}
+	r.batcher = sink.NewBatcher(sink.BatchOptions{
+		MaxBytes:   pipelineBytes,
+		MaxRecords: pipelineRecords,
+	}, r.sendBatch)
+	return r
+}
+
+// Send queues a record for adding to the stream for its schema and muid. The entry has the
+// fields schema, muid, id and record. Calling Send after Shutdown will panic.
+func (r *Redis) Send(record []byte) {
+	r.SendOriginal(record, record)
+}
+
+// SendOriginal queues a record for adding to the stream for the schema and muid of original,
+// the record before it was transformed, which the schema, muid and id fields of the entry are
+// also taken from. cef and leef formats render original. Calling SendOriginal after Shutdown
+// will panic.
+func (r *Redis) SendOriginal(record, original []byte) {
+	if r == nil || len(record) == 0 {
+		return
+	}
+
+	p := parserPool.Get()
+	v, err := p.ParseBytes(original)
+	if err != nil || v.Type() != fastjson.TypeObject {
+		parserPool.Put(p)
+		logwrapper.Logger().Warn().Err(err).Msg("dropping invalid record for redis")
+		return
+	}
+	family := string(v.GetStringBytes("schema"))
+	if i := strings.IndexByte(family, ':'); i >= 0 {
+		family = family[:i]
+	}
+	muid := string(v.GetStringBytes("muid"))
+	id := string(v.GetStringBytes("id"))
+	parserPool.Put(p)
+
+	if f := r.c.Format.Formatter(); f != nil {
+		formatted, err := f.Format(original)
+		if err != nil {
+			logwrapper.Logger().Warn().Err(err).Msg("unable to format event for redis; sending it unformatted")
+		} else {
+			record = formatted
+		}
+	}
+
+	args := []string{"XADD", r.c.KeyFor(family, muid)}
+	if *r.c.MaxLen > 0 {
+		args = append(args, "MAXLEN", "~", strconv.Itoa(*r.c.MaxLen))
+	}
+	args = append(args, "*", "schema", family)
+	if muid != "" {
+		args = append(args, "muid", muid)
+	}
+	if id != "" {
+		args = append(args, "id", id)
+	}
+	args = append(args, "record", string(record))
+	r.batcher.Add(appendCommand(nil, args...))
+}
+
+// Shutdown flushes the queue and shuts down the sink. It will block until the queue is empty.
+func (r *Redis) Shutdown() {
+	log.Printf("shutting down redis")
+	if r == nil {
+		return
+	}
+	r.batcher.Shutdown()
+	r.disconnect()
+}
+
+// sendBatch pipelines the XADD commands for a batch of records.
+func (r *Redis) sendBatch(b *sink.Batch) {
+	for attempt := 0; ; attempt++ {
+		rejected, err := r.pipeline(b.Records)
+		if err == nil {
+			logwrapper.Logger().Info().
+				Int("events", len(b.Records)-len(rejected)).
+				Int("bytes", b.Bytes).
+				Msg("sent to redis")
+			// rejected commands, e.g. for a key holding another type, will not succeed on retry
+			for _, e := range rejected {
+				logwrapper.Logger().Error().Str("error", e).Msg("Failed to add record to redis stream")
+			}
+			return
+		}
+		r.disconnect()
+		if attempt >= maxRetries {
+			logwrapper.Logger().Error().Err(err).Int("events", len(b.Records)).Msg("Failed to send records to redis")
+			return
+		}
+		logwrapper.Logger().Warn().Err(err).Msg("retrying records for redis")
+		time.Sleep(retryBaseDelay << attempt)
+	}
+}
+
+// pipeline writes commands and reads their replies. It returns the error replies, or an error
+// if the connection failed.
+func (r *Redis) pipeline(commands [][]byte) ([]string, error) {
+	if r.conn == nil {
+		if err := r.connect(); err != nil {
+			return nil, err
+		}
+	}
+	_ = r.conn.SetDeadline(time.Now().Add(replyTimeout))
+
+	size := 0
+	for _, cmd := range commands {
+		size += len(cmd)
+	}
+	buf := make([]byte, 0, size)
+	for _, cmd := range commands {
+		buf = append(buf, cmd...)
+	}
+	if _, err := r.conn.Write(buf); err != nil {
+		return nil, err
+	}
+
+	var rejected []string
+	for range commands {
+		reply, err := readReply(r.r)
+		if err != nil {
+			return nil, err
+		}
+		if e, ok := reply.(replyError); ok {
+			rejected = append(rejected, string(e))
+		}
+	}
+	return rejected, nil
+}
+
+func (r *Redis) connect() error {
+	dialer := &net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second}
+	var conn net.Conn
+	var err error
+	if r.c.TLS {
+		host, _, _ := net.SplitHostPort(r.c.Address)
+		conn, err = tls.DialWithDialer(dialer, "tcp", r.c.Address, &tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: r.c.Insecure,
+		})
+	} else {
+		conn, err = dialer.Dial("tcp", r.c.Address)
+	}
+	if err != nil {
+		return err
+	}
+	r.conn = conn
+	r.r = bufio.NewReader(conn)
+
+	var setup [][]byte
+	switch {
+	case r.c.Username != "":
+		setup = append(setup, appendCommand(nil, "AUTH", r.c.Username, r.c.Password))
+	case r.c.Password != "":
+		setup = append(setup, appendCommand(nil, "AUTH", r.c.Password))
+	}
+	if r.c.DB != 0 {
+		setup = append(setup, appendCommand(nil, "SELECT", strconv.Itoa(r.c.DB)))
+	}
+	rejected, err := r.pipeline(setup)
+	if err != nil {
+		return err
+	}
+	if len(rejected) > 0 {
+		return fmt.Errorf("redis connection setup failed: %s", rejected[0])
+	}
+	return nil
+}
+
+func (r *Redis) disconnect() {
+	if r.conn != nil {
+		_ = r.conn.Close()
+	}
+	r.conn = nil
+	r.r = nil
+}
@@ -0,0 +1,212 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"spyderbat-event-forwarder/config"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testRecords = [][]byte{
+	[]byte(`{"schema":"model_process::1.2.0","id":"proc:1","muid":"mach:abc","time":1700000001.5}`),
+	[]byte(`{"schema":"event_redflag:bash:1.0.0","id":"flag:1","muid":"mach:abc","time":1700000002}`),
+	[]byte(`{"schema":"model_process::1.2.0","id":"proc:2","muid":"mach:def","time":1700000003}`),
+}
+
+// mockRedis is a local stand-in for a Redis server that understands AUTH, SELECT and XADD.
+type mockRedis struct {
+	ln       net.Listener
+	password string
+	dropConn int // number of XADD commands to read before closing the connection unanswered
+
+	lock     sync.Mutex
+	commands [][]string
+	conns    int
+}
+
+func (m *mockRedis) start(t *testing.T) {
+	var err error
+	m.ln, err = net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = m.ln.Close() })
+	go func() {
+		for {
+			conn, err := m.ln.Accept()
+			if err != nil {
+				return
+			}
+			m.lock.Lock()
+			m.conns++
+			m.lock.Unlock()
+			go m.serve(conn)
+		}
+	}()
+}
+
+func (m *mockRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authed := m.password == ""
+	for {
+		v, err := readReply(r)
+		if err != nil {
+			return
+		}
+		var args []string
+		for _, a := range v.([]any) {
+			args = append(args, a.(string))
+		}
+
+		var reply string
+		switch args[0] {
+		case "AUTH":
+			authed = args[len(args)-1] == m.password
+			reply = "+OK\r\n"
+			if !authed {
+				reply = "-WRONGPASS invalid username-password pair\r\n"
+			}
+		case "SELECT":
+			reply = "+OK\r\n"
+		case "XADD":
+			m.lock.Lock()
+			if m.dropConn > 0 {
+				m.dropConn--
+				m.lock.Unlock()
+				return
+			}
+			switch {
+			case !authed:
+				reply = "-NOAUTH Authentication required.\r\n"
+			case args[1] == "spyderbat:wrongtype":
+				reply = "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"
+			default:
+				m.commands = append(m.commands, args)
+				reply = fmt.Sprintf("$15\r\n1700000000000-%d\r\n", len(m.commands)%10)
+			}
+			m.lock.Unlock()
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		if _, err := conn.Write([]byte(reply)); err != nil {
+			return
+		}
+	}
+}
+
+func (m *mockRedis) received() ([][]string, int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([][]string(nil), m.commands...), m.conns
+}
+
+func newRedis(t *testing.T, m *mockRedis, c *config.Redis) *Redis {
+	retryBaseDelay = time.Millisecond
+	m.start(t)
+	c.Address = m.ln.Addr().String()
+	require.NoError(t, config.ValidateRedis(c))
+	return New(c)
+}
+
+func TestRedis(t *testing.T) {
+	m := &mockRedis{password: "s3cr3t"}
+	r := newRedis(t, m, &config.Redis{Username: "default", Password: "s3cr3t", DB: 2})
+	for _, record := range testRecords {
+		r.Send(record)
+	}
+	r.Shutdown()
+
+	commands, conns := m.received()
+	assert.Equal(t, 1, conns)
+	require.Len(t, commands, 3)
+	assert.Equal(t, []string{
+		"XADD", "spyderbat:model_process", "MAXLEN", "~", "100000", "*",
+		"schema", "model_process", "muid", "mach:abc", "id", "proc:1", "record", string(testRecords[0]),
+	}, commands[0])
+	assert.Equal(t, "spyderbat:event_redflag", commands[1][1])
+	assert.Equal(t, string(testRecords[2]), commands[2][len(commands[2])-1])
+}
+
+func TestRedisTransformedRecords(t *testing.T) {
+	m := &mockRedis{}
+	r := newRedis(t, m, &config.Redis{Key: "{muid}:{schema}"})
+	// an OCSF record has no Spyderbat schema, muid or id
+	ocsf := `{"class_uid":1007,"time":1700000001500}`
+	r.SendOriginal([]byte(ocsf), testRecords[0])
+	r.Shutdown()
+
+	commands, _ := m.received()
+	require.Len(t, commands, 1)
+	assert.Equal(t, []string{
+		"XADD", "mach:abc:model_process", "MAXLEN", "~", "100000", "*",
+		"schema", "model_process", "muid", "mach:abc", "id", "proc:1", "record", ocsf,
+	}, commands[0])
+}
+
+func TestRedisKeyAndMaxLen(t *testing.T) {
+	m := &mockRedis{}
+	maxLen := 0
+	r := newRedis(t, m, &config.Redis{Key: "{muid}:{schema}", MaxLen: &maxLen})
+	r.Send(testRecords[2])
+	r.Send([]byte(`not json`))
+	r.Shutdown()
+
+	commands, _ := m.received()
+	require.Len(t, commands, 1)
+	assert.Equal(t, []string{"XADD", "mach:def:model_process", "*"}, commands[0][:3])
+}
+
+func TestRedisRetry(t *testing.T) {
+	m := &mockRedis{dropConn: 2}
+	r := newRedis(t, m, &config.Redis{})
+	for _, record := range testRecords {
+		r.Send(record)
+	}
+	r.Shutdown()
+
+	// the first two connections are closed before their replies, so the batch is sent again
+	commands, conns := m.received()
+	assert.Equal(t, 3, conns)
+	require.Len(t, commands, 3)
+	for i, cmd := range commands {
+		assert.Equal(t, string(testRecords[i]), cmd[len(cmd)-1])
+	}
+}
+
+func TestRedisRejected(t *testing.T) {
+	m := &mockRedis{}
+	r := newRedis(t, m, &config.Redis{Key: "spyderbat:{schema}"})
+	r.c.Key = "spyderbat:wrongtype"
+	r.Send(testRecords[0])
+	r.Shutdown()
+
+	// error replies are not retried
+	commands, conns := m.received()
+	assert.Empty(t, commands)
+	assert.Equal(t, 1, conns)
+}
+
+func TestRedisAuthFailed(t *testing.T) {
+	maxRetries = 1
+	defer func() { maxRetries = 5 }()
+	m := &mockRedis{password: "s3cr3t"}
+	r := newRedis(t, m, &config.Redis{Password: "wrong"})
+	r.Send(testRecords[0])
+	r.Shutdown()
+
+	commands, conns := m.received()
+	assert.Empty(t, commands)
+	assert.Equal(t, 2, conns)
+}
+
+func TestRedisNil(t *testing.T) {
+	var r *Redis
+	assert.Nil(t, New(nil))
+	r.Send(testRecords[0])
+	r.Shutdown()
+}
@@ -0,0 +1,248 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+// reshape converts timestamps, coerces types, renames fields and flattens nested objects of
+// records, for outputs whose destinations cannot take them as they are.
+package reshape
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"spyderbat-event-forwarder/config"
+
+	"github.com/valyala/fastjson"
+)
+
+var (
+	parserPool = fastjson.ParserPool{}
+	arenaPool  = fastjson.ArenaPool{}
+)
+
+type rename struct {
+	from []string
+	to   []string
+}
+
+type coercion struct {
+	path []string
+	typ  string
+}
+
+// Reshaper applies a field transform to records.
+type Reshaper struct {
+	timestamps [][]string
+	coerce     []coercion
+	rename     []rename
+	flatten    string
+}
+
+// New creates a Reshaper from the given config. If the config is nil, nil is returned.
+func New(c *config.FieldTransform) *Reshaper {
+	if c == nil {
+		return nil
+	}
+	r := &Reshaper{flatten: c.Flatten}
+	for _, path := range c.Timestamps {
+		r.timestamps = append(r.timestamps, strings.Split(path, "."))
+	}
+	// maps are unordered, so sort the paths to always change records the same way
+	for _, path := range sortedKeys(c.Coerce) {
+		r.coerce = append(r.coerce, coercion{path: strings.Split(path, "."), typ: c.Coerce[path]})
+	}
+	for _, from := range sortedKeys(c.Rename) {
+		r.rename = append(r.rename, rename{from: strings.Split(from, "."), to: strings.Split(c.Rename[from], ".")})
+	}
+	return r
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Reshape returns the reshaped record.
+func (r *Reshaper) Reshape(record []byte) ([]byte, error) {
+	p := parserPool.Get()
+	defer parserPool.Put(p)
+	v, err := p.ParseBytes(record)
+	if err != nil {
+		return nil, err
+	}
+	a := arenaPool.Get()
+	defer arenaPool.Put(a)
+
+	for _, path := range r.timestamps {
+		visit(v, path, func(o *fastjson.Object, key string, child *fastjson.Value) {
+			if child.Type() == fastjson.TypeNumber {
+				o.Set(key, a.NewString(rfc3339(child.GetFloat64())))
+			}
+		})
+	}
+	for _, c := range r.coerce {
+		visit(v, c.path, func(o *fastjson.Object, key string, child *fastjson.Value) {
+			if cv := coerce(a, child, c.typ); cv != nil {
+				o.Set(key, cv)
+			}
+		})
+	}
+	for _, rn := range r.rename {
+		move(a, v, rn.from, rn.to)
+	}
+	if r.flatten != "" && v.Type() == fastjson.TypeObject {
+		flat := a.NewObject()
+		flatten(flat, "", v, r.flatten)
+		v = flat
+	}
+	return v.MarshalTo(nil), nil
+}
+
+// rfc3339 converts a Spyderbat time (fractional unix seconds) to an RFC 3339 timestamp.
+func rfc3339(t float64) string {
+	sec, frac := math.Modf(t)
+	return time.Unix(int64(sec), int64(math.Round(frac*1e6))*1e3).UTC().Format(time.RFC3339Nano)
+}
+
+// visit calls fn for the fields at path under v, searching arrays element by element. * in
+// the path matches every field.
+func visit(v *fastjson.Value, path []string, fn func(o *fastjson.Object, key string, child *fastjson.Value)) {
+	switch v.Type() {
+	case fastjson.TypeArray:
+		for _, e := range v.GetArray() {
+			visit(e, path, fn)
+		}
+		return
+	case fastjson.TypeObject:
+	default:
+		return
+	}
+
+	o := v.GetObject()
+	var keys []string
+	if path[0] == "*" {
+		o.Visit(func(key []byte, _ *fastjson.Value) {
+			keys = append(keys, string(key))
+		})
+	} else if o.Get(path[0]) != nil {
+		keys = []string{path[0]}
+	}
+	for _, key := range keys {
+		if len(path) > 1 {
+			visit(o.Get(key), path[1:], fn)
+		} else {
+			fn(o, key, o.Get(key))
+		}
+	}
+}
+
+// coerce converts v to the given type, or returns nil if it cannot be converted. The elements
+// of arrays are converted one by one, objects are only converted to strings, and nulls are
+// left as they are.
+func coerce(a *fastjson.Arena, v *fastjson.Value, typ string) *fastjson.Value {
+	var text string
+	switch v.Type() {
+	case fastjson.TypeArray:
+		for i, e := range v.GetArray() {
+			if ce := coerce(a, e, typ); ce != nil {
+				v.SetArrayItem(i, ce)
+			}
+		}
+		return v
+	case fastjson.TypeString:
+		text = string(v.GetStringBytes())
+	case fastjson.TypeNumber, fastjson.TypeTrue, fastjson.TypeFalse:
+		text = v.String()
+	case fastjson.TypeObject:
+		if typ == "string" {
+			return a.NewString(v.String())
+		}
+		return nil
+	default:
+		return nil
+	}
+
+	switch typ {
+	case "string":
+		return a.NewString(text)
+	case "number", "integer":
+		var f float64
+		switch text {
+		case "true":
+			f = 1
+		case "false":
+			f = 0
+		default:
+			var err error
+			if f, err = strconv.ParseFloat(strings.TrimSpace(text), 64); err != nil {
+				return nil
+			}
+		}
+		if typ == "integer" {
+			return a.NewNumberInt(int(f))
+		}
+		return a.NewNumberFloat64(f)
+	case "boolean":
+		if b, err := strconv.ParseBool(strings.TrimSpace(text)); err == nil {
+			if b {
+				return a.NewTrue()
+			}
+			return a.NewFalse()
+		}
+		if f, err := strconv.ParseFloat(strings.TrimSpace(text), 64); err == nil {
+			if f != 0 {
+				return a.NewTrue()
+			}
+			return a.NewFalse()
+		}
+	}
+	return nil
+}
+
+// move moves the field at from to to, creating objects along to as needed. Nothing is moved
+// if from doesn't exist, or to goes through a field that is not an object.
+func move(a *fastjson.Arena, v *fastjson.Value, from, to []string) {
+	value := v.Get(from...)
+	parent := v.Get(from[:len(from)-1]...)
+	if value == nil || parent == nil || parent.Type() != fastjson.TypeObject {
+		return
+	}
+
+	dest := v
+	for _, key := range to[:len(to)-1] {
+		next := dest.Get(key)
+		if next == nil {
+			next = a.NewObject()
+			dest.Set(key, next)
+		} else if next.Type() != fastjson.TypeObject {
+			return
+		}
+		dest = next
+	}
+	parent.Del(from[len(from)-1])
+	dest.Set(to[len(to)-1], value)
+}
+
+// flatten sets the fields of v in flat, with nested object fields named by their paths
+// joined by sep. Dots in field names are replaced by sep too, so that no key has a dot
+// if sep is _. Arrays are kept as they are.
+func flatten(flat *fastjson.Value, prefix string, v *fastjson.Value, sep string) {
+	v.GetObject().Visit(func(key []byte, child *fastjson.Value) {
+		name := strings.ReplaceAll(string(key), ".", sep)
+		if prefix != "" {
+			name = prefix + sep + name
+		}
+		if child.Type() == fastjson.TypeObject && child.GetObject().Len() > 0 {
+			flatten(flat, name, child, sep)
+			return
+		}
+		flat.Set(name, child)
+	})
+}
@@ -0,0 +1,71 @@
+package reshape
+
+import (
+	"testing"
+
+	"spyderbat-event-forwarder/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const process = `{"schema":"model_process::1.2.0","id":"proc:1","time":1700000000.123456,"valid_from":1700000000,` +
+	`"valid_to":null,"model_version":"1.2","pid":"42","interactive":"true","args":["-c",1],` +
+	`"runtime_details":{"hostname":"web-1","cloud":{"region":"us-east-1"},"k8s.cluster":"prod"}}`
+
+func TestReshape(t *testing.T) {
+	tests := []struct {
+		name      string
+		transform config.FieldTransform
+		want      string
+	}{
+		{"timestamps", config.FieldTransform{Timestamps: []string{"time", "valid_from", "valid_to", "model_version"}},
+			`{"schema":"model_process::1.2.0","id":"proc:1","time":"2023-11-14T22:13:20.123456Z","valid_from":"2023-11-14T22:13:20Z",` +
+				`"valid_to":null,"model_version":"1.2","pid":"42","interactive":"true","args":["-c",1],` +
+				`"runtime_details":{"hostname":"web-1","cloud":{"region":"us-east-1"},"k8s.cluster":"prod"}}`},
+		{"coerce", config.FieldTransform{Coerce: map[string]string{"pid": "integer", "interactive": "boolean", "args": "string", "runtime_details.cloud": "string", "id": "number"}},
+			`{"schema":"model_process::1.2.0","id":"proc:1","time":1700000000.123456,"valid_from":1700000000,` +
+				`"valid_to":null,"model_version":"1.2","pid":42,"interactive":true,"args":["-c","1"],` +
+				`"runtime_details":{"hostname":"web-1","cloud":"{\"region\":\"us-east-1\"}","k8s.cluster":"prod"}}`},
+		{"rename", config.FieldTransform{Rename: map[string]string{"runtime_details.hostname": "host.name", "pid": "process_id", "missing": "x"}},
+			`{"schema":"model_process::1.2.0","id":"proc:1","time":1700000000.123456,"valid_from":1700000000,` +
+				`"valid_to":null,"model_version":"1.2","process_id":"42","interactive":"true","args":["-c",1],` +
+				`"runtime_details":{"cloud":{"region":"us-east-1"},"k8s.cluster":"prod"},"host":{"name":"web-1"}}`},
+		{"flatten underscore", config.FieldTransform{Flatten: "_"},
+			`{"schema":"model_process::1.2.0","id":"proc:1","time":1700000000.123456,"valid_from":1700000000,` +
+				`"valid_to":null,"model_version":"1.2","pid":"42","interactive":"true","args":["-c",1],` +
+				`"runtime_details_hostname":"web-1","runtime_details_cloud_region":"us-east-1","runtime_details_k8s_cluster":"prod"}`},
+		{"flatten dot", config.FieldTransform{Flatten: "."},
+			`{"schema":"model_process::1.2.0","id":"proc:1","time":1700000000.123456,"valid_from":1700000000,` +
+				`"valid_to":null,"model_version":"1.2","pid":"42","interactive":"true","args":["-c",1],` +
+				`"runtime_details.hostname":"web-1","runtime_details.cloud.region":"us-east-1","runtime_details.k8s.cluster":"prod"}`},
+		{"all", config.FieldTransform{
+			Timestamps: []string{"time"},
+			Coerce:     map[string]string{"pid": "integer"},
+			Rename:     map[string]string{"runtime_details.hostname": "host"},
+			Flatten:    "_",
+		},
+			`{"schema":"model_process::1.2.0","id":"proc:1","time":"2023-11-14T22:13:20.123456Z","valid_from":1700000000,` +
+				`"valid_to":null,"model_version":"1.2","pid":42,"interactive":"true","args":["-c",1],` +
+				`"runtime_details_cloud_region":"us-east-1","runtime_details_k8s_cluster":"prod","host":"web-1"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.transform.Outputs = []string{"webhook"}
+			require.NoError(t, config.ValidateFieldTransforms([]*config.FieldTransform{&tt.transform}))
+			got, err := New(&tt.transform).Reshape([]byte(process))
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+}
+
+func TestReshapeInvalid(t *testing.T) {
+	r := New(&config.FieldTransform{Coerce: map[string]string{"pid": "integer", "name": "boolean"}})
+	got, err := r.Reshape([]byte(`{"pid":"not a number","name":"alice"}`))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"pid":"not a number","name":"alice"}`, string(got))
+
+	_, err = r.Reshape([]byte(`{"pid":`))
+	require.Error(t, err)
+}
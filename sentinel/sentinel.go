@@ -0,0 +1,248 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+// sentinel sends records to Microsoft Sentinel through the Azure Monitor Logs Ingestion API.
+package sentinel
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"spyderbat-event-forwarder/config"
+	"spyderbat-event-forwarder/logwrapper"
+	"spyderbat-event-forwarder/sink"
+
+	retryablehttp "github.com/hashicorp/go-retryablehttp"
+	jsoniter "github.com/json-iterator/go"
+	"github.com/valyala/fastjson"
+)
+
+var (
+	json       = jsoniter.ConfigCompatibleWithStandardLibrary
+	parserPool = fastjson.ParserPool{}
+)
+
+type httpclient interface {
+	Do(req *retryablehttp.Request) (*http.Response, error)
+}
+
+// Sentinel is a sink that posts records to DCR streams, batching each stream separately.
+// Throttling responses (429) are retried after the delay the service asks for.
+type Sentinel struct {
+	c        *config.Sentinel
+	client   httpclient
+	tokens   *sink.TokenSource
+	batchers map[string]*sink.Batcher // DCR stream -> batcher; fixed after New
+
+	unmappedLock sync.Mutex
+	unmapped     map[string]bool // schema families without a stream that have already been reported
+}
+
+// New creates a new Sentinel sink from the given config. If the config is nil, nil is returned.
+// A nil Sentinel will silently drop all records.
+func New(c *config.Sentinel) *Sentinel {
+	if c == nil {
+		return nil
+	}
+
+	client := sink.NewHTTPClient(c.Insecure)
+	s := &Sentinel{
+		c:      c,
+		client: client,
+		tokens: sink.NewTokenSource(func() (string, time.Duration, error) {
+			return sink.FetchOAuth2Token(client, c.TokenURL(), url.Values{
+				"grant_type":    {"client_credentials"},
+				"client_id":     {c.ClientID},
+				"client_secret": {c.ClientSecret},
+				"scope":         {c.Scope()},
+			})
+		}),
+		batchers: make(map[string]*sink.Batcher),
+		unmapped: make(map[string]bool),
+	}
+
+	streams := []string{c.DefaultStream}
+	for _, stream := range c.Streams {
+		streams = append(streams, stream)
+	}
+	for _, stream := range streams {
+		if stream == "" || s.batchers[stream] != nil {
+			continue
+		}
+		// records are sent as a JSON array: brackets around the batch and a comma between records
+		s.batchers[stream] = sink.NewBatcher(sink.BatchOptions{
+			MaxBytes:       c.MaxPayloadBytes - 2,
+			RecordOverhead: 1,
+		}, func(b *sink.Batch) { s.sendBatch(stream, b) })
+	}
+	return s
+}
+
+// Send queues a record for the DCR stream of its schema. Records whose schema has no stream
+// are dropped. Calling Send after Shutdown will panic.
+func (s *Sentinel) Send(record []byte) {
+	s.SendOriginal(record, record)
+}
+
+// SendOriginal queues a record for the DCR stream of its schema, taking the schema and time
+// from original, the record before it was transformed. Records whose schema has no stream are
+// dropped. Calling SendOriginal after Shutdown will panic.
+func (s *Sentinel) SendOriginal(record, original []byte) {
+	if s == nil || len(record) == 0 {
+		return
+	}
+
+	p := parserPool.Get()
+	v, err := p.ParseBytes(original)
+	if err != nil || v.Type() != fastjson.TypeObject {
+		parserPool.Put(p)
+		logwrapper.Logger().Warn().Err(err).Msg("dropping invalid record for sentinel")
+		return
+	}
+	family := string(v.GetStringBytes("schema"))
+	if i := strings.IndexByte(family, ':'); i >= 0 {
+		family = family[:i]
+	}
+	t := v.GetFloat64("time")
+	parserPool.Put(p)
+
+	stream := s.c.Stream(family)
+	if stream == "" {
+		s.reportUnmapped(family)
+		return
+	}
+	s.batchers[stream].Add(withTimeGenerated(record, t))
+}
+
+// withTimeGenerated sets the TimeGenerated column, which every Log Analytics table has, to the
+// record time (or now, if the record has none). A TimeGenerated field already in the record,
+// e.g. renamed by a field transform, is replaced.
+func withTimeGenerated(record []byte, t float64) []byte {
+	ts := time.Now()
+	if t > 0 {
+		ts = time.UnixMilli(int64(t * 1000))
+	}
+	record = bytes.TrimSpace(record)
+	if bytes.Contains(record, []byte(`"TimeGenerated"`)) {
+		p := parserPool.Get()
+		if v, err := p.ParseBytes(record); err == nil && v.Get("TimeGenerated") != nil {
+			v.Del("TimeGenerated")
+			record = v.MarshalTo(nil)
+		}
+		parserPool.Put(p)
+	}
+	out := make([]byte, 0, len(record)+48)
+	out = append(out, `{"TimeGenerated":"`...)
+	out = ts.UTC().AppendFormat(out, time.RFC3339Nano)
+	out = append(out, '"')
+	if rest := bytes.TrimSpace(record[1:]); len(rest) > 0 && rest[0] != '}' {
+		out = append(out, ',')
+	}
+	return append(out, record[1:]...)
+}
+
+func (s *Sentinel) reportUnmapped(family string) {
+	s.unmappedLock.Lock()
+	defer s.unmappedLock.Unlock()
+	if s.unmapped[family] {
+		return
+	}
+	s.unmapped[family] = true
+	logwrapper.Logger().Warn().Str("schema", family).Msg("no sentinel stream for schema; its records will not be sent")
+}
+
+// Shutdown flushes the queues and shuts down the sink. It will block until the queues are empty.
+func (s *Sentinel) Shutdown() {
+	log.Printf("shutting down sentinel")
+	if s == nil {
+		return
+	}
+	for _, b := range s.batchers {
+		b.Shutdown()
+	}
+}
+
+// sendBatch posts a batch of records to a DCR stream.
+func (s *Sentinel) sendBatch(stream string, b *sink.Batch) {
+	buf := bytes.NewBuffer(make([]byte, 0, b.Bytes+2))
+	buf.WriteByte('[')
+	for i, record := range b.Records {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(record)
+	}
+	buf.WriteByte(']')
+
+	if err := s.post(stream, buf.Bytes(), len(b.Records)); err != nil {
+		logwrapper.Logger().Error().Err(err).Str("stream", stream).Msg("Failed to send records to sentinel")
+	}
+}
+
+func (s *Sentinel) post(stream string, data []byte, count int) error {
+	body := data
+	if s.c.CompressionAlgo == "gzip" {
+		buf := &bytes.Buffer{}
+		z, err := gzip.NewWriterLevel(buf, gzip.BestSpeed)
+		if err != nil {
+			panic(err) // only panics if level is invalid
+		}
+		// a write to a bytes.Buffer never returns an error
+		_, _ = z.Write(data)
+		_ = z.Close()
+		body = buf.Bytes()
+	}
+
+	// a rejected token is replaced and the request tried once more
+	for attempt := 0; ; attempt++ {
+		token, err := s.tokens.Token()
+		if err != nil {
+			return err
+		}
+
+		req, err := retryablehttp.NewRequest(http.MethodPost, s.c.StreamURL(stream), body)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		if s.c.CompressionAlgo == "gzip" {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return err
+		}
+		respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			logwrapper.Logger().Info().
+				Str("stream", stream).
+				Int("events", count).
+				Int("bytes", len(data)).
+				Int("compressed_bytes", len(body)).
+				Int("status_code", resp.StatusCode).
+				Msg("sent to sentinel")
+			return nil
+		}
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			s.tokens.Invalidate()
+			continue
+		}
+		return fmt.Errorf("logs ingestion api returned status code %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+}
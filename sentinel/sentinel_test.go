@@ -0,0 +1,197 @@
+package sentinel
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"spyderbat-event-forwarder/config"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	traceRecord   = []byte(`{"schema":"model_spydertrace::1.0.0","id":"trace:1","time":1700000001.5,"score":80}`)
+	processRecord = []byte(`{"schema":"model_process::1.2.0","id":"proc:1","time":1700000002}`)
+	machineRecord = []byte(`{"schema":"model_machine::1.0.0","id":"mach:1","time":1700000003}`)
+)
+
+// mockAzure is a local stand-in for the Entra token endpoint and a data collection endpoint.
+type mockAzure struct {
+	t    *testing.T
+	lock sync.Mutex
+
+	tokenRequests int
+	tokens        []string // tokens to issue, in order; the last is reused
+	accepted      []string // tokens the ingestion endpoint accepts
+	statuses      []int    // ingestion responses to return before succeeding
+	posts         map[string][]map[string]any
+}
+
+func (m *mockAzure) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if r.URL.Path == "/tenant-1/oauth2/v2.0/token" {
+		require.NoError(m.t, r.ParseForm())
+		assert.Equal(m.t, "client_credentials", r.PostForm.Get("grant_type"))
+		assert.Equal(m.t, "client-1", r.PostForm.Get("client_id"))
+		assert.Equal(m.t, "secret-1", r.PostForm.Get("client_secret"))
+		assert.Equal(m.t, "https://monitor.azure.com//.default", r.PostForm.Get("scope"))
+		token := m.tokens[min(m.tokenRequests, len(m.tokens)-1)]
+		m.tokenRequests++
+		_, _ = w.Write([]byte(`{"token_type":"Bearer","expires_in":3599,"access_token":"` + token + `"}`))
+		return
+	}
+
+	const prefix = "/dataCollectionRules/dcr-1/streams/"
+	require.True(m.t, strings.HasPrefix(r.URL.Path, prefix), r.URL.Path)
+	assert.Equal(m.t, "2023-01-01", r.URL.Query().Get("api-version"))
+	assert.Equal(m.t, "application/json", r.Header.Get("Content-Type"))
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	found := false
+	for _, a := range m.accepted {
+		found = found || a == token
+	}
+	if !found {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if len(m.statuses) > 0 {
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(m.statuses[0])
+		m.statuses = m.statuses[1:]
+		return
+	}
+
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		z, err := gzip.NewReader(r.Body)
+		require.NoError(m.t, err)
+		body = z
+	}
+	data, err := io.ReadAll(body)
+	require.NoError(m.t, err)
+	var records []map[string]any
+	require.NoError(m.t, json.Unmarshal(data, &records))
+
+	stream := strings.TrimPrefix(r.URL.Path, prefix)
+	m.posts[stream] = append(m.posts[stream], records...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newMock(t *testing.T) (*mockAzure, *config.Sentinel) {
+	m := &mockAzure{
+		t:        t,
+		tokens:   []string{"token-1"},
+		accepted: []string{"token-1"},
+		posts:    make(map[string][]map[string]any),
+	}
+	ts := httptest.NewTLSServer(m)
+	t.Cleanup(ts.Close)
+
+	cfg := &config.Sentinel{
+		Endpoint:       ts.URL,
+		DCRImmutableID: "dcr-1",
+		TenantID:       "tenant-1",
+		ClientID:       "client-1",
+		ClientSecret:   "secret-1",
+		AuthorityHost:  ts.URL,
+		Streams:        map[string]string{"model_spydertrace": "Custom-SpyderbatTraces"},
+		DefaultStream:  "Custom-SpyderbatEvents",
+		Insecure:       true,
+	}
+	require.NoError(t, config.ValidateSentinel(cfg))
+	return m, cfg
+}
+
+func TestSentinelStreams(t *testing.T) {
+	m, cfg := newMock(t)
+	s := New(cfg)
+	s.Send(traceRecord)
+	s.Send(processRecord)
+	s.Send(machineRecord)
+	s.Shutdown()
+
+	assert.Equal(t, 1, m.tokenRequests, "the token is cached")
+	require.Len(t, m.posts["Custom-SpyderbatTraces"], 1)
+	require.Len(t, m.posts["Custom-SpyderbatEvents"], 2)
+
+	trace := m.posts["Custom-SpyderbatTraces"][0]
+	assert.Equal(t, "2023-11-14T22:13:21.5Z", trace["TimeGenerated"])
+	assert.Equal(t, "trace:1", trace["id"])
+	assert.Equal(t, float64(80), trace["score"])
+}
+
+func TestSentinelUnmappedSchema(t *testing.T) {
+	m, cfg := newMock(t)
+	cfg.DefaultStream = ""
+	s := New(cfg)
+	s.Send(processRecord)
+	s.Send(traceRecord)
+	s.Shutdown()
+
+	assert.Len(t, m.posts["Custom-SpyderbatTraces"], 1)
+	assert.Len(t, m.posts, 1)
+	assert.True(t, s.unmapped["model_process"])
+}
+
+func TestSentinelThrottling(t *testing.T) {
+	m, cfg := newMock(t)
+	m.statuses = []int{http.StatusTooManyRequests, http.StatusTooManyRequests}
+	s := New(cfg)
+	s.Send(traceRecord)
+	s.Shutdown()
+
+	assert.Empty(t, m.statuses)
+	assert.Len(t, m.posts["Custom-SpyderbatTraces"], 1)
+}
+
+func TestSentinelTokenRefresh(t *testing.T) {
+	m, cfg := newMock(t)
+	m.tokens = []string{"stale", "token-1"}
+	cfg.CompressionAlgo = "none"
+	s := New(cfg)
+	s.Send(traceRecord)
+	s.Shutdown()
+
+	// the rejected token is replaced
+	assert.Equal(t, 2, m.tokenRequests)
+	assert.Len(t, m.posts["Custom-SpyderbatTraces"], 1)
+}
+
+func TestWithTimeGenerated(t *testing.T) {
+	assert.Equal(t, `{"TimeGenerated":"2023-11-14T22:13:20Z","a":1}`,
+		string(withTimeGenerated([]byte(`{"a":1}`), 1700000000)))
+	assert.Equal(t, `{"TimeGenerated":"2023-11-14T22:13:20Z"}`,
+		string(withTimeGenerated([]byte(`{}`), 1700000000)))
+	assert.Equal(t, `{"TimeGenerated":"2023-11-14T22:13:20Z","a":1,"b":{"TimeGenerated":2}}`,
+		string(withTimeGenerated([]byte(`{"a":1,"TimeGenerated":"2023-11-14T22:13:20.000Z","b":{"TimeGenerated":2}}`), 1700000000)))
+	assert.Equal(t, `{"TimeGenerated":"2023-11-14T22:13:20Z"}`,
+		string(withTimeGenerated([]byte(`{"TimeGenerated":1700000000}`), 1700000000)))
+}
+
+func TestSentinelNil(t *testing.T) {
+	var s *Sentinel
+	s.Send(traceRecord)
+	s.Shutdown()
+	assert.Nil(t, New(nil))
+}
+
+func TestSentinelTransformedRecords(t *testing.T) {
+	m, cfg := newMock(t)
+	s := New(cfg)
+	// an OCSF record has no Spyderbat schema and its time is in milliseconds
+	s.SendOriginal([]byte(`{"class_uid":1007,"time":1700000001500}`), traceRecord)
+	s.Shutdown()
+
+	require.Len(t, m.posts["Custom-SpyderbatTraces"], 1)
+	trace := m.posts["Custom-SpyderbatTraces"][0]
+	assert.Equal(t, "2023-11-14T22:13:21.5Z", trace["TimeGenerated"])
+	assert.Equal(t, float64(1007), trace["class_uid"])
+}
@@ -0,0 +1,160 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package sink
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMaxBatchAge   = 30 * time.Second // how often to flush the queue
+	DefaultSweepInterval = 1 * time.Second  // how often to check if the current batch is old enough to be flushed
+)
+
+// Batch is a group of records that are delivered together.
+type Batch struct {
+	Records [][]byte
+	Bytes   int // size of the records, including the per-record overhead
+}
+
+// BatchOptions configures a Batcher.
+type BatchOptions struct {
+	MaxBytes       int           // a batch is sent before it would exceed this many bytes
+	MaxRecords     int           // a batch is sent when it holds this many records; 0 for no limit
+	RecordOverhead int           // bytes added to each record when it is sent, e.g. a delimiter
+	MaxAge         time.Duration // a batch is sent once it is this old; default DefaultMaxBatchAge
+	SweepInterval  time.Duration // how often batch age is checked; default DefaultSweepInterval
+	QueueSize      int           // number of batches that may wait to be sent; default 10
+}
+
+// Batcher collects records into batches bounded by size and age, and hands each batch to a
+// send function on its own goroutine, one batch at a time.
+type Batcher struct {
+	o      BatchOptions
+	send   func(*Batch)
+	ctx    context.Context // ctx is used to shut down the batcher
+	cancel context.CancelFunc
+	wg     sync.WaitGroup // wg is used to wait for shutdown
+
+	recordQueue chan []byte // records are queued here before being added to the batch
+	batchQueue  chan *Batch // batches are queued here before being sent
+
+	// the following fields are only accessed by the ingest goroutine
+	created time.Time // created is the time the current batch was created
+	batch   *Batch    // batch is the current batch
+}
+
+// NewBatcher starts a Batcher that calls send for each batch.
+func NewBatcher(o BatchOptions, send func(*Batch)) *Batcher {
+	if o.MaxAge == 0 {
+		o.MaxAge = DefaultMaxBatchAge
+	}
+	if o.SweepInterval == 0 {
+		o.SweepInterval = DefaultSweepInterval
+	}
+	if o.QueueSize == 0 {
+		o.QueueSize = 10
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &Batcher{
+		o:           o,
+		send:        send,
+		ctx:         ctx,
+		cancel:      cancel,
+		recordQueue: make(chan []byte, 10000),
+		batchQueue:  make(chan *Batch, o.QueueSize),
+	}
+	b.resetBatch()
+	b.wg.Add(2)
+	go b.ingest()
+	go b.sender()
+	return b
+}
+
+// Add queues a record for batching. Calling Add after Shutdown will panic.
+func (b *Batcher) Add(record []byte) {
+	b.recordQueue <- record
+}
+
+// Shutdown sends any queued records and waits for all batches to be sent.
+func (b *Batcher) Shutdown() {
+	b.cancel()
+	b.wg.Wait()
+}
+
+func (b *Batcher) queueBatch() {
+	defer b.resetBatch()
+	if len(b.batch.Records) == 0 {
+		return
+	}
+	b.batchQueue <- b.batch
+}
+
+func (b *Batcher) resetBatch() {
+	b.batch = &Batch{}
+	b.created = time.Now()
+}
+
+// add adds a record to the current batch, queueing the batch for sending first if the record
+// would not fit.
+func (b *Batcher) add(record []byte) {
+	size := len(record) + b.o.RecordOverhead
+	if b.batch.Bytes+size > b.o.MaxBytes {
+		b.queueBatch()
+	}
+	b.batch.Records = append(b.batch.Records, record)
+	b.batch.Bytes += size
+	if b.o.MaxRecords > 0 && len(b.batch.Records) >= b.o.MaxRecords {
+		b.queueBatch()
+	}
+}
+
+// sender is the main loop for sending batches.
+// It will exit when the batchQueue is closed.
+func (b *Batcher) sender() {
+	defer b.wg.Done()
+
+	for batch := range b.batchQueue {
+		b.send(batch)
+	}
+}
+
+// ingest is the main loop for building batches.
+func (b *Batcher) ingest() {
+	ticker := time.NewTicker(b.o.SweepInterval)
+
+	defer func() {
+		ticker.Stop()
+		b.wg.Done()
+	}()
+
+	for {
+		select {
+		case <-ticker.C:
+			// if the current batch is older than MaxAge, queue it for sending
+			if time.Since(b.created) > b.o.MaxAge {
+				b.queueBatch()
+			}
+		case record := <-b.recordQueue:
+			b.add(record)
+		case <-b.ctx.Done():
+			// We must drain the record queue before shutting down, or we have a race condition.
+			// By closing the record queue here, we ensure that the following range loop will
+			// not block forever.
+			close(b.recordQueue)
+
+			for record := range b.recordQueue {
+				b.add(record)
+			}
+
+			b.queueBatch()
+			close(b.batchQueue)
+			return
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+// sink contains the plumbing shared by the outputs that forward records to other services:
+// the Sink interface, batching, and the HTTP client.
+package sink
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+
+	retryablehttp "github.com/hashicorp/go-retryablehttp"
+)
+
+// Sink is a destination for records. Send queues a record for delivery and may block if the
+// sink is backed up. Shutdown flushes anything queued and blocks until it has been delivered
+// (or delivery has failed). Calling Send after Shutdown will panic.
+type Sink interface {
+	Send(record []byte)
+	Shutdown()
+}
+
+// OriginalSink is a Sink that also needs each record as it was before the transform, to
+// route, partition or index records by Spyderbat fields such as schema and time, which
+// transforms like OCSF replace.
+type OriginalSink interface {
+	Sink
+	SendOriginal(record, original []byte)
+}
+
+// Send sends a record to s, along with the record before the transform if s needs it.
+func Send(s Sink, record, original []byte) {
+	if o, ok := s.(OriginalSink); ok {
+		o.SendOriginal(record, original)
+		return
+	}
+	s.Send(record)
+}
+
+// NewHTTPClient returns a retrying HTTP client with the settings used by all HTTP sinks.
+func NewHTTPClient(insecure bool) *retryablehttp.Client {
+	client := retryablehttp.NewClient()
+	client.Logger = nil
+	client.RetryMax = 5
+	client.HTTPClient.Timeout = 2 * time.Minute
+	client.HTTPClient.Transport = &http.Transport{
+		Dial: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).Dial,
+		TLSHandshakeTimeout: 10 * time.Second,
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: insecure,
+		},
+		ExpectContinueTimeout: 1 * time.Second,
+		DisableKeepAlives:     false,
+		DisableCompression:    true,
+		Proxy:                 http.ProxyFromEnvironment,
+	}
+	return client
+}
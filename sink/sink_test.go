@@ -0,0 +1,32 @@
+package sink
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingSink struct {
+	records, originals []string
+}
+
+func (s *recordingSink) Send(record []byte) { s.records = append(s.records, string(record)) }
+func (s *recordingSink) Shutdown()          {}
+
+type originalSink struct{ recordingSink }
+
+func (s *originalSink) SendOriginal(record, original []byte) {
+	s.records = append(s.records, string(record))
+	s.originals = append(s.originals, string(original))
+}
+
+func TestSend(t *testing.T) {
+	plain, withOriginal := new(recordingSink), new(originalSink)
+	Send(plain, []byte(`{"class_uid":1007}`), []byte(`{"schema":"model_process::1.2.0"}`))
+	Send(withOriginal, []byte(`{"class_uid":1007}`), []byte(`{"schema":"model_process::1.2.0"}`))
+
+	assert.Equal(t, []string{`{"class_uid":1007}`}, plain.records)
+	assert.Empty(t, plain.originals)
+	assert.Equal(t, []string{`{"class_uid":1007}`}, withOriginal.records)
+	assert.Equal(t, []string{`{"schema":"model_process::1.2.0"}`}, withOriginal.originals)
+}
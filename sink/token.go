@@ -0,0 +1,100 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package sink
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	retryablehttp "github.com/hashicorp/go-retryablehttp"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// tokenRefreshMargin is how long before expiry a token is replaced.
+const tokenRefreshMargin = 5 * time.Minute
+
+// Doer sends HTTP requests; *retryablehttp.Client is a Doer.
+type Doer interface {
+	Do(req *retryablehttp.Request) (*http.Response, error)
+}
+
+// TokenSource caches an access token until shortly before it expires.
+type TokenSource struct {
+	fetch func() (token string, lifetime time.Duration, err error)
+
+	lock    sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// NewTokenSource returns a TokenSource that gets new tokens from fetch.
+func NewTokenSource(fetch func() (string, time.Duration, error)) *TokenSource {
+	return &TokenSource{fetch: fetch}
+}
+
+// Token returns a valid access token, fetching a new one if needed.
+func (t *TokenSource) Token() (string, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.token != "" && time.Now().Before(t.expires.Add(-tokenRefreshMargin)) {
+		return t.token, nil
+	}
+	token, lifetime, err := t.fetch()
+	if err != nil {
+		return "", err
+	}
+	t.token = token
+	t.expires = time.Now().Add(lifetime)
+	return t.token, nil
+}
+
+// Invalidate discards the cached token, so the next call to Token fetches a new one.
+func (t *TokenSource) Invalidate() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.token = ""
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// FetchOAuth2Token requests an access token from an OAuth2 token endpoint, and returns it with
+// its lifetime.
+func FetchOAuth2Token(client Doer, tokenURL string, form url.Values) (string, time.Duration, error) {
+	req, err := retryablehttp.NewRequest(http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to request access token: %w", err)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	resp.Body.Close()
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read access token: %w", err)
+	}
+
+	var tr tokenResponse
+	if err := jsoniter.Unmarshal(body, &tr); err != nil && resp.StatusCode == http.StatusOK {
+		return "", 0, fmt.Errorf("failed to parse access token: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || tr.AccessToken == "" {
+		return "", 0, fmt.Errorf("token endpoint returned status code %d: %s %s", resp.StatusCode, tr.Error, tr.ErrorDescription)
+	}
+	return tr.AccessToken, time.Duration(tr.ExpiresIn) * time.Second, nil
+}
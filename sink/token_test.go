@@ -0,0 +1,63 @@
+package sink
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenSource(t *testing.T) {
+	fetches := 0
+	lifetime := time.Hour
+	ts := NewTokenSource(func() (string, time.Duration, error) {
+		fetches++
+		if fetches == 3 {
+			return "", 0, errors.New("unavailable")
+		}
+		return "token", lifetime, nil
+	})
+
+	token, err := ts.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "token", token)
+	_, _ = ts.Token()
+	assert.Equal(t, 1, fetches, "the token is cached")
+
+	ts.Invalidate()
+	_, _ = ts.Token()
+	assert.Equal(t, 2, fetches)
+
+	// a token that is about to expire is replaced
+	ts.expires = time.Now().Add(tokenRefreshMargin / 2)
+	_, err = ts.Token()
+	assert.EqualError(t, err, "unavailable")
+}
+
+func TestFetchOAuth2Token(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		if r.PostForm.Get("client_secret") != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_client","error_description":"bad secret"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"token_type":"Bearer","expires_in":3599,"access_token":"token"}`))
+	}))
+	defer ts.Close()
+	client := NewHTTPClient(false)
+
+	token, lifetime, err := FetchOAuth2Token(client, ts.URL, url.Values{"client_secret": {"secret"}})
+	require.NoError(t, err)
+	assert.Equal(t, "token", token)
+	assert.Equal(t, 3599*time.Second, lifetime)
+
+	_, _, err = FetchOAuth2Token(client, ts.URL, url.Values{"client_secret": {"wrong"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid_client bad secret")
+}
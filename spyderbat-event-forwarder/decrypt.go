@@ -0,0 +1,105 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"spyderbat-event-forwarder/config"
+	"spyderbat-event-forwarder/encryption"
+)
+
+// runDecrypt implements the "decrypt" subcommand, which prints encrypted event log files
+// decrypted.
+func runDecrypt(args []string) error {
+	fs := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	configPath := fs.String("c", "config.yaml", "path to config file; used for the key_file and kms keys when -identity and -key are not given")
+	identityPath := fs.String("identity", "", "age identity file, for files encrypted to age recipients")
+	keyPath := fs.String("key", "", "key file, for files encrypted with a key_file key")
+	outPath := fs.String("o", "-", "write output to this file (- for stdout)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s decrypt [flags] file...\n", filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no files to decrypt")
+	}
+
+	var unwrappers []encryption.KeyUnwrapper
+	if *identityPath != "" {
+		identities, err := encryption.LoadIdentities(*identityPath)
+		if err != nil {
+			return err
+		}
+		unwrappers = append(unwrappers, encryption.NewAgeUnwrapper(identities))
+	}
+	if *keyPath != "" {
+		kek, err := encryption.LoadKeyFile(*keyPath)
+		if err != nil {
+			return err
+		}
+		keys, err := encryption.NewFileKey(kek)
+		if err != nil {
+			return err
+		}
+		unwrappers = append(unwrappers, keys)
+	}
+	if len(unwrappers) == 0 {
+		cfg, err := config.LoadConfig(*configPath)
+		if err != nil {
+			return err
+		}
+		if cfg.EventLog.Encryption == nil {
+			return fmt.Errorf("event_log.encryption is not enabled in %s; use -identity or -key", *configPath)
+		}
+		if cfg.EventLog.Encryption.Unwrapper() == nil {
+			return fmt.Errorf("files encrypted to age recipients need -identity")
+		}
+		unwrappers = append(unwrappers, cfg.EventLog.Encryption.Unwrapper())
+	}
+
+	out := io.Writer(os.Stdout)
+	if *outPath != "-" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	for _, path := range fs.Args() {
+		if err := decryptFile(path, out, unwrappers); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// decryptFile decrypts a file, which may have been compressed when it was rotated.
+func decryptFile(path string, out io.Writer, unwrappers []encryption.KeyUnwrapper) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := io.Reader(f)
+	if filepath.Ext(path) == ".gz" {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	return encryption.Decrypt(context.Background(), r, out, unwrappers...)
+}
@@ -0,0 +1,130 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"spyderbat-event-forwarder/config"
+	"spyderbat-event-forwarder/encryption"
+	"spyderbat-event-forwarder/format"
+	"spyderbat-event-forwarder/hashchain"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// eventLogFile is the writer for an event log file.
+type eventLogFile interface {
+	io.WriteCloser
+	Rotate() error
+}
+
+// newFileEventLog creates the output for the event log file and the files it routes records to.
+func newFileEventLog(c *config.EventLog, formatter format.Formatter) (*eventLog, error) {
+	w, err := newEventLogFile(c, c.Integrity, c.Encryption)
+	if err != nil {
+		return nil, err
+	}
+	l := &eventLog{Logger: log.New(w, "", 0), formatter: formatter, files: []io.Closer{w}}
+	for _, r := range c.Routes {
+		route := &eventLogRoute{EventLogRoute: r}
+		if r.IsEnabled() {
+			w, err := newEventLogFile(&r.EventLog, c.Integrity, c.Encryption)
+			if err != nil {
+				return nil, err
+			}
+			route.logger = log.New(w, "", 0)
+			l.files = append(l.files, w)
+		}
+		l.routes = append(l.routes, route)
+	}
+	return l, nil
+}
+
+// newEventLogFile creates the self-rotating writer for an event log file, and starts rotating
+// it on the hour or day if configured to. If integrity is not nil, the lines are hash chained,
+// and if encryption is not nil, they are encrypted; the chain is over the encrypted lines, so
+// files can be verified without the keys to decrypt them.
+func newEventLogFile(c *config.EventLog, integrity *config.EventLogIntegrity, encrypt *config.EventLogEncryption) (eventLogFile, error) {
+	var l eventLogFile = &lumberjack.Logger{
+		Filename:   c.Path(),
+		MaxSize:    c.MaxSizeMB, // megabytes after which new file is created
+		MaxAge:     c.MaxAgeDays,
+		MaxBackups: *c.MaxBackups,
+		Compress:   c.Compress,
+		LocalTime:  c.LocalTime,
+	}
+
+	// lumberjack creates new files with mode 0600, but keeps the mode of an existing file
+	// when it rotates, so creating the file with the configured mode is enough
+	if mode := c.Mode(); mode != 0 {
+		if err := os.MkdirAll(filepath.Dir(c.Path()), 0o755); err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(c.Path(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, mode)
+		if err != nil {
+			return nil, err
+		}
+		// the umask may have removed bits, and an existing file may have another mode
+		err = f.Chmod(mode)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if integrity != nil {
+		// the chain writer rotates the file at the same size, so that it can checkpoint it
+		w, err := hashchain.NewWriter(l, c.Path(), hashchain.Options{
+			MaxBytes:           int64(c.MaxSizeMB) * 1024 * 1024,
+			Key:                integrity.Key(),
+			CheckpointInterval: integrity.CheckpointInterval,
+			Mode:               c.Mode(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		l = w
+	}
+	if encrypt != nil {
+		// rotates first, so that each file starts with the header for its data key
+		w, err := encryption.NewWriter(l, c.Path(), int64(c.MaxSizeMB)*1024*1024, encrypt.Wrapper())
+		if err != nil {
+			return nil, err
+		}
+		l = w
+	}
+
+	if c.Rotate != "" {
+		go func() {
+			for {
+				now := time.Now()
+				time.Sleep(nextRotation(now, c.Rotate, c.LocalTime).Sub(now))
+				if err := l.Rotate(); err != nil {
+					log.Printf("unable to rotate event log: %s", err)
+				}
+			}
+		}()
+	}
+	return l, nil
+}
+
+// nextRotation returns the start of the hour or day after now, in UTC or local time.
+func nextRotation(now time.Time, rotate string, local bool) time.Time {
+	if local {
+		now = now.Local()
+	} else {
+		now = now.UTC()
+	}
+	y, m, d := now.Date()
+	if rotate == "hourly" {
+		return time.Date(y, m, d, now.Hour()+1, 0, 0, 0, now.Location())
+	}
+	return time.Date(y, m, d+1, 0, 0, 0, 0, now.Location())
+}
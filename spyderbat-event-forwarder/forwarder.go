@@ -8,25 +8,37 @@ import (
 	"bytes"
 	"context"
 	"flag"
-	"io"
 	"log"
 	"log/syslog"
 	"net"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"runtime"
 	"runtime/debug"
+	"strings"
 	"syscall"
 	"time"
 
+	"spyderbat-event-forwarder/amazon"
 	"spyderbat-event-forwarder/api"
+	"spyderbat-event-forwarder/chronicle"
 	"spyderbat-event-forwarder/config"
+	"spyderbat-event-forwarder/forward"
 	_ "spyderbat-event-forwarder/logwrapper"
+	"spyderbat-event-forwarder/loki"
+	"spyderbat-event-forwarder/nats"
+	"spyderbat-event-forwarder/notify"
+	"spyderbat-event-forwarder/otlp"
+	"spyderbat-event-forwarder/panther"
+	"spyderbat-event-forwarder/parquet"
+	"spyderbat-event-forwarder/projection"
+	"spyderbat-event-forwarder/redis"
+	"spyderbat-event-forwarder/sentinel"
+	"spyderbat-event-forwarder/sink"
+	"spyderbat-event-forwarder/sqlite"
 	"spyderbat-event-forwarder/webhook"
 
 	jsoniter "github.com/json-iterator/go"
-	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 var (
@@ -106,9 +118,40 @@ func getEnvAny(names ...string) string {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "schema":
+			if err := runSchema(os.Args[2:]); err != nil {
+				log.Fatalf("fatal: %s", err)
+			}
+			return
+		case "query":
+			if err := runQuery(os.Args[2:]); err != nil {
+				log.Fatalf("fatal: %s", err)
+			}
+			return
+		case "verify":
+			if err := runVerify(os.Args[2:]); err != nil {
+				log.Fatalf("fatal: %s", err)
+			}
+			return
+		case "decrypt":
+			if err := runDecrypt(os.Args[2:]); err != nil {
+				log.Fatalf("fatal: %s", err)
+			}
+			return
+		}
+	}
+
 	configPath := flag.String("c", "config.yaml", "path to config file")
+	pantherSchema := flag.Bool("panther-schema", false, "print the bundled Panther schema and exit")
 	flag.Parse()
 
+	if *pantherSchema {
+		_, _ = os.Stdout.Write(panther.DefaultSchema)
+		return
+	}
+
 	printVersion()
 	cfg, err := config.LoadConfig(*configPath)
 	if err != nil {
@@ -119,6 +162,55 @@ func main() {
 	log.Printf("api host: %s", cfg.APIHost)
 	log.Printf("log path: %s", cfg.LogPath)
 	log.Printf("local syslog forwarding: %v", cfg.LocalSyslogForwarding)
+	if cfg.EventLog.IsEnabled() {
+		log.Printf("event log: %s", cfg.EventLog.Path())
+		log.Printf("event log max size mb: %d", cfg.EventLog.MaxSizeMB)
+		log.Printf("event log max age days: %d", cfg.EventLog.MaxAgeDays)
+		log.Printf("event log max backups: %d", *cfg.EventLog.MaxBackups)
+		log.Printf("event log compress: %v", cfg.EventLog.Compress)
+		if cfg.EventLog.FileMode != "" {
+			log.Printf("event log file mode: %s", cfg.EventLog.FileMode)
+		}
+		if cfg.EventLog.Rotate != "" {
+			log.Printf("event log rotate: %s", cfg.EventLog.Rotate)
+		}
+		if cfg.EventLog.Integrity != nil {
+			log.Printf("event log integrity checkpoint interval: %s", cfg.EventLog.Integrity.CheckpointInterval)
+		}
+		if cfg.EventLog.Encryption != nil {
+			log.Printf("event log encryption: %s", cfg.EventLog.Encryption.Type)
+		}
+		for _, r := range cfg.EventLog.Routes {
+			if r.IsEnabled() {
+				log.Printf("event log route: %s -> %s", strings.Join(r.Schemas, ", "), r.Path())
+			} else {
+				log.Printf("event log route: %s -> dropped", strings.Join(r.Schemas, ", "))
+			}
+		}
+	} else {
+		log.Printf("event log: disabled")
+	}
+	for name, f := range map[string]*config.Format{"file": cfg.FileFormat, "stdout": cfg.StdOutFormat, "syslog": cfg.SyslogFormat} {
+		if f != nil {
+			log.Printf("%s format: %s", name, f.Type)
+		}
+	}
+	if cfg.Transform != "" {
+		log.Printf("transform: %s", cfg.Transform)
+	}
+	for _, p := range cfg.Projection {
+		schemas := "all schemas"
+		if len(p.Schemas) > 0 {
+			schemas = strings.Join(p.Schemas, ", ")
+		}
+		log.Printf("projection: %s: include %s; exclude %s", schemas, strings.Join(p.IncludeFields, ", "), strings.Join(p.ExcludeFields, ", "))
+	}
+	for _, r := range cfg.Redaction {
+		log.Printf("redaction: %d rules for %s", len(r.Rules), strings.Join(r.Outputs, ", "))
+	}
+	for _, t := range cfg.FieldTransforms {
+		log.Printf("field transform: %s", strings.Join(t.Outputs, ", "))
+	}
 
 	if v := getEnvAny("HTTP_PROXY", "http_proxy"); v != "" {
 		log.Printf("http proxy: %s", v)
@@ -140,6 +232,9 @@ func main() {
 	}
 
 	if cfg.Webhook != nil {
+		if cfg.Webhook.Preset != "" {
+			log.Printf("webhook preset: %s", cfg.Webhook.Preset)
+		}
 		log.Printf("webhook endpoint: %s", cfg.Webhook.Endpoint)
 		log.Printf("webhook max payload bytes: %d", cfg.Webhook.MaxPayloadBytes)
 		log.Printf("webhook ignore cert validation: %v", cfg.Webhook.Insecure)
@@ -147,10 +242,160 @@ func main() {
 			log.Printf("webhook authentication method: %s", cfg.Webhook.Authentication.Method)
 		}
 		log.Printf("webhook compression algorithm: %s", cfg.Webhook.CompressionAlgo)
+		if cfg.Webhook.Format != nil {
+			log.Printf("webhook format: %s", cfg.Webhook.Format.Type)
+		}
+		if cfg.Webhook.SchemaFile != "" {
+			log.Printf("webhook schema validation: %s", cfg.Webhook.SchemaFile)
+		}
+		if cfg.Webhook.Datadog != nil {
+			log.Printf("webhook datadog source: %s", cfg.Webhook.Datadog.Source)
+			if len(cfg.Webhook.Datadog.Tags) > 0 {
+				log.Printf("webhook datadog tags: %s", strings.Join(cfg.Webhook.Datadog.Tags, ","))
+			}
+		}
+		if cfg.Webhook.SumoLogic != nil {
+			log.Printf("webhook sumologic category: %s", cfg.Webhook.SumoLogic.Category)
+			log.Printf("webhook sumologic name: %s", cfg.Webhook.SumoLogic.Name)
+		}
+		if p := cfg.Webhook.Payload; p != nil {
+			log.Printf("webhook payload framing: %s", p.Framing)
+			if p.Template != "" {
+				log.Printf("webhook payload: template")
+			} else if p.JQ != "" {
+				log.Printf("webhook payload jq: %s", p.JQ)
+			}
+		}
+		log.Printf("webhook content type: %s", cfg.Webhook.ContentType())
 	} else {
 		log.Printf("webhook: disabled")
 	}
 
+	if cfg.Loki != nil {
+		log.Printf("loki endpoint: %s", cfg.Loki.Endpoint)
+		if cfg.Loki.TenantID != "" {
+			log.Printf("loki tenant id: %s", cfg.Loki.TenantID)
+		}
+		log.Printf("loki labels: %s", strings.Join(cfg.Loki.Labels, ", "))
+		log.Printf("loki push format: %s", cfg.Loki.PushFormat)
+		log.Printf("loki out of order handling: %s", cfg.Loki.OutOfOrder)
+		log.Printf("loki max payload bytes: %d", cfg.Loki.MaxPayloadBytes)
+		if cfg.Loki.Format != nil {
+			log.Printf("loki format: %s", cfg.Loki.Format.Type)
+		}
+	}
+
+	if cfg.OTLP != nil {
+		log.Printf("otlp endpoint: %s", cfg.OTLP.Endpoint)
+		log.Printf("otlp protocol: %s", cfg.OTLP.Protocol)
+		log.Printf("otlp service name: %s", cfg.OTLP.ServiceName)
+		log.Printf("otlp compression algorithm: %s", cfg.OTLP.CompressionAlgo)
+		log.Printf("otlp max payload bytes: %d", cfg.OTLP.MaxPayloadBytes)
+		log.Printf("otlp ignore cert validation: %v", cfg.OTLP.Insecure)
+	}
+
+	if cfg.Sentinel != nil {
+		log.Printf("sentinel endpoint: %s", cfg.Sentinel.Endpoint)
+		log.Printf("sentinel dcr: %s", cfg.Sentinel.DCRImmutableID)
+		log.Printf("sentinel tenant id: %s", cfg.Sentinel.TenantID)
+		log.Printf("sentinel client id: %s", cfg.Sentinel.ClientID)
+		for family, stream := range cfg.Sentinel.Streams {
+			log.Printf("sentinel stream for %s: %s", family, stream)
+		}
+		if cfg.Sentinel.DefaultStream != "" {
+			log.Printf("sentinel default stream: %s", cfg.Sentinel.DefaultStream)
+		}
+		log.Printf("sentinel compression algorithm: %s", cfg.Sentinel.CompressionAlgo)
+		log.Printf("sentinel max payload bytes: %d", cfg.Sentinel.MaxPayloadBytes)
+	}
+
+	if cfg.Chronicle != nil {
+		log.Printf("chronicle endpoint: %s", cfg.Chronicle.Endpoint)
+		log.Printf("chronicle log type: %s", cfg.Chronicle.LogType)
+		if cfg.Chronicle.Namespace != "" {
+			log.Printf("chronicle namespace: %s", cfg.Chronicle.Namespace)
+		}
+		log.Printf("chronicle service account: %s", cfg.Chronicle.ServiceAccount().ClientEmail)
+		log.Printf("chronicle max payload bytes: %d", cfg.Chronicle.MaxPayloadBytes)
+		if cfg.Chronicle.Format != nil {
+			log.Printf("chronicle format: %s", cfg.Chronicle.Format.Type)
+		}
+	}
+	if cfg.AWS != nil {
+		log.Printf("aws service: %s", cfg.AWS.Service)
+		log.Printf("aws region: %s", cfg.AWS.Region)
+		switch cfg.AWS.Service {
+		case "firehose":
+			log.Printf("aws delivery stream: %s", cfg.AWS.DeliveryStreamName)
+		case "sqs":
+			log.Printf("aws queue url: %s", cfg.AWS.QueueURL)
+		}
+		if cfg.AWS.EndpointURL != "" {
+			log.Printf("aws endpoint: %s", cfg.AWS.EndpointURL)
+		}
+		if cfg.AWS.RoleARN != "" {
+			log.Printf("aws role: %s", cfg.AWS.RoleARN)
+		}
+		log.Printf("aws partial failure retries: %d", *cfg.AWS.PartialFailureRetries)
+		if cfg.AWS.Format != nil {
+			log.Printf("aws format: %s", cfg.AWS.Format.Type)
+		}
+	}
+	if cfg.Forward != nil {
+		log.Printf("forward address: %s", cfg.Forward.Address)
+		log.Printf("forward tag: %s", cfg.Forward.Tag)
+		log.Printf("forward tls: %v", cfg.Forward.TLS)
+		log.Printf("forward shared key handshake: %v", cfg.Forward.SharedKey != "")
+		log.Printf("forward require ack: %v", cfg.Forward.AckRequired())
+		log.Printf("forward max payload bytes: %d", cfg.Forward.MaxPayloadBytes)
+		if cfg.Forward.Format != nil {
+			log.Printf("forward format: %s", cfg.Forward.Format.Type)
+		}
+	}
+	if cfg.NATS != nil {
+		log.Printf("nats address: %s", cfg.NATS.Address())
+		log.Printf("nats subject: %s", cfg.NATS.Subject)
+		log.Printf("nats tls: %v", cfg.NATS.TLS())
+		if cfg.NATS.Format != nil {
+			log.Printf("nats format: %s", cfg.NATS.Format.Type)
+		}
+	}
+	if cfg.Redis != nil {
+		log.Printf("redis address: %s", cfg.Redis.Address)
+		log.Printf("redis key: %s", cfg.Redis.Key)
+		log.Printf("redis max len: %d", *cfg.Redis.MaxLen)
+		log.Printf("redis db: %d", cfg.Redis.DB)
+		log.Printf("redis tls: %v", cfg.Redis.TLS)
+		if cfg.Redis.Format != nil {
+			log.Printf("redis format: %s", cfg.Redis.Format.Type)
+		}
+	}
+	if cfg.Notify != nil {
+		log.Printf("notify type: %s", cfg.Notify.Type)
+		log.Printf("notify schemas: %s", strings.Join(cfg.Notify.Filter.Schemas, ", "))
+		if cfg.Notify.Filter.MinScore != nil {
+			log.Printf("notify min score: %v", *cfg.Notify.Filter.MinScore)
+		}
+		log.Printf("notify include suppressed: %v", cfg.Notify.Filter.IncludeSuppressed)
+		log.Printf("notify rate limit: %s", cfg.Notify.RateLimit)
+	}
+	if cfg.SQLite != nil {
+		log.Printf("sqlite path: %s", cfg.SQLite.Path())
+		log.Printf("sqlite retention days: %d", cfg.SQLite.RetentionDays)
+	}
+	if cfg.Parquet != nil {
+		log.Printf("parquet directory: %s", cfg.Parquet.Path())
+		log.Printf("parquet max file bytes: %d", cfg.Parquet.MaxFileBytes)
+		log.Printf("parquet max file age: %s", cfg.Parquet.MaxFileAge)
+		log.Printf("parquet compression: %s", cfg.Parquet.Compression)
+		if cfg.Parquet.S3 != nil {
+			log.Printf("parquet s3 bucket: %s", cfg.Parquet.S3.Bucket)
+			log.Printf("parquet s3 prefix: %s", cfg.Parquet.S3.Prefix)
+			log.Printf("parquet s3 region: %s", cfg.Parquet.S3.Region)
+			log.Printf("parquet s3 keep local: %v", cfg.Parquet.S3.KeepLocal)
+		}
+	}
+
 	sapi := api.New(cfg, getUserAgent())
 	sapi.SetDebug(noisy)
 	err = sapi.ValidateAPIReachability(context.Background())
@@ -161,16 +406,22 @@ func main() {
 	}
 
 	// create a self-rotating logger to write our events to
-	logWriters := []io.Writer{
-		&lumberjack.Logger{
-			Filename:   filepath.Join(cfg.LogPath, "spyderbat_events.log"),
-			MaxSize:    10, // megabytes after which new file is created
-			MaxBackups: 5,  // number of backups
-		},
+	var eventLogs []*eventLog
+	if cfg.EventLog.IsEnabled() {
+		l, err := newFileEventLog(cfg.EventLog, cfg.FileFormat.Formatter())
+		if err != nil {
+			log.Fatalf("fatal: unable to create event log: %s", err)
+		}
+		l.name = "file"
+		eventLogs = append(eventLogs, l)
 	}
 
 	if cfg.StdOut {
-		logWriters = append(logWriters, os.Stdout)
+		eventLogs = append(eventLogs, &eventLog{
+			Logger:    log.New(os.Stdout, "", 0),
+			name:      "stdout",
+			formatter: cfg.StdOutFormat.Formatter(),
+		})
 	}
 
 	if cfg.LocalSyslogForwarding {
@@ -178,7 +429,11 @@ func main() {
 		if err != nil {
 			log.Printf("syslog forwarding requested, but failed: %s", err)
 		} else {
-			logWriters = append(logWriters, w)
+			eventLogs = append(eventLogs, &eventLog{
+				Logger:    log.New(w, "", 0),
+				name:      "syslog",
+				formatter: cfg.SyslogFormat.Formatter(),
+			})
 		}
 	}
 
@@ -196,8 +451,57 @@ func main() {
 		}
 	}()
 
-	eventLog := log.New(io.MultiWriter(logWriters...), "", 0)
-	webhook := webhook.New(cfg.Webhook)
+	// remote outputs; each is left out if it is not configured
+	var sinks []sink.Sink
+	sinkNames := make(map[sink.Sink]string) // the names of the outputs in the config
+	if h := webhook.New(cfg.Webhook); h != nil {
+		sinks = append(sinks, h)
+		sinkNames[h] = "webhook"
+	}
+	if l := loki.New(cfg.Loki); l != nil {
+		sinks = append(sinks, l)
+		sinkNames[l] = "loki"
+	}
+	if o := otlp.New(cfg.OTLP); o != nil {
+		sinks = append(sinks, o)
+		sinkNames[o] = "otlp"
+	}
+	if s := sentinel.New(cfg.Sentinel); s != nil {
+		sinks = append(sinks, s)
+		sinkNames[s] = "sentinel"
+	}
+	if c := chronicle.New(cfg.Chronicle); c != nil {
+		sinks = append(sinks, c)
+		sinkNames[c] = "chronicle"
+	}
+	if a := amazon.New(cfg.AWS); a != nil {
+		sinks = append(sinks, a)
+		sinkNames[a] = "aws"
+	}
+	if f := forward.New(cfg.Forward); f != nil {
+		sinks = append(sinks, f)
+		sinkNames[f] = "forward"
+	}
+	if n := nats.New(cfg.NATS); n != nil {
+		sinks = append(sinks, n)
+		sinkNames[n] = "nats"
+	}
+	if r := redis.New(cfg.Redis); r != nil {
+		sinks = append(sinks, r)
+		sinkNames[r] = "redis"
+	}
+	if n := notify.New(cfg.Notify); n != nil {
+		sinks = append(sinks, n)
+		sinkNames[n] = "notify"
+	}
+	if s := sqlite.New(cfg.SQLite); s != nil {
+		sinks = append(sinks, s)
+		sinkNames[s] = "sqlite"
+	}
+	if p := parquet.New(cfg.Parquet); p != nil {
+		sinks = append(sinks, p)
+		sinkNames[p] = "parquet"
+	}
 
 	// do a graceful shutdown on SIGTERM or SIGINT
 	sig := make(chan os.Signal, 1)
@@ -208,7 +512,9 @@ func main() {
 		<-sig
 		cancel()
 		log.Printf("got shutdown signal, shutting down")
-		webhook.Shutdown()
+		for _, s := range sinks {
+			s.Shutdown()
+		}
 		shutdownComplete <- true
 	}()
 
@@ -222,11 +528,14 @@ func main() {
 	const maxErrCount = 5
 
 	req := &processLogsRequest{
-		sapi:     sapi,
-		eventLog: eventLog,
-		stats:    new(logstats),
-		webhook:  webhook,
+		sapi:      sapi,
+		projector: projection.New(cfg.Projection),
+		transform: cfg.Transformer(),
+		eventLogs: eventLogs,
+		stats:     new(logstats),
+		sinks:     sinks,
 	}
+	groupOutputs(req, cfg.Redaction, cfg.FieldTransforms, sinkNames)
 
 	buf := &bytes.Buffer{}
 
@@ -277,6 +586,9 @@ loop:
 			req.stats.recordsRetrieved,
 			req.stats.invalidRecords,
 			req.stats.loggedRecords)
+		if req.projector != nil {
+			log.Printf("projection removed %d bytes", req.stats.projectedBytes)
+		}
 
 		if records >= recordsPerRequest {
 			// if we got the number of records we requested, then we can assume that
@@ -289,5 +601,8 @@ loop:
 		}
 	}
 	<-shutdownComplete
+	for _, l := range eventLogs {
+		l.close()
+	}
 	log.Printf("shutdown complete")
 }
@@ -9,28 +9,170 @@ import (
 	"context"
 	"io"
 	"log"
+	"slices"
 	"spyderbat-event-forwarder/api"
-	"spyderbat-event-forwarder/webhook"
+	"spyderbat-event-forwarder/config"
+	"spyderbat-event-forwarder/format"
+	"spyderbat-event-forwarder/projection"
+	"spyderbat-event-forwarder/redact"
+	"spyderbat-event-forwarder/reshape"
+	"spyderbat-event-forwarder/sink"
+	"spyderbat-event-forwarder/transform"
+
+	"github.com/valyala/fastjson"
 )
 
 type logstats struct {
 	recordsRetrieved int
 	invalidRecords   int
 	loggedRecords    int
+	projectedBytes   int // bytes removed from records by projection
 }
 
 func (l *logstats) reset() {
 	l.recordsRetrieved = 0
 	l.invalidRecords = 0
 	l.loggedRecords = 0
+	l.projectedBytes = 0
+}
+
+var parserPool = fastjson.ParserPool{}
+
+// eventLog is a local output for records, such as the event log file, stdout or syslog.
+type eventLog struct {
+	*log.Logger
+	name      string           // file, stdout or syslog, for redaction and field transforms
+	formatter format.Formatter // nil to write records as-is
+	routes    []*eventLogRoute // records go to the first route for their schema, or to Logger
+	files     []io.Closer      // closed at shutdown
+}
+
+// eventLogRoute is a separate output for the records with some schemas.
+type eventLogRoute struct {
+	*config.EventLogRoute
+	logger *log.Logger // nil if the route is disabled, to drop its records
+}
+
+// close closes the output's files.
+func (l *eventLog) close() {
+	for _, f := range l.files {
+		if err := f.Close(); err != nil {
+			log.Printf("unable to close event log: %s", err)
+		}
+	}
+}
+
+// write writes a record to the output. original is the record before it was transformed, which
+// has the schema that routes are selected by and is what cef and leef formats render.
+func (l *eventLog) write(record, original []byte) {
+	logger := l.Logger
+	if len(l.routes) > 0 {
+		schema := recordSchema(original)
+		for _, r := range l.routes {
+			if r.Match(schema) {
+				logger = r.logger
+				break
+			}
+		}
+		if logger == nil {
+			return
+		}
+	}
+
+	if l.formatter != nil {
+		formatted, err := l.formatter.Format(original)
+		if err != nil {
+			log.Printf("unable to format record, writing it unformatted: %s", err)
+		} else {
+			record = formatted
+		}
+	}
+	logger.Print(string(record))
+}
+
+// recordSchema returns the schema of a record, or "" if it has none.
+func recordSchema(record []byte) string {
+	p := parserPool.Get()
+	defer parserPool.Put(p)
+	v, err := p.ParseBytes(record)
+	if err != nil {
+		return ""
+	}
+	return string(v.GetStringBytes("schema"))
+}
+
+// outputGroup is the outputs that get records redacted and reshaped the same way.
+type outputGroup struct {
+	redactor  *redact.Redactor  // nil if the outputs have no redaction rules
+	reshaper  *reshape.Reshaper // nil if the outputs have no field transform
+	eventLogs []*eventLog
+	sinks     []sink.Sink
+}
+
+// groupOutputs moves the outputs that have redaction rules or field transforms from the
+// request's eventLogs and sinks to its output groups. sinkNames are the names of the sinks in
+// the config.
+func groupOutputs(req *processLogsRequest, redactions []*config.Redaction, transforms []*config.FieldTransform, sinkNames map[sink.Sink]string) {
+	type key struct{ redaction, transform int }
+	groups := make(map[key]*outputGroup)
+	group := func(name string) *outputGroup {
+		k := key{-1, -1}
+		for i, c := range redactions {
+			if slices.Contains(c.Outputs, name) {
+				k.redaction = i
+			}
+		}
+		for i, c := range transforms {
+			if slices.Contains(c.Outputs, name) {
+				k.transform = i
+			}
+		}
+		if k == (key{-1, -1}) {
+			return nil
+		}
+		g := groups[k]
+		if g == nil {
+			g = &outputGroup{}
+			if k.redaction >= 0 {
+				g.redactor = redact.New(redactions[k.redaction])
+			}
+			if k.transform >= 0 {
+				g.reshaper = reshape.New(transforms[k.transform])
+			}
+			groups[k] = g
+			req.groups = append(req.groups, g)
+		}
+		return g
+	}
+
+	eventLogs := req.eventLogs[:0:0]
+	for _, l := range req.eventLogs {
+		if g := group(l.name); g != nil {
+			g.eventLogs = append(g.eventLogs, l)
+		} else {
+			eventLogs = append(eventLogs, l)
+		}
+	}
+	sinks := req.sinks[:0:0]
+	for _, s := range req.sinks {
+		if g := group(sinkNames[s]); g != nil {
+			g.sinks = append(g.sinks, s)
+		} else {
+			sinks = append(sinks, s)
+		}
+	}
+	req.eventLogs, req.sinks = eventLogs, sinks
 }
 
 type processLogsRequest struct {
-	r        io.Reader        // Input: The data to process
-	sapi     api.APIer        // Input: The API service to use for augmenting the data
-	eventLog *log.Logger      // Input: The logger to use for emitting events
-	webhook  *webhook.Webhook // Input: The webhook to use for emitting events
-	stats    *logstats        // Input/Return: stats
+	r         io.Reader             // Input: The data to process
+	sapi      api.APIer             // Input: The API service to use for augmenting the data
+	projector *projection.Projector // Input: The projection to apply to each record, if any
+	transform transform.Transformer // Input: The transformation to apply to each record, if any
+	eventLogs []*eventLog           // Input: The local outputs to use for emitting events
+	sinks     []sink.Sink           // Input: The remote outputs (webhook, loki, ...) to use for emitting events
+	groups    []*outputGroup        // Input: The outputs that get redacted or reshaped events
+	stats     *logstats             // Input/Return: stats
 }
 
 func processLogs(ctx context.Context, req *processLogsRequest) {
@@ -41,10 +183,75 @@ func processLogs(ctx context.Context, req *processLogsRequest) {
 		req.stats.recordsRetrieved++
 		jsonRecord := scanner.Bytes()
 
-		req.stats.loggedRecords++
 		r := req.sapi.AugmentRuntimeDetailsJSON(jsonRecord)
-		req.eventLog.Print(string(r))
-		req.webhook.Send(r)
+		if req.projector != nil {
+			p, err := req.projector.Project(r, recordSchema(r))
+			if err != nil {
+				// forward the record as-is rather than lose it
+				req.stats.invalidRecords++
+			} else {
+				req.stats.projectedBytes += len(r) - len(p)
+				r = p
+			}
+		}
+		original := r
+		if req.transform != nil {
+			t, err := req.transform.Transform(r)
+			if err != nil {
+				// forward the record as-is rather than lose it
+				req.stats.invalidRecords++
+			} else {
+				r = t
+			}
+		}
+
+		req.stats.loggedRecords++
+		for _, l := range req.eventLogs {
+			l.write(r, original)
+		}
+		for _, s := range req.sinks {
+			sink.Send(s, r, original)
+		}
+		if len(req.groups) > 0 {
+			schema := recordSchema(original)
+			for _, g := range req.groups {
+				out, in := r, original
+				if g.redactor != nil {
+					// redact before the transform, which may copy fields elsewhere in the record
+					redacted, err := g.redactor.Redact(original, schema)
+					if err != nil {
+						// never send the record unredacted
+						log.Printf("unable to redact record, dropping it: %s", err)
+						continue
+					}
+					out, in = redacted, redacted
+					if req.transform != nil {
+						t, err := req.transform.Transform(redacted)
+						if err != nil {
+							// forward the record as-is rather than lose it
+							req.stats.invalidRecords++
+						} else {
+							out = t
+						}
+					}
+				}
+				if g.reshaper != nil {
+					reshaped, err := g.reshaper.Reshape(out)
+					if err != nil {
+						// forward the record as-is rather than lose it
+						req.stats.invalidRecords++
+					} else {
+						out = reshaped
+					}
+				}
+				for _, l := range g.eventLogs {
+					l.write(out, in)
+				}
+				for _, s := range g.sinks {
+					sink.Send(s, out, in)
+				}
+			}
+		}
 	}
 	if err := scanner.Err(); err != nil {
 		log.Printf("error processing records: %s", err)
@@ -11,8 +11,15 @@ import (
 	"log"
 	"os"
 	"spyderbat-event-forwarder/api"
+	"spyderbat-event-forwarder/config"
+	"spyderbat-event-forwarder/format"
+	"spyderbat-event-forwarder/projection"
+	"spyderbat-event-forwarder/sink"
+	"spyderbat-event-forwarder/transform"
+	"strings"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -66,7 +73,7 @@ func setupTestRequest(t testing.TB) (*processLogsRequest, *bytes.Buffer) {
 
 	req := new(processLogsRequest)
 	req.stats = new(logstats)
-	req.eventLog = log.New(eventLogBuf, "", 0)
+	req.eventLogs = []*eventLog{{Logger: log.New(eventLogBuf, "", 0)}}
 	req.sapi = new(mockSAPI)
 
 	data, err := os.ReadFile("testdata/source_data_response.out")
@@ -92,6 +99,165 @@ func TestProcessLogs(t *testing.T) {
 	require.Equal(t, req.stats.recordsRetrieved, req.stats.loggedRecords)
 }
 
+type recordingSink struct {
+	records []string
+}
+
+func (s *recordingSink) Send(record []byte) { s.records = append(s.records, string(record)) }
+func (s *recordingSink) Shutdown()          {}
+
+func TestProcessLogsRedaction(t *testing.T) {
+	tests := []struct {
+		name      string
+		transform transform.Transformer
+		field     string // a field that every output's records have
+	}{
+		{"no transform", nil, `"schema":"model_process::1.2.0"`},
+		// the transforms copy args to other fields and embed the original record
+		{"ocsf", &transform.OCSF{}, `"class_uid":`},
+		{"ecs", &transform.ECS{}, `"ecs":`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupLogging(t)
+			fileBuf, stdoutBuf := new(bytes.Buffer), new(bytes.Buffer)
+			webhook, loki := new(recordingSink), new(recordingSink)
+			redactions := []*config.Redaction{{
+				Outputs: []string{"stdout", "webhook"},
+				Rules:   []*config.RedactionRule{{Path: "args", Action: "drop"}},
+			}}
+			require.NoError(t, config.ValidateRedaction(redactions))
+
+			req := &processLogsRequest{
+				sapi:      new(mockSAPI),
+				stats:     new(logstats),
+				transform: tt.transform,
+				eventLogs: []*eventLog{
+					{Logger: log.New(fileBuf, "", 0), name: "file"},
+					{Logger: log.New(stdoutBuf, "", 0), name: "stdout"},
+				},
+				sinks: []sink.Sink{webhook, loki},
+			}
+			groupOutputs(req, redactions, nil, map[sink.Sink]string{webhook: "webhook", loki: "loki"})
+			require.Len(t, req.groups, 1)
+
+			record := `{"schema":"model_process::1.2.0","id":"proc:1","time":1700000000.5,"args":["curl","-u","admin:secret"]}`
+			req.r = &nopSeekerCloser{strings.NewReader(record + "\n")}
+			processLogs(context.TODO(), req)
+
+			assert.Contains(t, fileBuf.String(), "admin:secret")
+			assert.NotContains(t, stdoutBuf.String(), "admin:secret")
+			assert.Contains(t, stdoutBuf.String(), `"proc:1"`)
+			require.Len(t, loki.records, 1)
+			assert.Contains(t, loki.records[0], "admin:secret")
+			require.Len(t, webhook.records, 1)
+			assert.NotContains(t, webhook.records[0], "admin:secret")
+			for _, out := range []string{fileBuf.String(), stdoutBuf.String(), loki.records[0], webhook.records[0]} {
+				assert.Contains(t, out, tt.field)
+			}
+		})
+	}
+}
+
+func TestProcessLogsFormatTransform(t *testing.T) {
+	setupLogging(t)
+	cef, err := format.New(format.Options{Type: "cef"})
+	require.NoError(t, err)
+	fileBuf, stdoutBuf := new(bytes.Buffer), new(bytes.Buffer)
+	redactions := []*config.Redaction{{
+		Outputs: []string{"stdout"},
+		Rules:   []*config.RedactionRule{{Path: "muid", Action: "drop"}},
+	}}
+	require.NoError(t, config.ValidateRedaction(redactions))
+
+	req := &processLogsRequest{
+		sapi:      new(mockSAPI),
+		stats:     new(logstats),
+		transform: &transform.OCSF{},
+		eventLogs: []*eventLog{
+			{Logger: log.New(fileBuf, "", 0), name: "file", formatter: cef},
+			{Logger: log.New(stdoutBuf, "", 0), name: "stdout", formatter: cef},
+		},
+	}
+	groupOutputs(req, redactions, nil, nil)
+
+	record := `{"schema":"event_redflag:bash:1.0.0","id":"flag:1","muid":"mach:1","time":1700000000.5,"severity":"high"}`
+	req.r = &nopSeekerCloser{strings.NewReader(record + "\n")}
+	processLogs(context.TODO(), req)
+
+	// cef renders the record before it was transformed, which has the schema, severity and
+	// time in seconds; ocsf has none of them
+	for _, out := range []string{fileBuf.String(), stdoutBuf.String()} {
+		assert.True(t, strings.HasPrefix(out, "CEF:0|Spyderbat|"), out)
+		assert.Contains(t, out, "|event_redflag:bash:1.0.0|")
+		assert.Contains(t, out, "|8|rt=1700000000500 ")
+		assert.NotContains(t, out, "class_uid")
+	}
+	assert.Contains(t, fileBuf.String(), "mach:1")
+	assert.NotContains(t, stdoutBuf.String(), "mach:1", "redaction still applies")
+}
+
+func TestProcessLogsFieldTransforms(t *testing.T) {
+	setupLogging(t)
+	webhook, loki, nats := new(recordingSink), new(recordingSink), new(recordingSink)
+	redactions := []*config.Redaction{{
+		Outputs: []string{"webhook", "loki"},
+		Rules:   []*config.RedactionRule{{Path: "args", Action: "drop"}},
+	}}
+	require.NoError(t, config.ValidateRedaction(redactions))
+	transforms := []*config.FieldTransform{{
+		Outputs:    []string{"loki", "nats"},
+		Timestamps: []string{"time"},
+		Flatten:    "_",
+	}}
+	require.NoError(t, config.ValidateFieldTransforms(transforms))
+
+	req := &processLogsRequest{sapi: new(mockSAPI), stats: new(logstats), sinks: []sink.Sink{webhook, loki, nats}}
+	groupOutputs(req, redactions, transforms, map[sink.Sink]string{webhook: "webhook", loki: "loki", nats: "nats"})
+	require.Len(t, req.groups, 3) // redacted, redacted and reshaped, reshaped
+	assert.Empty(t, req.sinks)
+
+	record := `{"schema":"model_process::1.2.0","id":"proc:1","time":1700000000.5,"args":["curl"]}`
+	req.r = &nopSeekerCloser{strings.NewReader(record + "\n")}
+	processLogs(context.TODO(), req)
+
+	require.Len(t, webhook.records, 1)
+	assert.NotContains(t, webhook.records[0], "curl")
+	assert.Contains(t, webhook.records[0], `"time":1700000000.5`)
+	assert.Contains(t, webhook.records[0], `"runtime_details":{"cloud_instance_id":"kittens"`)
+	require.Len(t, loki.records, 1)
+	assert.NotContains(t, loki.records[0], "curl")
+	assert.Contains(t, loki.records[0], `"time":"2023-11-14T22:13:20.5Z"`)
+	assert.Contains(t, loki.records[0], `"runtime_details_cloud_instance_id":"kittens"`)
+	require.Len(t, nats.records, 1)
+	assert.Contains(t, nats.records[0], `"args":["curl"]`)
+	assert.Contains(t, nats.records[0], `"time":"2023-11-14T22:13:20.5Z"`)
+}
+
+func TestProcessLogsProjection(t *testing.T) {
+	setupLogging(t)
+	eventLogBuf := new(bytes.Buffer)
+	req := &processLogsRequest{
+		sapi:      new(mockSAPI),
+		stats:     new(logstats),
+		eventLogs: []*eventLog{{Logger: log.New(eventLogBuf, "", 0)}},
+		projector: projection.New([]*config.Projection{{Schemas: []string{"model_process"}, IncludeFields: []string{"id"}}}),
+	}
+	process := `{"schema":"model_process::1.2.0","id":"proc:1","args":["curl","-v"]}`
+	conn := `{"schema":"model_connection::1.2.0","id":"conn:1","remote_port":443}`
+	req.r = &nopSeekerCloser{strings.NewReader(process + "\n" + conn + "\n")}
+	processLogs(context.TODO(), req)
+
+	// runtime_details is added before the projection, and kept
+	lines := strings.Split(strings.TrimSpace(eventLogBuf.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[0], `{"schema":"model_process::1.2.0","id":"proc:1","runtime_details":{"cloud_instance_id":"kittens"`), lines[0])
+	assert.NotContains(t, lines[0], "args")
+	assert.Contains(t, lines[1], `"remote_port":443`)
+	assert.Equal(t, len(`,"args":["curl","-v"]`), req.stats.projectedBytes)
+	assert.Equal(t, 0, req.stats.invalidRecords)
+}
+
 func BenchmarkProcessLogs(b *testing.B) {
 	setupLogging(b)
 	req, _ := setupTestRequest(b)
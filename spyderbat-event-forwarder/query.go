@@ -0,0 +1,104 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"spyderbat-event-forwarder/config"
+	"spyderbat-event-forwarder/sqlite"
+)
+
+// runQuery implements the "query" subcommand, which prints records from the sqlite store
+// as newline-delimited JSON.
+func runQuery(args []string) error {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	configPath := fs.String("c", "config.yaml", "path to config file; used to find the database")
+	dbPath := fs.String("db", "", "path to the database, instead of the one in the config file")
+	since := fs.String("since", "24h", "only print records at or after this time; a duration ago, a date, RFC 3339 or unix seconds")
+	until := fs.String("until", "", "only print records before this time; same forms as -since")
+	schema := fs.String("schema", "", "only print records whose schema starts with this prefix")
+	hostname := fs.String("hostname", "", "only print records from this host")
+	muid := fs.String("muid", "", "only print records from this machine")
+	limit := fs.Int("n", 0, "maximum number of records to print; 0 for no limit")
+	outPath := fs.String("o", "-", "write output to this file (- for stdout)")
+	_ = fs.Parse(args)
+
+	now := time.Now()
+	q := sqlite.Query{Schema: *schema, Hostname: *hostname, MUID: *muid, Limit: *limit}
+	var err error
+	if q.Since, err = parseQueryTime(*since, now); err != nil {
+		return fmt.Errorf("invalid -since: %w", err)
+	}
+	if q.Until, err = parseQueryTime(*until, now); err != nil {
+		return fmt.Errorf("invalid -until: %w", err)
+	}
+
+	path := *dbPath
+	if path == "" {
+		cfg, err := config.LoadConfig(*configPath)
+		if err != nil {
+			return err
+		}
+		if cfg.SQLite == nil {
+			return fmt.Errorf("sqlite is not enabled in %s; use -db to name a database", *configPath)
+		}
+		path = cfg.SQLite.Path()
+	}
+	db, err := sqlite.OpenReadOnly(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	out := io.Writer(os.Stdout)
+	if *outPath != "-" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	w := bufio.NewWriter(out)
+	err = sqlite.Search(context.Background(), db, q, func(record []byte) error {
+		if _, err := w.Write(record); err != nil {
+			return err
+		}
+		return w.WriteByte('\n')
+	})
+	if err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// parseQueryTime parses a time given as a duration before now (e.g. 36h), a local date
+// (2006-01-02), RFC 3339 or unix seconds. An empty string is the zero time.
+func parseQueryTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation(time.DateOnly, s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Unix(0, int64(f*1e9)), nil
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time '%s'", s)
+}
@@ -0,0 +1,206 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	stdjson "encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"spyderbat-event-forwarder/api"
+	"spyderbat-event-forwarder/config"
+	"spyderbat-event-forwarder/panther"
+
+	"github.com/valyala/fastjson"
+	"gopkg.in/yaml.v2"
+)
+
+// runSchema implements the "schema" subcommand, which infers a schema from sampled records
+// and prints it, or prints how it differs from an existing schema.
+func runSchema(args []string) error {
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	configPath := fs.String("c", "config.yaml", "path to config file; used to sample records from the API")
+	inputPath := fs.String("f", "", "sample records from this event log instead of the API (- for stdin)")
+	samples := fs.Int("n", 10000, "maximum number of records to sample")
+	match := fs.String("schema", "", "only sample records whose schema starts with this prefix")
+	format := fs.String("format", "panther", "output format [ panther | elasticsearch | jsonschema ]")
+	basePath := fs.String("base", "builtin", "existing panther schema to carry annotations from and diff against [ builtin | path | none ]")
+	diff := fs.Bool("diff", false, "print the differences from the base schema instead of the inferred schema")
+	unobserved := fs.Bool("unobserved", false, "with -diff, also list base schema fields that were not observed")
+	outPath := fs.String("o", "-", "write output to this file (- for stdout)")
+	_ = fs.Parse(args)
+
+	switch *format {
+	case "panther", "elasticsearch", "jsonschema":
+	default:
+		return fmt.Errorf("unsupported schema format '%s'", *format)
+	}
+
+	var base *panther.Schema
+	switch *basePath {
+	case "none":
+		if *diff {
+			return fmt.Errorf("-diff requires a base schema")
+		}
+	case "builtin":
+		s, err := panther.ParseSchema(panther.DefaultSchema)
+		if err != nil {
+			return err
+		}
+		base = s
+	default:
+		data, err := os.ReadFile(*basePath)
+		if err != nil {
+			return fmt.Errorf("failed to read base schema: %w", err)
+		}
+		s, err := panther.ParseSchema(data)
+		if err != nil {
+			return err
+		}
+		base = s
+	}
+
+	in := panther.NewInferrer()
+	observe := func(record []byte) bool {
+		if *match != "" && !strings.HasPrefix(fastjson.GetString(record, "schema"), *match) {
+			return true
+		}
+		if err := in.Observe(record); err != nil {
+			log.Printf("skipping invalid record: %s", err)
+		}
+		return in.Records() < *samples
+	}
+
+	var err error
+	if *inputPath != "" {
+		err = sampleFile(*inputPath, observe)
+	} else {
+		err = sampleAPI(*configPath, observe)
+	}
+	if err != nil {
+		return err
+	}
+	if in.Records() == 0 {
+		return fmt.Errorf("no records sampled")
+	}
+	log.Printf("sampled %d records", in.Records())
+
+	inferred := in.Schema(base)
+
+	out := io.Writer(os.Stdout)
+	if *outPath != "-" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	if *diff {
+		if *format != "panther" {
+			return fmt.Errorf("-diff is only supported for the panther format")
+		}
+		for _, line := range panther.Diff(base, inferred) {
+			// a field missing from the sample hasn't necessarily gone away
+			if strings.HasPrefix(line, "- ") && !*unobserved {
+				continue
+			}
+			fmt.Fprintln(out, line)
+		}
+		return nil
+	}
+
+	switch *format {
+	case "elasticsearch":
+		return writeIndentedJSON(out, inferred.ElasticsearchMapping())
+	case "jsonschema":
+		return writeIndentedJSON(out, inferred.JSONSchema())
+	}
+	return yaml.NewEncoder(out).Encode(inferred)
+}
+
+func writeIndentedJSON(w io.Writer, v any) error {
+	data, err := stdjson.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// sampleFile calls observe for each record in a newline-delimited event log until observe returns false.
+func sampleFile(path string, observe func([]byte) bool) error {
+	r := io.Reader(os.Stdin)
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 16*1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		if !observe(scanner.Bytes()) {
+			break
+		}
+	}
+	return scanner.Err()
+}
+
+// sampleAPI calls observe for each record retrieved from the API, starting at the oldest
+// available record, until observe returns false or no more records are available. Records
+// are augmented with runtime details just as they are when forwarded. The stored iterator
+// is not modified.
+func sampleAPI(configPath string, observe func([]byte) bool) error {
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	sapi := api.New(cfg, getUserAgent())
+	if err := sapi.RefreshSources(ctx); err != nil {
+		log.Printf("unable to load sources; runtime details will be incomplete: %s", err)
+	}
+
+	buf := &bytes.Buffer{}
+	iterator := "OLDEST"
+	for {
+		buf.Reset()
+		records, next, err := sapi.LoadEvents(ctx, iterator, recordsPerRequest, buf)
+		if err != nil {
+			return fmt.Errorf("error querying events: %w", err)
+		}
+
+		scanner := bufio.NewScanner(buf)
+		for scanner.Scan() {
+			if !observe(sapi.AugmentRuntimeDetailsJSON(scanner.Bytes())) {
+				return nil
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+
+		if records < recordsPerRequest || next == "" || next == iterator {
+			return nil
+		}
+		iterator = next
+	}
+}
@@ -0,0 +1,87 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package main
+
+import (
+	"crypto/ed25519"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"spyderbat-event-forwarder/config"
+	"spyderbat-event-forwarder/hashchain"
+)
+
+// runVerify implements the "verify" subcommand, which checks the event log files against their
+// signed checkpoints and reports records that were modified, reordered or deleted.
+func runVerify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	configPath := fs.String("c", "config.yaml", "path to config file; used to find the event logs and key")
+	filePath := fs.String("f", "", "verify this event log, and the files rotated from it, instead of those in the config file")
+	keyPath := fs.String("key", "", "ed25519 public key to verify checkpoints with, instead of the config file's signing key")
+	_ = fs.Parse(args)
+
+	var paths []string
+	var key ed25519.PublicKey
+	if *filePath == "" || *keyPath == "" {
+		cfg, err := config.LoadConfig(*configPath)
+		if err != nil {
+			return err
+		}
+		if cfg.EventLog.Integrity == nil {
+			return fmt.Errorf("event_log.integrity is not enabled in %s", *configPath)
+		}
+		paths = append(paths, cfg.EventLog.Path())
+		for _, r := range cfg.EventLog.Routes {
+			paths = append(paths, r.Path())
+		}
+		key = cfg.EventLog.Integrity.Key().Public().(ed25519.PublicKey)
+	}
+	if *filePath != "" {
+		paths = []string{*filePath}
+	}
+	if *keyPath != "" {
+		var err error
+		if key, err = hashchain.LoadPublicKey(*keyPath); err != nil {
+			return err
+		}
+	}
+
+	failed, total := 0, 0
+	for _, path := range paths {
+		results, err := hashchain.Verify(path, key)
+		if err != nil {
+			return err
+		}
+		total += len(results)
+		failed += printResults(os.Stdout, filepath.Dir(path), results)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed verification", failed, total)
+	}
+	return nil
+}
+
+// printResults prints a line for each result, and returns the number of failures.
+func printResults(w io.Writer, dir string, results []hashchain.Result) int {
+	failed := 0
+	for _, r := range results {
+		path := filepath.Join(dir, r.File)
+		switch {
+		case r.Err != nil:
+			failed++
+			fmt.Fprintf(w, "FAIL  %s: %s\n", path, r.Err)
+		case r.Note != "" && r.Lines == 0:
+			fmt.Fprintf(w, "SKIP  %s: %s\n", path, r.Note)
+		case r.Note != "":
+			fmt.Fprintf(w, "OK    %s: %d records; %s\n", path, r.Lines, r.Note)
+		default:
+			fmt.Fprintf(w, "OK    %s: %d records\n", path, r.Lines)
+		}
+	}
+	return failed
+}
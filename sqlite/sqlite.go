@@ -0,0 +1,301 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+// sqlite stores records in a local SQLite database and searches them.
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"spyderbat-event-forwarder/config"
+	"spyderbat-event-forwarder/logwrapper"
+	"spyderbat-event-forwarder/sink"
+
+	"github.com/valyala/fastjson"
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+const (
+	batchBytes   = 4 * 1024 * 1024 // records written in one transaction
+	batchRecords = 1000
+)
+
+var (
+	maxBatchAge   = 5 * time.Second // records are searchable this soon after they are received
+	pruneInterval = 1 * time.Hour   // how often records older than the retention period are deleted
+)
+
+var (
+	parserPool = fastjson.ParserPool{}
+	arenaPool  = fastjson.ArenaPool{}
+)
+
+// The same id may be stored more than once, since models are updated as they change.
+const createTables = `
+CREATE TABLE IF NOT EXISTS records (
+	time     REAL NOT NULL, -- seconds since the epoch
+	schema   TEXT NOT NULL,
+	id       TEXT NOT NULL,
+	muid     TEXT NOT NULL,
+	hostname TEXT NOT NULL,
+	record   TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS records_time ON records (time);
+CREATE INDEX IF NOT EXISTS records_schema ON records (schema, time);
+CREATE INDEX IF NOT EXISTS records_muid ON records (muid, time);
+CREATE INDEX IF NOT EXISTS records_hostname ON records (hostname, time);
+CREATE INDEX IF NOT EXISTS records_id ON records (id);
+`
+
+// SQLite is a sink that writes records to a local database, deleting records once they are
+// older than the retention period.
+type SQLite struct {
+	c       *config.SQLite
+	batcher *sink.Batcher
+
+	// only accessed by the batcher's sender goroutine
+	db     *sql.DB
+	pruned time.Time
+}
+
+// New creates a new SQLite sink from the given config. If the config is nil, nil is returned.
+// A nil SQLite will silently drop all records.
+func New(c *config.SQLite) *SQLite {
+	if c == nil {
+		return nil
+	}
+	s := &SQLite{c: c}
+	s.batcher = sink.NewBatcher(sink.BatchOptions{
+		MaxBytes:   batchBytes,
+		MaxRecords: batchRecords,
+		MaxAge:     maxBatchAge,
+	}, s.sendBatch)
+	return s
+}
+
+// Send queues a record for writing to the database. Calling Send after Shutdown will panic.
+func (s *SQLite) Send(record []byte) {
+	s.SendOriginal(record, record)
+}
+
+// SendOriginal queues a record for writing to the database, indexed by the time, schema, id,
+// muid and hostname of original, the record before it was transformed. Calling SendOriginal
+// after Shutdown will panic.
+func (s *SQLite) SendOriginal(record, original []byte) {
+	if s == nil || len(record) == 0 {
+		return
+	}
+
+	p := parserPool.Get()
+	defer parserPool.Put(p)
+	v, err := p.ParseBytes(original)
+	if err != nil || v.Type() != fastjson.TypeObject {
+		logwrapper.Logger().Warn().Err(err).Msg("dropping invalid record for sqlite")
+		return
+	}
+	t := v.GetFloat64("time")
+	if t <= 0 {
+		t = float64(time.Now().UnixNano()) / 1e9
+	}
+
+	// the index columns are queued as a JSON array on a line in front of the record
+	a := arenaPool.Get()
+	defer arenaPool.Put(a)
+	columns := a.NewArray()
+	columns.SetArrayItem(0, a.NewNumberFloat64(t))
+	columns.SetArrayItem(1, a.NewStringBytes(v.GetStringBytes("schema")))
+	columns.SetArrayItem(2, a.NewStringBytes(v.GetStringBytes("id")))
+	columns.SetArrayItem(3, a.NewStringBytes(v.GetStringBytes("muid")))
+	columns.SetArrayItem(4, a.NewStringBytes(v.GetStringBytes("runtime_details", "hostname")))
+	row := append(columns.MarshalTo(nil), '\n')
+	s.batcher.Add(append(row, record...))
+}
+
+// Shutdown flushes the queue and shuts down the sink. It will block until the queue is empty.
+func (s *SQLite) Shutdown() {
+	log.Printf("shutting down sqlite")
+	if s == nil {
+		return
+	}
+	s.batcher.Shutdown()
+	if s.db != nil {
+		_ = s.db.Close()
+	}
+}
+
+// Open opens the database at path, creating it and its tables if necessary.
+func Open(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)")
+	if err != nil {
+		return nil, err
+	}
+	// a single writer avoids lock contention within the process
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(createTables); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to create tables in %s: %w", path, err)
+	}
+	return db, nil
+}
+
+// OpenReadOnly opens an existing database at path for searching.
+func OpenReadOnly(path string) (*sql.DB, error) {
+	// sqlite reports a missing file as "out of memory"
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	return db, nil
+}
+
+func (s *SQLite) sendBatch(b *sink.Batch) {
+	if s.db == nil {
+		db, err := Open(s.c.Path())
+		if err != nil {
+			logwrapper.Logger().Error().Err(err).Int("events", len(b.Records)).Msg("Failed to write records to sqlite")
+			return
+		}
+		s.db = db
+	}
+
+	count, err := s.insert(b.Records)
+	if err != nil {
+		logwrapper.Logger().Error().Err(err).Int("events", len(b.Records)).Msg("Failed to write records to sqlite")
+	} else {
+		logwrapper.Logger().Info().Int("events", count).Int("bytes", b.Bytes).Msg("sent to sqlite")
+	}
+
+	if time.Since(s.pruned) > pruneInterval {
+		s.prune(time.Now())
+	}
+}
+
+// insert writes rows queued by SendOriginal in a single transaction, and returns the number
+// written.
+func (s *SQLite) insert(rows [][]byte) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	stmt, err := tx.Prepare(`INSERT INTO records (time, schema, id, muid, hostname, record) VALUES (?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	p := parserPool.Get()
+	defer parserPool.Put(p)
+	count := 0
+	for _, row := range rows {
+		header, record, _ := bytes.Cut(row, []byte{'\n'})
+		v, err := p.ParseBytes(header)
+		if err != nil {
+			return 0, err
+		}
+		c := v.GetArray()
+		_, err = stmt.Exec(c[0].GetFloat64(),
+			string(c[1].GetStringBytes()),
+			string(c[2].GetStringBytes()),
+			string(c[3].GetStringBytes()),
+			string(c[4].GetStringBytes()),
+			string(record))
+		if err != nil {
+			return 0, err
+		}
+		count++
+	}
+	return count, tx.Commit()
+}
+
+// prune deletes records older than the retention period.
+func (s *SQLite) prune(now time.Time) {
+	s.pruned = now
+	cutoff := now.AddDate(0, 0, -s.c.RetentionDays)
+	res, err := s.db.Exec(`DELETE FROM records WHERE time < ?`, float64(cutoff.UnixNano())/1e9)
+	if err != nil {
+		logwrapper.Logger().Error().Err(err).Msg("Failed to prune records from sqlite")
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		logwrapper.Logger().Info().Int64("events", n).Time("before", cutoff).Msg("pruned records from sqlite")
+	}
+}
+
+// Query selects stored records. Zero values match all records.
+type Query struct {
+	Since    time.Time // records at or after this time
+	Until    time.Time // records before this time
+	Schema   string    // schema prefix, e.g. model_process or event_redflag:bash
+	Hostname string
+	MUID     string
+	Limit    int
+}
+
+// Search calls fn with each record that matches the query, oldest first, until fn returns
+// an error.
+func Search(ctx context.Context, db *sql.DB, q Query, fn func(record []byte) error) error {
+	var where []string
+	var args []any
+	if !q.Since.IsZero() {
+		where = append(where, "time >= ?")
+		args = append(args, float64(q.Since.UnixNano())/1e9)
+	}
+	if !q.Until.IsZero() {
+		where = append(where, "time < ?")
+		args = append(args, float64(q.Until.UnixNano())/1e9)
+	}
+	if q.Schema != "" {
+		where = append(where, "substr(schema, 1, ?) = ?")
+		args = append(args, len(q.Schema), q.Schema)
+	}
+	if q.Hostname != "" {
+		where = append(where, "hostname = ?")
+		args = append(args, q.Hostname)
+	}
+	if q.MUID != "" {
+		where = append(where, "muid = ?")
+		args = append(args, q.MUID)
+	}
+
+	query := "SELECT record FROM records"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY time, rowid"
+	if q.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, q.Limit)
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var record []byte
+	for rows.Next() {
+		if err := rows.Scan(&record); err != nil {
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
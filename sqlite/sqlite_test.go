@@ -0,0 +1,120 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"spyderbat-event-forwarder/config"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testRecords = [][]byte{
+	[]byte(`{"schema":"model_process::1.2.0","id":"proc:1","muid":"mach:1","time":1700000001.5,"runtime_details":{"hostname":"puppies"}}`),
+	[]byte(`{"schema":"event_redflag:bash:1.0.0","id":"flag:1","muid":"mach:1","time":1700000002,"runtime_details":{"hostname":"puppies"}}`),
+	[]byte(`{"schema":"model_process::1.2.0","id":"proc:2","muid":"mach:2","time":1700000003,"runtime_details":{"hostname":"kittens"}}`),
+	[]byte(`{"schema":"model_process::1.2.0","id":"proc:1","muid":"mach:1","time":1700000004,"runtime_details":{"hostname":"puppies"}}`),
+}
+
+func newTestSQLite(t *testing.T, retentionDays int) (*SQLite, string) {
+	c := &config.SQLite{RetentionDays: retentionDays}
+	require.NoError(t, config.ValidateSQLite(c, t.TempDir()))
+	return New(c), c.Path()
+}
+
+func search(t *testing.T, path string, q Query) []string {
+	db, err := OpenReadOnly(path)
+	require.NoError(t, err)
+	defer db.Close()
+	var found []string
+	require.NoError(t, Search(context.Background(), db, q, func(record []byte) error {
+		found = append(found, string(record))
+		return nil
+	}))
+	return found
+}
+
+func TestSQLite(t *testing.T) {
+	// the test records are from 2023, so they are kept for longer than the default
+	s, path := newTestSQLite(t, 365*100)
+	assert.Equal(t, "spyderbat_events.db", filepath.Base(path))
+	// the records are written out of order
+	for _, i := range []int{3, 1, 0, 2} {
+		s.Send(testRecords[i])
+	}
+	s.Send([]byte(`not json`))
+	s.Shutdown()
+
+	all := search(t, path, Query{})
+	assert.Equal(t, []string{string(testRecords[0]), string(testRecords[1]), string(testRecords[2]), string(testRecords[3])}, all)
+
+	tests := []struct {
+		name  string
+		query Query
+		want  []int
+	}{
+		{"hostname", Query{Hostname: "puppies"}, []int{0, 1, 3}},
+		{"schema prefix", Query{Schema: "model_"}, []int{0, 2, 3}},
+		{"full schema", Query{Schema: "event_redflag:bash:1.0.0"}, []int{1}},
+		{"muid", Query{MUID: "mach:2"}, []int{2}},
+		{"time range", Query{Since: time.Unix(1700000002, 0), Until: time.Unix(1700000004, 0)}, []int{1, 2}},
+		{"combined", Query{Hostname: "puppies", Schema: "model_process", Since: time.Unix(1700000002, 0)}, []int{3}},
+		{"limit", Query{Limit: 2}, []int{0, 1}},
+		{"no match", Query{Hostname: "ferrets"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var want []string
+			for _, i := range tt.want {
+				want = append(want, string(testRecords[i]))
+			}
+			assert.Equal(t, want, search(t, path, tt.query))
+		})
+	}
+}
+
+func TestSQLiteTransformedRecords(t *testing.T) {
+	s, path := newTestSQLite(t, 365*100)
+	// an OCSF record has no Spyderbat schema, muid or hostname, and its time is in milliseconds
+	ocsf := `{"class_uid":1007,"time":1700000001500}`
+	s.SendOriginal([]byte(ocsf), testRecords[0])
+	s.Shutdown()
+
+	assert.Equal(t, []string{ocsf}, search(t, path, Query{
+		Schema:   "model_process",
+		Hostname: "puppies",
+		MUID:     "mach:1",
+		Since:    time.Unix(1700000001, 0),
+		Until:    time.Unix(1700000002, 0),
+	}))
+}
+
+func TestSQLitePrune(t *testing.T) {
+	s, path := newTestSQLite(t, 0)
+	now := time.Now()
+	old := []byte(`{"schema":"model_process::1.2.0","id":"proc:old","time":` + strconv.FormatInt(now.AddDate(0, 0, -8).Unix(), 10) + `}`)
+	recent := []byte(`{"schema":"model_process::1.2.0","id":"proc:new","time":` + strconv.FormatInt(now.AddDate(0, 0, -6).Unix(), 10) + `}`)
+	s.Send(old)
+	s.Send(recent)
+	s.Shutdown()
+
+	// the first batch is pruned after it is written, with the default retention of 7 days
+	assert.Equal(t, []string{string(recent)}, search(t, path, Query{}))
+
+	db, err := Open(path)
+	require.NoError(t, err)
+	s = &SQLite{c: s.c, db: db}
+	s.prune(now.AddDate(0, 0, 2))
+	_ = db.Close()
+	assert.Empty(t, search(t, path, Query{}))
+}
+
+func TestSQLiteNil(t *testing.T) {
+	var s *SQLite
+	assert.Nil(t, New(nil))
+	s.Send(testRecords[0])
+	s.Shutdown()
+}
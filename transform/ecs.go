@@ -0,0 +1,265 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package transform
+
+import (
+	"strings"
+	"time"
+
+	"github.com/valyala/fastjson"
+)
+
+const ecsVersion = "8.11.0"
+
+// ECS maps Spyderbat records to Elastic Common Schema documents. Runtime details are mapped
+// to host.*, process details to process.* and user.*, trace scores to event.risk_score and
+// the record time to @timestamp. Every record is mapped; the original record is preserved
+// under spyderbat.
+type ECS struct{}
+
+type ecsDocument struct {
+	Timestamp   string          `json:"@timestamp"`
+	Message     string          `json:"message,omitempty"`
+	ECS         ecsVersionField `json:"ecs"`
+	Event       ecsEvent        `json:"event"`
+	Host        *ecsHost        `json:"host,omitempty"`
+	Cloud       *ecsCloud       `json:"cloud,omitempty"`
+	Process     *ecsProcess     `json:"process,omitempty"`
+	User        *ecsUser        `json:"user,omitempty"`
+	Source      *ecsEndpoint    `json:"source,omitempty"`
+	Destination *ecsEndpoint    `json:"destination,omitempty"`
+	Network     *ecsNetwork     `json:"network,omitempty"`
+	Rule        *ecsRule        `json:"rule,omitempty"`
+	Spyderbat   rawJSON         `json:"spyderbat"`
+}
+
+type ecsVersionField struct {
+	Version string `json:"version"`
+}
+
+type ecsEvent struct {
+	ID        string   `json:"id,omitempty"`
+	Kind      string   `json:"kind"`
+	Category  []string `json:"category,omitempty"`
+	Type      []string `json:"type,omitempty"`
+	Module    string   `json:"module"`
+	Dataset   string   `json:"dataset"`
+	Severity  int      `json:"severity,omitempty"`
+	RiskScore *float64 `json:"risk_score,omitempty"`
+	URL       string   `json:"url,omitempty"`
+	Start     string   `json:"start,omitempty"`
+	End       string   `json:"end,omitempty"`
+}
+
+type ecsHost struct {
+	ID       string   `json:"id,omitempty"`
+	Name     string   `json:"name,omitempty"`
+	Hostname string   `json:"hostname,omitempty"`
+	IP       []string `json:"ip,omitempty"`
+	MAC      []string `json:"mac,omitempty"`
+}
+
+type ecsCloud struct {
+	Instance struct {
+		ID string `json:"id"`
+	} `json:"instance"`
+}
+
+type ecsProcess struct {
+	PID         int         `json:"pid,omitempty"`
+	EntityID    string      `json:"entity_id,omitempty"`
+	Name        string      `json:"name,omitempty"`
+	Executable  string      `json:"executable,omitempty"`
+	Args        []string    `json:"args,omitempty"`
+	ArgsCount   int         `json:"args_count,omitempty"`
+	CommandLine string      `json:"command_line,omitempty"`
+	User        *ecsUser    `json:"user,omitempty"`
+	Parent      *ecsProcess `json:"parent,omitempty"`
+}
+
+type ecsUser struct {
+	ID   string `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+type ecsEndpoint struct {
+	IP   string `json:"ip,omitempty"`
+	Port int    `json:"port,omitempty"`
+}
+
+type ecsNetwork struct {
+	Transport string `json:"transport,omitempty"`
+	Direction string `json:"direction,omitempty"`
+}
+
+type ecsRule struct {
+	Name string `json:"name,omitempty"`
+}
+
+// ecsSeverities maps Spyderbat severities to numeric event.severity values.
+var ecsSeverities = map[string]int{
+	"info":     1,
+	"low":      21,
+	"medium":   47,
+	"high":     73,
+	"critical": 99,
+}
+
+// ecsTime converts a Spyderbat time (fractional unix seconds) to an RFC 3339 timestamp.
+func ecsTime(v *fastjson.Value, key string) string {
+	if v.Get(key) == nil {
+		return ""
+	}
+	return time.UnixMilli(timeMillis(v, key)).UTC().Format(time.RFC3339Nano)
+}
+
+// ecsMAC converts a MAC address to the upper case, dash separated form ECS expects.
+func ecsMAC(mac string) string {
+	return strings.ToUpper(strings.ReplaceAll(mac, ":", "-"))
+}
+
+// Transform implements Transformer.
+func (e *ECS) Transform(record []byte) ([]byte, error) {
+	p := parserPool.Get()
+	defer parserPool.Put(p)
+
+	v, err := p.ParseBytes(record)
+	if err != nil {
+		return nil, err
+	}
+
+	family := schemaFamily(string(v.GetStringBytes("schema")))
+	d := &ecsDocument{
+		Timestamp: ecsTime(v, "time"),
+		ECS:       ecsVersionField{Version: ecsVersion},
+		Event: ecsEvent{
+			ID:       string(v.GetStringBytes("id")),
+			Kind:     "event",
+			Module:   "spyderbat",
+			Dataset:  "spyderbat." + family,
+			Severity: ecsSeverities[strings.ToLower(string(v.GetStringBytes("severity")))],
+			URL:      string(v.GetStringBytes("linkback")),
+		},
+		Host:      ecsHostFrom(v),
+		Spyderbat: record,
+	}
+	if d.Timestamp == "" {
+		d.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	if id := string(v.GetStringBytes("runtime_details", "cloud_instance_id")); id != "" {
+		d.Cloud = &ecsCloud{}
+		d.Cloud.Instance.ID = id
+	}
+	if v.Get("score") != nil {
+		score := v.GetFloat64("score")
+		d.Event.RiskScore = &score
+	}
+	d.Message = firstNonEmpty(
+		string(v.GetStringBytes("description")),
+		string(v.GetStringBytes("trace_summary")),
+		string(v.GetStringBytes("name")),
+		string(v.GetStringBytes("short_name")),
+	)
+
+	switch family {
+	case "model_spydertrace", "event_redflag":
+		d.Event.Kind = "alert"
+		d.Event.Category = []string{"intrusion_detection"}
+		d.Event.Type = []string{"info"}
+		d.Rule = &ecsRule{Name: firstNonEmpty(
+			string(v.GetStringBytes("policy_name")),
+			string(v.GetStringBytes("short_name")),
+			string(v.GetStringBytes("trigger_short_name")),
+			string(v.GetStringBytes("name")),
+		)}
+	case "model_process":
+		d.Event.Category = []string{"process"}
+		d.Event.Type = []string{"start"}
+		if string(v.GetStringBytes("status")) == "closed" {
+			d.Event.Type = []string{"end"}
+			d.Event.End = ecsTime(v, "valid_to")
+		}
+		d.Event.Start = ecsTime(v, "valid_from")
+	case "model_connection":
+		d.Event.Category = []string{"network"}
+		d.Event.Type = []string{"connection"}
+		ecsNetworkFrom(d, v)
+	}
+
+	// process and user details are present on several schemas (processes, red flags, traces)
+	ecsProcessFrom(d, v)
+
+	return json.Marshal(d)
+}
+
+func ecsHostFrom(v *fastjson.Value) *ecsHost {
+	h := &ecsHost{
+		ID:       string(v.GetStringBytes("muid")),
+		Hostname: string(v.GetStringBytes("runtime_details", "hostname")),
+		IP:       getStrings(v, "runtime_details", "ip_addresses"),
+	}
+	h.Name = h.Hostname
+	for _, mac := range getStrings(v, "runtime_details", "mac_addresses") {
+		h.MAC = append(h.MAC, ecsMAC(mac))
+	}
+	if h.ID == "" && h.Hostname == "" && len(h.IP) == 0 && len(h.MAC) == 0 {
+		return nil
+	}
+	return h
+}
+
+func ecsProcessFrom(d *ecsDocument, v *fastjson.Value) {
+	args := getStrings(v, "args")
+	proc := &ecsProcess{
+		PID:        v.GetInt("pid"),
+		Executable: string(v.GetStringBytes("exe")),
+		Args:       args,
+		ArgsCount:  len(args),
+	}
+	if len(args) > 0 {
+		proc.CommandLine = strings.Join(args, " ")
+	}
+	if d.Event.Dataset == "spyderbat.model_process" {
+		proc.EntityID = d.Event.ID
+		proc.Name = string(v.GetStringBytes("name"))
+	}
+	if euser := string(v.GetStringBytes("euser")); euser != "" {
+		proc.User = &ecsUser{Name: euser, ID: getString(v, "euid")}
+	}
+
+	parent := &ecsProcess{PID: v.GetInt("ppid")}
+	if ancestors := getStrings(v, "ancestors"); len(ancestors) > 0 {
+		parent.Name = ancestors[0]
+	}
+	if parent.PID != 0 || parent.Name != "" {
+		proc.Parent = parent
+	}
+
+	if proc.PID != 0 || proc.Name != "" || len(args) > 0 || proc.User != nil || proc.Parent != nil {
+		d.Process = proc
+	}
+
+	// user.* is the user who logged in, which spyderbat tracks as the audit user
+	if auser := string(v.GetStringBytes("auser")); auser != "" || v.Get("auid") != nil {
+		d.User = &ecsUser{Name: auser, ID: getString(v, "auid")}
+	}
+}
+
+func ecsNetworkFrom(d *ecsDocument, v *fastjson.Value) {
+	local := &ecsEndpoint{IP: string(v.GetStringBytes("local_ip")), Port: v.GetInt("local_port")}
+	remote := &ecsEndpoint{IP: string(v.GetStringBytes("remote_ip")), Port: v.GetInt("remote_port")}
+	d.Network = &ecsNetwork{Transport: strings.ToLower(string(v.GetStringBytes("proto")))}
+
+	switch strings.ToLower(string(v.GetStringBytes("direction"))) {
+	case "inbound":
+		d.Network.Direction = "inbound"
+		d.Source, d.Destination = remote, local
+	case "outbound":
+		d.Network.Direction = "outbound"
+		d.Source, d.Destination = local, remote
+	default:
+		d.Source, d.Destination = local, remote
+	}
+}
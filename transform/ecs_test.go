@@ -0,0 +1,94 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package transform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestECSProcess(t *testing.T) {
+	record := `{"id":"proc:1","schema":"model_process::1.2.0","muid":"mach:1","time":1700000000.25,"pid":42,"ppid":1,` +
+		`"name":"bash","exe":"/bin/bash","args":["bash","-c","id"],"euser":"root","euid":0,"auser":"alice","auid":1000,` +
+		`"ancestors":["sshd","systemd"],"valid_from":1700000000,` + runtimeDetails + `}`
+
+	out, err := (&ECS{}).Transform([]byte(record))
+	require.NoError(t, err)
+
+	require.JSONEq(t, `{
+		"@timestamp": "2023-11-14T22:13:20.25Z",
+		"message": "bash",
+		"ecs": {"version": "8.11.0"},
+		"event": {
+			"id": "proc:1",
+			"kind": "event",
+			"category": ["process"],
+			"type": ["start"],
+			"module": "spyderbat",
+			"dataset": "spyderbat.model_process",
+			"start": "2023-11-14T22:13:20Z"
+		},
+		"host": {
+			"id": "mach:1",
+			"name": "puppies",
+			"hostname": "puppies",
+			"ip": ["10.0.0.1", "10.0.0.2"],
+			"mac": ["00-11-22-33-44-55"]
+		},
+		"cloud": {"instance": {"id": "i-kittens"}},
+		"process": {
+			"pid": 42,
+			"entity_id": "proc:1",
+			"name": "bash",
+			"executable": "/bin/bash",
+			"args": ["bash", "-c", "id"],
+			"args_count": 3,
+			"command_line": "bash -c id",
+			"user": {"id": "0", "name": "root"},
+			"parent": {"pid": 1, "name": "sshd"}
+		},
+		"user": {"id": "1000", "name": "alice"},
+		"spyderbat": `+record+`
+	}`, string(out))
+}
+
+func TestECSTrace(t *testing.T) {
+	record := `{"id":"trace:1","schema":"model_spydertrace:1.0.0","time":1700000000,"name":"suspicious shell",` +
+		`"score":95,"linkback":"https://example.com/trace","severity":"high"}`
+
+	out, err := (&ECS{}).Transform([]byte(record))
+	require.NoError(t, err)
+
+	var d map[string]any
+	require.NoError(t, json.Unmarshal(out, &d))
+	event := d["event"].(map[string]any)
+	assert.Equal(t, "alert", event["kind"])
+	assert.Equal(t, float64(95), event["risk_score"])
+	assert.Equal(t, float64(73), event["severity"])
+	assert.Equal(t, "https://example.com/trace", event["url"])
+	assert.Equal(t, map[string]any{"name": "suspicious shell"}, d["rule"])
+	assert.Equal(t, "suspicious shell", d["message"])
+	assert.NotContains(t, d, "host")
+	assert.NotContains(t, d, "process")
+}
+
+func TestECSConnection(t *testing.T) {
+	record := `{"id":"conn:1","schema":"model_connection::1.0.0","time":1700000000,"proto":"TCP",` +
+		`"direction":"outbound","local_ip":"10.0.0.1","local_port":50000,"remote_ip":"192.0.2.1","remote_port":443}`
+
+	out, err := (&ECS{}).Transform([]byte(record))
+	require.NoError(t, err)
+
+	var d map[string]any
+	require.NoError(t, json.Unmarshal(out, &d))
+	assert.Equal(t, map[string]any{"ip": "10.0.0.1", "port": float64(50000)}, d["source"])
+	assert.Equal(t, map[string]any{"ip": "192.0.2.1", "port": float64(443)}, d["destination"])
+	assert.Equal(t, map[string]any{"transport": "tcp", "direction": "outbound"}, d["network"])
+
+	_, err = (&ECS{}).Transform([]byte(`{`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,324 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package transform
+
+import (
+	"strings"
+
+	"github.com/valyala/fastjson"
+)
+
+const ocsfVersion = "1.1.0"
+
+// OCSF classes and categories used by the mapping.
+const (
+	ocsfCategoryFindings = 2
+	ocsfCategorySystem   = 1
+	ocsfCategoryNetwork  = 4
+
+	ocsfClassDetectionFinding = 2004
+	ocsfClassProcessActivity  = 1007
+	ocsfClassNetworkActivity  = 4001
+)
+
+// OCSF maps Spyderbat records to Open Cybersecurity Schema Framework events:
+// spydertraces and red flags to Detection Finding, processes to Process Activity, and
+// connections to Network Activity. Runtime details are mapped to the device, and the
+// original record is preserved in unmapped.
+type OCSF struct{}
+
+type ocsfEvent struct {
+	ActivityID     int                 `json:"activity_id"`
+	ActivityName   string              `json:"activity_name,omitempty"`
+	CategoryUID    int                 `json:"category_uid"`
+	CategoryName   string              `json:"category_name,omitempty"`
+	ClassUID       int                 `json:"class_uid"`
+	ClassName      string              `json:"class_name,omitempty"`
+	TypeUID        int                 `json:"type_uid"`
+	SeverityID     int                 `json:"severity_id"`
+	Severity       string              `json:"severity,omitempty"`
+	StatusID       int                 `json:"status_id,omitempty"`
+	Time           int64               `json:"time"`
+	Message        string              `json:"message,omitempty"`
+	Metadata       ocsfMetadata        `json:"metadata"`
+	Device         *ocsfDevice         `json:"device,omitempty"`
+	FindingInfo    *ocsfFindingInfo    `json:"finding_info,omitempty"`
+	RiskScore      *int                `json:"risk_score,omitempty"`
+	Actor          *ocsfActor          `json:"actor,omitempty"`
+	Process        *ocsfProcess        `json:"process,omitempty"`
+	SrcEndpoint    *ocsfEndpoint       `json:"src_endpoint,omitempty"`
+	DstEndpoint    *ocsfEndpoint       `json:"dst_endpoint,omitempty"`
+	ConnectionInfo *ocsfConnectionInfo `json:"connection_info,omitempty"`
+	Unmapped       rawJSON             `json:"unmapped"`
+}
+
+type ocsfMetadata struct {
+	Version   string      `json:"version"`
+	Product   ocsfProduct `json:"product"`
+	UID       string      `json:"uid,omitempty"`
+	LogName   string      `json:"log_name,omitempty"`
+	EventCode string      `json:"event_code,omitempty"`
+}
+
+type ocsfProduct struct {
+	Name       string `json:"name"`
+	VendorName string `json:"vendor_name"`
+}
+
+type ocsfDevice struct {
+	TypeID      int    `json:"type_id"`
+	UID         string `json:"uid,omitempty"`
+	Hostname    string `json:"hostname,omitempty"`
+	IP          string `json:"ip,omitempty"`
+	MAC         string `json:"mac,omitempty"`
+	InstanceUID string `json:"instance_uid,omitempty"`
+}
+
+type ocsfFindingInfo struct {
+	UID    string   `json:"uid"`
+	Title  string   `json:"title"`
+	Desc   string   `json:"desc,omitempty"`
+	Types  []string `json:"types,omitempty"`
+	SrcURL string   `json:"src_url,omitempty"`
+}
+
+type ocsfUser struct {
+	Name string `json:"name,omitempty"`
+	UID  string `json:"uid,omitempty"`
+}
+
+type ocsfActor struct {
+	User    *ocsfUser    `json:"user,omitempty"`
+	Process *ocsfProcess `json:"process,omitempty"`
+}
+
+type ocsfProcess struct {
+	PID            int          `json:"pid,omitempty"`
+	UID            string       `json:"uid,omitempty"`
+	Name           string       `json:"name,omitempty"`
+	CmdLine        string       `json:"cmd_line,omitempty"`
+	User           *ocsfUser    `json:"user,omitempty"`
+	ParentProcess  *ocsfProcess `json:"parent_process,omitempty"`
+	CreatedTime    int64        `json:"created_time,omitempty"`
+	TerminatedTime int64        `json:"terminated_time,omitempty"`
+}
+
+type ocsfEndpoint struct {
+	IP   string `json:"ip,omitempty"`
+	Port int    `json:"port,omitempty"`
+}
+
+type ocsfConnectionInfo struct {
+	ProtocolName string `json:"protocol_name,omitempty"`
+	Direction    string `json:"direction,omitempty"`
+	DirectionID  int    `json:"direction_id"`
+}
+
+// rawJSON is embedded in the output as-is.
+type rawJSON []byte
+
+func (r rawJSON) MarshalJSON() ([]byte, error) { return r, nil }
+
+// ocsfSeverities maps Spyderbat severities to OCSF severity ids.
+var ocsfSeverities = map[string]int{
+	"info":     1,
+	"low":      2,
+	"medium":   3,
+	"high":     4,
+	"critical": 5,
+}
+
+var ocsfSeverityNames = []string{"Unknown", "Informational", "Low", "Medium", "High", "Critical"}
+
+// ocsfSeverity returns the OCSF severity id for a record, using the severity if present and
+// otherwise the trace score.
+func ocsfSeverity(v *fastjson.Value) int {
+	if id, found := ocsfSeverities[strings.ToLower(string(v.GetStringBytes("severity")))]; found {
+		return id
+	}
+	if v.Get("score") == nil {
+		return 0
+	}
+	switch score := v.GetFloat64("score"); {
+	case score >= 90:
+		return 5
+	case score >= 60:
+		return 4
+	case score >= 30:
+		return 3
+	}
+	return 2
+}
+
+// Transform implements Transformer.
+func (o *OCSF) Transform(record []byte) ([]byte, error) {
+	p := parserPool.Get()
+	defer parserPool.Put(p)
+
+	v, err := p.ParseBytes(record)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := string(v.GetStringBytes("schema"))
+	e := &ocsfEvent{
+		Time: timeMillis(v, "time"),
+		Metadata: ocsfMetadata{
+			Version:   ocsfVersion,
+			Product:   ocsfProduct{Name: "Spyderbat", VendorName: "Spyderbat"},
+			UID:       string(v.GetStringBytes("id")),
+			LogName:   schema,
+			EventCode: schemaFamily(schema),
+		},
+		Device:   ocsfDeviceFrom(v),
+		Unmapped: record,
+	}
+	e.SeverityID = ocsfSeverity(v)
+	e.Severity = ocsfSeverityNames[e.SeverityID]
+
+	switch schemaFamily(schema) {
+	case "model_spydertrace", "event_redflag":
+		ocsfDetectionFinding(e, v)
+	case "model_process":
+		ocsfProcessActivity(e, v)
+	case "model_connection":
+		ocsfNetworkActivity(e, v)
+	default:
+		return record, nil
+	}
+	e.TypeUID = e.ClassUID*100 + e.ActivityID
+
+	return json.Marshal(e)
+}
+
+func ocsfDeviceFrom(v *fastjson.Value) *ocsfDevice {
+	d := &ocsfDevice{
+		UID:         string(v.GetStringBytes("muid")),
+		Hostname:    string(v.GetStringBytes("runtime_details", "hostname")),
+		InstanceUID: string(v.GetStringBytes("runtime_details", "cloud_instance_id")),
+	}
+	if ips := getStrings(v, "runtime_details", "ip_addresses"); len(ips) > 0 {
+		d.IP = ips[0]
+	}
+	if macs := getStrings(v, "runtime_details", "mac_addresses"); len(macs) > 0 {
+		d.MAC = macs[0]
+	}
+	return d
+}
+
+func ocsfDetectionFinding(e *ocsfEvent, v *fastjson.Value) {
+	e.CategoryUID = ocsfCategoryFindings
+	e.CategoryName = "Findings"
+	e.ClassUID = ocsfClassDetectionFinding
+	e.ClassName = "Detection Finding"
+	e.ActivityID = 1
+	e.ActivityName = "Create"
+
+	e.StatusID = 1 // New
+	if v.GetBool("suppressed") {
+		e.StatusID = 3 // Suppressed
+	}
+
+	title := firstNonEmpty(
+		string(v.GetStringBytes("name")),
+		string(v.GetStringBytes("short_name")),
+		string(v.GetStringBytes("trigger_short_name")),
+		e.Metadata.EventCode,
+	)
+	desc := firstNonEmpty(
+		string(v.GetStringBytes("description")),
+		string(v.GetStringBytes("trace_summary")),
+	)
+	e.Message = firstNonEmpty(desc, title)
+	e.FindingInfo = &ocsfFindingInfo{
+		UID:    e.Metadata.UID,
+		Title:  title,
+		Desc:   desc,
+		Types:  []string{e.Metadata.EventCode},
+		SrcURL: string(v.GetStringBytes("linkback")),
+	}
+
+	if v.Get("score") != nil {
+		score := v.GetInt("score")
+		e.RiskScore = &score
+	}
+}
+
+func ocsfProcessActivity(e *ocsfEvent, v *fastjson.Value) {
+	e.CategoryUID = ocsfCategorySystem
+	e.CategoryName = "System Activity"
+	e.ClassUID = ocsfClassProcessActivity
+	e.ClassName = "Process Activity"
+	e.ActivityID = 1
+	e.ActivityName = "Launch"
+
+	proc := &ocsfProcess{
+		PID:         v.GetInt("pid"),
+		UID:         e.Metadata.UID,
+		Name:        string(v.GetStringBytes("name")),
+		CmdLine:     strings.Join(getStrings(v, "args"), " "),
+		CreatedTime: timeMillis(v, "valid_from"),
+		User: &ocsfUser{
+			Name: string(v.GetStringBytes("euser")),
+			UID:  getString(v, "euid"),
+		},
+	}
+	if ppid := v.GetInt("ppid"); ppid > 0 {
+		proc.ParentProcess = &ocsfProcess{PID: ppid}
+	}
+	if string(v.GetStringBytes("status")) == "closed" {
+		e.ActivityID = 2
+		e.ActivityName = "Terminate"
+		proc.TerminatedTime = timeMillis(v, "valid_to")
+	}
+	e.Process = proc
+	e.Actor = &ocsfActor{User: &ocsfUser{
+		Name: string(v.GetStringBytes("auser")),
+		UID:  getString(v, "auid"),
+	}}
+	e.Message = proc.CmdLine
+}
+
+func ocsfNetworkActivity(e *ocsfEvent, v *fastjson.Value) {
+	e.CategoryUID = ocsfCategoryNetwork
+	e.CategoryName = "Network Activity"
+	e.ClassUID = ocsfClassNetworkActivity
+	e.ClassName = "Network Activity"
+	e.ActivityID = 1
+	e.ActivityName = "Open"
+	if string(v.GetStringBytes("status")) == "closed" {
+		e.ActivityID = 2
+		e.ActivityName = "Close"
+	}
+
+	local := &ocsfEndpoint{IP: string(v.GetStringBytes("local_ip")), Port: v.GetInt("local_port")}
+	remote := &ocsfEndpoint{IP: string(v.GetStringBytes("remote_ip")), Port: v.GetInt("remote_port")}
+	info := &ocsfConnectionInfo{ProtocolName: strings.ToLower(string(v.GetStringBytes("proto")))}
+
+	switch strings.ToLower(string(v.GetStringBytes("direction"))) {
+	case "inbound":
+		info.Direction, info.DirectionID = "Inbound", 1
+		e.SrcEndpoint, e.DstEndpoint = remote, local
+	case "outbound":
+		info.Direction, info.DirectionID = "Outbound", 2
+		e.SrcEndpoint, e.DstEndpoint = local, remote
+	default:
+		e.SrcEndpoint, e.DstEndpoint = local, remote
+	}
+	e.ConnectionInfo = info
+
+	if pid := v.GetInt("pid"); pid > 0 {
+		e.Actor = &ocsfActor{Process: &ocsfProcess{PID: pid}}
+	}
+}
+
+func firstNonEmpty(s ...string) string {
+	for _, v := range s {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,126 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package transform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const runtimeDetails = `"runtime_details":{"cloud_instance_id":"i-kittens","ip_addresses":["10.0.0.1","10.0.0.2"],` +
+	`"mac_addresses":["00:11:22:33:44:55"],"hostname":"puppies","forwarder":"test/1.0"}`
+
+func TestOCSFDetectionFinding(t *testing.T) {
+	record := `{"id":"trace:1","schema":"model_spydertrace:1.0.0","muid":"mach:1","time":1700000000.25,` +
+		`"name":"suspicious shell","score":95,"suppressed":true,"linkback":"https://example.com/trace",` + runtimeDetails + `}`
+
+	out, err := (&OCSF{}).Transform([]byte(record))
+	require.NoError(t, err)
+
+	require.JSONEq(t, `{
+		"activity_id": 1,
+		"activity_name": "Create",
+		"category_uid": 2,
+		"category_name": "Findings",
+		"class_uid": 2004,
+		"class_name": "Detection Finding",
+		"type_uid": 200401,
+		"severity_id": 5,
+		"severity": "Critical",
+		"status_id": 3,
+		"time": 1700000000250,
+		"message": "suspicious shell",
+		"metadata": {
+			"version": "1.1.0",
+			"product": {"name": "Spyderbat", "vendor_name": "Spyderbat"},
+			"uid": "trace:1",
+			"log_name": "model_spydertrace:1.0.0",
+			"event_code": "model_spydertrace"
+		},
+		"device": {
+			"type_id": 0,
+			"uid": "mach:1",
+			"hostname": "puppies",
+			"ip": "10.0.0.1",
+			"mac": "00:11:22:33:44:55",
+			"instance_uid": "i-kittens"
+		},
+		"finding_info": {
+			"uid": "trace:1",
+			"title": "suspicious shell",
+			"types": ["model_spydertrace"],
+			"src_url": "https://example.com/trace"
+		},
+		"risk_score": 95,
+		"unmapped": `+record+`
+	}`, string(out))
+}
+
+func TestOCSFProcessActivity(t *testing.T) {
+	record := `{"id":"proc:1","schema":"model_process::1.2.0","time":1700000000,"pid":42,"ppid":1,"name":"bash",` +
+		`"args":["bash","-c","id"],"euser":"root","euid":0,"auser":"alice","auid":1000,"status":"closed",` +
+		`"valid_from":1699999999,"valid_to":1700000000,` + runtimeDetails + `}`
+
+	out, err := (&OCSF{}).Transform([]byte(record))
+	require.NoError(t, err)
+
+	var e map[string]any
+	require.NoError(t, json.Unmarshal(out, &e))
+	assert.EqualValues(t, 1007, e["class_uid"])
+	assert.EqualValues(t, 100702, e["type_uid"])
+	assert.Equal(t, "Terminate", e["activity_name"])
+	assert.Equal(t, map[string]any{
+		"pid":             float64(42),
+		"uid":             "proc:1",
+		"name":            "bash",
+		"cmd_line":        "bash -c id",
+		"user":            map[string]any{"name": "root", "uid": "0"},
+		"parent_process":  map[string]any{"pid": float64(1)},
+		"created_time":    float64(1699999999000),
+		"terminated_time": float64(1700000000000),
+	}, e["process"])
+	assert.Equal(t, map[string]any{"user": map[string]any{"name": "alice", "uid": "1000"}}, e["actor"])
+	assert.Equal(t, "puppies", e["device"].(map[string]any)["hostname"])
+}
+
+func TestOCSFNetworkActivity(t *testing.T) {
+	record := `{"id":"conn:1","schema":"model_connection::1.0.0","time":1700000000,"pid":42,"proto":"TCP",` +
+		`"direction":"inbound","local_ip":"10.0.0.1","local_port":22,"remote_ip":"192.0.2.1","remote_port":50000}`
+
+	out, err := (&OCSF{}).Transform([]byte(record))
+	require.NoError(t, err)
+
+	var e map[string]any
+	require.NoError(t, json.Unmarshal(out, &e))
+	assert.EqualValues(t, 400101, e["type_uid"])
+	assert.Equal(t, map[string]any{"ip": "192.0.2.1", "port": float64(50000)}, e["src_endpoint"])
+	assert.Equal(t, map[string]any{"ip": "10.0.0.1", "port": float64(22)}, e["dst_endpoint"])
+	assert.Equal(t, map[string]any{"protocol_name": "tcp", "direction": "Inbound", "direction_id": float64(1)}, e["connection_info"])
+}
+
+func TestOCSFPassthrough(t *testing.T) {
+	record := []byte(`{"id":"x","schema":"model_machine:1.0.0","time":1700000000}`)
+	out, err := (&OCSF{}).Transform(record)
+	require.NoError(t, err)
+	assert.Equal(t, record, out)
+
+	_, err = (&OCSF{}).Transform([]byte(`{`))
+	assert.Error(t, err)
+}
+
+func TestNew(t *testing.T) {
+	tr, err := New("")
+	require.NoError(t, err)
+	assert.Nil(t, tr)
+
+	tr, err = New("ocsf")
+	require.NoError(t, err)
+	assert.IsType(t, &OCSF{}, tr)
+
+	_, err = New("kittens")
+	assert.Error(t, err)
+}
@@ -0,0 +1,77 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+// transform converts Spyderbat records into other schemas before they are forwarded.
+package transform
+
+import (
+	"fmt"
+	"strings"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/valyala/fastjson"
+)
+
+var (
+	json       = jsoniter.ConfigCompatibleWithStandardLibrary
+	parserPool = fastjson.ParserPool{}
+)
+
+// Transformer converts a Spyderbat record to another representation. Records that the
+// transformer has no mapping for are returned unchanged.
+type Transformer interface {
+	Transform(record []byte) ([]byte, error)
+}
+
+// New returns the transformer with the given name, or nil if name is empty or "none".
+func New(name string) (Transformer, error) {
+	switch name {
+	case "", "none":
+		return nil, nil
+	case "ocsf":
+		return &OCSF{}, nil
+	case "ecs":
+		return &ECS{}, nil
+	}
+	return nil, fmt.Errorf("unsupported transform '%s'", name)
+}
+
+// schemaFamily returns the portion of a schema name before the first colon.
+func schemaFamily(schema string) string {
+	if i := strings.IndexByte(schema, ':'); i >= 0 {
+		return schema[:i]
+	}
+	return schema
+}
+
+// timeMillis converts a Spyderbat time (fractional unix seconds) to unix milliseconds.
+func timeMillis(v *fastjson.Value, key string) int64 {
+	return int64(v.GetFloat64(key) * 1000)
+}
+
+// getStrings returns the string elements of an array.
+func getStrings(v *fastjson.Value, keys ...string) []string {
+	var s []string
+	for _, e := range v.GetArray(keys...) {
+		if b, err := e.StringBytes(); err == nil {
+			s = append(s, string(b))
+		}
+	}
+	return s
+}
+
+// getString returns a string value, or the string form of a number.
+func getString(v *fastjson.Value, keys ...string) string {
+	e := v.Get(keys...)
+	if e == nil {
+		return ""
+	}
+	switch e.Type() {
+	case fastjson.TypeString:
+		return string(e.GetStringBytes())
+	case fastjson.TypeNumber:
+		return e.String()
+	}
+	return ""
+}
@@ -0,0 +1,99 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package webhook
+
+import (
+	"strings"
+
+	"spyderbat-event-forwarder/config"
+	"spyderbat-event-forwarder/logwrapper"
+
+	jsoniter "github.com/json-iterator/go"
+	"github.com/valyala/fastjson"
+)
+
+var (
+	json       = jsoniter.ConfigCompatibleWithStandardLibrary
+	parserPool = fastjson.ParserPool{}
+)
+
+// datadogAttributes are the reserved attributes the Datadog Logs intake reads from each log.
+type datadogAttributes struct {
+	Source    string `json:"ddsource"`
+	Tags      string `json:"ddtags,omitempty"`
+	Hostname  string `json:"hostname,omitempty"`
+	Service   string `json:"service,omitempty"`
+	Timestamp int64  `json:"timestamp,omitempty"` // milliseconds since the epoch
+	Message   string `json:"message,omitempty"`
+}
+
+// datadogTag makes a key:value tag, replacing commas, which separate tags in ddtags.
+func datadogTag(key, value string) string {
+	return key + ":" + strings.ReplaceAll(value, ",", "_")
+}
+
+// datadogEvent adds Datadog's reserved attributes to an event. The source is from the config;
+// the service, hostname, tags and timestamp are derived from original, the record before it was
+// transformed. A formatted event is sent as the log message; otherwise the attributes are added
+// to the event's own fields.
+func datadogEvent(o *config.DatadogOptions, original, event []byte, formatted bool) []byte {
+	attrs := datadogAttributes{Source: o.Source, Service: o.Service}
+	tags := append([]string{}, o.Tags...)
+
+	p := parserPool.Get()
+	defer parserPool.Put(p)
+	v, err := p.ParseBytes(original)
+	if err != nil || v.Type() != fastjson.TypeObject {
+		logwrapper.Logger().Warn().Err(err).Msg("unable to read event for datadog; sending it without tags")
+		v = nil
+	}
+
+	if v != nil {
+		family := string(v.GetStringBytes("schema"))
+		if i := strings.IndexByte(family, ':'); i >= 0 {
+			family = family[:i]
+		}
+		if family != "" {
+			tags = append(tags, datadogTag("schema", family))
+			if attrs.Service == "" {
+				attrs.Service = family
+			}
+		}
+		if muid := v.GetStringBytes("muid"); len(muid) > 0 {
+			tags = append(tags, datadogTag("muid", string(muid)))
+		}
+		if t := v.GetFloat64("time"); t > 0 {
+			attrs.Timestamp = int64(t * 1000)
+		}
+		if rd := v.GetObject("runtime_details"); rd != nil {
+			rd.Visit(func(key []byte, f *fastjson.Value) {
+				if f.Type() != fastjson.TypeString || len(f.GetStringBytes()) == 0 {
+					return
+				}
+				if string(key) == "hostname" {
+					attrs.Hostname = string(f.GetStringBytes())
+					return
+				}
+				tags = append(tags, datadogTag(string(key), string(f.GetStringBytes())))
+			})
+		}
+	}
+	attrs.Tags = strings.Join(tags, ",")
+
+	if formatted || v == nil {
+		attrs.Message = string(event)
+		out, _ := json.Marshal(attrs)
+		return out
+	}
+
+	// splice the attributes in front of the record's own fields
+	out, _ := json.Marshal(attrs)
+	rest := strings.TrimSpace(string(event))[1:]
+	if strings.TrimSpace(rest) != "}" {
+		out[len(out)-1] = ','
+		return append(out, rest...)
+	}
+	return out
+}
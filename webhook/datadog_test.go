@@ -0,0 +1,39 @@
+package webhook
+
+import (
+	"testing"
+
+	"spyderbat-event-forwarder/config"
+	"spyderbat-event-forwarder/transform"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatadogEvent(t *testing.T) {
+	o := &config.DatadogOptions{Source: "spyderbat", Tags: []string{"env:prod"}}
+	record := []byte(`{"schema":"event_redflag:bash:1.0.0","id":"flag:1","muid":"mach:1","time":1700000001.5,` +
+		`"runtime_details":{"hostname":"puppies","cluster_name":"prod,east","ip_addresses":["10.0.0.1"]}}`)
+
+	assert.Equal(t, `{"ddsource":"spyderbat","ddtags":"env:prod,schema:event_redflag,muid:mach:1,cluster_name:prod_east",`+
+		`"hostname":"puppies","service":"event_redflag","timestamp":1700000001500,`+string(record[1:]),
+		string(datadogEvent(o, record, record, false)))
+
+	// a formatted event is the message
+	assert.Equal(t, `{"ddsource":"spyderbat","ddtags":"env:prod,schema:event_redflag,muid:mach:1,cluster_name:prod_east",`+
+		`"hostname":"puppies","service":"event_redflag","timestamp":1700000001500,"message":"CEF:0|Spyderbat"}`,
+		string(datadogEvent(o, record, []byte("CEF:0|Spyderbat"), true)))
+
+	// the attributes are taken from the record before it was transformed; ocsf has no schema,
+	// muid or runtime_details, and its time is in milliseconds
+	ocsf, err := new(transform.OCSF).Transform(record)
+	require.NoError(t, err)
+	assert.Equal(t, `{"ddsource":"spyderbat","ddtags":"env:prod,schema:event_redflag,muid:mach:1,cluster_name:prod_east",`+
+		`"hostname":"puppies","service":"event_redflag","timestamp":1700000001500,`+string(ocsf[1:]),
+		string(datadogEvent(o, record, ocsf, false)))
+
+	// the configured service wins, and empty records stay valid JSON
+	o.Service = "spyderbat"
+	assert.Equal(t, `{"ddsource":"spyderbat","ddtags":"env:prod","service":"spyderbat"}`,
+		string(datadogEvent(o, []byte(`{}`), []byte(`{}`), false)))
+}
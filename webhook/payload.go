@@ -0,0 +1,71 @@
+// Spyderbat Event Forwarder
+// Copyright (C) 2022-2025 Spyderbat, Inc.
+// Use according to license terms.
+
+package webhook
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// render renders an event with the payload template or jq expression of the webhook, if any.
+// A template renders one event, and a jq expression one event for each of its results, so it
+// can also drop events, e.g. with select(). The rendered events must be JSON, and are compacted
+// so that each is on one line.
+func (h *Webhook) render(event []byte) ([][]byte, error) {
+	t, jq := h.c.Payload.EventTemplate(), h.c.Payload.EventJQ()
+	if t == nil && jq == nil {
+		return [][]byte{event}, nil
+	}
+
+	// numbers are kept as they are, so that times and ids don't turn into floats
+	var v any
+	d := json.NewDecoder(bytes.NewReader(event))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	var events [][]byte
+	if t != nil {
+		buf := &bytes.Buffer{}
+		if err := t.Execute(buf, v); err != nil {
+			return nil, err
+		}
+		out, err := compact(buf.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		return append(events, out), nil
+	}
+
+	iter := jq.Run(v)
+	for {
+		r, ok := iter.Next()
+		if !ok {
+			break
+		}
+		if err, ok := r.(error); ok {
+			return nil, err
+		}
+		out, err := json.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, out)
+	}
+	return events, nil
+}
+
+// compact removes insignificant space from rendered JSON, and returns an error if it is not
+// valid JSON.
+func compact(b []byte) ([]byte, error) {
+	p := parserPool.Get()
+	defer parserPool.Put(p)
+	v, err := p.ParseBytes(b)
+	if err != nil {
+		return nil, fmt.Errorf("rendered event is not valid JSON: %w", err)
+	}
+	return v.MarshalTo(nil), nil
+}
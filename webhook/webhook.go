@@ -6,27 +6,24 @@ package webhook
 
 import (
 	"bytes"
-	"context"
 	"crypto/hmac"
-	"crypto/tls"
 	"errors"
 	"fmt"
 	"hash"
 	"io"
 	"log"
-	"net"
 	"net/http"
 	"spyderbat-event-forwarder/config"
 	"spyderbat-event-forwarder/logwrapper"
+	"spyderbat-event-forwarder/sink"
 	"sync"
-	"time"
 
 	retryablehttp "github.com/hashicorp/go-retryablehttp"
 )
 
 var (
-	maxPayloadAge = 30 * time.Second // how often to flush the queue
-	sweepInterval = 1 * time.Second  // how often to check if the current buffer is old enough to be flushed
+	maxPayloadAge = sink.DefaultMaxBatchAge   // how often to flush the queue
+	sweepInterval = sink.DefaultSweepInterval // how often to check if the current buffer is old enough to be flushed
 )
 
 var (
@@ -39,19 +36,12 @@ type httpclient interface {
 }
 
 type Webhook struct {
-	c      *config.Webhook
-	ctx    context.Context // ctx is used to shut down the webhook
-	cancel context.CancelFunc
-	wg     sync.WaitGroup // wg is used to wait for shutdown
-	client httpclient
-
-	messageQueue chan []byte   // messages are queued here before being written to the payload
-	payloadQueue chan *payload // payloads are queued here before being sent to the webhook
-
-	// the following fields are only accessed by the run goroutine
-	created time.Time     // created is the time the current buffer was created
-	count   int           // count is the number of events written to the buffer
-	payload *bytes.Buffer // payload is the current payload buffer
+	c       *config.Webhook
+	client  httpclient
+	batcher *sink.Batcher
+
+	driftLock sync.Mutex
+	drift     map[string]bool // drift holds schema problems that have already been reported
 }
 
 type payload struct {
@@ -67,123 +57,91 @@ func New(c *config.Webhook) *Webhook {
 		return nil
 	}
 
-	client := retryablehttp.NewClient()
-	client.Logger = nil
-	client.RetryMax = 5
-	client.HTTPClient.Timeout = 2 * time.Minute
-	client.HTTPClient.Transport = &http.Transport{
-		Dial: (&net.Dialer{
-			Timeout:   30 * time.Second,
-			KeepAlive: 30 * time.Second,
-		}).Dial,
-		TLSHandshakeTimeout: 10 * time.Second,
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: c.Insecure,
-		},
-		ExpectContinueTimeout: 1 * time.Second,
-		DisableKeepAlives:     false,
-		DisableCompression:    true,
-		Proxy:                 http.ProxyFromEnvironment,
-	}
-
-	ctx, cancel := context.WithCancel(context.Background())
 	h := &Webhook{
-		c:            c,
-		ctx:          ctx,
-		cancel:       cancel,
-		messageQueue: make(chan []byte, 10000),
-		payloadQueue: make(chan *payload, 10), // with 1MB payloads, this is 10MB of memory
-		client:       client,
+		c:      c,
+		client: sink.NewHTTPClient(c.Insecure),
+		drift:  make(map[string]bool),
 	}
-	h.resetPayload()
-	h.wg.Add(2)
-	go h.ingest()
-	go h.sender()
+	maxBytes, overhead := c.MaxPayloadBytes, len(c.Delimiter())
+	if c.JSONArray() {
+		// brackets around the payload and a comma between events
+		maxBytes, overhead = maxBytes-2, 1
+	}
+	if key := c.WrapperKey(); key != "" {
+		maxBytes -= len(wrapperPrefix(key)) + 1
+	}
+	h.batcher = sink.NewBatcher(sink.BatchOptions{
+		MaxBytes:       maxBytes,
+		MaxRecords:     c.MaxRecords(),
+		RecordOverhead: overhead,
+		MaxAge:         maxPayloadAge,
+		SweepInterval:  sweepInterval,
+		QueueSize:      10, // with 1MB payloads, this is 10MB of memory
+	}, h.sendBatch)
 	return h
 }
 
-func (h *Webhook) queuePayload() {
-	defer h.resetPayload()
-	if h.payload.Len() == 0 {
-		return
+// sendBatch frames a batch of events into a payload and sends it.
+func (h *Webhook) sendBatch(b *sink.Batch) {
+	buf := bytes.NewBuffer(make([]byte, 0, b.Bytes+2))
+	if h.c.JSONArray() {
+		key := h.c.WrapperKey()
+		if key != "" {
+			buf.Write(wrapperPrefix(key))
+		}
+		buf.WriteByte('[')
+		for i, msg := range b.Records {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.Write(msg)
+		}
+		buf.WriteByte(']')
+		if key != "" {
+			buf.WriteByte('}')
+		}
+	} else {
+		delimiter := h.c.Delimiter()
+		for _, msg := range b.Records {
+			// a write to a bytes.Buffer never returns an error
+			_, _ = buf.Write(msg)
+			_, _ = buf.Write(delimiter)
+		}
 	}
-	h.payloadQueue <- &payload{
-		bytes: h.payload.Bytes(),
-		count: h.count,
+	err := h.send(&payload{bytes: buf.Bytes(), count: len(b.Records)})
+	if err != nil {
+		logwrapper.Logger().Error().Err(err).Msg("Failed to send event to webhook")
 	}
 }
 
-func (h *Webhook) resetPayload() {
-	h.payload = &bytes.Buffer{}
-	h.count = 0
-	h.created = time.Now()
+// wrapperPrefix returns the start of the wrapper object that events are sent in, up to the
+// events array, e.g. {"events":
+func wrapperPrefix(key string) []byte {
+	k, _ := json.Marshal(key) // marshaling a string never fails
+	return append(append([]byte{'{'}, k...), ':')
 }
 
-// sender is the main loop for the webhook sender.
-// It will exit when the payloadQueue is closed.
-func (h *Webhook) sender() {
-	defer h.wg.Done()
-
-	for payload := range h.payloadQueue {
-		if payload == nil {
-			return
-		}
-		err := h.send(payload)
-		if err != nil {
-			logwrapper.Logger().Error().Err(err).Msg("Failed to send event to webhook")
-		}
+// checkSchema validates a message against the configured schema, if any, and logs each
+// distinct problem the first time it is seen.
+func (h *Webhook) checkSchema(msg []byte) {
+	schema := h.c.Schema()
+	if schema == nil {
+		return
+	}
+	problems, err := schema.Validate(msg)
+	if err != nil {
+		logwrapper.Logger().Warn().Err(err).Msg("unable to validate event against webhook schema")
+		return
 	}
-}
-
-// ingest is the main loop for the webhook.
-func (h *Webhook) ingest() {
-	ticker := time.NewTicker(sweepInterval)
-
-	defer func() {
-		ticker.Stop()
-		h.wg.Done()
-	}()
-
-	for {
-		select {
-		case <-ticker.C:
-			// if the current buffer is older than maxPayloadAge, queue it for sending
-			if time.Since(h.created) > maxPayloadAge {
-				h.queuePayload()
-			}
-		case msg := <-h.messageQueue:
-			// if the message would exceed the maximum payload size, queue it for sending
-			if h.payload.Len()+len(msg) > h.c.MaxPayloadBytes {
-				h.queuePayload()
-			}
-			// write the message to the current buffer
-			// a write to a bytes.Buffer never returns an error
-			_, _ = h.payload.Write(msg)
-			h.count++
-		case <-h.ctx.Done():
-			// We must drain the message queue before shutting down, or we have a race condition.
-			// By closing the message queue here, we ensure that the following range loop will
-			// not block forever.
-			close(h.messageQueue)
-
-			for msg := range h.messageQueue {
-				if msg == nil {
-					break
-				}
-				// if the message would exceed the maximum payload size, queue it for sending
-				if h.payload.Len()+len(msg) > h.c.MaxPayloadBytes {
-					h.queuePayload()
-				}
-				// write the message to the current buffer
-				// a write to a bytes.Buffer never returns an error
-				_, _ = h.payload.Write(msg)
-				h.count++
-			}
 
-			h.queuePayload()
-			close(h.payloadQueue)
-			return
+	h.driftLock.Lock()
+	defer h.driftLock.Unlock()
+	for _, p := range problems {
+		if h.drift[p] {
+			continue
 		}
+		h.drift[p] = true
+		logwrapper.Logger().Warn().Str("problem", p).Msg("forwarded event does not match webhook schema")
 	}
 }
 
@@ -246,15 +204,13 @@ func (h *Webhook) send(p *payload) error {
 	if err != nil {
 		return err
 	}
-	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Type", h.c.ContentType())
 	req.Header.Set("Accept", "application/json")
-	if h.c.Authentication.Method == "basic" {
-		req.SetBasicAuth(h.c.Authentication.Parameters.Username, string(h.c.Authentication.Parameters.GetPassword()))
-	} else if h.c.Authentication.Method == "shared_secret" {
-		req.Header.Set(h.c.Authentication.Parameters.HeaderName, string(h.c.Authentication.Parameters.GetSecretKey()))
-	} else if h.c.Authentication.Method == "bearer" {
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", h.c.Authentication.Parameters.GetSecretKey()))
-	} else if pHMAC != nil {
+	for k, v := range h.c.Headers() {
+		req.Header.Set(k, v)
+	}
+	h.c.Authentication.SetHeaders(req.Request)
+	if pHMAC != nil {
 		req.Header.Set(h.c.Authentication.Parameters.HeaderName, fmt.Sprintf("%x", pHMAC.Sum(nil)))
 	}
 	if h.c.CompressionAlgo == "zstd" {
@@ -289,11 +245,44 @@ func (h *Webhook) send(p *payload) error {
 // Send queues an event for sending to the webhook. It will be sent asynchronously.
 // Calling Send after Shutdown will panic.
 func (h *Webhook) Send(event []byte) {
+	h.SendOriginal(event, event)
+}
+
+// SendOriginal queues an event for sending to the webhook, with cef and leef formats rendering
+// original, the record before it was transformed, and Datadog's reserved attributes taken from
+// it. Calling SendOriginal after Shutdown will panic.
+func (h *Webhook) SendOriginal(event, original []byte) {
 	if h == nil || len(event) == 0 {
 		return
 	}
 
-	h.messageQueue <- event
+	formatted := false
+	if f := h.c.Format.Formatter(); f != nil {
+		out, err := f.Format(original)
+		if err != nil {
+			logwrapper.Logger().Warn().Err(err).Msg("unable to format event for webhook; sending it unformatted")
+		} else {
+			event, formatted = out, true
+		}
+	}
+
+	if h.c.Datadog != nil {
+		event = datadogEvent(h.c.Datadog, original, event, formatted)
+	}
+	events, err := h.render(event)
+	if err != nil {
+		logwrapper.Logger().Warn().Err(err).Msg("dropping event that could not be rendered for webhook")
+		return
+	}
+	for _, event := range events {
+		if max := h.c.MaxRecordBytes(); max > 0 && len(event) > max {
+			logwrapper.Logger().Warn().Int("bytes", len(event)).Int("max_bytes", max).Msg("dropping event that is too large for webhook")
+			continue
+		}
+
+		h.checkSchema(event)
+		h.batcher.Add(event)
+	}
 }
 
 // Shutdown flushes the queue and shuts down the webhook. It will block until the queue is empty.
@@ -302,6 +291,5 @@ func (h *Webhook) Shutdown() {
 	if h == nil {
 		return
 	}
-	h.cancel()
-	h.wg.Wait()
+	h.batcher.Shutdown()
 }
@@ -1,15 +1,19 @@
 package webhook
 
 import (
+	"bufio"
 	"bytes"
 	"compress/gzip"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	stdjson "encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"spyderbat-event-forwarder/config"
+	"strings"
 	"testing"
 	"time"
 
@@ -19,8 +23,8 @@ import (
 )
 
 // assertBasicHeaders checks the basic request headers that should be present on every request
-func assertBasicHeaders(t *testing.T, r *http.Request) {
-	assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+func assertBasicHeaders(t *testing.T, r *http.Request, contentType string) {
+	assert.Equal(t, contentType, r.Header.Get("Content-Type"))
 	assert.Equal(t, "application/json", r.Header.Get("Accept"))
 }
 
@@ -30,11 +34,11 @@ func TestWebhookSimple(t *testing.T) {
 	visited := false
 
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		assertBasicHeaders(t, r)
+		assertBasicHeaders(t, r, "application/x-ndjson")
 
 		body, err := io.ReadAll(r.Body)
 		require.NoError(t, err)
-		assert.Equal(t, expectedBody, body)
+		assert.Equal(t, string(expectedBody)+"\n", string(body))
 
 		w.WriteHeader(http.StatusOK)
 		visited = true
@@ -61,11 +65,11 @@ func TestWebhookSweep(t *testing.T) {
 	visited := make(chan bool, 1)
 
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		assertBasicHeaders(t, r)
+		assertBasicHeaders(t, r, "application/x-ndjson")
 
 		body, err := io.ReadAll(r.Body)
 		require.NoError(t, err)
-		assert.Equal(t, expectedBody, body)
+		assert.Equal(t, string(expectedBody)+"\n", string(body))
 
 		w.WriteHeader(http.StatusOK)
 		visited <- true
@@ -103,7 +107,7 @@ func TestWebhookGzip(t *testing.T) {
 	expectedBody := []byte(`{"foo":"bar"}`)
 
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		assertBasicHeaders(t, r)
+		assertBasicHeaders(t, r, "application/x-ndjson")
 
 		if r.Header.Get("Content-Encoding") != "gzip" {
 			t.Errorf("Expected Content-Encoding header to be gzip, but got %s", r.Header.Get("Content-Encoding"))
@@ -113,7 +117,7 @@ func TestWebhookGzip(t *testing.T) {
 		require.NoError(t, err)
 
 		body, err := io.ReadAll(zipReader)
-		require.Equal(t, expectedBody, body)
+		require.Equal(t, string(expectedBody)+"\n", string(body))
 
 		require.NoError(t, err)
 
@@ -143,7 +147,7 @@ func TestWebhookZstd(t *testing.T) {
 	expectedBody := []byte(`{"foo":"bar"}`)
 
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		assertBasicHeaders(t, r)
+		assertBasicHeaders(t, r, "application/x-ndjson")
 
 		if r.Header.Get("Content-Encoding") != "zstd" {
 			t.Errorf("Expected Content-Encoding header to be zstd, but got %s", r.Header.Get("Content-Encoding"))
@@ -153,7 +157,7 @@ func TestWebhookZstd(t *testing.T) {
 		require.NoError(t, err)
 
 		body, err := io.ReadAll(zipReader)
-		require.Equal(t, expectedBody, body)
+		require.Equal(t, string(expectedBody)+"\n", string(body))
 
 		require.NoError(t, err)
 
@@ -183,15 +187,15 @@ func TestWebhookHMAC(t *testing.T) {
 	visited := false
 	expectedBody := []byte(`{"foo":"bar"}`)
 	mac := hmac.New(sha256.New, []byte("test-secret"))
-	mac.Write(expectedBody)
+	mac.Write(append(expectedBody, '\n'))
 	expectedMAC := mac.Sum(nil)
 
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		assertBasicHeaders(t, r)
+		assertBasicHeaders(t, r, "application/x-ndjson")
 
 		body, err := io.ReadAll(r.Body)
 		assert.NoError(t, err)
-		assert.Equal(t, expectedBody, body)
+		assert.Equal(t, string(expectedBody)+"\n", string(body))
 		hexmac := r.Header.Get("X-HMAC")
 		mac, err := hex.DecodeString(hexmac)
 		assert.NoError(t, err)
@@ -231,7 +235,7 @@ func TestWebhookZstdHMAC(t *testing.T) {
 	visited := false
 
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		assertBasicHeaders(t, r)
+		assertBasicHeaders(t, r, "application/x-ndjson")
 		require.Equal(t, "zstd", r.Header.Get("Content-Encoding"))
 
 		zipReader, err := zstd.NewReader(r.Body)
@@ -239,7 +243,7 @@ func TestWebhookZstdHMAC(t *testing.T) {
 
 		body, err := io.ReadAll(zipReader)
 		assert.NoError(t, err)
-		assert.Equal(t, expectedPayload, body)
+		assert.Equal(t, string(expectedPayload)+"\n", string(body))
 
 		mac := hmac.New(sha256.New, []byte("test-secret"))
 		mac.Write(body)
@@ -287,7 +291,7 @@ func TestWebhookLarge(t *testing.T) {
 	var maxPayloadBytes int
 
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		assertBasicHeaders(t, r)
+		assertBasicHeaders(t, r, "application/x-ndjson")
 
 		n, err := io.Copy(receiveBuffer, r.Body)
 		require.NoError(t, err)
@@ -305,14 +309,14 @@ func TestWebhookLarge(t *testing.T) {
 	err := config.ValidateWebhook(cfg)
 	require.NoError(t, err)
 	h := New(cfg)
-	maxPayloadBytes = h.c.MaxPayloadBytes
+	maxPayloadBytes = cfg.MaxPayloadBytes
 
 	msg := []byte(`{"foo":"bar"}`)
 	bytesSent := 0
 
 	for bytesSent < maxPayloadBytes*2 {
 		h.Send(msg)
-		bytesSent += len(msg)
+		bytesSent += len(msg) + 1 // each event ends with a newline
 	}
 
 	h.Shutdown()
@@ -327,7 +331,7 @@ func TestWebhookBasicAuth(t *testing.T) {
 	visited := false
 
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		assertBasicHeaders(t, r)
+		assertBasicHeaders(t, r, "application/x-ndjson")
 
 		user, pass, ok := r.BasicAuth()
 		require.True(t, ok)
@@ -336,7 +340,7 @@ func TestWebhookBasicAuth(t *testing.T) {
 
 		body, err := io.ReadAll(r.Body)
 		require.NoError(t, err)
-		assert.Equal(t, expectedBody, body)
+		assert.Equal(t, string(expectedBody)+"\n", string(body))
 
 		w.WriteHeader(http.StatusOK)
 		visited = true
@@ -370,13 +374,13 @@ func TestWebhookSharedSecret(t *testing.T) {
 	visited := false
 
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		assertBasicHeaders(t, r)
+		assertBasicHeaders(t, r, "application/x-ndjson")
 
 		assert.Equal(t, "test-secret", r.Header.Get("X-Shared-Secret"))
 
 		body, err := io.ReadAll(r.Body)
 		require.NoError(t, err)
-		assert.Equal(t, expectedBody, body)
+		assert.Equal(t, string(expectedBody)+"\n", string(body))
 
 		w.WriteHeader(http.StatusOK)
 		visited = true
@@ -410,13 +414,13 @@ func TestWebhookBearer(t *testing.T) {
 	visited := false
 
 	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		assertBasicHeaders(t, r)
+		assertBasicHeaders(t, r, "application/x-ndjson")
 
 		assert.Equal(t, "Bearer test-secret", r.Header.Get("Authorization"))
 
 		body, err := io.ReadAll(r.Body)
 		require.NoError(t, err)
-		assert.Equal(t, expectedBody, body)
+		assert.Equal(t, string(expectedBody)+"\n", string(body))
 
 		w.WriteHeader(http.StatusOK)
 		visited = true
@@ -443,6 +447,400 @@ func TestWebhookBearer(t *testing.T) {
 	assert.True(t, visited)
 }
 
+// TestWebhookPantherPreset validates that the panther preset sends zstd-compressed, newline-delimited
+// events with bearer auth.
+func TestWebhookPantherPreset(t *testing.T) {
+	events := [][]byte{[]byte(`{"foo":"bar"}`), []byte(`{"baz":"qux"}`)}
+	visited := false
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assertBasicHeaders(t, r, "application/x-ndjson")
+		require.Equal(t, "zstd", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "Bearer test-secret", r.Header.Get("Authorization"))
+
+		zipReader, err := zstd.NewReader(r.Body)
+		require.NoError(t, err)
+
+		body, err := io.ReadAll(zipReader)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("{\"foo\":\"bar\"}\n{\"baz\":\"qux\"}\n"), body)
+
+		w.WriteHeader(http.StatusOK)
+		visited = true
+	}))
+
+	cfg := &config.Webhook{
+		Preset:     "panther",
+		Endpoint:   ts.URL,
+		Insecure:   true,
+		SchemaFile: "builtin",
+		Authentication: config.WebhookAuthentication{
+			Parameters: config.AuthenticationParameters{
+				Secret: "test-secret",
+			},
+		},
+	}
+	err := config.ValidateWebhook(cfg)
+	require.NoError(t, err)
+	h := New(cfg)
+
+	for _, e := range events {
+		h.Send(e)
+	}
+
+	h.Shutdown()
+	ts.Close()
+	assert.True(t, visited)
+	assert.True(t, h.drift["foo: not declared in schema (observed string)"])
+}
+
+// TestWebhookDatadogPreset validates that the datadog preset sends gzip-compressed JSON arrays of
+// logs with the api key and Datadog's reserved attributes.
+func TestWebhookDatadogPreset(t *testing.T) {
+	visited := false
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assertBasicHeaders(t, r, "application/json")
+		require.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "api-key", r.Header.Get("DD-API-KEY"))
+
+		zipReader, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(zipReader)
+		require.NoError(t, err)
+
+		var logs []map[string]any
+		require.NoError(t, json.Unmarshal(body, &logs))
+		require.Len(t, logs, 2)
+		assert.Equal(t, "spyderbat", logs[0]["ddsource"])
+		assert.Equal(t, "model_process", logs[0]["service"])
+		assert.Equal(t, "puppies", logs[0]["hostname"])
+		assert.Equal(t, "env:prod,schema:model_process", logs[0]["ddtags"])
+		assert.Equal(t, "proc:1", logs[0]["id"])
+		assert.Equal(t, "proc:2", logs[1]["id"])
+
+		w.WriteHeader(http.StatusAccepted)
+		visited = true
+	}))
+
+	cfg := &config.Webhook{
+		Preset:   "datadog",
+		Endpoint: ts.URL,
+		Insecure: true,
+		Datadog:  &config.DatadogOptions{Tags: []string{"env:prod"}},
+		Authentication: config.WebhookAuthentication{
+			Parameters: config.AuthenticationParameters{
+				Secret: "api-key",
+			},
+		},
+	}
+	err := config.ValidateWebhook(cfg)
+	require.NoError(t, err)
+	h := New(cfg)
+
+	h.Send([]byte(`{"schema":"model_process::1.2.0","id":"proc:1","runtime_details":{"hostname":"puppies"}}`))
+	h.Send([]byte(`{"schema":"model_process::1.2.0","id":"proc:2","runtime_details":{"hostname":"kittens"}}`))
+	h.Send([]byte(`{"big":"` + strings.Repeat("x", cfg.MaxRecordBytes()) + `"}`))
+
+	h.Shutdown()
+	ts.Close()
+	assert.True(t, visited)
+}
+
+// TestWebhookSumoLogicPreset validates that the sumologic preset sends gzip-compressed,
+// newline-delimited events with the source metadata headers.
+func TestWebhookSumoLogicPreset(t *testing.T) {
+	events := [][]byte{[]byte(`{"foo":"bar"}`), []byte(`{"baz":"qux"}`)}
+	visited := false
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "security/spyderbat", r.Header.Get("X-Sumo-Category"))
+		assert.Equal(t, "spyderbat-event-forwarder", r.Header.Get("X-Sumo-Name"))
+		assert.Equal(t, "team=secops", r.Header.Get("X-Sumo-Fields"))
+		assert.Empty(t, r.Header.Get("X-Sumo-Host"))
+		assert.Empty(t, r.Header.Get("Authorization"))
+
+		zipReader, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(zipReader)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("{\"foo\":\"bar\"}\n{\"baz\":\"qux\"}\n"), body)
+
+		w.WriteHeader(http.StatusOK)
+		visited = true
+	}))
+
+	cfg := &config.Webhook{
+		Preset:   "sumologic",
+		Endpoint: ts.URL,
+		Insecure: true,
+		SumoLogic: &config.SumoLogicOptions{
+			Category: "security/spyderbat",
+			Fields:   map[string]string{"team": "secops"},
+		},
+	}
+	err := config.ValidateWebhook(cfg)
+	require.NoError(t, err)
+	h := New(cfg)
+
+	for _, e := range events {
+		h.Send(e)
+	}
+
+	h.Shutdown()
+	ts.Close()
+	assert.True(t, visited)
+}
+
+// TestWebhookFraming validates that the events of a payload can be parsed back for each framing.
+// Records have no trailing newline, and may have newlines and braces in their strings. The
+// payloads are parsed with the standard library rather than the package's json.
+func TestWebhookFraming(t *testing.T) {
+	events := []string{
+		`{"schema":"model_process::1.2.0","id":"proc:1","args":["sh","-c","echo '}{'\n"]}`,
+		`{"schema":"model_process::1.2.0","id":"proc:2","runtime_details":{"hostname":"web-1"}}`,
+		`{"schema":"event_redflag:bash:1.0.0","id":"flag:1","time":1700000000.5}`,
+	}
+
+	parseNDJSON := func(t *testing.T, body []byte) []string {
+		var parsed []string
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		for scanner.Scan() {
+			require.True(t, stdjson.Valid(scanner.Bytes()), scanner.Text())
+			parsed = append(parsed, scanner.Text())
+		}
+		require.NoError(t, scanner.Err())
+		return parsed
+	}
+	parseArray := func(t *testing.T, body []byte) []string {
+		var raw []stdjson.RawMessage
+		require.NoError(t, stdjson.Unmarshal(body, &raw))
+		var parsed []string
+		for _, r := range raw {
+			parsed = append(parsed, string(r))
+		}
+		return parsed
+	}
+
+	tests := []struct {
+		name        string
+		payload     *config.WebhookPayload
+		contentType string
+		parse       func(t *testing.T, body []byte) []string
+	}{
+		{"default", nil, "application/x-ndjson", parseNDJSON},
+		{"ndjson", &config.WebhookPayload{Framing: "ndjson"}, "application/x-ndjson", parseNDJSON},
+		{"json_array", &config.WebhookPayload{Framing: "json_array"}, "application/json", parseArray},
+		{"wrapper", &config.WebhookPayload{Framing: "wrapper"}, "application/json", func(t *testing.T, body []byte) []string {
+			var wrapper map[string]stdjson.RawMessage
+			require.NoError(t, stdjson.Unmarshal(body, &wrapper))
+			require.Len(t, wrapper, 1)
+			return parseArray(t, wrapper["events"])
+		}},
+		{"concatenated", &config.WebhookPayload{Framing: "concatenated"}, "application/json", func(t *testing.T, body []byte) []string {
+			assert.NotContains(t, string(body), "}\n{")
+			var parsed []string
+			d := stdjson.NewDecoder(bytes.NewReader(body))
+			for d.More() {
+				var r stdjson.RawMessage
+				require.NoError(t, d.Decode(&r))
+				parsed = append(parsed, string(r))
+			}
+			return parsed
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received []string
+			ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assertBasicHeaders(t, r, tt.contentType)
+				body, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				received = append(received, tt.parse(t, body)...)
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			cfg := &config.Webhook{
+				Endpoint: ts.URL,
+				Insecure: true,
+				Payload:  tt.payload,
+			}
+			require.NoError(t, config.ValidateWebhook(cfg))
+			h := New(cfg)
+			for _, e := range events {
+				h.Send([]byte(e))
+			}
+			h.Shutdown()
+			ts.Close()
+
+			assert.Equal(t, events, received)
+		})
+	}
+}
+
+// TestWebhookTextFraming validates that formatted events are sent one per line, whatever the
+// framing.
+func TestWebhookTextFraming(t *testing.T) {
+	events := []string{
+		`{"schema":"event_redflag:bash:1.0.0","id":"flag:1","time":1700000001,"severity":"high"}`,
+		`{"schema":"event_redflag:bash:1.0.0","id":"flag:2","time":1700000002,"severity":"low"}`,
+		`{"schema":"event_redflag:bash:1.0.0","id":"flag:3","time":1700000003,"severity":"critical"}`,
+	}
+
+	for _, payload := range []*config.WebhookPayload{nil, {}, {ContentType: "text/plain"}, {Framing: "ndjson"}, {Framing: "concatenated"}} {
+		var lines []string
+		ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assertBasicHeaders(t, r, "text/plain")
+			body, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			scanner := bufio.NewScanner(bytes.NewReader(body))
+			for scanner.Scan() {
+				lines = append(lines, scanner.Text())
+			}
+			require.NoError(t, scanner.Err())
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		cfg := &config.Webhook{
+			Endpoint: ts.URL,
+			Insecure: true,
+			Format:   &config.Format{Type: "cef"},
+			Payload:  payload,
+		}
+		require.NoError(t, config.ValidateWebhook(cfg))
+		h := New(cfg)
+		for _, e := range events {
+			h.Send([]byte(e))
+		}
+		h.Shutdown()
+		ts.Close()
+
+		require.Len(t, lines, len(events), "payload %+v", payload)
+		for i, line := range lines {
+			assert.True(t, strings.HasPrefix(line, "CEF:0|Spyderbat|"), line)
+			assert.Contains(t, line, fmt.Sprintf("externalId=flag:%d", i+1))
+		}
+	}
+}
+
+// TestWebhookWrapperPayload validates that events are sent in a wrapper object.
+func TestWebhookWrapperPayload(t *testing.T) {
+	visited := false
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assertBasicHeaders(t, r, "application/json")
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, `{"records":[{"foo":"bar"},{"baz":"qux"}]}`, string(body))
+
+		w.WriteHeader(http.StatusOK)
+		visited = true
+	}))
+
+	cfg := &config.Webhook{
+		Endpoint: ts.URL,
+		Insecure: true,
+		Payload:  &config.WebhookPayload{Framing: "wrapper", WrapperKey: "records"},
+	}
+	err := config.ValidateWebhook(cfg)
+	require.NoError(t, err)
+	h := New(cfg)
+
+	h.Send([]byte(`{"foo":"bar"}`))
+	h.Send([]byte(`{"baz":"qux"}`))
+
+	h.Shutdown()
+	ts.Close()
+	assert.True(t, visited)
+}
+
+// TestWebhookTemplatePayload validates that each event is rendered with the payload template.
+func TestWebhookTemplatePayload(t *testing.T) {
+	visited := false
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/vnd.incident+json", r.Header.Get("Content-Type"))
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		var incidents []map[string]any
+		require.NoError(t, json.Unmarshal(body, &incidents))
+		assert.Equal(t, []map[string]any{{
+			"short_description": "bash \"-c\" reverse shell",
+			"correlation_id":    "flag:1",
+			"opened_at":         1700000000.123456,
+			"args":              []any{"-c", "id"},
+		}}, incidents)
+
+		w.WriteHeader(http.StatusCreated)
+		visited = true
+	}))
+
+	cfg := &config.Webhook{
+		Endpoint: ts.URL,
+		Insecure: true,
+		Payload: &config.WebhookPayload{
+			Framing: "json_array",
+			Template: `{
+				"short_description": {{ json .description }},
+				"correlation_id": "{{ .id }}",
+				"opened_at": {{ .time }},
+				"args": {{ json .args }}
+			}`,
+			ContentType: "application/vnd.incident+json",
+		},
+	}
+	err := config.ValidateWebhook(cfg)
+	require.NoError(t, err)
+	h := New(cfg)
+
+	h.Send([]byte(`{"schema":"event_redflag:bash:1.0.0","id":"flag:1","time":1700000000.123456,"description":"bash \"-c\" reverse shell","args":["-c","id"]}`))
+	h.Send([]byte(`not json`)) // dropped
+
+	h.Shutdown()
+	ts.Close()
+	assert.True(t, visited)
+}
+
+// TestWebhookJQPayload validates that each event is run through the payload jq expression,
+// which can drop events or turn one into several.
+func TestWebhookJQPayload(t *testing.T) {
+	visited := false
+
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assertBasicHeaders(t, r, "application/x-ndjson")
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		// jq objects are marshaled with their keys sorted
+		assert.Equal(t, "{\"host\":\"web-1\",\"id\":\"flag:1\"}\n{\"host\":\"web-2\",\"id\":\"flag:1\"}\n", string(body))
+
+		w.WriteHeader(http.StatusOK)
+		visited = true
+	}))
+
+	cfg := &config.Webhook{
+		Endpoint: ts.URL,
+		Insecure: true,
+		Payload: &config.WebhookPayload{
+			Framing: "ndjson",
+			JQ:      `select(.schema | startswith("event_redflag")) | {id, host: .hosts[]}`,
+		},
+	}
+	err := config.ValidateWebhook(cfg)
+	require.NoError(t, err)
+	h := New(cfg)
+
+	h.Send([]byte(`{"schema":"model_process::1.2.0","id":"proc:1","hosts":["web-1"]}`))
+	h.Send([]byte(`{"schema":"event_redflag:bash:1.0.0","id":"flag:1","hosts":["web-1","web-2"]}`))
+
+	h.Shutdown()
+	ts.Close()
+	assert.True(t, visited)
+}
+
 // TestNilSafe ensures that all webhook methods are nil-safe.
 func TestNilSafe(t *testing.T) {
 	h := New(nil)